@@ -0,0 +1,69 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ActivityEntry is an entry of the activity log of a message: an attempt to
+// deliver it, which postal calls a delivery.
+type ActivityEntry struct {
+	ID     int64          `json:"id"`
+	Status DeliveryStatus `json:"status"`
+	// Details is postal's description of the attempt, and Output the
+	// response of the receiving server, if any.
+	Details     string `json:"details"`
+	Output      string `json:"output"`
+	SentWithSSL bool   `json:"sent_with_ssl"`
+	LogID       string `json:"log_id"`
+	// Time is how long the attempt took, in seconds.
+	Time      float64   `json:"time"`
+	Timestamp Timestamp `json:"timestamp"`
+}
+
+// StreamActivity sends the entries of the activity log of the message with
+// the given ID on the returned channel, oldest first. The channel is closed
+// once every entry has been sent, the context is done, or an entry can't be
+// decoded, which is logged, see WithLogger.
+//
+// Postal returns the whole log in a single response, it has no pages, so the
+// response is fetched before StreamActivity returns, with an unknown ID or a
+// bad token returned as an error. The entries are then decoded one at a time
+// as they're received, so only the response, not every decoded entry, is
+// held in memory.
+func (a *ApiClient) StreamActivity(ctx context.Context, id int64) (<-chan ActivityEntry, error) {
+	res, _, err := a.post(ctx, SendOptions{}, a.apiPath("/messages/deliveries"), messageRequest{ID: id})
+	if err != nil {
+		return nil, err
+	}
+	if err := errorFromResponse(res); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(res.Data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, withKind(ErrDecode, fmt.Errorf("error decoding activity of message %d: expected a list", id))
+	}
+
+	out := make(chan ActivityEntry)
+	go func() {
+		defer close(out)
+
+		for dec.More() {
+			var e ActivityEntry
+			if err := dec.Decode(&e); err != nil {
+				a.logf(ctx, "postal: error decoding activity of message %d: %v", id, err)
+				return
+			}
+
+			select {
+			case out <- e:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
@@ -0,0 +1,69 @@
+package postal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestStreamActivity(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/messages/deliveries" {
+			http.NotFound(w, r)
+			return
+		}
+		var req messageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		if req.ID != 42 {
+			w.Write([]byte(`{"status":"error","data":{"code":"MessageNotFound","message":"No message found matching provided ID"}}`))
+			return
+		}
+		w.Write([]byte(`{"status":"success","time":0.01,"data":[
+			{"id":1,"status":"SoftFail","details":"Temporary failure","output":"451 try again","sent_with_ssl":true,"log_id":"a1","time":0.5,"timestamp":1700000000},
+			{"id":2,"status":"Sent","details":"Message delivered","output":"250 OK","sent_with_ssl":true,"log_id":"a2","time":0.2,"timestamp":1700000600}
+		]}`))
+	})
+
+	entries, err := client.StreamActivity(context.Background(), 42)
+	if err != nil {
+		t.Fatalf("error streaming activity: %v", err)
+	}
+	var got []ActivityEntry
+	for e := range entries {
+		got = append(got, e)
+	}
+	if len(got) != 2 || got[0].Status != StatusSoftFail || got[0].Output != "451 try again" || got[1].Status != StatusSent || got[1].Timestamp.Unix() != 1700000600 {
+		t.Fatalf("unexpected entries: %+v", got)
+	}
+
+	if _, err := client.StreamActivity(context.Background(), 7); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected ErrMessageNotFound, got %v", err)
+	}
+}
+
+func TestStreamActivityCanceled(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":[{"id":1,"status":"SoftFail"},{"id":2,"status":"Sent"}]}`))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, err := client.StreamActivity(ctx, 42)
+	if err != nil {
+		t.Fatalf("error streaming activity: %v", err)
+	}
+	if e := <-entries; e.ID != 1 {
+		t.Fatalf("expected the first entry, got %+v", e)
+	}
+	cancel()
+	// The channel is closed once the context is done, although an entry
+	// being sent as it's canceled may still be received.
+	for e := range entries {
+		if e.ID != 2 {
+			t.Fatalf("unexpected entry after cancel: %+v", e)
+		}
+	}
+}
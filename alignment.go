@@ -0,0 +1,89 @@
+package postal
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+const HdrReturnPath = "Return-Path"
+
+// Warning is a problem with a message which doesn't keep it from being sent,
+// but may keep it from being delivered.
+type Warning struct {
+	// Field is the header the warning is about, such as "From".
+	Field   string
+	Message string
+}
+
+func (w Warning) String() string {
+	return w.Field + ": " + w.Message
+}
+
+// CheckAlignment checks that the domains of the message are aligned the way
+// DMARC needs them to be: the domain of the envelope sender, and of the
+// Return-Path header if the message has one, must match the domain of the
+// From address for SPF to align. If domains are given, such as the domains
+// the postal server signs with DKIM, the From domain must match one of them
+// for DKIM to align.
+//
+// Domains match if they're the same or one is a subdomain of the other,
+// which approximates DMARC's relaxed alignment without looking up public
+// suffixes. This is a local sanity check, it doesn't look at DNS.
+func (m Message) CheckAlignment(domains ...string) []Warning {
+	from, err := mail.ParseAddressList(m.From)
+	if err != nil || len(from) == 0 {
+		return []Warning{{Field: "From", Message: fmt.Sprintf("can't parse %q", m.From)}}
+	}
+
+	var warnings []Warning
+	fromDomain := addressDomain(from[0].Address)
+	for _, a := range from[1:] {
+		if d := addressDomain(a.Address); !domainsAligned(d, fromDomain) {
+			warnings = append(warnings, Warning{Field: "From", Message: fmt.Sprintf("addresses are on different domains, %s and %s; DMARC is only checked against one", fromDomain, d)})
+			break
+		}
+	}
+
+	if envelope, err := envelopeSender(m); err == nil {
+		if d := addressDomain(envelope); !domainsAligned(d, fromDomain) {
+			warnings = append(warnings, Warning{Field: HdrSender, Message: fmt.Sprintf("envelope sender domain %s doesn't align with From domain %s, SPF won't align", d, fromDomain)})
+		}
+	}
+
+	if rp := m.Headers.Get(HdrReturnPath); rp != "" {
+		addr, err := mail.ParseAddress(rp)
+		switch {
+		case err != nil:
+			warnings = append(warnings, Warning{Field: HdrReturnPath, Message: fmt.Sprintf("can't parse %q", rp)})
+		case !domainsAligned(addressDomain(addr.Address), fromDomain):
+			warnings = append(warnings, Warning{Field: HdrReturnPath, Message: fmt.Sprintf("domain %s doesn't align with From domain %s, SPF won't align", addressDomain(addr.Address), fromDomain)})
+		}
+	}
+
+	if len(domains) > 0 {
+		aligned := false
+		for _, d := range domains {
+			if domainsAligned(strings.ToLower(d), fromDomain) {
+				aligned = true
+				break
+			}
+		}
+		if !aligned {
+			warnings = append(warnings, Warning{Field: "From", Message: fmt.Sprintf("domain %s isn't one of %s, DKIM won't align", fromDomain, strings.Join(domains, ", "))})
+		}
+	}
+
+	return warnings
+}
+
+// addressDomain returns the lower cased domain of the address.
+func addressDomain(addr string) string {
+	return strings.ToLower(addr[strings.LastIndex(addr, "@")+1:])
+}
+
+// domainsAligned reports whether the domains are the same, or one is a
+// subdomain of the other.
+func domainsAligned(a, b string) bool {
+	return a == b || strings.HasSuffix(a, "."+b) || strings.HasSuffix(b, "."+a)
+}
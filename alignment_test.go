@@ -0,0 +1,37 @@
+package postal
+
+import (
+	"net/textproto"
+	"testing"
+)
+
+func TestCheckAlignment(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     Message
+		domains []string
+		fields  []string
+	}{
+		{"aligned", Message{From: "Jane <jane@example.com>"}, []string{"example.com"}, nil},
+		{"subdomain", Message{From: "jane@mail.example.com", Headers: textproto.MIMEHeader{HdrReturnPath: {"<bounces@example.com>"}}}, []string{"example.com"}, nil},
+		{"sender", Message{From: "a@example.com, b@example.com", Sender: "ops@other.com"}, nil, []string{HdrSender}},
+		{"multiple from domains", Message{From: "a@example.com, b@other.com"}, nil, []string{"From"}},
+		{"return path", Message{From: "jane@example.com", Headers: textproto.MIMEHeader{HdrReturnPath: {"<bounces@other.com>"}}}, nil, []string{HdrReturnPath}},
+		{"domains", Message{From: "jane@example.com"}, []string{"other.com"}, []string{"From"}},
+		{"unparseable", Message{From: "not an address"}, nil, []string{"From"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := tt.msg.CheckAlignment(tt.domains...)
+			if len(warnings) != len(tt.fields) {
+				t.Fatalf("expected warnings for %v, got %v", tt.fields, warnings)
+			}
+			for i, w := range warnings {
+				if w.Field != tt.fields[i] {
+					t.Fatalf("expected a warning for %s, got %v", tt.fields[i], w)
+				}
+			}
+		})
+	}
+}
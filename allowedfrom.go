@@ -0,0 +1,73 @@
+package postal
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// ErrSenderNotAllowed is returned when a message's sender isn't one the
+// client allows, see WithAllowedFromPattern and WithAllowedFromDomains.
+var ErrSenderNotAllowed = errors.New("postal: sender not allowed")
+
+// checkSenders checks every sender address of the message, which are its
+// From addresses, its Sender and Return-Path headers and its envelope
+// sender, against the client's allowed senders.
+func (a *ApiClient) checkSenders(msg Message) error {
+	if a.allowedFrom == nil && len(a.allowedFromDomains) == 0 {
+		return nil
+	}
+
+	from, err := mail.ParseAddressList(msg.From)
+	if err != nil {
+		return fmt.Errorf("%w: can't parse From %q", ErrSenderNotAllowed, msg.From)
+	}
+	for _, addr := range from {
+		if err := a.checkSender("From", addr.Address); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range []struct{ name, value string }{
+		{HdrSender, msg.Sender},
+		{HdrReturnPath, msg.Headers.Get(HdrReturnPath)},
+	} {
+		// An empty Return-Path is the null sender of bounces.
+		if strings.TrimSpace(field.value) == "" || strings.TrimSpace(field.value) == "<>" {
+			continue
+		}
+		addr, err := mail.ParseAddress(field.value)
+		if err != nil {
+			return fmt.Errorf("%w: can't parse %s %q", ErrSenderNotAllowed, field.name, field.value)
+		}
+		if err := a.checkSender(field.name, addr.Address); err != nil {
+			return err
+		}
+	}
+
+	envelope, err := envelopeSender(msg)
+	if err != nil {
+		return err
+	}
+	return a.checkSender("envelope sender", envelope)
+}
+
+// checkSender checks the bare address of a sender against the client's
+// allowed senders. field names where the address is from.
+func (a *ApiClient) checkSender(field, addr string) error {
+	if a.allowedFrom != nil && !a.allowedFrom.MatchString(addr) {
+		return fmt.Errorf("%w: %s %s doesn't match %s", ErrSenderNotAllowed, field, addr, a.allowedFrom)
+	}
+	if len(a.allowedFromDomains) == 0 {
+		return nil
+	}
+
+	domain := addressDomain(addr)
+	for _, d := range a.allowedFromDomains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s %s isn't on an allowed domain", ErrSenderNotAllowed, field, addr)
+}
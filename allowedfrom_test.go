@@ -0,0 +1,72 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/textproto"
+	"regexp"
+	"testing"
+)
+
+func TestAllowedFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		msg     Message
+		allowed bool
+	}{
+		{"from", Message{From: "Tenant <news@tenant.example>"}, true},
+		{"subdomain", Message{From: "news@mail.tenant.example"}, true},
+		{"other domain", Message{From: "news@other.example"}, false},
+		{"lookalike domain", Message{From: "news@eviltenant.example"}, false},
+		{"second from", Message{From: "a@tenant.example, b@other.example"}, false},
+		{"sender", Message{From: "news@tenant.example", Sender: "ops@other.example"}, false},
+		{"return path", Message{From: "news@tenant.example", Headers: textproto.MIMEHeader{HdrReturnPath: {"<bounces@other.example>"}}}, false},
+		{"null return path", Message{From: "news@tenant.example", Headers: textproto.MIMEHeader{HdrReturnPath: {"<>"}}}, true},
+	}
+
+	opts := map[string]Option{
+		"domains": WithAllowedFromDomains("Tenant.Example"),
+		"pattern": WithAllowedFromPattern(regexp.MustCompile(`^[^@]+@([a-z]+\.)?tenant\.example$`)),
+	}
+	for optName, opt := range opts {
+		for _, tt := range tests {
+			t.Run(optName+"/"+tt.name, func(t *testing.T) {
+				client, rec := newRecordingClient(t, opt)
+				msg := tt.msg
+				msg.To = []string{"to@example.com"}
+				msg.PlainBody = "hello"
+
+				_, err := client.SendMessage(msg)
+				if tt.allowed {
+					if err != nil {
+						t.Fatalf("expected the sender to be allowed, got %v", err)
+					}
+					return
+				}
+				if !errors.Is(err, ErrSenderNotAllowed) || !errors.Is(err, ErrInvalidMessage) {
+					t.Fatalf("expected ErrSenderNotAllowed, got %v", err)
+				}
+				if len(rec.reqs) != 0 {
+					t.Fatalf("expected nothing to be sent, got %d requests", len(rec.reqs))
+				}
+			})
+		}
+	}
+}
+
+func TestAllowedFromSendRaw(t *testing.T) {
+	client, rec := newRecordingClient(t, WithAllowedFromDomains("tenant.example"))
+	raw := []byte("Subject: hello\r\n\r\nhello\r\n")
+	to := []string{"to@example.com"}
+
+	if _, err := client.SendRaw(context.Background(), "bounces@other.example", to, bytes.NewReader(raw)); !errors.Is(err, ErrSenderNotAllowed) {
+		t.Fatalf("expected ErrSenderNotAllowed, got %v", err)
+	}
+	if _, err := client.SendRaw(context.Background(), "bounces@tenant.example", to, bytes.NewReader(raw)); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(rec.reqs) != 1 {
+		t.Fatalf("expected only the allowed send, got %d requests", len(rec.reqs))
+	}
+}
@@ -0,0 +1,840 @@
+package postal
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mimePart is a node in the MIME tree of a message.
+type mimePart struct {
+	contentType string
+	disposition string
+	contentID   string
+	children    []mimePart
+}
+
+// parseMIMETree parses the MIME tree of a raw message.
+func parseMIMETree(t *testing.T, raw []byte) mimePart {
+	t.Helper()
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	return parseMIMEPart(t, m.Header.Get(HdrContentType), m.Header.Get(HdrContentDisposition), m.Header.Get(HdrContentID), m.Body)
+}
+
+func parseMIMEPart(t *testing.T, contentType, disposition, contentID string, body io.Reader) mimePart {
+	t.Helper()
+
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("error parsing content type %q: %v", contentType, err)
+	}
+
+	p := mimePart{contentType: mt, contentID: contentID}
+	if disposition != "" {
+		p.disposition, _, _ = mime.ParseMediaType(disposition)
+	}
+	if !strings.HasPrefix(mt, "multipart/") {
+		return p
+	}
+
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading part: %v", err)
+		}
+		p.children = append(p.children, parseMIMEPart(t, part.Header.Get(HdrContentType), part.Header.Get(HdrContentDisposition), part.Header.Get(HdrContentID), part))
+	}
+	return p
+}
+
+func TestAttachInlineMIMETree(t *testing.T) {
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+		HTMLBody:  `<img src="cid:logo.png"><div style="background:url(cid:bg.jpg)"></div>`,
+	}
+	if _, err := msg.AttachInline(strings.NewReader("png"), "logo.png", "image/png"); err != nil {
+		t.Fatalf("error attaching inline: %v", err)
+	}
+	if _, err := msg.AttachInline(strings.NewReader("jpg"), "bg.jpg", "image/jpeg"); err != nil {
+		t.Fatalf("error attaching inline: %v", err)
+	}
+	if err := msg.Attach(strings.NewReader("pdf"), "report.pdf", "application/pdf", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	client, rec := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	// multipart/mixed
+	// ├── multipart/alternative
+	// │   ├── text/plain
+	// │   └── multipart/related
+	// │       ├── text/html
+	// │       ├── image/png
+	// │       └── image/jpeg
+	// └── application/pdf
+	root := parseMIMETree(t, rec.last(t))
+	if root.contentType != "multipart/mixed" || len(root.children) != 2 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+
+	alt := root.children[0]
+	if alt.contentType != "multipart/alternative" || len(alt.children) != 2 {
+		t.Fatalf("unexpected alternative part: %+v", alt)
+	}
+	if alt.children[0].contentType != "text/plain" {
+		t.Fatalf("expected text/plain first in alternative, got %s", alt.children[0].contentType)
+	}
+
+	related := alt.children[1]
+	if related.contentType != "multipart/related" || len(related.children) != 3 {
+		t.Fatalf("unexpected related part: %+v", related)
+	}
+	if related.children[0].contentType != "text/html" {
+		t.Fatalf("expected text/html first in related, got %s", related.children[0].contentType)
+	}
+	for i, want := range []string{"<logo.png>", "<bg.jpg>"} {
+		img := related.children[i+1]
+		if img.contentID != want || img.disposition != "inline" {
+			t.Fatalf("unexpected inline part: %+v", img)
+		}
+	}
+
+	if att := root.children[1]; att.contentType != "application/pdf" || att.disposition != "attachment" {
+		t.Fatalf("unexpected attachment part: %+v", att)
+	}
+}
+
+func TestAttachInlineHTMLOnly(t *testing.T) {
+	msg := Message{
+		From:     "from@example.com",
+		To:       []string{"to@example.com"},
+		HTMLBody: `<img src="cid:logo.png">`,
+	}
+	if _, err := msg.AttachInline(strings.NewReader("png"), "logo.png", "image/png"); err != nil {
+		t.Fatalf("error attaching inline: %v", err)
+	}
+
+	client, rec := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	root := parseMIMETree(t, rec.last(t))
+	if root.contentType != "multipart/related" || len(root.children) != 2 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	if root.children[0].contentType != "text/html" || root.children[1].contentType != "image/png" {
+		t.Fatalf("unexpected related parts: %+v", root.children)
+	}
+}
+
+func TestAttachInlineWithoutHTML(t *testing.T) {
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	if _, err := msg.AttachInline(strings.NewReader("png"), "logo.png", "image/png"); err != nil {
+		t.Fatalf("error attaching inline: %v", err)
+	}
+
+	client, _ := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err == nil {
+		t.Fatal("expected error for inline attachments without an HTML body")
+	}
+}
+
+func TestAttachFileContentType(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := map[string]string{
+		"image.webp": "image/webp",
+		"invite.ics": "text/calendar",
+	}
+	for name, want := range tests {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("content"), 0o600); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+
+		var msg Message
+		if err := msg.AttachFile(path); err != nil {
+			t.Fatalf("error attaching file: %v", err)
+		}
+
+		got, _, err := mime.ParseMediaType(msg.attachments[0].Header.Get(HdrContentType))
+		if err != nil {
+			t.Fatalf("error parsing content type: %v", err)
+		}
+		if got != want {
+			t.Fatalf("expected content type %s for %s, got %s", want, name, got)
+		}
+	}
+}
+
+func TestAttachFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("missing file", func(t *testing.T) {
+		var msg Message
+		path := filepath.Join(dir, "missing.pdf")
+		err := msg.AttachFile(path)
+		if !errors.Is(err, ErrAttachmentOpen) {
+			t.Fatalf("expected ErrAttachmentOpen, got %v", err)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			t.Fatalf("expected the error to wrap fs.ErrNotExist, got %v", err)
+		}
+		if !strings.Contains(err.Error(), path) {
+			t.Fatalf("expected the error to name the file, got %v", err)
+		}
+	})
+
+	t.Run("unreadable file", func(t *testing.T) {
+		// A directory can be opened but not read.
+		var msg Message
+		err := msg.AttachFile(dir)
+		if !errors.Is(err, ErrAttachmentRead) {
+			t.Fatalf("expected ErrAttachmentRead, got %v", err)
+		}
+		if errors.Is(err, ErrAttachmentOpen) {
+			t.Fatalf("expected the error not to be ErrAttachmentOpen, got %v", err)
+		}
+		if !strings.Contains(err.Error(), dir) {
+			t.Fatalf("expected the error to name the file, got %v", err)
+		}
+		if len(msg.attachments) != 0 {
+			t.Fatal("expected no attachment")
+		}
+	})
+}
+
+func TestAttachUTF8CSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.csv")
+	if err := os.WriteFile(path, []byte("item,price\ncafé,3€\n"), 0o600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	if err := msg.AttachFile(path); err != nil {
+		t.Fatalf("error attaching file: %v", err)
+	}
+	// An explicit charset is passed through as is.
+	if err := msg.Attach(strings.NewReader("x"), "latin.csv", "text/csv; charset=iso-8859-1", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	client, rec := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	_, params, err := mime.ParseMediaType(m.Header.Get(HdrContentType))
+	if err != nil {
+		t.Fatalf("error parsing content type: %v", err)
+	}
+
+	var charsets []string
+	mr := multipart.NewReader(m.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading part: %v", err)
+		}
+		mt, params, err := mime.ParseMediaType(part.Header.Get(HdrContentType))
+		if err != nil {
+			t.Fatalf("error parsing content type: %v", err)
+		}
+		if mt == "text/csv" {
+			charsets = append(charsets, params["charset"])
+		}
+	}
+
+	if len(charsets) != 2 || charsets[0] != "utf-8" || charsets[1] != "iso-8859-1" {
+		t.Fatalf("unexpected csv charsets: %v", charsets)
+	}
+}
+
+func TestAttachDetectContentType(t *testing.T) {
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	var msg Message
+	if err := msg.Attach(bytes.NewReader(png), "image", "", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if err := msg.Attach(bytes.NewReader([]byte{0x00, 0x01, 0x02}), "blob", "", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	if got := msg.attachments[0].Header.Get(HdrContentType); got != "image/png" {
+		t.Fatalf("expected image/png, got %s", got)
+	}
+	if got := msg.attachments[1].Header.Get(HdrContentType); got != ContentTypeOctetStream {
+		t.Fatalf("expected %s, got %s", ContentTypeOctetStream, got)
+	}
+}
+
+func TestAttachLimited(t *testing.T) {
+	var msg Message
+	if err := msg.AttachLimited(strings.NewReader("12345"), "ok.txt", "text/plain", 5); err != nil {
+		t.Fatalf("error attaching at the limit: %v", err)
+	}
+
+	err := msg.AttachLimited(strings.NewReader("123456"), "big.txt", "text/plain", 5)
+	if !errors.Is(err, ErrAttachmentTooLarge) {
+		t.Fatalf("expected ErrAttachmentTooLarge, got %v", err)
+	}
+	if len(msg.attachments) != 1 || string(msg.attachments[0].Content) != "12345" {
+		t.Fatalf("unexpected attachments: %+v", msg.attachments)
+	}
+}
+
+func TestAttachBase64(t *testing.T) {
+	var msg Message
+	at, err := msg.AttachBase64("aGVsbG8g\r\nd29ybGQ=", "hello.txt", "text/plain")
+	if err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if string(at.Content) != "hello world" {
+		t.Fatalf("unexpected content %q", at.Content)
+	}
+	if len(msg.attachments) != 1 || msg.attachments[0].Filename != "hello.txt" {
+		t.Fatalf("unexpected attachments: %+v", msg.attachments)
+	}
+
+	if _, err := msg.AttachBase64("not base64!", "bad.txt", "text/plain"); err == nil {
+		t.Fatal("expected an error for invalid base64")
+	}
+	if len(msg.attachments) != 1 {
+		t.Fatalf("invalid attachment shouldn't be attached: %+v", msg.attachments)
+	}
+}
+
+func TestAttachCompressed(t *testing.T) {
+	content := strings.Repeat("2024-01-01 12:00:00 INFO request handled\n", 1000)
+
+	var msg Message
+	if err := msg.AttachCompressed(strings.NewReader(content), "app.log"); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if len(msg.attachments) != 1 {
+		t.Fatalf("expected 1 attachment, got %d", len(msg.attachments))
+	}
+	at := msg.attachments[0]
+	if at.Filename != "app.log.gz" || at.Header.Get(HdrContentType) != "application/gzip" {
+		t.Fatalf("unexpected attachment %s of type %s", at.Filename, at.Header.Get(HdrContentType))
+	}
+	if len(at.Content) >= len(content) {
+		t.Fatalf("expected the content to be compressed, got %d bytes from %d", len(at.Content), len(content))
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(at.Content))
+	if err != nil {
+		t.Fatalf("error reading gzip: %v", err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("error decompressing: %v", err)
+	}
+	if string(got) != content || zr.Name != "app.log" {
+		t.Fatalf("unexpected decompressed content or name %q", zr.Name)
+	}
+}
+
+func TestAttachSanitizesFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{"../../etc/passwd", "passwd"},
+		{`C:\Users\jane\report.pdf`, "report.pdf"},
+		{"bad\r\nX-Injected: yes.txt", "badX-Injected: yes.txt"},
+		{"..", "attachment"},
+		{"", "attachment"},
+		{"résumé 2024.pdf", "résumé 2024.pdf"},
+		{"報告書.pdf", "報告書.pdf"},
+	}
+
+	for _, tt := range tests {
+		var msg Message
+		if err := msg.Attach(strings.NewReader("data"), tt.filename, "application/octet-stream", nil); err != nil {
+			t.Fatalf("error attaching %q: %v", tt.filename, err)
+		}
+		at := msg.attachments[0]
+		if at.Filename != tt.want {
+			t.Errorf("filename %q: expected %q, got %q", tt.filename, tt.want, at.Filename)
+		}
+
+		cd := at.Header.Get(HdrContentDisposition)
+		if strings.ContainsAny(cd, "\r\n") {
+			t.Errorf("filename %q: line break in Content-Disposition %q", tt.filename, cd)
+		}
+		for _, r := range cd {
+			if r > 0x7f {
+				t.Errorf("filename %q: non-ASCII Content-Disposition %q", tt.filename, cd)
+				break
+			}
+		}
+		_, params, err := mime.ParseMediaType(cd)
+		if err != nil || params["filename"] != tt.want {
+			t.Errorf("filename %q: Content-Disposition %q parses to %q: %v", tt.filename, cd, params["filename"], err)
+		}
+	}
+
+	var msg Message
+	if err := msg.AttachCompressed(strings.NewReader("data"), "報告書.csv"); err != nil {
+		t.Fatalf("error attaching a compressed file with a non-Latin-1 name: %v", err)
+	}
+}
+
+func TestAttachNonASCIIFilename(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if err := msg.Attach(strings.NewReader("data"), "отчёт.pdf", "application/pdf", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	// Unfold the headers, which are folded when they're long.
+	raw := strings.ReplaceAll(string(rec.last(t)), "\r\n ", " ")
+	var cd string
+	for _, line := range strings.Split(raw, "\r\n") {
+		if strings.HasPrefix(line, HdrContentDisposition+": attachment") {
+			cd = strings.TrimPrefix(line, HdrContentDisposition+": ")
+		}
+	}
+	if !strings.Contains(cd, "filename*=utf-8''%D0%BE%D1%82%D1%87%D1%91%D1%82.pdf") || !strings.Contains(cd, "filename=_____.pdf") {
+		t.Fatalf("expected an RFC 2231 filename with a plain fallback, got %q", cd)
+	}
+	if _, params, err := mime.ParseMediaType(cd); err != nil || params["filename"] != "отчёт.pdf" {
+		t.Fatalf("expected the filename to decode, got %q: %v", params["filename"], err)
+	}
+}
+
+func TestAttachDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.csv", "a.csv", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("content"), 0o600); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "old.csv"), 0o700); err != nil {
+		t.Fatalf("error creating directory: %v", err)
+	}
+
+	var msg Message
+	attached, err := msg.AttachDir(dir, "*.csv")
+	if err != nil {
+		t.Fatalf("error attaching directory: %v", err)
+	}
+	if len(attached) != 2 || attached[0].Filename != "a.csv" || attached[1].Filename != "b.csv" {
+		t.Fatalf("expected a.csv and b.csv, got %+v", attached)
+	}
+	if len(msg.attachments) != 2 {
+		t.Fatalf("expected 2 attachments on the message, got %d", len(msg.attachments))
+	}
+
+	if _, err := msg.AttachDir(dir, "*.pdf"); !errors.Is(err, ErrNoMatchingFiles) {
+		t.Fatalf("expected ErrNoMatchingFiles, got %v", err)
+	}
+	if _, err := msg.AttachDir(dir, "["); err == nil {
+		t.Fatal("expected an error for a bad pattern")
+	}
+}
+
+func TestAttachErrorEmpty(t *testing.T) {
+	if got := (&AttachError{}).Error(); got == "" {
+		t.Fatal("expected a message for an empty AttachError")
+	}
+}
+
+func TestAttachmentOnlyMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want []string
+	}{
+		{"no body", nil, []string{"text/csv"}},
+		{"default body", []Option{WithAttachmentOnlyBody("See the attached report.")}, []string{"text/plain", "text/csv"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, rec := newRecordingClient(t, tt.opts...)
+			msg := Message{
+				From:    "from@example.com",
+				To:      []string{"to@example.com"},
+				Subject: "Daily export",
+			}
+			if err := msg.Attach(strings.NewReader("id,total\n1,42\n"), "export.csv", "", nil); err != nil {
+				t.Fatalf("error attaching file: %v", err)
+			}
+			if _, err := client.SendMessage(msg); err != nil {
+				t.Fatalf("error sending message: %v", err)
+			}
+
+			root := parseMIMETree(t, rec.last(t))
+			if root.contentType != "multipart/mixed" {
+				t.Fatalf("expected a multipart/mixed message, got %s", root.contentType)
+			}
+			if len(root.children) != len(tt.want) {
+				t.Fatalf("expected %d parts, got %d", len(tt.want), len(root.children))
+			}
+			for i, want := range tt.want {
+				if got := root.children[i].contentType; got != want {
+					t.Fatalf("expected part %d to be %s, got %s", i, want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestContentTypeSniffing(t *testing.T) {
+	dir := t.TempDir()
+	files := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"report.txt", "%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj", "application/pdf"},
+		{"notes.pdf", "just some notes", "text/plain"},
+		{"photo.jpg", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		// Zip based formats sniff as zip files, which isn't a signature
+		// type, so their extension's type is kept.
+		{"letter.docx", "PK\x03\x04\x14\x00\x06\x00", "application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+		{"data.csv", "a,b\n1,2\n", "text/csv"},
+	}
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+		if err := os.WriteFile(path, []byte(f.content), 0o600); err != nil {
+			t.Fatalf("error writing file: %v", err)
+		}
+		if err := msg.AttachFile(path); err != nil {
+			t.Fatalf("error attaching file: %v", err)
+		}
+	}
+	// An explicit content type isn't second guessed.
+	if err := msg.Attach(strings.NewReader("%PDF-1.4"), "raw.bin", "application/x-custom", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	logger := &testLogger{}
+	client, rec := newRecordingClient(t, WithContentTypeSniffing(), WithLogger(logger))
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	parts := parseMIMETree(t, rec.last(t)).children[1:]
+	if len(parts) != len(files)+1 {
+		t.Fatalf("expected %d attachments, got %d", len(files)+1, len(parts))
+	}
+	for i, f := range files {
+		if parts[i].contentType != f.want {
+			t.Errorf("expected %s to be sent as %s, got %s", f.name, f.want, parts[i].contentType)
+		}
+	}
+	if got := parts[len(files)].contentType; got != "application/x-custom" {
+		t.Errorf("expected the explicit content type to be kept, got %s", got)
+	}
+	if len(logger.lines) != 3 || !strings.Contains(logger.lines[0], "report.txt looks like application/pdf") {
+		t.Errorf("expected the 3 corrections to be logged, got %q", logger.lines)
+	}
+
+	// The message's attachments aren't modified, and without the option
+	// nothing is corrected.
+	client, rec = newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if got := parseMIMETree(t, rec.last(t)).children[1].contentType; got != "text/plain" {
+		t.Fatalf("expected report.txt to be sent as text/plain without sniffing, got %s", got)
+	}
+}
+
+func TestContentTypeSniffingDenylist(t *testing.T) {
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if err := msg.Attach(strings.NewReader("%PDF-1.4"), "report.txt", "", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	client, _ := newRecordingClient(t, WithContentTypeSniffing(), WithAttachmentTypeDenylist([]string{"application/pdf"}))
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrAttachmentNotAllowed) {
+		t.Fatalf("expected the sniffed type to be denied, got %v", err)
+	}
+}
+
+func TestFilenameTransliteration(t *testing.T) {
+	tests := map[string]string{
+		"résumé.pdf":           "resume.pdf",
+		"Straße_Übersicht.csv": "Strasse_Ubersicht.csv",
+		"Łódź Œuvre.txt":       "Lodz OEuvre.txt",
+		// Decomposed, with combining accents.
+		"re\u0301sume\u0301": "resume",
+		"отчёт.pdf":          "_____.pdf",
+		"plain.txt":          "plain.txt",
+	}
+	for in, want := range tests {
+		if got := transliterate(in); got != want {
+			t.Errorf("expected %q for %q, got %q", want, in, got)
+		}
+	}
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello", HTMLBody: `<img src="cid:café.png">`}
+	if err := msg.Attach(strings.NewReader("data"), "résumé.pdf", "application/pdf", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if _, err := msg.AttachInline(strings.NewReader("png"), "café.png", "image/png"); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	client, rec := newRecordingClient(t, WithFilenameTransliteration())
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	raw := strings.ReplaceAll(string(rec.last(t)), "\r\n ", " ")
+	for _, want := range []string{
+		"Content-Disposition: attachment; filename=resume.pdf\r\n",
+		"Content-Disposition: inline; filename=cafe.png\r\n",
+		"Content-Id: <café.png>\r\n",
+	} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("expected %q in message:\n%s", want, raw)
+		}
+	}
+	if strings.Contains(raw, "filename*=") {
+		t.Errorf("expected no RFC 2231 filenames:\n%s", raw)
+	}
+	if h := msg.attachments[0].Header.Get(HdrContentDisposition); !strings.Contains(h, "filename*=") {
+		t.Errorf("expected the message's attachment to be unchanged, got %q", h)
+	}
+}
+
+func TestAttachInlineCID(t *testing.T) {
+	msg := Message{
+		From:     "from@example.com",
+		To:       []string{"to@example.com"},
+		HTMLBody: `<img src="cid:header-logo"><img src="cid:footer-logo">`,
+	}
+	if _, err := msg.AttachInlineCID(strings.NewReader("png"), "logo.png", "image/png", "header-logo"); err != nil {
+		t.Fatalf("error attaching inline: %v", err)
+	}
+	at, err := msg.AttachInlineCID(strings.NewReader("png"), "logo.png", "image/png", "<footer-logo>")
+	if err != nil {
+		t.Fatalf("error attaching inline: %v", err)
+	}
+	if got := at.Header.Get(HdrContentID); got != "<footer-logo>" {
+		t.Fatalf("expected the Content-ID <footer-logo>, got %q", got)
+	}
+	if _, err := msg.AttachInlineCID(strings.NewReader("png"), "logo.png", "image/png", "bad cid"); err == nil {
+		t.Fatal("expected an error for a content id with a space")
+	}
+
+	client, rec := newRecordingClient(t, WithStrictContentIDs())
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	raw := string(rec.last(t))
+	for _, want := range []string{"Content-Id: <header-logo>\r\n", "Content-Id: <footer-logo>\r\n"} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("expected %q in message:\n%s", want, raw)
+		}
+	}
+}
+
+func TestAttachInlineFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logo.png")
+	if err := os.WriteFile(path, []byte("png"), 0o600); err != nil {
+		t.Fatalf("error writing file: %v", err)
+	}
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+		HTMLBody:  `<img src="cid:logo.png">`,
+	}
+	at, err := msg.AttachInlineFile(path)
+	if err != nil {
+		t.Fatalf("error attaching inline file: %v", err)
+	}
+	if !at.HTMLRelated || at.Filename != "logo.png" {
+		t.Fatalf("unexpected attachment: %+v", at)
+	}
+	if err := msg.Attach(strings.NewReader("pdf"), "report.pdf", "application/pdf", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if _, err := msg.AttachInlineFile(filepath.Join(filepath.Dir(path), "missing.png")); !errors.Is(err, ErrAttachmentOpen) {
+		t.Fatalf("expected ErrAttachmentOpen, got %v", err)
+	}
+
+	client, rec := newRecordingClient(t, WithStrictContentIDs())
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	root := parseMIMETree(t, rec.last(t))
+	if root.contentType != "multipart/mixed" || len(root.children) != 2 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	alt := root.children[0]
+	if alt.contentType != "multipart/alternative" || len(alt.children) != 2 {
+		t.Fatalf("unexpected alternative part: %+v", alt)
+	}
+	related := alt.children[1]
+	if related.contentType != "multipart/related" || len(related.children) != 2 {
+		t.Fatalf("unexpected related part: %+v", related)
+	}
+	if img := related.children[1]; img.contentType != "image/png" || img.disposition != "inline" || img.contentID != "<logo.png>" {
+		t.Fatalf("unexpected inline part: %+v", img)
+	}
+	if att := root.children[1]; att.contentType != "application/pdf" || att.disposition != "attachment" {
+		t.Fatalf("unexpected attachment part: %+v", att)
+	}
+}
+
+func TestStrictContentIDs(t *testing.T) {
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello", HTMLBody: `<img src="cid:logo.png">`}
+	// Regular attachments may share a filename.
+	for i := 0; i < 2; i++ {
+		if err := msg.Attach(strings.NewReader("data"), "report.pdf", "application/pdf", nil); err != nil {
+			t.Fatalf("error attaching: %v", err)
+		}
+	}
+
+	client, rec := newRecordingClient(t, WithStrictContentIDs())
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	// An inline attachment may share neither another inline attachment's
+	// Content-ID nor a regular one's.
+	tests := map[string][]string{
+		"inline":  {"logo.png", "logo.png"},
+		"regular": {"report.pdf"},
+	}
+	for name, inline := range tests {
+		dup := msg
+		dup.attachments = append([]Attachment(nil), msg.attachments...)
+		for _, filename := range inline {
+			if _, err := dup.AttachInline(strings.NewReader("png"), filename, "image/png"); err != nil {
+				t.Fatalf("error attaching inline: %v", err)
+			}
+		}
+		if _, err := client.SendMessage(dup); !errors.Is(err, ErrDuplicateContentID) || !errors.Is(err, ErrInvalidMessage) {
+			t.Fatalf("expected ErrDuplicateContentID for the %s duplicate, got %v", name, err)
+		}
+		// Without strict mode, the message is sent as is.
+		lax, _ := newRecordingClient(t)
+		if _, err := lax.SendMessage(dup); err != nil {
+			t.Fatalf("error sending the %s duplicate without strict content ids: %v", name, err)
+		}
+	}
+	if len(rec.reqs) != 1 {
+		t.Fatalf("expected only the first message to be sent, got %d requests", len(rec.reqs))
+	}
+}
+
+func TestAttachmentContentMD5(t *testing.T) {
+	content := bytes.Repeat([]byte("report "), 100)
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if err := msg.Attach(bytes.NewReader(content), "report.txt", "", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if err := msg.AttachSource(BytesSource("data.bin", "application/octet-stream", []byte("data")), nil); err != nil {
+		t.Fatalf("error attaching source: %v", err)
+	}
+	preset := textproto.MIMEHeader{}
+	preset.Set(HdrContentMD5, "preset")
+	if err := msg.Attach(strings.NewReader("kept"), "kept.txt", "", preset); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	client, rec := newRecordingClient(t, WithAttachmentContentMD5())
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	_, params, _ := mime.ParseMediaType(m.Header.Get(HdrContentType))
+	mr := multipart.NewReader(m.Body, params["boundary"])
+
+	sums := map[string]string{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("error reading part: %v", err)
+		}
+		if part.FileName() == "" {
+			continue
+		}
+		data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		if err != nil {
+			t.Fatalf("error decoding %s: %v", part.FileName(), err)
+		}
+		got := part.Header.Get(HdrContentMD5)
+		if part.FileName() != "kept.txt" {
+			sum := md5.Sum(data)
+			if want := base64.StdEncoding.EncodeToString(sum[:]); got != want {
+				t.Errorf("expected the Content-MD5 of %s to be %s, got %q", part.FileName(), want, got)
+			}
+		}
+		sums[part.FileName()] = got
+	}
+	if len(sums) != 3 || sums["kept.txt"] != "preset" {
+		t.Fatalf("expected the given Content-MD5 to be kept, got %v", sums)
+	}
+
+	// It's opt-in.
+	client, rec = newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if n := strings.Count(strings.ToLower(string(rec.last(t))), "content-md5:"); n != 1 {
+		t.Fatalf("expected only the given Content-MD5, got %d", n)
+	}
+}
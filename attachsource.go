@@ -0,0 +1,190 @@
+package postal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/knadh/smtppool"
+)
+
+// AttachmentSource is the content of an attachment which is read while the
+// message is built, rather than held in memory from when it's attached, see
+// AttachSource.
+type AttachmentSource interface {
+	// Open returns a reader of the content. It's called every time the
+	// content is needed, such as on every build of the message, and the
+	// reader is closed once it's been read.
+	Open() (io.ReadCloser, error)
+	// Size is the size of the content, in bytes, used for the message's
+	// size estimates.
+	Size() int64
+	// ContentType is the content type of the content, or "" to have it
+	// guessed from the filename's extension or else from the content.
+	ContentType() string
+	Filename() string
+}
+
+// BytesSource returns an AttachmentSource of content already in memory, which
+// is how attachments added with Attach are read.
+func BytesSource(filename, contentType string, content []byte) AttachmentSource {
+	return bytesSource{filename: filename, contentType: contentType, content: content}
+}
+
+type bytesSource struct {
+	filename    string
+	contentType string
+	content     []byte
+}
+
+func (s bytesSource) Open() (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(s.content)), nil
+}
+
+func (s bytesSource) Size() int64         { return int64(len(s.content)) }
+func (s bytesSource) ContentType() string { return s.contentType }
+func (s bytesSource) Filename() string    { return s.filename }
+
+// FileSource returns an AttachmentSource which reads the file at path when
+// the message is built. Its size is the file's size when FileSource is
+// called.
+func FileSource(path string) (AttachmentSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, withKind(ErrAttachmentOpen, fmt.Errorf("error opening attachment %s: %w", path, err))
+	}
+	if info.IsDir() {
+		return nil, withKind(ErrAttachmentOpen, fmt.Errorf("error opening attachment %s: is a directory", path))
+	}
+	return fileSource{path: path, size: info.Size()}, nil
+}
+
+type fileSource struct {
+	path string
+	size int64
+}
+
+func (s fileSource) Open() (io.ReadCloser, error) {
+	return os.Open(s.path)
+}
+
+func (s fileSource) Size() int64 { return s.size }
+
+func (s fileSource) ContentType() string {
+	return withTextCharset(typeByExtension(filepath.Ext(s.path)))
+}
+
+func (s fileSource) Filename() string { return filepath.Base(s.path) }
+
+// AttachSource attaches the content of src, which is only read when the
+// message is built, and streamed into it. It's for large attachments, such
+// as files on disk or objects in a bucket: they aren't held in memory while
+// the message waits to be sent, and aren't held whole while it's built.
+// `headers` is optional, as for Attach.
+//
+// The built message and postal's request are still built in memory, so a
+// large attachment needs that much memory for the send. Sends to the
+// structured endpoint, idempotency keys and content type sniffing read the
+// content in full, or its start for sniffing, whenever they need it.
+func (m *Message) AttachSource(src AttachmentSource, headers textproto.MIMEHeader) error {
+	at := Attachment{Filename: sanitizeFilename(src.Filename()), Source: src}
+	contentType := src.ContentType()
+	if contentType == "" {
+		contentType = typeByExtension(filepath.Ext(at.Filename))
+	}
+	if contentType == "" {
+		head, err := at.peek()
+		if err != nil {
+			return withKind(ErrAttachmentRead, fmt.Errorf("error reading attachment %s: %w", at.Filename, err))
+		}
+		contentType = http.DetectContentType(head)
+	}
+	at.Header = attachmentHeader(at.Filename, contentType, "attachment")
+
+	for key, val := range headers {
+		for _, v := range val {
+			at.Header.Set(key, v)
+		}
+	}
+
+	m.attachments = append(m.attachments, at)
+	return nil
+}
+
+// size returns the size of the attachment's content, in bytes.
+func (at Attachment) size() int64 {
+	if at.Source != nil {
+		return at.Source.Size()
+	}
+	return int64(len(at.Content))
+}
+
+// content returns the attachment's content, read in full if it's read from
+// a source.
+func (at Attachment) content() ([]byte, error) {
+	if at.Source == nil {
+		return at.Content, nil
+	}
+	r, err := at.Source.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// sniffLen is how much of the content http.DetectContentType looks at.
+const sniffLen = 512
+
+// peek returns the start of the attachment's content, as much of it as
+// content type detection looks at.
+func (at Attachment) peek() ([]byte, error) {
+	if at.Source == nil {
+		return at.Content, nil
+	}
+	r, err := at.Source.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	return head[:n], nil
+}
+
+// hdrAttachmentSource marks the attachments of an smtppool.Email which are
+// read from a source: it's the index of the message's attachment with the
+// source. smtppool attachments only hold content, so the index is how the
+// builder finds the source, whatever email customizers do to the list. It's
+// never written to the message.
+const hdrAttachmentSource = "X-Postal-Go-Attachment-Source"
+
+// emailSource returns the source of the email's attachment, or nil if its
+// content is in it, along with its header without the marker.
+func emailSource(attachments []Attachment, at smtppool.Attachment) (AttachmentSource, textproto.MIMEHeader, error) {
+	idx := at.Header.Get(hdrAttachmentSource)
+	if idx == "" {
+		return nil, at.Header, nil
+	}
+
+	i, err := strconv.Atoi(idx)
+	if err != nil || i < 0 || i >= len(attachments) || attachments[i].Source == nil {
+		return nil, nil, fmt.Errorf("attachment %s: no source %q", at.Filename, idx)
+	}
+	hdr := make(textproto.MIMEHeader, len(at.Header))
+	for k, v := range at.Header {
+		hdr[k] = v
+	}
+	hdr.Del(hdrAttachmentSource)
+	return attachments[i].Source, hdr, nil
+}
@@ -0,0 +1,128 @@
+package postal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// countingSource is an AttachmentSource which counts how often it's opened.
+type countingSource struct {
+	AttachmentSource
+	opens int
+}
+
+func (s *countingSource) Open() (io.ReadCloser, error) {
+	s.opens++
+	return s.AttachmentSource.Open()
+}
+
+func TestAttachSource(t *testing.T) {
+	// Larger than a chunk of base64WrapReader, and not a whole number of
+	// lines.
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	src := &countingSource{AttachmentSource: BytesSource("report.csv", "", content)}
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if err := msg.AttachSource(src, nil); err != nil {
+		t.Fatalf("error attaching source: %v", err)
+	}
+	if src.opens != 0 {
+		t.Fatalf("expected the source not to be read when attached, got %d opens", src.opens)
+	}
+	inMemory := Message{From: msg.From, To: msg.To, PlainBody: msg.PlainBody}
+	if err := inMemory.Attach(bytes.NewReader(content), "report.csv", "", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if msg.IdempotencyKey() != inMemory.IdempotencyKey() {
+		t.Fatal("expected the same idempotency key as the in-memory attachment")
+	}
+	if got := msg.Summary().AttachmentBytes; got != int64(len(content)) {
+		t.Fatalf("expected %d attachment bytes, got %d", len(content), got)
+	}
+
+	client, rec := newRecordingClient(t, WithBoundary("b"))
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if _, err := client.SendMessage(inMemory); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	sent, want := rec.raw(t, 0), rec.raw(t, 1)
+	// The messages only differ in their Message-ID and Date.
+	strip := func(raw []byte) string {
+		_, body := splitMessage(raw)
+		return string(body)
+	}
+	if strip(sent) != strip(want) {
+		t.Fatalf("expected the same body as the in-memory attachment:\n%s\n%s", sent, want)
+	}
+	if bytes.Contains(sent, []byte(hdrAttachmentSource)) {
+		t.Fatalf("expected the source marker not to be written:\n%s", sent)
+	}
+	if !bytes.Contains(sent, []byte("Content-Type: text/csv")) {
+		t.Fatalf("expected the content type to be guessed from the extension:\n%s", sent)
+	}
+}
+
+func TestAttachSourceStructured(t *testing.T) {
+	var req structuredRequest
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithStructuredSend())
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if err := msg.AttachSource(BytesSource("data.bin", "application/octet-stream", []byte("data")), nil); err != nil {
+		t.Fatalf("error attaching source: %v", err)
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(req.Attachments) != 1 || req.Attachments[0].Data != base64.StdEncoding.EncodeToString([]byte("data")) {
+		t.Fatalf("unexpected attachments: %+v", req.Attachments)
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(path, []byte("hello"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	src, err := FileSource(path)
+	if err != nil {
+		t.Fatalf("error opening file source: %v", err)
+	}
+	if src.Size() != 5 || src.Filename() != "notes.txt" || !strings.HasPrefix(src.ContentType(), "text/plain") {
+		t.Fatalf("unexpected source: %d %s %s", src.Size(), src.Filename(), src.ContentType())
+	}
+	if _, err := FileSource(filepath.Dir(path)); !errors.Is(err, ErrAttachmentOpen) {
+		t.Fatalf("expected ErrAttachmentOpen for a directory, got %v", err)
+	}
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if err := msg.AttachSource(src, nil); err != nil {
+		t.Fatalf("error attaching source: %v", err)
+	}
+	// The file is read when the message is built.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	client, rec := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the removed file not to be found, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatalf("expected nothing to be sent, got %d requests", len(rec.reqs))
+	}
+}
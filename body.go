@@ -0,0 +1,49 @@
+package postal
+
+import "strings"
+
+// utf8BOM is the UTF-8 encoded byte order mark.
+const utf8BOM = "\ufeff"
+
+// body returns the body normalized according to the client's options.
+func (a *ApiClient) body(b string) []byte {
+	if a.stripBOM {
+		b = strings.TrimPrefix(b, utf8BOM)
+	}
+	return []byte(b)
+}
+
+// plainTextFallback is the plain text body of HTML only messages sent with
+// WithPlainTextFallback.
+const plainTextFallback = "This email is best viewed in an HTML-capable client."
+
+// plainText returns the plain text body of the message, which is the
+// fallback text for HTML only messages if WithPlainTextFallback is set.
+func (a *ApiClient) plainText(msg Message) string {
+	if a.plainFallback && msg.PlainBody == "" && msg.HTMLBody != "" {
+		return plainTextFallback
+	}
+	return msg.PlainBody
+}
+
+// plainBody returns the plain text body normalized according to the
+// client's options.
+func (a *ApiClient) plainBody(b string) []byte {
+	if a.normalizePlain {
+		b = normalizeWhitespace(b)
+	}
+	return a.body(b)
+}
+
+// normalizeWhitespace converts all line endings to CRLF and trims trailing
+// whitespace from every line.
+func normalizeWhitespace(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(l, " \t")
+	}
+	return strings.Join(lines, "\r\n")
+}
@@ -0,0 +1,101 @@
+package postal
+
+import (
+	"bytes"
+	"io"
+	"mime/quotedprintable"
+	"net/mail"
+	"testing"
+)
+
+func TestStripBOM(t *testing.T) {
+	msg := Message{
+		From:     "from@example.com",
+		To:       []string{"to@example.com"},
+		HTMLBody: "\ufeff<p>hello</p>",
+	}
+
+	client, rec := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if !bytes.Contains(rec.last(t), []byte("=EF=BB=BF<p>hello</p>")) {
+		t.Fatal("expected BOM to be kept without WithStripBOM")
+	}
+
+	client, rec = newRecordingClient(t, WithStripBOM())
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	raw := rec.last(t)
+	if bytes.Contains(raw, []byte("=EF=BB=BF")) {
+		t.Fatal("expected BOM to be stripped")
+	}
+	if !bytes.Contains(raw, []byte("<p>hello</p>")) {
+		t.Fatal("expected body to be present")
+	}
+}
+
+func TestNormalizeWhitespace(t *testing.T) {
+	got := normalizeWhitespace("one  \r\ntwo\t\rthree \nfour")
+	if want := "one\r\ntwo\r\nthree\r\nfour"; got != want {
+		t.Fatalf("unexpected normalized text:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestWithPlainTextNormalization(t *testing.T) {
+	client, rec := newRecordingClient(t, WithPlainTextNormalization())
+
+	if _, err := client.SendMessage(Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello   \nworld\t\r\n",
+	}); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	body, err := io.ReadAll(quotedprintable.NewReader(m.Body))
+	if err != nil {
+		t.Fatalf("error decoding body: %v", err)
+	}
+	if want := "hello\r\nworld\r\n"; string(body) != want {
+		t.Fatalf("unexpected body:\n got: %q\nwant: %q", body, want)
+	}
+}
+
+func TestWithPlainTextFallback(t *testing.T) {
+	msg := Message{
+		From:     "from@example.com",
+		To:       []string{"to@example.com"},
+		HTMLBody: "<p>hello</p>",
+	}
+
+	client, rec := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if bytes.Contains(rec.last(t), []byte(plainTextFallback)) {
+		t.Fatal("expected no plain text fallback without WithPlainTextFallback")
+	}
+
+	client, rec = newRecordingClient(t, WithPlainTextFallback())
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	tree := parseMIMETree(t, rec.last(t))
+	if tree.contentType != "multipart/alternative" || len(tree.children) != 2 || tree.children[0].contentType != "text/plain" {
+		t.Fatalf("expected a text/plain alternative, got %+v", tree)
+	}
+
+	msg.PlainBody = "hello"
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if bytes.Contains(rec.last(t), []byte(plainTextFallback)) {
+		t.Fatal("expected the plain text body to be kept")
+	}
+}
@@ -0,0 +1,143 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+const (
+	// ContentTypeMultipartReport is the content type of delivery status
+	// notifications.
+	ContentTypeMultipartReport = "multipart/report"
+	// ContentTypeDeliveryStatus is the content type of the machine readable
+	// part of a delivery status notification.
+	ContentTypeDeliveryStatus = "message/delivery-status"
+	// ContentTypeRFC822 is the content type of an attached message.
+	ContentTypeRFC822 = "message/rfc822"
+
+	// bounceLocalPart is the mailbox bounces are sent from.
+	bounceLocalPart = "MAILER-DAEMON"
+)
+
+// SendBounce sends a bounce for originalMessage to `to`, which is usually
+// the envelope sender of the original message.
+//
+// The bounce is a delivery status notification (RFC3464) with a human
+// readable explanation, a message/delivery-status part reporting a permanent
+// failure for each recipient of the original message, and the original
+// message itself. Its From header is MAILER-DAEMON at the domain of the
+// original message's first recipient, which has to be a domain postal is
+// allowed to send from, and postal is told that the message is a bounce.
+//
+// Postal requires an envelope sender, so the bounce is sent from the same
+// MAILER-DAEMON address rather than the null one RFC 3464 asks for. It's
+// sent as a bounce, which keeps postal from bouncing it back and starting a
+// loop. As with SendRaw, the recipient is rewritten and checked according to
+// the client's options, such as WithRedirectAllTo.
+func (a *ApiClient) SendBounce(ctx context.Context, to string, originalMessage []byte) (resp Response, err error) {
+	defer func() { a.stats.recordSend(false, err) }()
+	rcpt, err := mail.ParseAddress(to)
+	if err != nil {
+		return Response{}, withKind(ErrInvalidMessage, fmt.Errorf("error parsing bounce recipient: %w", err))
+	}
+
+	orig, err := mail.ReadMessage(bytes.NewReader(originalMessage))
+	if err != nil {
+		return Response{}, withKind(ErrInvalidMessage, fmt.Errorf("error parsing original message: %w", err))
+	}
+	failed, err := orig.Header.AddressList("To")
+	if err != nil && err != mail.ErrHeaderNotPresent {
+		return Response{}, withKind(ErrInvalidMessage, fmt.Errorf("error parsing recipients of original message: %w", err))
+	}
+	if len(failed) == 0 {
+		return Response{}, withKind(ErrInvalidMessage, fmt.Errorf("%w: original message has no recipients", ErrNoRecipients))
+	}
+
+	domain := failed[0].Address[strings.LastIndex(failed[0].Address, "@")+1:]
+	from := bounceLocalPart + "@" + domain
+
+	rawMsg, err := buildBounce(a.clock.Now(), from, rcpt.Address, domain, failed, orig.Header, originalMessage)
+	if err != nil {
+		return Response{}, withKind(ErrInvalidMessage, fmt.Errorf("error building bounce: %w", err))
+	}
+
+	res, err := a.sendEnvelope(ctx, from, []string{rcpt.Address}, a.encodeData(rawMsg), "", true)
+	return res.Response, err
+}
+
+// buildBounce builds the multipart/report message for a bounce sent at now.
+func buildBounce(now time.Time, from, to, domain string, failed []*mail.Address, origHeader mail.Header, original []byte) ([]byte, error) {
+	var buff bytes.Buffer
+	w := multipart.NewWriter(&buff)
+
+	id, err := generateMessageID(domain, now)
+	if err != nil {
+		return nil, err
+	}
+
+	date := now.Format(time.RFC1123Z)
+	hdr := []string{
+		"From: Mail Delivery System <" + from + ">",
+		"To: <" + to + ">",
+		"Subject: Undelivered Mail Returned to Sender",
+		"Date: " + date,
+		"Message-Id: " + id,
+		"Auto-Submitted: auto-replied",
+		"MIME-Version: 1.0",
+		"Content-Type: " + ContentTypeMultipartReport + "; report-type=delivery-status;\r\n boundary=\"" + w.Boundary() + "\"",
+	}
+	if origID := origHeader.Get("Message-Id"); origID != "" {
+		hdr = append(hdr, "In-Reply-To: "+origID)
+	}
+	io.WriteString(&buff, strings.Join(hdr, "\r\n")+"\r\n\r\n")
+
+	addrs := make([]string, 0, len(failed))
+	for _, f := range failed {
+		addrs = append(addrs, f.Address)
+	}
+
+	// Human readable explanation.
+	p, err := w.CreatePart(textproto.MIMEHeader{
+		HdrContentType: {"text/plain; charset=UTF-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(p, "Your message could not be delivered to the following recipients:\r\n\r\n    %s\r\n",
+		strings.Join(addrs, "\r\n    "))
+
+	// Machine readable delivery status.
+	p, err = w.CreatePart(textproto.MIMEHeader{
+		HdrContentType: {ContentTypeDeliveryStatus},
+	})
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(p, "Reporting-MTA: dns; %s\r\nArrival-Date: %s\r\n", domain, date)
+	for _, addr := range addrs {
+		fmt.Fprintf(p, "\r\nFinal-Recipient: rfc822; %s\r\nAction: failed\r\nStatus: 5.0.0\r\n", addr)
+	}
+
+	// The original message.
+	p, err = w.CreatePart(textproto.MIMEHeader{
+		HdrContentType: {ContentTypeRFC822},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.Write(original); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buff.Bytes(), nil
+}
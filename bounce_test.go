@@ -0,0 +1,157 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+const testOriginal = "From: Sender <sender@remote.com>\r\n" +
+	"To: user@example.com\r\n" +
+	"Subject: Hello\r\n" +
+	"Message-Id: <orig@remote.com>\r\n" +
+	"\r\n" +
+	"Hello there\r\n"
+
+func TestSendBounce(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	if _, err := client.SendBounce(context.Background(), "Sender <sender@remote.com>", []byte(testOriginal)); err != nil {
+		t.Fatalf("error sending bounce: %v", err)
+	}
+
+	req := rec.reqs[0]
+	if !req.Bounce {
+		t.Fatal("expected bounce flag to be set")
+	}
+	if req.From != "MAILER-DAEMON@example.com" {
+		t.Fatalf("expected the MAILER-DAEMON envelope sender, got %q", req.From)
+	}
+	if len(req.To) != 1 || req.To[0] != "sender@remote.com" {
+		t.Fatalf("unexpected rcpt to: %v", req.To)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing bounce: %v", err)
+	}
+	if got := m.Header.Get("From"); got != "Mail Delivery System <MAILER-DAEMON@example.com>" {
+		t.Fatalf("unexpected From: %q", got)
+	}
+	if got := m.Header.Get("In-Reply-To"); got != "<orig@remote.com>" {
+		t.Fatalf("unexpected In-Reply-To: %q", got)
+	}
+
+	mt, params, err := mime.ParseMediaType(m.Header.Get(HdrContentType))
+	if err != nil {
+		t.Fatalf("error parsing content type: %v", err)
+	}
+	if mt != ContentTypeMultipartReport || params["report-type"] != "delivery-status" {
+		t.Fatalf("unexpected content type: %s", m.Header.Get(HdrContentType))
+	}
+
+	var (
+		types  []string
+		bodies []string
+		mr     = multipart.NewReader(m.Body, params["boundary"])
+	)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("error reading part: %v", err)
+		}
+		b, _ := io.ReadAll(p)
+		types = append(types, p.Header.Get(HdrContentType))
+		bodies = append(bodies, string(b))
+	}
+
+	if len(types) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(types))
+	}
+	if types[1] != ContentTypeDeliveryStatus || !strings.Contains(bodies[1], "Final-Recipient: rfc822; user@example.com") {
+		t.Fatalf("unexpected delivery status part: %s %q", types[1], bodies[1])
+	}
+	if types[2] != ContentTypeRFC822 || bodies[2] != testOriginal {
+		t.Fatalf("unexpected original message part: %s %q", types[2], bodies[2])
+	}
+}
+
+func TestSendBounceInvalidOriginal(t *testing.T) {
+	client, _ := newRecordingClient(t)
+
+	_, err := client.SendBounce(context.Background(), "sender@remote.com", []byte("Subject: no recipients\r\n\r\n"))
+	if !errors.Is(err, ErrNoRecipients) || !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrNoRecipients for original message without recipients, got %v", err)
+	}
+}
+
+func TestSendBounceRedirected(t *testing.T) {
+	client, rec := newRecordingClient(t, WithRedirectAllTo("staging@example.com"))
+
+	if _, err := client.SendBounce(context.Background(), "sender@remote.com", []byte(testOriginal)); err != nil {
+		t.Fatalf("error sending bounce: %v", err)
+	}
+	if req := rec.reqs[0]; !req.Bounce || len(req.To) != 1 || req.To[0] != "staging@example.com" {
+		t.Fatalf("expected the bounce to be redirected, got %v", req.To)
+	}
+	if got := client.Stats().Sent; got != 1 {
+		t.Fatalf("expected the bounce to be counted, got %d sent", got)
+	}
+}
+
+func TestMessageBounceAndTag(t *testing.T) {
+	var bodies []map[string]interface{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		bodies = append(bodies, body)
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	})
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	msg.Bounce = true
+	msg.Tag = "dsn"
+	msg.Class = ClassTransactional
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	msg.ForceStructured = true
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	if bodies[0]["bounce"] != false || bodies[1]["bounce"] != true || bodies[2]["bounce"] != true {
+		t.Fatalf("unexpected bounce flags: %v, %v, %v", bodies[0]["bounce"], bodies[1]["bounce"], bodies[2]["bounce"])
+	}
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(bodies[1]["data"].(string), "="))
+	if err != nil {
+		t.Fatalf("error decoding message data: %v", err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get(HdrPostalTag); got != "dsn" {
+		t.Fatalf("expected the tag dsn to replace the class, got %q", got)
+	}
+	if got := bodies[2]["tag"]; got != "dsn" {
+		t.Fatalf("expected the structured tag dsn, got %v", got)
+	}
+}
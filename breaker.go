@@ -0,0 +1,113 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without making a request while the circuit
+// breaker set with WithCircuitBreaker is open.
+var ErrCircuitOpen = errors.New("postal: circuit breaker is open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker stops requests to postal after a number of consecutive
+// failures. Once it has been open for openDuration, a single probe request
+// is let through: if it succeeds the breaker closes, otherwise it opens
+// again.
+type circuitBreaker struct {
+	mu           sync.Mutex
+	clock        Clock
+	threshold    int
+	openDuration time.Duration
+	// isFailure reports whether an error means postal is unavailable.
+	isFailure func(error) bool
+
+	state    breakerState
+	failures int
+	openedAt time.Time
+	// probing is set while the half open breaker's probe is in flight.
+	probing bool
+}
+
+func newCircuitBreaker(c Clock, threshold int, openDuration time.Duration, isFailure func(error) bool) *circuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &circuitBreaker{
+		clock:        c,
+		threshold:    threshold,
+		openDuration: openDuration,
+		isFailure:    isFailure,
+	}
+}
+
+// allow returns ErrCircuitOpen if a request can't be made. Every allowed
+// request must be followed by a call to record with its result.
+func (b *circuitBreaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.openDuration {
+			return ErrCircuitOpen
+		}
+		b.state = breakerHalfOpen
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// release ends an allowed request which wasn't made, such as one rejected by
+// a pre-send hook, without recording a result, so a half open breaker lets
+// another probe through.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+}
+
+// record updates the breaker with the result of a request. Only failures
+// which mean postal is unavailable, those which the client would retry,
+// count; a rejected message is a sign postal is up. Requests ended by
+// their context don't say anything about postal and are ignored.
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == breakerHalfOpen {
+		b.probing = false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return
+	}
+
+	if !b.isFailure(err) {
+		b.state = breakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.clock.Now()
+	}
+}
@@ -0,0 +1,116 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls int32
+	clock := newFakeClock()
+	client := newTestClient(t, failingHandler(3, http.StatusServiceUnavailable, &calls),
+		WithClock(clock), WithCircuitBreaker(2, time.Minute))
+
+	// Closed: requests are made until the threshold is reached.
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendMessage(retryMsg); !errors.Is(err, ErrServer) {
+			t.Fatalf("expected ErrServer, got %v", err)
+		}
+	}
+
+	// Open: requests fail fast.
+	if _, err := client.SendMessage(retryMsg); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected 2 requests while open, got %d", got)
+	}
+
+	// Half open: the failed probe opens the breaker again.
+	clock.Advance(time.Minute)
+	if _, err := client.SendMessage(retryMsg); !errors.Is(err, ErrServer) {
+		t.Fatalf("expected the probe to fail with ErrServer, got %v", err)
+	}
+	if _, err := client.SendMessage(retryMsg); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected ErrCircuitOpen after a failed probe, got %v", err)
+	}
+
+	// Half open: the successful probe closes the breaker.
+	clock.Advance(time.Minute)
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendMessage(retryMsg); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 5 {
+		t.Fatalf("expected 5 requests, got %d", got)
+	}
+}
+
+func TestCircuitBreakerSingleProbe(t *testing.T) {
+	clock := newFakeClock()
+	b := newCircuitBreaker(clock, 1, time.Minute, IsRetryable)
+
+	if err := b.allow(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b.record(&APIError{StatusCode: http.StatusBadGateway})
+
+	clock.Advance(time.Minute)
+	if err := b.allow(); err != nil {
+		t.Fatalf("expected the probe to be allowed, got %v", err)
+	}
+	if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected a single probe, got %v", err)
+	}
+}
+
+func TestCircuitBreakerIgnoresClientErrors(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, failingHandler(3, http.StatusUnprocessableEntity, &calls),
+		WithCircuitBreaker(1, time.Minute))
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.SendMessage(retryMsg); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("client errors shouldn't open the breaker: %v", err)
+		}
+	}
+}
+
+func TestCircuitBreakerPreSendHookDuringProbe(t *testing.T) {
+	var calls int32
+	var reject int32
+	clock := newFakeClock()
+	hookErr := errors.New("rejected")
+	client := newTestClient(t, failingHandler(1, http.StatusServiceUnavailable, &calls),
+		WithClock(clock), WithCircuitBreaker(1, time.Minute),
+		WithPreSendHook(func(ctx context.Context, req *http.Request, msg Message) error {
+			if atomic.LoadInt32(&reject) == 1 {
+				return hookErr
+			}
+			return nil
+		}))
+
+	if _, err := client.SendMessage(retryMsg); !errors.Is(err, ErrServer) {
+		t.Fatalf("expected ErrServer, got %v", err)
+	}
+
+	// The hook rejects the probe, which must not keep the breaker from
+	// letting the next one through.
+	clock.Advance(time.Minute)
+	atomic.StoreInt32(&reject, 1)
+	if _, err := client.SendMessage(retryMsg); !errors.Is(err, hookErr) {
+		t.Fatalf("expected the hook's error, got %v", err)
+	}
+	atomic.StoreInt32(&reject, 0)
+	if _, err := client.SendMessage(retryMsg); err != nil {
+		t.Fatalf("expected the next probe to be sent, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected 2 requests, got %d", got)
+	}
+}
@@ -0,0 +1,61 @@
+package postal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// ContentTypeCalendar is the content type of iCalendar invites.
+const ContentTypeCalendar = "text/calendar"
+
+// icsFilename is the filename given to calendar invites.
+const icsFilename = "invite.ics"
+
+// iTIP methods which can be used with AttachICS.
+const (
+	ICSMethodPublish        = "PUBLISH"
+	ICSMethodRequest        = "REQUEST"
+	ICSMethodReply          = "REPLY"
+	ICSMethodAdd            = "ADD"
+	ICSMethodCancel         = "CANCEL"
+	ICSMethodRefresh        = "REFRESH"
+	ICSMethodCounter        = "COUNTER"
+	ICSMethodDeclineCounter = "DECLINECOUNTER"
+)
+
+// AttachICS attaches a calendar invite read from r to the message. `method`
+// is the iTIP method of the invite, e.g. REQUEST or CANCEL, and must match
+// the METHOD property in the invite.
+//
+// The invite is added inline with a text/calendar content type carrying the
+// method, which lets calendar clients recognize it as an invite rather than a
+// file to download.
+func (m *Message) AttachICS(r io.Reader, method string) (Attachment, error) {
+	method = strings.ToUpper(method)
+	switch method {
+	case ICSMethodPublish, ICSMethodRequest, ICSMethodReply, ICSMethodAdd,
+		ICSMethodCancel, ICSMethodRefresh, ICSMethodCounter, ICSMethodDeclineCounter:
+	default:
+		return Attachment{}, fmt.Errorf("invalid calendar method: %q", method)
+	}
+
+	var buffer bytes.Buffer
+	if _, err := io.Copy(&buffer, r); err != nil {
+		return Attachment{}, err
+	}
+
+	at := Attachment{
+		Filename: icsFilename,
+		Header:   textproto.MIMEHeader{},
+		Content:  buffer.Bytes(),
+	}
+	at.Header.Set(HdrContentType, fmt.Sprintf("%s; method=%s; charset=UTF-8", ContentTypeCalendar, method))
+	at.Header.Set(HdrContentDisposition, fmt.Sprintf("inline; filename=\"%s\"", icsFilename))
+	at.Header.Set(HdrContentTransferEncoding, contentEncBase64)
+
+	m.attachments = append(m.attachments, at)
+	return at, nil
+}
@@ -0,0 +1,56 @@
+package postal
+
+import (
+	"mime"
+	"strings"
+	"testing"
+)
+
+const testICS = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nMETHOD:REQUEST\r\nEND:VCALENDAR\r\n"
+
+func TestAttachICS(t *testing.T) {
+	msg := Message{}
+	at, err := msg.AttachICS(strings.NewReader(testICS), "request")
+	if err != nil {
+		t.Fatalf("error attaching invite: %v", err)
+	}
+
+	mt, params, err := mime.ParseMediaType(at.Header.Get(HdrContentType))
+	if err != nil {
+		t.Fatalf("error parsing content type: %v", err)
+	}
+	if mt != ContentTypeCalendar {
+		t.Fatalf("expected content type %s, got %s", ContentTypeCalendar, mt)
+	}
+	if params["method"] != ICSMethodRequest {
+		t.Fatalf("expected method REQUEST, got %q", params["method"])
+	}
+	if params["charset"] != "UTF-8" {
+		t.Fatalf("expected charset UTF-8, got %q", params["charset"])
+	}
+
+	disp, _, err := mime.ParseMediaType(at.Header.Get(HdrContentDisposition))
+	if err != nil {
+		t.Fatalf("error parsing content disposition: %v", err)
+	}
+	if disp != "inline" {
+		t.Fatalf("expected inline disposition, got %s", disp)
+	}
+
+	if string(at.Content) != testICS {
+		t.Fatalf("unexpected content: %q", at.Content)
+	}
+	if len(msg.attachments) != 1 {
+		t.Fatalf("expected 1 attachment, got %d", len(msg.attachments))
+	}
+}
+
+func TestAttachICSInvalidMethod(t *testing.T) {
+	msg := Message{}
+	if _, err := msg.AttachICS(strings.NewReader(testICS), "INVITE"); err == nil {
+		t.Fatal("expected error for invalid method")
+	}
+	if len(msg.attachments) != 0 {
+		t.Fatal("invite with invalid method was attached")
+	}
+}
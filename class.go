@@ -0,0 +1,59 @@
+package postal
+
+import (
+	"fmt"
+	"net/textproto"
+	"strings"
+)
+
+const (
+	// HdrPostalTag is the header postal reads the tag of a message from.
+	HdrPostalTag = "X-Postal-Tag"
+	// HdrPostalIPPool is the header Message.IPPool is sent in.
+	HdrPostalIPPool = "X-Postal-IP-Pool"
+	HdrPrecedence   = "Precedence"
+)
+
+// Values of the Precedence header. Receivers use it to tell mail sent to many
+// recipients apart and to suppress auto-replies, such as out of office
+// replies, to it.
+const (
+	PrecedenceBulk = "bulk"
+	PrecedenceList = "list"
+	PrecedenceJunk = "junk"
+)
+
+// MessageClass classifies a message by the kind of traffic it is.
+//
+// Postal has no notion of message priority, so the class is sent as the
+// message's tag. Postal shows tags on messages and can filter them, which
+// lets traffic be told apart, but it doesn't queue transactional messages
+// ahead of bulk ones. To keep bulk sends from delaying transactional ones,
+// send them through separate postal servers.
+type MessageClass string
+
+const (
+	// ClassTransactional is for messages triggered by a user's action, such
+	// as password resets and receipts.
+	ClassTransactional MessageClass = "transactional"
+	// ClassBulk is for messages sent to many recipients at once, such as
+	// newsletters.
+	ClassBulk MessageClass = "bulk"
+)
+
+// SetPrecedence sets the Precedence header of the message to one of
+// PrecedenceBulk, PrecedenceList or PrecedenceJunk.
+func (m *Message) SetPrecedence(value string) error {
+	value = strings.ToLower(strings.TrimSpace(value))
+	switch value {
+	case PrecedenceBulk, PrecedenceList, PrecedenceJunk:
+	default:
+		return fmt.Errorf("invalid precedence %q, must be one of bulk, list or junk", value)
+	}
+
+	if m.Headers == nil {
+		m.Headers = textproto.MIMEHeader{}
+	}
+	m.Headers.Set(HdrPrecedence, value)
+	return nil
+}
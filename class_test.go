@@ -0,0 +1,110 @@
+package postal
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"testing"
+)
+
+func TestMessageClass(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+		Class:     ClassTransactional,
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get(HdrPostalTag); got != "transactional" {
+		t.Fatalf("expected tag transactional, got %q", got)
+	}
+
+	// An explicit tag header takes precedence.
+	msg.Headers = textproto.MIMEHeader{HdrPostalTag: {"password-reset"}}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	m, err = mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header[HdrPostalTag]; len(got) != 1 || got[0] != "password-reset" {
+		t.Fatalf("expected tag password-reset, got %q", got)
+	}
+}
+
+func TestMessageClassStructured(t *testing.T) {
+	var req structuredRequest
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithStructuredSend())
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+		Class:     ClassBulk,
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if req.Tag != "bulk" {
+		t.Fatalf("expected tag bulk, got %q", req.Tag)
+	}
+	if _, ok := req.Headers[HdrPostalTag]; ok {
+		t.Fatal("tag shouldn't be sent as a header")
+	}
+}
+
+func TestSetPrecedence(t *testing.T) {
+	var msg Message
+	if err := msg.SetPrecedence("Bulk"); err != nil {
+		t.Fatalf("error setting precedence: %v", err)
+	}
+	if got := msg.Headers.Get(HdrPrecedence); got != PrecedenceBulk {
+		t.Fatalf("expected precedence bulk, got %q", got)
+	}
+
+	if err := msg.SetPrecedence("first-class"); err == nil {
+		t.Fatal("expected an error for an invalid precedence")
+	}
+	if got := msg.Headers.Get(HdrPrecedence); got != PrecedenceBulk {
+		t.Fatalf("invalid precedence replaced the header: %q", got)
+	}
+}
+
+func TestMessageIPPool(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+		IPPool:    "warmup",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get(HdrPostalIPPool); got != "warmup" {
+		t.Fatalf("expected ip pool warmup, got %q", got)
+	}
+}
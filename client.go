@@ -2,16 +2,29 @@ package postal
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime"
+	"net"
 	"net/http"
+	"net/mail"
 	"net/textproto"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+	"unicode"
 
 	"github.com/knadh/smtppool"
 )
@@ -25,6 +38,10 @@ const (
 	contentEncBase64           = "base64"
 )
 
+// defaultAPIVersion is the version of postal's API used unless set with
+// WithAPIVersion.
+const defaultAPIVersion = "v1"
+
 // Message is the email which needs to be sent.
 type Message struct {
 	To        []string
@@ -38,62 +55,401 @@ type Message struct {
 	HTMLBody  string
 	Headers   textproto.MIMEHeader
 
+	// Class is sent to postal as the message's tag, unless the message has
+	// an X-Postal-Tag header or a Tag. See MessageClass.
+	Class MessageClass
+
+	// Tag is the tag postal files the message under, which its web UI and
+	// webhooks show and filter messages by. It's sent in the X-Postal-Tag
+	// header, which postal reads the tag of raw messages from, and as the
+	// tag of structured sends, unless Headers already has one.
+	Tag string
+
+	// Bounce tells postal the message is a bounce, such as a delivery status
+	// notification relayed through it, so it's treated as one: it isn't
+	// itself bounced back, and shows as a bounce in postal. See SendBounce
+	// for building and sending one.
+	Bounce bool
+
+	// IPPool is a hint of the IP pool the message should be sent from. It's
+	// sent in the X-Postal-IP-Pool header, unless the message already has
+	// one.
+	//
+	// Postal's API has no way to pick the IP pool of a message: a server
+	// sends from its default pool, or from the pool its IP pool rules pick
+	// for the sender or recipient. The header is only a convention for
+	// tooling around postal, such as a relay in front of it; to separate
+	// traffic by pool in postal itself, send it through servers with
+	// different pools.
+	IPPool string
+
+	// SenderHeader controls when the Sender header is written, and whether
+	// Sender is the envelope sender. See SenderHeaderMode.
+	SenderHeader SenderHeaderMode
+
+	// ContentLanguage is the language of the message, a BCP 47 tag such as
+	// "en" or "pt-BR", sent in the Content-Language header unless Headers
+	// already has one.
+	ContentLanguage string
+
+	// ThreadID identifies the thread the message belongs to for the client's
+	// thread tracker, see WithThreadTracker.
+	ThreadID string
+
+	// UnsubscribeURL is the link with which the recipient unsubscribes,
+	// which the client's unsubscribe footer is rendered with, see
+	// WithUnsubscribeFooter.
+	UnsubscribeURL string
+
+	// Sandbox sends the message to the client's sandbox recipient instead of
+	// its recipients, see WithSandboxRecipient.
+	Sandbox bool
+
+	// ForceRaw and ForceStructured send the message using postal's raw or
+	// structured send endpoint, whichever the client uses for other
+	// messages, for example to send an externally signed message unchanged
+	// from a client using WithStructuredSend. Setting both fails with
+	// ErrConflictingEndpoints.
+	ForceRaw        bool
+	ForceStructured bool
+
+	// EnvelopeTo, if set, are the envelope recipients of the message, which
+	// postal delivers it to, in place of the addresses in To, Cc and Bcc.
+	// The headers are still written from To and Cc, so the message can be
+	// delivered to addresses it doesn't show, or not delivered to addresses
+	// it does; Bcc is then unused. Recipient rewriting, redirection and
+	// sandboxing apply to EnvelopeTo like they do to the other recipients.
+	//
+	// Only the raw send endpoint takes envelope recipients: structured sends
+	// of messages with EnvelopeTo fail with ErrEnvelopeStructured.
+	EnvelopeTo []string
+
 	// Attachments
-	attachments []attachment
+	attachments []Attachment
 }
 
 // Attach creates an attachment in the message.
 // `headers` is optional. If given, it will add the headers to the attachment.
+// If contentType is empty, it's guessed from the filename's extension or else
+// from the content.
 func (m *Message) Attach(r io.Reader, filename string, contentType string, headers textproto.MIMEHeader) error {
+	at, err := newAttachment(r, filename, contentType, "attachment")
+	if err != nil {
+		return err
+	}
+
+	for key, val := range headers {
+		for _, v := range val {
+			at.Header.Set(key, v)
+		}
+	}
+
+	m.attachments = append(m.attachments, at)
+	return nil
+}
+
+// ErrAttachmentTooLarge is returned by AttachLimited when the attachment is
+// larger than the limit.
+var ErrAttachmentTooLarge = errors.New("postal: attachment too large")
+
+// AttachLimited is like Attach, but reads at most maxBytes from r. If r has
+// more than maxBytes, it fails with ErrAttachmentTooLarge rather than
+// attaching a truncated file. Use it for attachments from untrusted sources.
+func (m *Message) AttachLimited(r io.Reader, filename string, contentType string, maxBytes int64) error {
+	at, err := newAttachment(io.LimitReader(r, maxBytes+1), filename, contentType, "attachment")
+	if err != nil {
+		return err
+	}
+	if int64(len(at.Content)) > maxBytes {
+		return fmt.Errorf("%w: %s is over %d bytes", ErrAttachmentTooLarge, filename, maxBytes)
+	}
+
+	m.attachments = append(m.attachments, at)
+	return nil
+}
+
+// AttachInline attaches a file which is referenced by the HTML body, like an
+// image, to the message. The HTML can refer to it by its filename as
+// `cid:<filename>`.
+//
+// Inline attachments are grouped with the HTML body in a multipart/related
+// part, so the message must have an HTML body.
+func (m *Message) AttachInline(r io.Reader, filename string, contentType string) (Attachment, error) {
+	at, err := newAttachment(r, filename, contentType, "inline")
+	if err != nil {
+		return Attachment{}, err
+	}
+	at.HTMLRelated = true
+
+	m.attachments = append(m.attachments, at)
+	return at, nil
+}
+
+// AttachInlineCID is like AttachInline, but sets the attachment's
+// Content-ID to cid, with or without its angle brackets, so the HTML can
+// refer to it as `cid:<cid>` whatever its filename. Use it for inline
+// attachments which may share a filename; see WithStrictContentIDs to catch
+// those which still collide.
+func (m *Message) AttachInlineCID(r io.Reader, filename string, contentType string, cid string) (Attachment, error) {
+	cid = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(cid), "<"), ">")
+	if cid == "" || strings.ContainsAny(cid, "<> \t\r\n") {
+		return Attachment{}, fmt.Errorf("invalid content id %q for %s", cid, filename)
+	}
+
+	at, err := newAttachment(r, filename, contentType, "inline")
+	if err != nil {
+		return Attachment{}, err
+	}
+	at.HTMLRelated = true
+	at.Header.Set(HdrContentID, "<"+cid+">")
+
+	m.attachments = append(m.attachments, at)
+	return at, nil
+}
+
+// AttachBase64 attaches content which is already base64 encoded, decoding it
+// as it's read. Line breaks in encoded are ignored.
+func (m *Message) AttachBase64(encoded string, filename string, contentType string) (Attachment, error) {
+	at, err := newAttachment(base64.NewDecoder(base64.StdEncoding, strings.NewReader(encoded)), filename, contentType, "attachment")
+	if err != nil {
+		return Attachment{}, fmt.Errorf("error decoding base64 attachment %s: %w", filename, err)
+	}
+
+	m.attachments = append(m.attachments, at)
+	return at, nil
+}
+
+// AttachCompressed attaches the content of r gzipped, as filename with a .gz
+// extension and the application/gzip content type. Mail clients open .gz
+// files directly; use it for large text attachments such as logs or CSVs,
+// which compress well.
+func (m *Message) AttachCompressed(r io.Reader, filename string) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	// The gzip header can only hold Latin-1 names.
+	if name := sanitizeFilename(filename); isLatin1(name) {
+		zw.Name = name
+	}
+	if _, err := io.Copy(zw, r); err != nil {
+		return fmt.Errorf("error compressing attachment %s: %w", filename, err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("error compressing attachment %s: %w", filename, err)
+	}
+
+	at, err := newAttachment(&buf, filename+".gz", "application/gzip", "attachment")
+	if err != nil {
+		return err
+	}
+	m.attachments = append(m.attachments, at)
+	return nil
+}
+
+// newAttachment reads r into an attachment with the given disposition.
+func newAttachment(r io.Reader, filename string, contentType string, disposition string) (Attachment, error) {
 	var buffer bytes.Buffer
 	if _, err := io.Copy(&buffer, r); err != nil {
-		return err
+		return Attachment{}, err
 	}
 
-	at := attachment{
+	filename = sanitizeFilename(filename)
+	at := Attachment{
 		Filename: filename,
-		Header:   textproto.MIMEHeader{},
 		Content:  buffer.Bytes(),
 	}
 
-	if contentType != "" {
-		at.Header.Set(HdrContentType, contentType)
-	} else {
-		at.Header.Set(HdrContentType, ContentTypeOctetStream)
+	if contentType == "" {
+		contentType = typeByExtension(filepath.Ext(filename))
+	}
+	if contentType == "" {
+		// DetectContentType falls back to application/octet-stream.
+		contentType = http.DetectContentType(at.Content)
 	}
+	at.Header = attachmentHeader(filename, contentType, disposition)
+	return at, nil
+}
 
-	at.Header.Set(HdrContentDisposition, fmt.Sprintf("attachment;\r\n filename=\"%s\"", filename))
-	at.Header.Set(HdrContentID, fmt.Sprintf("<%s>", filename))
-	at.Header.Set(HdrContentTransferEncoding, contentEncBase64)
+// attachmentHeader returns the header of an attachment with the given
+// sanitized filename, content type and disposition.
+func attachmentHeader(filename, contentType, disposition string) textproto.MIMEHeader {
+	hdr := textproto.MIMEHeader{}
+	hdr.Set(HdrContentType, contentType)
+	hdr.Set(HdrContentDisposition, formatDisposition(disposition, filename))
+	hdr.Set(HdrContentID, fmt.Sprintf("<%s>", filename))
+	hdr.Set(HdrContentTransferEncoding, contentEncBase64)
+	return hdr
+}
 
-	for key, val := range headers {
-		for _, v := range val {
-			at.Header.Set(key, v)
+// sanitizeFilename returns the base name of filename without control
+// characters, so a name from an untrusted source can't point outside the
+// directory it's saved to or break the headers it's written in.
+func sanitizeFilename(filename string) string {
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		filename = filename[i+1:]
+	}
+	filename = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
 		}
+		return r
+	}, filename))
+	if filename == "" || filename == "." || filename == ".." {
+		return "attachment"
 	}
+	return filename
+}
 
-	m.attachments = append(m.attachments, at)
-	return nil
+// formatDisposition returns the Content-Disposition header for an attachment
+// with the filename. Non-ASCII filenames are sent in a filename* parameter,
+// percent-encoded as in RFC 2231, after a plain filename parameter with the
+// non-ASCII characters replaced for clients which don't support RFC 2231.
+func formatDisposition(disposition, filename string) string {
+	ascii := strings.Map(func(r rune) rune {
+		if r > unicode.MaxASCII {
+			return '_'
+		}
+		return r
+	}, filename)
+	if ascii == filename {
+		return mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+	}
+
+	// FormatMediaType picks the RFC 2231 encoding itself for non-ASCII
+	// values.
+	extended := mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+	plain := mime.FormatMediaType(disposition, map[string]string{"filename": ascii})
+	return plain + extended[len(disposition):]
+}
+
+// isLatin1 reports whether s only has characters in ISO 8859-1.
+func isLatin1(s string) bool {
+	for _, r := range s {
+		if r > 0xff {
+			return false
+		}
+	}
+	return true
 }
 
+// ErrAttachmentOpen and ErrAttachmentRead are the kinds of the errors
+// returned by AttachFile when the file can't be opened or read. The errors
+// also wrap the os error, so errors.Is(err, fs.ErrNotExist) works too.
+var (
+	ErrAttachmentOpen = errors.New("postal: error opening attachment")
+	ErrAttachmentRead = errors.New("postal: error reading attachment")
+)
+
 // AttachFile attaches given file to the message.
-// This is a wrapper over Attach function.
+// This is a wrapper over Attach function. Text files are attached with a
+// UTF-8 charset unless their content type specifies another one.
 func (m *Message) AttachFile(filename string) error {
 	f, err := os.Open(filename)
 	if err != nil {
-		return err
+		return withKind(ErrAttachmentOpen, fmt.Errorf("error opening attachment %s: %w", filename, err))
 	}
 	defer f.Close()
 
-	ct := mime.TypeByExtension(filepath.Ext(filename))
+	ct := withTextCharset(typeByExtension(filepath.Ext(filename)))
 	basename := filepath.Base(filename)
-	return m.Attach(f, basename, ct, nil)
+	if err := m.Attach(f, basename, ct, nil); err != nil {
+		return withKind(ErrAttachmentRead, fmt.Errorf("error reading attachment %s: %w", filename, err))
+	}
+	return nil
 }
 
-type attachment struct {
-	Filename    string
-	Header      textproto.MIMEHeader
-	Content     []byte
+// AttachInlineFile attaches the given file inline, like AttachInline, so the
+// HTML can refer to it by its base name as `cid:<name>`, as in
+// `<img src="cid:logo.png">` for images/logo.png. Use AttachInlineCID to
+// refer to it by another Content-ID.
+func (m *Message) AttachInlineFile(filename string) (Attachment, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return Attachment{}, withKind(ErrAttachmentOpen, fmt.Errorf("error opening attachment %s: %w", filename, err))
+	}
+	defer f.Close()
+
+	at, err := m.AttachInline(f, filepath.Base(filename), withTextCharset(typeByExtension(filepath.Ext(filename))))
+	if err != nil {
+		return Attachment{}, withKind(ErrAttachmentRead, fmt.Errorf("error reading attachment %s: %w", filename, err))
+	}
+	return at, nil
+}
+
+// ErrNoMatchingFiles is returned by AttachDir when no file matches the
+// pattern.
+var ErrNoMatchingFiles = errors.New("postal: no matching files")
+
+// AttachError is returned by AttachDir when some of the files couldn't be
+// attached.
+type AttachError struct {
+	// Errors is the error for each file which couldn't be attached.
+	Errors map[string]error
+}
+
+func (e *AttachError) Error() string {
+	if len(e.Errors) == 0 {
+		return "error attaching files"
+	}
+	files := make([]string, 0, len(e.Errors))
+	for f := range e.Errors {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return fmt.Sprintf("error attaching %d files, first file %s: %v", len(files), files[0], e.Errors[files[0]])
+}
+
+// AttachDir attaches every file in dir whose name matches pattern, as in
+// filepath.Match, with AttachFile, and returns the attachments in the order
+// of the file names. Subdirectories are skipped. If no file matches, it
+// fails with ErrNoMatchingFiles; check for it with errors.Is if an empty
+// directory is fine.
+//
+// A file which can't be attached doesn't stop the others from being
+// attached: the attachments are returned along with an *AttachError holding
+// the error for each file which couldn't be.
+func (m *Message) AttachDir(dir string, pattern string) ([]Attachment, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return nil, fmt.Errorf("error matching files in %s: %w", dir, err)
+	}
+
+	var (
+		attached []Attachment
+		errs     = make(map[string]error)
+	)
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil {
+			errs[path] = err
+			continue
+		}
+		if info.IsDir() {
+			continue
+		}
+		if err := m.AttachFile(path); err != nil {
+			errs[path] = err
+			continue
+		}
+		attached = append(attached, m.attachments[len(m.attachments)-1])
+	}
+
+	if len(errs) > 0 {
+		return attached, &AttachError{Errors: errs}
+	}
+	if len(attached) == 0 {
+		return nil, fmt.Errorf("%w for %s in %s", ErrNoMatchingFiles, pattern, dir)
+	}
+	return attached, nil
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Filename string
+	Header   textproto.MIMEHeader
+	Content  []byte
+	// Source, if set, is what the content is read from when the message is
+	// built, in place of Content, see AttachSource.
+	Source      AttachmentSource
 	HTMLRelated bool
 }
 
@@ -102,9 +458,76 @@ type ResponseMessage struct {
 	Token string `json:"token"`
 }
 
+// accepted reports whether postal created a message for the recipient.
+func (m ResponseMessage) accepted() bool {
+	return m.ID != 0 && m.Token != ""
+}
+
 type Response struct {
 	MessageID string                     `json:"message_id"`
 	Messages  map[string]ResponseMessage `json:"messages"`
+
+	// RFCMessageID is the Message-ID header of the sent message, which is
+	// what webhook events and replies refer to the message by. Postal's
+	// MessageID is its own identifier for the send.
+	RFCMessageID string `json:"-"`
+}
+
+// ServerHost returns the host postal generated the message ID on, the part
+// of MessageID after the "@", such as "rp.postal.example.com". With several
+// postal servers behind a load balancer, it tells which one handled the
+// send. It's empty if MessageID isn't in that form.
+func (r Response) ServerHost() string {
+	i := strings.LastIndex(r.MessageID, "@")
+	if i < 0 {
+		return ""
+	}
+	return r.MessageID[i+1:]
+}
+
+// ResponseEntry is the message postal created for one recipient of a send.
+type ResponseEntry struct {
+	Recipient string
+	ID        int64
+	Token     string
+}
+
+// Entries returns the messages of the response as a slice sorted by
+// recipient.
+func (r Response) Entries() []ResponseEntry {
+	entries := make([]ResponseEntry, 0, len(r.Messages))
+	for rcpt, m := range r.Messages {
+		entries = append(entries, ResponseEntry{Recipient: rcpt, ID: m.ID, Token: m.Token})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Recipient < entries[j].Recipient
+	})
+	return entries
+}
+
+// AcceptedRecipients returns the recipients postal accepted the message for,
+// sorted. Compare it with the recipients sent to detect ones postal dropped.
+func (r Response) AcceptedRecipients() []string {
+	rcpts := make([]string, 0, len(r.Messages))
+	for rcpt, m := range r.Messages {
+		if m.accepted() {
+			rcpts = append(rcpts, rcpt)
+		}
+	}
+	sort.Strings(rcpts)
+	return rcpts
+}
+
+// AcceptedCount returns the number of recipients postal accepted the message
+// for.
+func (r Response) AcceptedCount() int {
+	n := 0
+	for _, m := range r.Messages {
+		if m.accepted() {
+			n++
+		}
+	}
+	return n
 }
 
 type request struct {
@@ -115,44 +538,836 @@ type request struct {
 }
 
 type response struct {
-	Status string   `json:"status"`
-	Time   float64  `json:"time"`
-	Data   Response `json:"data"`
+	Status string          `json:"status"`
+	Time   float64         `json:"time"`
+	Flags  json.RawMessage `json:"flags"`
+	Data   json.RawMessage `json:"data"`
+
+	// body is the raw body of the response.
+	body []byte
+	// requestSize is the size of the request's JSON body, in bytes.
+	requestSize int
+	// timing is the request's timing, if the client traces requests.
+	timing *RequestTiming
+	// tls is the state of the request's TLS connection, if it had one.
+	tls *tls.ConnectionState
+	// request is the request's JSON body, redacted for diagnostics.
+	request []byte
+}
+
+// errorData is the data postal sends along with an error status.
+type errorData struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
-// Client is the client for postal.
+// Client is the client for postal. Clients which don't talk to postal's API,
+// such as FileClient and SMTPClient, can't look up messages, and fail
+// GetMessageDetails with ErrNotSupported.
 type Client interface {
 	SendMessage(Message) (Response, error)
+	// GetMessageDetails fetches the status and details of the message with
+	// the given ID, from the Messages of a send's Response.
+	GetMessageDetails(id int64) (MessageDetails, error)
 }
 
 type ApiClient struct {
 	baseURI    string
 	token      string
+	authScheme string
 	httpClient *http.Client
+	// clientCerts are the TLS client certificates of the default http
+	// client.
+	clientCerts []tls.Certificate
+	// dialTimeout, tlsTimeout and headerTimeout are the timeouts of the
+	// default http client's transport, if they're not its defaults.
+	dialTimeout   time.Duration
+	tlsTimeout    time.Duration
+	headerTimeout time.Duration
+
+	// sourceHeader and source are added as a header to every message.
+	sourceHeader string
+	source       string
+
+	// stripBOM strips a leading UTF-8 BOM from the message bodies.
+	stripBOM bool
+	// normalizePlain normalizes whitespace in the plain text body.
+	normalizePlain bool
+	// plainFallback adds a plain text body to HTML only messages.
+	plainFallback bool
+
+	// maxAttachments is the maximum number of attachments on a message, or
+	// 0 for no limit.
+	maxAttachments int
+	// maxMessageSize is the maximum size of a message in bytes, or 0 for no
+	// limit. maxSizeFromServer replaces it with the server's limit when the
+	// client is created.
+	maxMessageSize    int64
+	maxSizeFromServer bool
+	// maxHeaderSize is the maximum size of a message's header in bytes, or 0
+	// for no limit.
+	maxHeaderSize int
+
+	// retention is how long postal keeps messages, see FullResult.LookupUntil.
+	retention time.Duration
+
+	// dkim signs raw messages, see WithDKIM.
+	dkim *dkimSigner
+
+	// unsubscribeTemplate is the unsubscribe footer added to messages with
+	// an unsubscribe URL, parsed into unsubscribeFooter.
+	unsubscribeTemplate string
+	unsubscribeFooter   *texttemplate.Template
+	// rejectEmpty rejects messages with empty attachments.
+	rejectEmpty bool
+	// strictCIDs rejects messages whose inline attachments share a
+	// Content-ID.
+	strictCIDs bool
+	// rawLineEndings is what SendRaw does with bare LF line endings.
+	rawLineEndings RawLineEndings
+	// requireSubject rejects messages without a subject.
+	requireSubject bool
+
+	// attachAllow and attachDeny are the lower cased content types and
+	// file extensions attachments must, or must not, have.
+	attachAllow []string
+	attachDeny  []string
+
+	// skipRemoved skips sends of messages whose recipients were all removed
+	// by rewriting, rather than failing them.
+	skipRemoved bool
+
+	// rcptValidator checks every recipient of a message before it's sent.
+	rcptValidator func(addr string) error
+	// preSend is called with every request right before it's sent.
+	preSend PreSendHook
+	// httpTrace is given the timing of every request, see WithHTTPTrace.
+	httpTrace func(ctx context.Context, timing RequestTiming)
+	// allowedFrom and allowedFromDomains are what a message's senders must
+	// match, and the lower cased domains they must be on.
+	allowedFrom        *regexp.Regexp
+	allowedFromDomains []string
+	// plainOnlyDomains are the lower cased domains whose recipients are
+	// sent plain-only copies, see SendSplitPlainOnly.
+	plainOnlyDomains []string
+
+	// retry is the policy for retrying failed requests.
+	retry RetryPolicy
+	// retryStatuses are the retryable response statuses, if they're not
+	// the default ones.
+	retryStatuses map[int]bool
+
+	// rateLimit and rateBurst configure limiter, which limits the rate of
+	// requests to postal.
+	rateLimit float64
+	rateBurst int
+	limiter   *rateLimiter
+
+	// breakerThreshold and breakerOpenDuration configure breaker, which
+	// stops requests to postal while it's failing.
+	breakerThreshold    int
+	breakerOpenDuration time.Duration
+	breaker             *circuitBreaker
+
+	// sendConcurrency is the number of messages SendStream sends at once.
+	sendConcurrency int
+	// maxConcurrency configures inFlight, which limits the number of
+	// requests to postal in flight at once.
+	maxConcurrency int
+	inFlight       semaphore
+
+	// stats counts the client's sends and requests, see Stats.
+	stats *clientStats
+	// async tracks the sends of SendAsync, see Flush.
+	async flushGroup
+
+	// errorBodyLimit is the maximum number of bytes of a response body
+	// included in error messages.
+	errorBodyLimit int
+
+	// dedup removes duplicate recipients from messages before sending them.
+	dedup bool
+
+	// rewriter and redirectTo change the recipients of every message, see
+	// WithAddressRewriter and WithRedirectAllTo.
+	rewriter   AddressRewriter
+	redirectTo string
+
+	// sandboxRcpt is the recipient of sandbox messages.
+	sandboxRcpt string
+
+	// boundary is the fixed prefix of multipart boundaries, see
+	// WithBoundary.
+	boundary string
+
+	// apiVersion is the version of postal's API in request paths.
+	apiVersion string
+	// requestFormat names the fields of raw send requests, see
+	// WithRequestFormat.
+	requestFormat RequestFormat
+
+	// domainsPath is the API path for listing domains.
+	domainsPath string
+
+	// limitsPath is the API path for fetching send limits.
+	limitsPath string
+
+	// defaultFrom and defaultSender are used for messages without a From or
+	// Sender.
+	defaultFrom   string
+	defaultSender string
+
+	// attachOnlyBody is the plain body of messages with only attachments,
+	// see WithAttachmentOnlyBody.
+	attachOnlyBody string
+
+	// mailer is the X-Mailer header added to every message.
+	mailer string
+
+	// threads tracks the last message of threads, see WithThreadTracker.
+	threads ThreadTracker
+
+	// suppressions is checked by SendIfNotSuppressed.
+	suppressions SuppressionList
+	// sendLog is the log of sends made with SendOnceWithin.
+	sendLog SendLog
+	// idempotency is the store of sends made with SendIdempotent.
+	idempotency IdempotencyStore
+
+	// structured sends messages using the structured send endpoint
+	// instead of the raw one.
+	structured bool
+
+	// wrapData wraps the base64 message data at 76 columns.
+	wrapData bool
+
+	clock Clock
+
+	// sniffTypes corrects the content types of mislabeled attachments.
+	sniffTypes bool
+	// perRecipient sends a message per recipient, see
+	// WithPerRecipientMessages.
+	perRecipient bool
+	// contentMD5 adds the Content-MD5 header to attachments.
+	contentMD5 bool
+	// transliterate sends attachment filenames transliterated to ASCII.
+	transliterate bool
+
+	// emailCustomizers are run on the email before it is built.
+	emailCustomizers []func(*smtppool.Email)
+
+	logger Logger
+	// correlation returns the correlation ID of a send's context, see
+	// WithCorrelationIDFromContext.
+	correlation func(context.Context) string
+
+	// archiver receives the body of postal's response to every send, see
+	// WithResponseArchiver. archiveMu keeps concurrent sends from
+	// interleaving their writes.
+	archiver  io.Writer
+	archiveMu sync.Mutex
+	// msgArchiver is called with every message sent, see
+	// WithMessageArchiver.
+	msgArchiver MessageArchiver
+
+	// skewThreshold is the clock skew with postal above which a warning is
+	// logged.
+	skewThreshold time.Duration
+
+	// versionHeader is the response header with the server's version, the
+	// last of which is serverVersion. See ServerVersion.
+	versionHeader string
+	versionMu     sync.Mutex
+	serverVersion string
 }
 
-// NewAPIClient returns a postal client which uses the API.
-func NewAPIClient(url, token string, httpClient *http.Client) (Client, error) {
-	return &ApiClient{
-		baseURI:    url,
-		token:      token,
-		httpClient: httpClient,
-	}, nil
+// NewAPIClient returns a postal client which uses the API. If httpClient is
+// nil, a client configured by the options, such as WithClientCertificate, is
+// used.
+func NewAPIClient(url, token string, httpClient *http.Client, opts ...Option) (*ApiClient, error) {
+	a := &ApiClient{
+		baseURI:       url,
+		token:         token,
+		httpClient:    httpClient,
+		clock:         realClock{},
+		mailer:        defaultMailer,
+		apiVersion:    defaultAPIVersion,
+		versionHeader: HdrPostalVersion,
+		retention:     DefaultMessageRetention,
+	}
+	for _, o := range opts {
+		o(a)
+	}
+
+	if a.apiVersion == "" || strings.ContainsAny(a.apiVersion, "/?#") {
+		return nil, fmt.Errorf("invalid api version: %q", a.apiVersion)
+	}
+	a.requestFormat = a.requestFormat.withDefaults()
+	if err := a.requestFormat.check(); err != nil {
+		return nil, err
+	}
+	if a.dkim != nil {
+		if err := a.dkim.init(); err != nil {
+			return nil, err
+		}
+	}
+	if a.unsubscribeTemplate != "" {
+		footer, err := parseUnsubscribeFooter(a.unsubscribeTemplate)
+		if err != nil {
+			return nil, err
+		}
+		a.unsubscribeFooter = footer
+	}
+	if a.boundary != "" {
+		if err := checkBoundary(a.boundary); err != nil {
+			return nil, err
+		}
+	}
+	if a.defaultFrom != "" {
+		if _, err := mail.ParseAddressList(a.defaultFrom); err != nil {
+			return nil, fmt.Errorf("invalid default from address %q: %v", a.defaultFrom, err)
+		}
+	}
+	if a.defaultSender != "" {
+		if _, err := mail.ParseAddress(a.defaultSender); err != nil {
+			return nil, fmt.Errorf("invalid default sender address %q: %v", a.defaultSender, err)
+		}
+	}
+	if a.authScheme != "" && (strings.ContainsAny(a.authScheme, " \t") || checkHeaderValue("Authorization", a.authScheme) != nil) {
+		return nil, fmt.Errorf("invalid auth scheme: %q", a.authScheme)
+	}
+	if a.mailer != "" {
+		if err := checkHeaderValue(HdrXMailer, a.mailer); err != nil {
+			return nil, err
+		}
+	}
+	timeouts := a.dialTimeout > 0 || a.tlsTimeout > 0 || a.headerTimeout > 0
+	if len(a.clientCerts) > 0 || timeouts {
+		if httpClient != nil && len(a.clientCerts) > 0 {
+			return nil, errors.New("client certificates can't be used with a custom http client, configure its transport instead")
+		}
+		if httpClient != nil {
+			return nil, errors.New("transport timeouts can't be used with a custom http client, configure its transport instead")
+		}
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		if len(a.clientCerts) > 0 {
+			transport.TLSClientConfig = &tls.Config{Certificates: a.clientCerts}
+		}
+		if a.dialTimeout > 0 {
+			transport.DialContext = (&net.Dialer{Timeout: a.dialTimeout, KeepAlive: 30 * time.Second}).DialContext
+		}
+		if a.tlsTimeout > 0 {
+			transport.TLSHandshakeTimeout = a.tlsTimeout
+		}
+		if a.headerTimeout > 0 {
+			transport.ResponseHeaderTimeout = a.headerTimeout
+		}
+		a.httpClient = &http.Client{Transport: transport}
+	}
+	if a.httpClient == nil {
+		a.httpClient = &http.Client{}
+	}
+	if a.rateLimit > 0 {
+		a.limiter = newRateLimiter(a.clock, a.rateLimit, a.rateBurst)
+	}
+	if a.maxConcurrency > 0 {
+		a.inFlight = make(semaphore, a.maxConcurrency)
+	}
+	a.stats = newClientStats()
+	if a.breakerThreshold > 0 {
+		a.breaker = newCircuitBreaker(a.clock, a.breakerThreshold, a.breakerOpenDuration, a.retryable)
+	}
+	if a.maxSizeFromServer {
+		a.loadMaxMessageSize()
+	}
+	return a, nil
 }
 
 // SendMessage sends the given message to postal.
+//
+// A successful response means postal has accepted the message into its
+// queue, not that it has been delivered. Use GetMessageDetails or
+// SendAndTrack to follow the delivery of the message.
+//
+// If postal accepts the message for only some of its recipients, the
+// response is returned along with a *PartialSuccessError listing the others.
 func (a *ApiClient) SendMessage(msg Message) (Response, error) {
+	return a.SendMessageContext(context.Background(), msg)
+}
+
+// SendMessageContext is like SendMessage, but the request to postal is bound
+// to the given context.
+func (a *ApiClient) SendMessageContext(ctx context.Context, msg Message) (Response, error) {
+	res, err := a.SendMessageFull(ctx, msg)
+	return res.Response, err
+}
+
+// SendOptions overrides the client's configuration for a single send. Empty
+// fields fall back to the client's configuration.
+type SendOptions struct {
+	// Token is the API token to authenticate the send with.
+	Token string
+	// BaseURL is the URL of the postal server to send to.
+	BaseURL string
+	// HTTPClient is the http client to send the request with, for example to
+	// send through a different proxy.
+	HTTPClient *http.Client
+	// Timeout bounds the send, including its retries, for example to give
+	// a message with large attachments more time. It replaces the http
+	// client's Timeout for this send.
+	Timeout time.Duration
+}
+
+// SendMessageWith is like SendMessageContext, but overrides the client's
+// configuration with opts for this send. This lets a single client send on
+// behalf of tenants with their own postal servers or tokens.
+func (a *ApiClient) SendMessageWith(ctx context.Context, msg Message, opts SendOptions) (Response, error) {
+	res, err := a.send(ctx, msg, opts)
+	return res.Response, err
+}
+
+// SendMessageFull is like SendMessageContext, but returns the response along
+// with metadata about the request.
+func (a *ApiClient) SendMessageFull(ctx context.Context, msg Message) (FullResult, error) {
+	return a.send(ctx, msg, SendOptions{})
+}
+
+// normalize returns the message as the client sends it: with its defaults
+// and unsubscribe footer, and its recipients rewritten and deduplicated.
+func (a *ApiClient) normalize(ctx context.Context, msg Message) Message {
+	return a.dedupRecipients(ctx, a.rewriteRecipients(a.withUnsubscribeFooter(a.withDefaults(msg))))
+}
+
+// send builds the message and sends it to postal, as a message per
+// recipient with WithPerRecipientMessages.
+func (a *ApiClient) send(ctx context.Context, msg Message, opts SendOptions) (FullResult, error) {
+	if a.perRecipient {
+		if copies := perRecipientCopies(msg); len(copies) > 1 {
+			return a.sendPerRecipient(ctx, copies, opts)
+		}
+	}
+	return a.sendMessage(ctx, msg, opts)
+}
+
+// sendMessage builds the message and sends it to postal.
+func (a *ApiClient) sendMessage(ctx context.Context, msg Message, opts SendOptions) (res FullResult, err error) {
+	defer func() { a.stats.recordSend(res.Skipped, err) }()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	msg, err = a.normalizeChecked(ctx, msg)
+	if err != nil {
+		if a.skipRemoved {
+			a.logf(ctx, "postal: skipped message %q: %v", msg.Subject, err)
+			return FullResult{Skipped: true}, nil
+		}
+		a.archiveMessage(ctx, msg, nil, Response{}, err)
+		return FullResult{}, err
+	}
+	msg = a.withCorrelationID(ctx, msg)
+	structured, err := a.useStructured(msg)
+	if err != nil {
+		a.archiveMessage(ctx, msg, nil, Response{}, err)
+		return FullResult{}, err
+	}
+	msg, err = a.threadMessage(ctx, msg)
+	if err != nil {
+		a.archiveMessage(ctx, msg, nil, Response{}, err)
+		return FullResult{}, err
+	}
+	ctx = a.withSentMessage(ctx, msg)
+
+	var raw []byte
+	if structured {
+		res, err = a.sendStructured(ctx, msg, opts)
+		res.Endpoint = EndpointStructured
+	} else {
+		res, raw, err = a.sendMIME(ctx, msg, opts)
+		res.Endpoint = EndpointRaw
+	}
+	a.recordThread(ctx, msg, res, err)
+	err = unauthorizedSender(err, msg.From)
+	a.archiveMessage(ctx, msg, raw, res.Response, err)
+	return res, err
+}
+
+// sendMIME builds the MIME message and sends it using the raw send endpoint.
+func (a *ApiClient) sendMIME(ctx context.Context, msg Message, opts SendOptions) (FullResult, []byte, error) {
+	raw, id, err := a.buildMIME(msg)
+	if err != nil {
+		return FullResult{}, nil, err
+	}
+	req, err := a.rawRequest(msg, raw)
+	if err != nil {
+		return FullResult{}, raw, err
+	}
+
+	res, err := a.sendRaw(ctx, opts, req)
+	if err != nil {
+		return FullResult{}, raw, err
+	}
+	res.RFCMessageID = id
+	res.SubmittedRecipients = req.To
+
+	if rejected := rejectedRecipients(res.Response, req.To); len(rejected) > 0 {
+		return res, raw, &PartialSuccessError{Rejected: rejected}
+	}
+	return res, raw, nil
+}
+
+// BuildSendRequest returns the JSON body SendMessage would post to postal for
+// the message, without sending it.
+//
+// Unless the message has a Message-ID header, a new one is generated on every
+// call, so the bodies of two calls for the same message differ in it.
+func (a *ApiClient) BuildSendRequest(msg Message) ([]byte, error) {
+	msg, err := a.normalizeChecked(context.Background(), msg)
+	if err != nil {
+		return nil, err
+	}
+	req, _, err := a.buildRequest(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	reqJson, err := json.Marshal(a.rawPayload(req))
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling request to json: %v", err)
+	}
+	return reqJson, nil
+}
+
+// buildRequest validates the message and builds the raw send request for it.
+// It also returns the Message-ID of the message.
+func (a *ApiClient) buildRequest(msg Message) (request, string, error) {
+	raw, id, err := a.buildMIME(msg)
+	if err != nil {
+		return request{}, "", err
+	}
+	req, err := a.rawRequest(msg, raw)
+	if err != nil {
+		return request{}, "", err
+	}
+	return req, id, nil
+}
+
+// rawRequest returns the request sending the raw message built from msg to
+// its envelope recipients.
+func (a *ApiClient) rawRequest(msg Message, raw []byte) (request, error) {
+	rcpts, err := envelopeRecipients(msg)
+	if err != nil {
+		return request{}, withKind(ErrInvalidMessage, err)
+	}
+	rcpts, err = a.sandboxRecipients(msg, rcpts)
+	if err != nil {
+		return request{}, err
+	}
+	from, err := envelopeSender(msg)
+	if err != nil {
+		return request{}, withKind(ErrInvalidMessage, err)
+	}
+
+	return request{
+		From:   from,
+		To:     rcpts,
+		Data:   a.encodeData(raw),
+		Bounce: msg.Bounce,
+	}, nil
+}
+
+// buildMIME validates the message and builds it as an RFC5322 message. It
+// also returns the Message-ID of the message.
+func (a *ApiClient) buildMIME(msg Message) ([]byte, string, error) {
+	if err := a.validate(msg); err != nil {
+		return nil, "", err
+	}
+
+	email := a.email(msg)
+	id, err := ensureMessageID(&email, a.clock.Now())
+	if err != nil {
+		return nil, "", err
+	}
+
+	b := a.mimeBuilder()
+	b.attachments = msg.attachments
+	rawMsg, err := b.build(&email)
+	if err != nil {
+		return nil, "", withKind(ErrInvalidMessage, fmt.Errorf("error building rfc 5322 message: %w", err))
+	}
+	if a.dkim != nil {
+		if rawMsg, err = a.dkim.sign(rawMsg, a.clock.Now()); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := a.checkSize(len(rawMsg)); err != nil {
+		return nil, "", err
+	}
+	header, _ := splitMessage(rawMsg)
+	if err := a.checkHeaderSize(len(header)); err != nil {
+		return nil, "", err
+	}
+	return rawMsg, id, nil
+}
+
+// envelopeRecipients returns the addresses of all the recipients of the
+// message, which is every address in EnvelopeTo if it's set, or else in To,
+// Cc and Bcc.
+func envelopeRecipients(msg Message) ([]string, error) {
+	lists := [][]string{msg.To, msg.Cc, msg.Bcc}
+	if len(msg.EnvelopeTo) > 0 {
+		lists = [][]string{msg.EnvelopeTo}
+	}
+
+	var rcpts []string
+	for _, list := range lists {
+		for _, r := range list {
+			addr, err := mail.ParseAddress(r)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing recipient %q: %v", r, err)
+			}
+			rcpts = append(rcpts, addr.Address)
+		}
+	}
+	return rcpts, nil
+}
+
+// encodeData base64 encodes the raw message for the data field of a request.
+func (a *ApiClient) encodeData(rawMsg []byte) string {
+	if !a.wrapData {
+		return base64.RawStdEncoding.EncodeToString(rawMsg)
+	}
+
+	var b strings.Builder
+	// Writes to a strings.Builder don't fail.
+	_ = base64Wrap(&b, rawMsg)
+	return strings.TrimSuffix(b.String(), "\r\n")
+}
+
+// sendRaw sends the request to postal's raw message endpoint.
+func (a *ApiClient) sendRaw(ctx context.Context, opts SendOptions, r request) (FullResult, error) {
+	return a.sendRequest(ctx, opts, a.apiPath("/send/raw"), a.rawPayload(r))
+}
+
+// sendRequest posts a send request to the given API path and decodes the
+// response.
+func (a *ApiClient) sendRequest(ctx context.Context, opts SendOptions, path string, payload interface{}) (FullResult, error) {
+	res, hdr, err := a.post(ctx, opts, path, payload)
+	a.archiveResponse(ctx, res, err)
+	if err != nil {
+		return FullResult{}, err
+	}
+	if err := errorFromResponse(res); err != nil {
+		return FullResult{}, err
+	}
+
+	full := FullResult{
+		Time:        res.Time,
+		RequestSize: res.requestSize,
+		Flags:       res.Flags,
+		Raw:         res.body,
+		ServerDate:  serverDate(hdr),
+		Received:    a.clock.Now(),
+		Timing:      res.timing,
+		TLS:         res.tls,
+	}
+	full.LookupUntil = full.Received.Add(a.retention)
+	full.RateLimit = rateLimitInfo(hdr, full.Received)
+	if err := json.Unmarshal(res.Data, &full.Response); err != nil {
+		return FullResult{}, withKind(ErrDecode, fmt.Errorf("error unmarshalling json from postal response: %v", err))
+	}
+	a.checkClockSkew(ctx, full)
+
+	return full, nil
+}
+
+// post sends the payload as JSON to the given API path and returns the
+// decoded response along with the response headers. Failed requests are
+// retried according to the client's retry policy, and every attempt waits for
+// the client's rate limit and concurrency limit.
+func (a *ApiClient) post(ctx context.Context, opts SendOptions, path string, payload interface{}) (response, http.Header, error) {
+	reqJson, err := json.Marshal(payload)
+	if err != nil {
+		return response{}, nil, fmt.Errorf("error marshalling request to json: %v", err)
+	}
+
+	var (
+		res     response
+		hdr     http.Header
+		lastErr error
+	)
+	for attempt := 1; ; attempt++ {
+		if a.breaker != nil {
+			if err := a.breaker.allow(); err != nil {
+				// A retry stopped by the breaker fails with the error
+				// which opened it.
+				if lastErr != nil {
+					return res, hdr, lastErr
+				}
+				return response{}, nil, err
+			}
+		}
+		if a.limiter != nil {
+			if err := a.limiter.wait(ctx); err != nil {
+				if a.breaker != nil {
+					a.breaker.record(err)
+				}
+				return response{}, nil, fmt.Errorf("error waiting for rate limit: %w", err)
+			}
+		}
+		if a.inFlight != nil {
+			if err := a.inFlight.acquire(ctx); err != nil {
+				if a.breaker != nil {
+					a.breaker.record(err)
+				}
+				return response{}, nil, fmt.Errorf("error waiting for a request slot: %w", err)
+			}
+		}
+
+		res, hdr, err = a.postOnce(ctx, opts, path, reqJson)
+		if a.inFlight != nil {
+			a.inFlight.release()
+		}
+		// The request wasn't sent, so there's nothing for the breaker to
+		// record nor to retry.
+		var hookErr *preSendError
+		if errors.As(err, &hookErr) {
+			if a.breaker != nil {
+				a.breaker.release()
+			}
+			return response{}, nil, err
+		}
+		if a.breaker != nil {
+			a.breaker.record(err)
+		}
+		lastErr = err
+		if err == nil || attempt >= a.retry.MaxAttempts || !a.retryable(err) {
+			return res, hdr, err
+		}
+
+		backoff := a.retry.backoff(attempt, err)
+		// There's no point in waiting if the context's deadline passes
+		// before the next attempt could be made. The deadline is in real
+		// time, whatever the client's clock.
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= backoff {
+			return res, hdr, err
+		}
+		if sleep(ctx, a.clock, backoff) != nil {
+			return res, hdr, err
+		}
+	}
+}
+
+// postOnce makes a single request to the given API path with the JSON body.
+func (a *ApiClient) postOnce(ctx context.Context, opts SendOptions, path string, reqJson []byte) (res response, _ http.Header, err error) {
+	baseURI := a.baseURI
+	if opts.BaseURL != "" {
+		baseURI = opts.BaseURL
+	}
+	token := a.token
+	if opts.Token != "" {
+		token = opts.Token
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint(baseURI, path), bytes.NewBuffer(reqJson))
+	if err != nil {
+		return response{}, nil, fmt.Errorf("error sending request to postal: %v", err)
+	}
+	a.setAuth(req, token)
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+	if id := a.correlationID(ctx); id != "" {
+		req.Header.Set(HdrCorrelationID, id)
+	}
+	if err := a.preSendHook(ctx, req); err != nil {
+		return response{}, nil, err
+	}
+	if a.httpTrace != nil {
+		tracer := newRequestTracer(a.clock, path)
+		req = req.WithContext(tracer.withTrace(req.Context()))
+		defer func() {
+			timing := tracer.done()
+			res.timing = &timing
+			a.httpTrace(ctx, timing)
+		}()
+	}
+
+	httpClient := a.httpClient
+	if opts.HTTPClient != nil {
+		httpClient = opts.HTTPClient
+	}
+	if opts.Timeout > 0 && httpClient.Timeout != 0 {
+		// The send's context has the timeout.
+		c := *httpClient
+		c.Timeout = 0
+		httpClient = &c
+	}
+	a.stats.recordRequest(len(reqJson))
+	resp, err := noRedirects(httpClient).Do(req)
+	if err != nil {
+		return response{}, nil, networkError(ctx, fmt.Errorf("error sending request to postal: %w", err))
+	}
+
+	defer resp.Body.Close()
+	a.stats.recordStatus(resp.StatusCode)
+	a.recordServerVersion(resp.Header)
+	if err := redirectError(resp); err != nil {
+		return response{}, nil, err
+	}
+	body, err := readBody(resp)
+	if err != nil {
+		return response{}, nil, networkError(ctx, fmt.Errorf("error reading body from postal response: %w", err))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return response{}, nil, statusError(resp.StatusCode, body, a.errorBodyLimit, redactRequest(reqJson, a.requestFormat.Data))
+	}
+
+	res = response{body: body, requestSize: len(reqJson), tls: resp.TLS, request: redactRequest(reqJson, a.requestFormat.Data)}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return response{}, nil, withKind(ErrDecode, fmt.Errorf("error unmarshalling json from postal response: %v", err))
+	}
+
+	return res, resp.Header, nil
+}
+
+// email maps the message into the smtppool.Email used to build the RFC2882
+// message. The client's email customizers are applied to the result.
+func (a *ApiClient) email(msg Message) smtppool.Email {
 	attachments := make([]smtppool.Attachment, 0, len(msg.attachments))
-	for _, ac := range msg.attachments {
+	for i, ac := range msg.attachments {
+		hdr := ac.Header
+		if hdr == nil {
+			hdr = textproto.MIMEHeader{}
+		}
+		if a.sniffTypes {
+			hdr = a.correctContentType(ac, hdr)
+		}
+		if a.contentMD5 {
+			hdr = withContentMD5(ac, hdr)
+		}
+		filename := ac.Filename
+		if a.transliterate {
+			filename, hdr = transliterateFilename(ac, hdr)
+		}
+		if ac.Source != nil {
+			marked := make(textproto.MIMEHeader, len(hdr)+1)
+			for k, v := range hdr {
+				marked[k] = v
+			}
+			marked.Set(hdrAttachmentSource, strconv.Itoa(i))
+			hdr = marked
+		}
 		attachments = append(attachments, smtppool.Attachment{
-			Filename:    ac.Filename,
-			Header:      ac.Header,
+			Filename:    filename,
+			Header:      hdr,
 			Content:     ac.Content,
 			HTMLRelated: ac.HTMLRelated,
 		})
 	}
 
-	// Format the message into RFC2882 message.
 	email := smtppool.Email{
 		ReplyTo:     msg.ReplyTo,
 		From:        msg.From,
@@ -160,54 +1375,117 @@ func (a *ApiClient) SendMessage(msg Message) (Response, error) {
 		Bcc:         msg.Bcc,
 		Cc:          msg.Cc,
 		Subject:     msg.Subject,
-		Text:        []byte(msg.PlainBody),
-		HTML:        []byte(msg.HTMLBody),
-		Sender:      msg.Sender,
-		Headers:     msg.Headers,
+		Text:        a.plainBody(a.plainText(msg)),
+		HTML:        a.body(msg.HTMLBody),
+		Sender:      headerSender(msg),
+		Headers:     a.headers(msg),
 		Attachments: attachments,
 	}
 
-	rawMsg, err := email.Bytes()
-	if err != nil {
-		return Response{}, fmt.Errorf("error converting email to rfc 2882 message: %v", err)
+	for _, c := range a.emailCustomizers {
+		c(&email)
 	}
+	return email
+}
 
-	reqJson, err := json.Marshal(request{
-		From:   msg.From,
-		To:     msg.To,
-		Data:   base64.RawStdEncoding.EncodeToString(rawMsg),
-		Bounce: false,
-	})
-	if err != nil {
-		return Response{}, fmt.Errorf("error marshalling request to json: %v", err)
+// endpoint returns the full URL for the given API path on the client's
+// postal server.
+func (a *ApiClient) endpoint(path string) string {
+	return endpoint(a.baseURI, path)
+}
+
+// readBody reads the body of the response. http.Transport asks for gzip
+// compressed responses and decompresses them itself; responses which are
+// still compressed, from transports which don't, are decompressed here.
+func readBody(resp *http.Response) ([]byte, error) {
+	if resp.Uncompressed || !strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") {
+		return io.ReadAll(resp.Body)
 	}
 
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s/api/v1/send/raw", strings.TrimSuffix(a.baseURI, "/")), bytes.NewBuffer(reqJson))
+	zr, err := gzip.NewReader(resp.Body)
 	if err != nil {
-		return Response{}, fmt.Errorf("error sending request to postal: %v", err)
+		return nil, err
 	}
-	req.Header.Add("X-Server-API-Key", a.token)
-	req.Header.Add("Content-Type", "application/json")
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
 
-	resp, err := a.httpClient.Do(req)
-	if err != nil {
-		return Response{}, fmt.Errorf("error sending request to postal: %v", err)
+// noRedirects returns c, or a copy of it which doesn't follow redirects if
+// it has no redirect policy of its own. Following a redirect would turn the
+// request into a GET without a body, or send it to another host without
+// the API key, either of which postal rejects in confusing ways.
+func noRedirects(c *http.Client) *http.Client {
+	if c.CheckRedirect != nil {
+		return c
+	}
+	nc := *c
+	nc.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
 	}
+	return &nc
+}
 
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return Response{}, fmt.Errorf("error reading body from postal response: %v", err)
+// redirectError returns an error pointing to the new location if postal
+// responded with a redirect.
+func redirectError(resp *http.Response) error {
+	loc, err := resp.Location()
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 || err != nil {
+		return nil
 	}
+	return fmt.Errorf("%w to %s (%s), the client's base URL should be changed to it", ErrRedirected, loc, resp.Status)
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return Response{}, fmt.Errorf("error sending message to postal, status code: %d, error: %s", resp.StatusCode, body)
+// setAuth adds the token to the request, see WithAuthScheme.
+func (a *ApiClient) setAuth(req *http.Request, token string) {
+	if a.authScheme != "" {
+		req.Header.Set("Authorization", a.authScheme+" "+token)
+		return
 	}
+	req.Header.Set("X-Server-API-Key", token)
+}
 
-	r := response{}
-	if err := json.Unmarshal(body, &r); err != nil {
-		return Response{}, fmt.Errorf("error unmarshalling json from postal response: %v", err)
+// apiPath returns the path of an endpoint of the client's version of the
+// API, such as "/send/raw".
+func (a *ApiClient) apiPath(path string) string {
+	return "/api/" + a.apiVersion + path
+}
+
+// endpoint returns the full URL for the given API path on the postal server
+// at baseURI.
+func endpoint(baseURI, path string) string {
+	return fmt.Sprintf("%s%s", strings.TrimSuffix(baseURI, "/"), path)
+}
+
+// headers returns the headers of the message along with the headers the
+// client adds to every message. The message's headers aren't modified.
+func (a *ApiClient) headers(msg Message) textproto.MIMEHeader {
+	hdr := make(textproto.MIMEHeader, len(msg.Headers)+5)
+	for k, v := range msg.Headers {
+		hdr[k] = v
 	}
 
-	return r.Data, nil
+	if a.source != "" && hdr.Get(a.sourceHeader) == "" {
+		hdr.Set(a.sourceHeader, a.source)
+	}
+	if msg.Tag != "" && hdr.Get(HdrPostalTag) == "" {
+		hdr.Set(HdrPostalTag, msg.Tag)
+	}
+	if msg.Class != "" && hdr.Get(HdrPostalTag) == "" {
+		hdr.Set(HdrPostalTag, string(msg.Class))
+	}
+	if msg.IPPool != "" && hdr.Get(HdrPostalIPPool) == "" {
+		hdr.Set(HdrPostalIPPool, msg.IPPool)
+	}
+	if msg.ContentLanguage != "" && hdr.Get(HdrContentLanguage) == "" {
+		hdr.Set(HdrContentLanguage, msg.ContentLanguage)
+	}
+	if msg.SenderHeader == SenderHeaderAlways && msg.Sender != "" && hdr.Get(HdrSender) == "" {
+		if addr, err := mail.ParseAddress(msg.Sender); err == nil {
+			hdr.Set(HdrSender, addr.String())
+		}
+	}
+	if a.mailer != "" && hdr.Get(HdrXMailer) == "" {
+		hdr.Set(HdrXMailer, a.mailer)
+	}
+	return hdr
 }
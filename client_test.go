@@ -1,8 +1,20 @@
 package postal
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/textproto"
 	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -14,7 +26,101 @@ var (
 	toAddr      = os.Getenv("POSTAL_TO")
 )
 
+// requirePostal skips tests against a real postal server unless one is
+// configured with POSTAL_ADDR.
+func requirePostal(t *testing.T) {
+	t.Helper()
+	if postalAddr == "" {
+		t.Skip("POSTAL_ADDR isn't set")
+	}
+}
+
+// newTestClient returns a client which talks to a test server serving h.
+func newTestClient(t *testing.T, h http.HandlerFunc, opts ...Option) *ApiClient {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	client, err := NewAPIClient(srv.URL, "test-token", srv.Client(), opts...)
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+	return client
+}
+
+// recorder records the requests sent to the raw send endpoint and replies
+// with a successful response.
+type recorder struct {
+	mu   sync.Mutex
+	reqs []request
+}
+
+func (rec *recorder) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := request{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+
+		rec.mu.Lock()
+		rec.reqs = append(rec.reqs, req)
+		rec.mu.Unlock()
+
+		w.Write(successResponse("abc@postal", req.To))
+	}
+}
+
+// successResponse returns postal's response to a successful send to rcpts.
+func successResponse(messageID string, rcpts []string) []byte {
+	msgs := make(map[string]ResponseMessage, len(rcpts))
+	for i, r := range rcpts {
+		msgs[r] = ResponseMessage{ID: int64(i + 1), Token: fmt.Sprintf("token%d", i+1)}
+	}
+
+	data, _ := json.Marshal(Response{MessageID: messageID, Messages: msgs})
+	return []byte(`{"status":"success","time":0.1,"data":` + string(data) + `}`)
+}
+
+// last returns the raw message of the last recorded request.
+func (rec *recorder) last(t *testing.T) []byte {
+	t.Helper()
+
+	rec.mu.Lock()
+	n := len(rec.reqs)
+	rec.mu.Unlock()
+	if n == 0 {
+		t.Fatal("no requests recorded")
+	}
+	return rec.raw(t, n-1)
+}
+
+// raw returns the raw message of the i-th recorded request.
+func (rec *recorder) raw(t *testing.T, i int) []byte {
+	t.Helper()
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	// The data may be wrapped and padded, see WithWrappedData.
+	data := strings.TrimRight(strings.ReplaceAll(rec.reqs[i].Data, "\r\n", ""), "=")
+	raw, err := base64.RawStdEncoding.DecodeString(data)
+	if err != nil {
+		t.Fatalf("error decoding message data: %v", err)
+	}
+	return raw
+}
+
+// newRecordingClient returns a client along with the recorder of its sends.
+func newRecordingClient(t *testing.T, opts ...Option) (*ApiClient, *recorder) {
+	t.Helper()
+
+	rec := &recorder{}
+	return newTestClient(t, rec.handler(t), opts...), rec
+}
+
 func TestSend(t *testing.T) {
+	requirePostal(t)
 	client, err := NewAPIClient(postalAddr, postalToken, &http.Client{
 		Timeout: 10 * time.Second,
 	})
@@ -38,3 +144,274 @@ func TestSend(t *testing.T) {
 	}
 	t.Logf("resp: %v", resp)
 }
+
+func TestSendMessageWith(t *testing.T) {
+	var defaultHits, tenantHits int
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		defaultHits++
+		if got := r.Header.Get("X-Server-API-Key"); got != "test-token" {
+			t.Errorf("expected default token, got %q", got)
+		}
+		w.Write(successResponse("default", []string{"to@example.com"}))
+	})
+
+	tenant := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenantHits++
+		if got := r.Header.Get("X-Server-API-Key"); got != "tenant-token" {
+			t.Errorf("expected tenant token, got %q", got)
+		}
+		w.Write(successResponse("tenant", []string{"to@example.com"}))
+	}))
+	defer tenant.Close()
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+
+	resp, err := client.SendMessageWith(context.Background(), msg, SendOptions{
+		Token:   "tenant-token",
+		BaseURL: tenant.URL + "/",
+	})
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if resp.MessageID != "tenant" {
+		t.Fatalf("expected message to be sent to the tenant's server, got %s", resp.MessageID)
+	}
+
+	// Empty options fall back to the client's configuration.
+	resp, err = client.SendMessageWith(context.Background(), msg, SendOptions{})
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if resp.MessageID != "default" {
+		t.Fatalf("expected message to be sent to the default server, got %s", resp.MessageID)
+	}
+
+	if defaultHits != 1 || tenantHits != 1 {
+		t.Fatalf("unexpected hits, default: %d, tenant: %d", defaultHits, tenantHits)
+	}
+}
+
+func TestBuildSendRequest(t *testing.T) {
+	client, rec := newRecordingClient(t, WithClock(newFakeClock()))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		Cc:        []string{"Cc <cc@example.com>"},
+		PlainBody: "hello",
+		Headers:   textproto.MIMEHeader{"Message-Id": {"<fixed@example.com>"}},
+	}
+
+	body, err := client.BuildSendRequest(msg)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	var built request
+	if err := json.Unmarshal(body, &built); err != nil {
+		t.Fatalf("error decoding built request: %v", err)
+	}
+
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if !reflect.DeepEqual(built, rec.reqs[0]) {
+		t.Fatalf("built request differs from the sent one:\nbuilt: %+v\nsent:  %+v", built, rec.reqs[0])
+	}
+	if want := []string{"to@example.com", "cc@example.com"}; !reflect.DeepEqual(built.To, want) {
+		t.Fatalf("expected rcpt_to %v, got %v", want, built.To)
+	}
+}
+
+func TestResponseEntries(t *testing.T) {
+	resp := Response{Messages: map[string]ResponseMessage{
+		"c@example.com": {ID: 3, Token: "c"},
+		"a@example.com": {ID: 1, Token: "a"},
+		"b@example.com": {ID: 2, Token: "b"},
+	}}
+
+	want := []ResponseEntry{
+		{Recipient: "a@example.com", ID: 1, Token: "a"},
+		{Recipient: "b@example.com", ID: 2, Token: "b"},
+		{Recipient: "c@example.com", ID: 3, Token: "c"},
+	}
+	if got := resp.Entries(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected entries: %+v", got)
+	}
+	if got := (Response{}).Entries(); len(got) != 0 {
+		t.Fatalf("expected no entries, got %+v", got)
+	}
+}
+
+func TestResponseAcceptedRecipients(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","time":0.1,"flags":{},"data":{"message_id":"abc@postal","messages":{` +
+			`"b@example.com":{"id":2,"token":"b"},"a@example.com":{"id":1,"token":"a"},"c@example.com":{"id":0,"token":""}}}}`))
+	})
+
+	resp, err := client.SendMessage(Message{
+		From:      "from@example.com",
+		To:        []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"},
+		PlainBody: "hello",
+	})
+	var partial *PartialSuccessError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected a PartialSuccessError, got %v", err)
+	}
+	if got := resp.AcceptedCount(); got != 2 {
+		t.Fatalf("expected 2 accepted recipients, got %d", got)
+	}
+	if got := resp.AcceptedRecipients(); !reflect.DeepEqual(got, []string{"a@example.com", "b@example.com"}) {
+		t.Fatalf("unexpected accepted recipients %v", got)
+	}
+	if got := (Response{}).AcceptedRecipients(); len(got) != 0 || (Response{}).AcceptedCount() != 0 {
+		t.Fatalf("expected no accepted recipients, got %v", got)
+	}
+}
+
+func TestResponseServerHost(t *testing.T) {
+	tests := []struct {
+		messageID string
+		want      string
+	}{
+		{"e6c25f7b-0b97-4c1e-a8d3-0d8f3e1a2b3c@rp.postal.example.com", "rp.postal.example.com"},
+		{"abc", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := (Response{MessageID: tt.messageID}).ServerHost(); got != tt.want {
+			t.Errorf("ServerHost of %q = %q, want %q", tt.messageID, got, tt.want)
+		}
+	}
+}
+
+// countingTransport counts the requests made through it.
+type countingTransport struct {
+	n int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.n++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestSendMessageWithHTTPClient(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	transport := &countingTransport{}
+	if _, err := client.SendMessageWith(context.Background(), msg, SendOptions{HTTPClient: &http.Client{Transport: transport}}); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if _, err := client.SendMessageWith(context.Background(), msg, SendOptions{}); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	if transport.n != 1 {
+		t.Fatalf("expected 1 request through the override client, got %d", transport.n)
+	}
+	if len(rec.reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(rec.reqs))
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	var calls int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}))
+	t.Cleanup(target.Close)
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+r.URL.Path, http.StatusMovedPermanently)
+	})
+
+	_, err := client.SendMessage(Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	})
+	if !errors.Is(err, ErrRedirected) || !strings.Contains(err.Error(), target.URL+"/api/v1/send/raw") {
+		t.Fatalf("expected ErrRedirected pointing to the new location, got %v", err)
+	}
+	if IsRetryable(err) {
+		t.Fatal("a redirect shouldn't be retryable")
+	}
+	if atomic.LoadInt32(&calls) != 0 {
+		t.Fatal("expected the redirect not to be followed")
+	}
+}
+
+func TestSendMessageWithTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}))
+	t.Cleanup(srv.Close)
+
+	httpClient := srv.Client()
+	httpClient.Timeout = 20 * time.Millisecond
+	client, err := NewAPIClient(srv.URL, "test-token", httpClient)
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	if _, err := client.SendMessage(msg); err == nil {
+		t.Fatal("expected the client's timeout to fail the send")
+	}
+	if _, err := client.SendMessageWith(context.Background(), msg, SendOptions{Timeout: 5 * time.Second}); err != nil {
+		t.Fatalf("expected the longer timeout to override the client's: %v", err)
+	}
+	if _, err := client.SendMessageWith(context.Background(), msg, SendOptions{Timeout: 10 * time.Millisecond}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+	if httpClient.Timeout != 20*time.Millisecond {
+		t.Fatal("the http client was modified")
+	}
+}
+
+func TestGzipResponse(t *testing.T) {
+	var accept string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		// The response is compressed even though the transport below
+		// doesn't ask for it, as it wouldn't decompress it.
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write(successResponse("abc@postal", []string{"to@example.com"}))
+		zw.Close()
+	}))
+	t.Cleanup(srv.Close)
+
+	client, err := NewAPIClient(srv.URL, "test-token", &http.Client{Transport: &http.Transport{DisableCompression: true}})
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+	resp, err := client.SendMessage(Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	})
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if resp.MessageID != "abc@postal" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if accept != "application/json" {
+		t.Fatalf("expected Accept: application/json, got %q", accept)
+	}
+}
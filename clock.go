@@ -0,0 +1,43 @@
+package postal
+
+import (
+	"context"
+	"time"
+)
+
+// Clock is the source of time used by the client for anything time based,
+// such as waiting between retries. It can be replaced using WithClock to
+// make such behaviour deterministic in tests.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After waits for the duration to elapse and then sends the current time
+	// on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// sleep waits for d to elapse on the clock. It returns early with the
+// context's error if it's done before that.
+func sleep(ctx context.Context, c Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	select {
+	case <-c.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
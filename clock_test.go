@@ -0,0 +1,142 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock which only moves when advanced.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the clock forward, firing any waiters which are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if !w.at.After(c.now) {
+			w.ch <- c.now
+			continue
+		}
+		waiters = append(waiters, w)
+	}
+	c.waiters = waiters
+}
+
+// Waiters returns the number of pending waiters.
+func (c *fakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// waitForWaiters blocks until the clock has n pending waiters.
+func (c *fakeClock) waitForWaiters(t *testing.T, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for c.Waiters() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d waiters", n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSleep(t *testing.T) {
+	clock := newFakeClock()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sleep(context.Background(), clock, time.Minute)
+	}()
+
+	clock.waitForWaiters(t, 1)
+	clock.Advance(30 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("sleep returned before the duration elapsed")
+	default:
+	}
+
+	clock.Advance(30 * time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error from sleep: %v", err)
+	}
+}
+
+func TestSleepContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := sleep(ctx, newFakeClock(), time.Hour); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestClockDatesAndMessageIDs(t *testing.T) {
+	clock := newFakeClock()
+	client, rec := newRecordingClient(t, WithClock(clock))
+	wantDate := clock.Now().Format(time.RFC1123Z)
+	wantID := fmt.Sprintf("<%d.", clock.Now().UnixNano())
+
+	if _, err := client.SendMessage(Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if _, err := client.SendBounce(context.Background(), "sender@remote.com", []byte("To: user@example.com\r\n\r\nhello")); err != nil {
+		t.Fatalf("error sending bounce: %v", err)
+	}
+
+	for i := range rec.reqs {
+		m, err := mail.ReadMessage(bytes.NewReader(rec.raw(t, i)))
+		if err != nil {
+			t.Fatalf("error parsing message %d: %v", i, err)
+		}
+		if got := m.Header.Get("Date"); got != wantDate {
+			t.Fatalf("expected Date %q from the clock for message %d, got %q", wantDate, i, got)
+		}
+		if got := m.Header.Get("Message-Id"); !strings.HasPrefix(got, wantID) {
+			t.Fatalf("expected a Message-ID from the clock for message %d, got %q", i, got)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ConnectionStatus is the outcome of validating the connection to postal.
+type ConnectionStatus int
+
+const (
+	// ConnectionOK means the token is valid and is allowed to send.
+	ConnectionOK ConnectionStatus = iota
+	// ConnectionInvalidToken means postal didn't recognize the token.
+	ConnectionInvalidToken
+	// ConnectionForbidden means the token is valid, but isn't allowed to send.
+	ConnectionForbidden
+)
+
+func (s ConnectionStatus) String() string {
+	switch s {
+	case ConnectionOK:
+		return "ok"
+	case ConnectionInvalidToken:
+		return "invalid token"
+	case ConnectionForbidden:
+		return "forbidden"
+	}
+	return fmt.Sprintf("ConnectionStatus(%d)", int(s))
+}
+
+// Postal error codes returned when authentication fails.
+const (
+	codeAccessDenied        = "AccessDenied"
+	codeInvalidServerAPIKey = "InvalidServerAPIKey"
+	codeServerSuspended     = "ServerSuspended"
+)
+
+// ConnectionResult is the result of ValidateConnection.
+type ConnectionResult struct {
+	Status ConnectionStatus
+
+	// Code and Message are the error code and message returned by postal,
+	// if any.
+	Code    string
+	Message string
+}
+
+// Err returns an actionable error describing why the token can't be used,
+// or nil if the connection is usable.
+func (r ConnectionResult) Err() error {
+	switch r.Status {
+	case ConnectionOK:
+		return nil
+	case ConnectionInvalidToken:
+		return errors.New("postal: token is invalid")
+	case ConnectionForbidden:
+		if r.Code == codeServerSuspended {
+			return errors.New("postal: token lacks send permission, server is suspended")
+		}
+		return errors.New("postal: token lacks send permission")
+	}
+	return fmt.Errorf("postal: unknown connection status: %s", r.Status)
+}
+
+// ValidateConnection checks that postal is reachable and the token is allowed
+// to send messages.
+//
+// It posts an empty request to the send endpoint. Postal authenticates the
+// request before validating the parameters, so an authorized token gets a
+// parameter error back and nothing is sent.
+//
+// The returned error is only non-nil if postal couldn't be reached or gave an
+// unexpected response. Use ConnectionResult.Err to turn an unusable token into
+// an error.
+func (a *ApiClient) ValidateConnection(ctx context.Context) (ConnectionResult, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint(a.apiPath("/send/raw")), bytes.NewBufferString("{}"))
+	if err != nil {
+		return ConnectionResult{}, fmt.Errorf("error creating request to postal: %v", err)
+	}
+	a.setAuth(req, a.token)
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+
+	resp, err := noRedirects(a.httpClient).Do(req)
+	if err != nil {
+		return ConnectionResult{}, networkError(ctx, fmt.Errorf("error sending request to postal: %w", err))
+	}
+
+	defer resp.Body.Close()
+	if err := redirectError(resp); err != nil {
+		return ConnectionResult{}, err
+	}
+	body, err := readBody(resp)
+	if err != nil {
+		return ConnectionResult{}, networkError(ctx, fmt.Errorf("error reading body from postal response: %w", err))
+	}
+
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return ConnectionResult{Status: ConnectionInvalidToken, Message: string(body)}, nil
+	case http.StatusForbidden:
+		return ConnectionResult{Status: ConnectionForbidden, Message: string(body)}, nil
+	case http.StatusOK:
+	default:
+		return ConnectionResult{}, statusError(resp.StatusCode, body, a.errorBodyLimit, nil)
+	}
+
+	r := response{}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return ConnectionResult{}, withKind(ErrDecode, fmt.Errorf("error unmarshalling json from postal response: %v", err))
+	}
+
+	// Any status other than an authentication error means the request made it
+	// past authentication.
+	if r.Status != "error" {
+		return ConnectionResult{Status: ConnectionOK}, nil
+	}
+
+	e := errorData{}
+	if err := json.Unmarshal(r.Data, &e); err != nil {
+		return ConnectionResult{}, withKind(ErrDecode, fmt.Errorf("error unmarshalling json from postal response: %v", err))
+	}
+
+	res := ConnectionResult{Code: e.Code, Message: e.Message}
+	switch e.Code {
+	case codeInvalidServerAPIKey:
+		res.Status = ConnectionInvalidToken
+	case codeAccessDenied, codeServerSuspended:
+		res.Status = ConnectionForbidden
+	default:
+		res.Status = ConnectionOK
+	}
+	return res, nil
+}
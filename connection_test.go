@@ -0,0 +1,59 @@
+package postal
+
+import (
+	"context"
+	"net/http"
+	"testing"
+)
+
+func TestValidateConnection(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   ConnectionStatus
+	}{
+		{"ok", http.StatusOK, `{"status":"parameter-error","data":{"message":"rcpt_to is required"}}`, ConnectionOK},
+		{"invalid key", http.StatusOK, `{"status":"error","data":{"code":"InvalidServerAPIKey","message":"invalid"}}`, ConnectionInvalidToken},
+		{"access denied", http.StatusOK, `{"status":"error","data":{"code":"AccessDenied","message":"denied"}}`, ConnectionForbidden},
+		{"suspended", http.StatusOK, `{"status":"error","data":{"code":"ServerSuspended"}}`, ConnectionForbidden},
+		{"http 401", http.StatusUnauthorized, `unauthorized`, ConnectionInvalidToken},
+		{"http 403", http.StatusForbidden, `forbidden`, ConnectionForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v1/send/raw" {
+					t.Errorf("unexpected path: %s", r.URL.Path)
+				}
+				if r.Header.Get("X-Server-API-Key") != "test-token" {
+					t.Errorf("api key header not set")
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			res, err := client.ValidateConnection(context.Background())
+			if err != nil {
+				t.Fatalf("error validating connection: %v", err)
+			}
+			if res.Status != tt.want {
+				t.Fatalf("expected status %s, got %s", tt.want, res.Status)
+			}
+			if (res.Err() == nil) != (tt.want == ConnectionOK) {
+				t.Fatalf("unexpected error from result: %v", res.Err())
+			}
+		})
+	}
+}
+
+func TestValidateConnectionUnexpectedStatus(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+
+	if _, err := client.ValidateConnection(context.Background()); err == nil {
+		t.Fatal("expected error for unexpected status code")
+	}
+}
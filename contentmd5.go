@@ -0,0 +1,52 @@
+package postal
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+	"net/textproto"
+)
+
+// HdrContentMD5 is the header with the MD5 digest of an attachment's
+// content, see WithAttachmentContentMD5.
+const HdrContentMD5 = "Content-MD5"
+
+// contentMD5 returns the Content-MD5 of the attachment's content: the base64
+// encoded MD5 digest, as defined by RFC 1864. Content read from a source is
+// streamed into the digest.
+func contentMD5(at Attachment) (string, error) {
+	h := md5.New()
+	if at.Source == nil {
+		h.Write(at.Content)
+	} else {
+		r, err := at.Source.Open()
+		if err != nil {
+			return "", err
+		}
+		defer r.Close()
+		if _, err := io.Copy(h, r); err != nil {
+			return "", err
+		}
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// withContentMD5 returns the attachment's header with its Content-MD5,
+// unless it already has one.
+func withContentMD5(at Attachment, hdr textproto.MIMEHeader) textproto.MIMEHeader {
+	if hdr.Get(HdrContentMD5) != "" {
+		return hdr
+	}
+	// An attachment whose source can't be read fails when it's built.
+	sum, err := contentMD5(at)
+	if err != nil {
+		return hdr
+	}
+
+	out := make(textproto.MIMEHeader, len(hdr)+1)
+	for k, v := range hdr {
+		out[k] = v
+	}
+	out.Set(HdrContentMD5, sum)
+	return out
+}
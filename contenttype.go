@@ -0,0 +1,122 @@
+package postal
+
+import (
+	"mime"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+)
+
+// extensionTypes are the content types of common file extensions, used when
+// the system's mime database doesn't know the extension. Its contents vary
+// across platforms, so without these the same file may be attached as
+// application/octet-stream on some of them.
+var extensionTypes = map[string]string{
+	".avif": "image/avif",
+	".csv":  "text/csv",
+	".heic": "image/heic",
+	".heif": "image/heif",
+	".ics":  "text/calendar",
+	".json": "application/json",
+	".md":   "text/markdown",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".pdf":  "application/pdf",
+	".svg":  "image/svg+xml",
+	".vcf":  "text/vcard",
+	".webm": "video/webm",
+	".webp": "image/webp",
+	".woff": "font/woff",
+	".zip":  "application/zip",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	".pptx": "application/vnd.openxmlformats-officedocument.presentationml.presentation",
+}
+
+// typeByExtension returns the content type for the file extension ext, which
+// must include the leading dot. It returns an empty string if the type isn't
+// known.
+func typeByExtension(ext string) string {
+	if ct := mime.TypeByExtension(ext); ct != "" {
+		return ct
+	}
+	return extensionTypes[strings.ToLower(ext)]
+}
+
+// withTextCharset adds a UTF-8 charset to text content types which don't
+// specify one, so that clients don't have to guess the encoding of text
+// attachments.
+func withTextCharset(contentType string) string {
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mt, "text/") || params["charset"] != "" {
+		return contentType
+	}
+
+	params["charset"] = "utf-8"
+	return mime.FormatMediaType(mt, params)
+}
+
+// signatureTypes are the content types http.DetectContentType detects by a
+// signature in the content, so a file of one of them without it, or with
+// another type's, isn't what its extension says.
+var signatureTypes = map[string]bool{
+	"application/pdf": true,
+	"image/bmp":       true,
+	"image/gif":       true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+}
+
+// sniffContentType returns the content type sniffed from the content of an
+// attachment whose content type is the one of its extension, if the two
+// strongly disagree: one of them is a signatureTypes type and the other
+// isn't the same. Types which differ from the extension's were given
+// explicitly, so they're left alone.
+func sniffContentType(filename, contentType string, content []byte) (string, bool) {
+	extType := typeByExtension(filepath.Ext(filename))
+	if len(content) == 0 || extType == "" || mediaType(contentType) != mediaType(extType) {
+		return "", false
+	}
+
+	sniffed := http.DetectContentType(content)
+	extMT, sniffedMT := mediaType(extType), mediaType(sniffed)
+	if sniffedMT == extMT || (!signatureTypes[extMT] && !signatureTypes[sniffedMT]) {
+		return "", false
+	}
+	return sniffed, true
+}
+
+// correctContentType returns the header of the attachment with its content
+// type replaced by the sniffed one if its extension's is wrong, see
+// sniffContentType. The attachment's header isn't modified.
+func (a *ApiClient) correctContentType(at Attachment, hdr textproto.MIMEHeader) textproto.MIMEHeader {
+	ct := hdr.Get(HdrContentType)
+	// An attachment whose source can't be read fails when it's built.
+	head, err := at.peek()
+	if err != nil {
+		return hdr
+	}
+	sniffed, ok := sniffContentType(at.Filename, ct, head)
+	if !ok {
+		return hdr
+	}
+	if a.logger != nil {
+		a.logger.Printf("postal: attachment %s looks like %s, not %s", at.Filename, sniffed, ct)
+	}
+
+	corrected := make(textproto.MIMEHeader, len(hdr))
+	for k, v := range hdr {
+		corrected[k] = v
+	}
+	corrected.Set(HdrContentType, sniffed)
+	return corrected
+}
+
+// mediaType returns the lower cased media type of a content type, without
+// its parameters.
+func mediaType(contentType string) string {
+	mt, _, _ := strings.Cut(contentType, ";")
+	return strings.ToLower(strings.TrimSpace(mt))
+}
@@ -0,0 +1,55 @@
+package postal
+
+import (
+	"context"
+	"net/textproto"
+)
+
+// HdrCorrelationID is the header a send's correlation ID is sent in, see
+// WithCorrelationIDFromContext.
+const HdrCorrelationID = "X-Correlation-ID"
+
+// correlationID returns the correlation ID of the context, or an empty
+// string if it has none or the client doesn't look for one. IDs which can't
+// be sent in a header are ignored.
+func (a *ApiClient) correlationID(ctx context.Context) string {
+	if a.correlation == nil {
+		return ""
+	}
+	id := a.correlation(ctx)
+	if id == "" || checkHeaderValue(HdrCorrelationID, id) != nil {
+		return ""
+	}
+	return id
+}
+
+// withCorrelationID returns the message with the context's correlation ID in
+// its X-Correlation-ID header, unless it already has one. The given message
+// isn't modified.
+func (a *ApiClient) withCorrelationID(ctx context.Context, msg Message) Message {
+	id := a.correlationID(ctx)
+	if id == "" || msg.Headers.Get(HdrCorrelationID) != "" {
+		return msg
+	}
+
+	hdr := make(textproto.MIMEHeader, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		hdr[k] = v
+	}
+	hdr.Set(HdrCorrelationID, id)
+	msg.Headers = hdr
+	return msg
+}
+
+// logf logs with the client's logger, if it has one, adding the context's
+// correlation ID to the line.
+func (a *ApiClient) logf(ctx context.Context, format string, v ...interface{}) {
+	if a.logger == nil {
+		return
+	}
+	if id := a.correlationID(ctx); id != "" {
+		format += " (correlation id %s)"
+		v = append(v, id)
+	}
+	a.logger.Printf(format, v...)
+}
@@ -0,0 +1,114 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+type correlationKey struct{}
+
+func correlationFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+func TestCorrelationID(t *testing.T) {
+	var (
+		headers []string
+		reqs    []request
+	)
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get(HdrCorrelationID))
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		reqs = append(reqs, req)
+		w.Write(successResponse("id", []string{"to@example.com"}))
+	}, WithCorrelationIDFromContext(correlationFromContext))
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	ctx := context.WithValue(context.Background(), correlationKey{}, "req-123")
+	if _, err := client.SendMessageContext(ctx, msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	// A message's own header is kept.
+	msg.Headers = textproto.MIMEHeader{}
+	msg.Headers.Set(HdrCorrelationID, "own")
+	if _, err := client.SendMessageContext(ctx, msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	// Without an ID, or with one which can't be sent, nothing is added.
+	msg.Headers = nil
+	for _, c := range []context.Context{context.Background(), context.WithValue(ctx, correlationKey{}, "bad\r\nid")} {
+		if _, err := client.SendMessageContext(c, msg); err != nil {
+			t.Fatalf("error sending message: %v", err)
+		}
+	}
+
+	wantHeaders := []string{"req-123", "req-123", "", ""}
+	wantMessage := []string{"X-Correlation-ID: req-123\r\n", "X-Correlation-ID: own\r\n", "", ""}
+	for i := range reqs {
+		if headers[i] != wantHeaders[i] {
+			t.Errorf("send %d: expected request header %q, got %q", i, wantHeaders[i], headers[i])
+		}
+		rec := &recorder{reqs: reqs}
+		raw := rec.raw(t, i)
+		if wantMessage[i] == "" {
+			if bytes.Contains(raw, []byte(HdrCorrelationID)) {
+				t.Errorf("send %d: expected no correlation id in the message:\n%s", i, raw)
+			}
+		} else if !bytes.Contains(raw, []byte(wantMessage[i])) {
+			t.Errorf("send %d: expected %q in the message:\n%s", i, wantMessage[i], raw)
+		}
+	}
+}
+
+func TestCorrelationIDLogs(t *testing.T) {
+	logger := &testLogger{}
+	tracker := &failingThreadTracker{err: errors.New("store down")}
+	client, _ := newRecordingClient(t, WithCorrelationIDFromContext(correlationFromContext), WithLogger(logger), WithThreadTracker(tracker))
+
+	ctx := context.WithValue(context.Background(), correlationKey{}, "req-123")
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello", ThreadID: "t1"}
+	if _, err := client.SendMessageContext(ctx, msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(logger.lines) != 1 || !strings.HasSuffix(logger.lines[0], "store down (correlation id req-123)") {
+		t.Fatalf("expected the correlation id in the log, got %q", logger.lines)
+	}
+}
+
+func TestCorrelationIDDedupLogs(t *testing.T) {
+	logger := &testLogger{}
+	client, _ := newRecordingClient(t, WithCorrelationIDFromContext(correlationFromContext), WithLogger(logger), WithDedupRecipients())
+
+	ctx := context.WithValue(context.Background(), correlationKey{}, "req-123")
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, Cc: []string{"to@example.com"}, PlainBody: "hello"}
+	if _, err := client.SendMessageContext(ctx, msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(logger.lines) != 1 || logger.lines[0] != "postal: removed duplicate recipients to@example.com (correlation id req-123)" {
+		t.Fatalf("expected the correlation id in the log, got %q", logger.lines)
+	}
+}
+
+// failingThreadTracker is a ThreadTracker which has no threads and fails to
+// record messages.
+type failingThreadTracker struct {
+	err error
+}
+
+func (f *failingThreadTracker) LastMessage(context.Context, string) (Thread, bool, error) {
+	return Thread{}, false, nil
+}
+
+func (f *failingThreadTracker) RecordMessage(context.Context, string, Thread) error {
+	return f.err
+}
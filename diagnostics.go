@@ -0,0 +1,60 @@
+package postal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DumpFailure describes a failed send for a bug report: the error's message
+// and chain and, if postal responded with an error, the request and
+// response. The request is dumped without the message data, as it holds the
+// message's content, and the API key, which isn't part of the request's
+// body, is never included.
+func DumpFailure(err error) string {
+	if err == nil {
+		return "no error\n"
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "error: %v\n", err)
+	b.WriteString("chain:\n")
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		fmt.Fprintf(&b, "  %T: %v\n", e, e)
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if apiErr.request != nil {
+			fmt.Fprintf(&b, "request body: %s\n", apiErr.request)
+		}
+		fmt.Fprintf(&b, "response status code: %d\n", apiErr.StatusCode)
+		if apiErr.Status != "" {
+			fmt.Fprintf(&b, "response status: %s, code: %s, message: %s\n", apiErr.Status, apiErr.Code, apiErr.Message)
+		}
+		fmt.Fprintf(&b, "response body: %s\n", apiErr.bodySnippet())
+	}
+	return b.String()
+}
+
+// redactRequest returns the JSON body of a request with the data of the
+// message, if it has any, replaced by its size. dataKey is the field of the
+// raw message's data, see RequestFormat. It returns nil if the body isn't a
+// JSON object.
+func redactRequest(body []byte, dataKey string) []byte {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil
+	}
+	for _, k := range []string{dataKey, "plain_body", "html_body", "attachments"} {
+		if v, ok := fields[k]; ok {
+			fields[k], _ = json.Marshal(fmt.Sprintf("<%d bytes omitted>", len(v)))
+		}
+	}
+	redacted, err := json.Marshal(fields)
+	if err != nil {
+		return nil
+	}
+	return redacted
+}
@@ -0,0 +1,56 @@
+package postal
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDumpFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		want    []string
+	}{
+		{
+			"api error",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"status":"error","data":{"code":"NoRecipients","message":"There are no recipients defined"}}`))
+			},
+			[]string{"*postal.APIError", "response status: error, code: NoRecipients", "response status code: 200"},
+		},
+		{
+			"http error",
+			func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadGateway)
+				w.Write([]byte("bad gateway"))
+			},
+			[]string{"*postal.APIError", "response status code: 502", "response body: bad gateway"},
+		},
+	}
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "secret content"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, tt.handler)
+			_, err := client.SendMessage(msg)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			dump := DumpFailure(err)
+			for _, w := range append(tt.want, `"mail_from":"from@example.com"`, `"data":"\u003c`, "bytes omitted") {
+				if !strings.Contains(dump, w) {
+					t.Errorf("expected the dump to contain %q:\n%s", w, dump)
+				}
+			}
+			if strings.Contains(dump, "test-token") {
+				t.Errorf("expected the token to be left out:\n%s", dump)
+			}
+		})
+	}
+
+	if got := DumpFailure(ErrNoContent); !strings.Contains(got, ErrNoContent.Error()) || strings.Contains(got, "request body") {
+		t.Fatalf("unexpected dump of a local error:\n%s", got)
+	}
+}
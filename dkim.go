@@ -0,0 +1,229 @@
+package postal
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HdrDKIMSignature is the header with the DKIM signature of a message.
+const HdrDKIMSignature = "DKIM-Signature"
+
+// defaultDKIMHeaders are the headers signed by WithDKIM unless it's given
+// others.
+var defaultDKIMHeaders = []string{
+	"From", HdrSender, "Reply-To", "To", "Cc", "Subject", "Date",
+	"Message-ID", HdrInReplyTo, HdrReferences, "MIME-Version",
+	HdrContentType, HdrContentTransferEncoding,
+}
+
+// dkimSigner signs messages with DKIM, using rsa-sha256 and relaxed
+// canonicalization of both the headers and the body.
+type dkimSigner struct {
+	selector string
+	domain   string
+	headers  []string
+	keyPEM   []byte
+	key      *rsa.PrivateKey
+}
+
+// init parses the signer's private key and checks its configuration.
+func (d *dkimSigner) init() error {
+	if d.selector == "" || d.domain == "" {
+		return errors.New("invalid dkim configuration: selector and domain are required")
+	}
+	if strings.ContainsAny(d.selector+d.domain, "; \t\r\n") {
+		return fmt.Errorf("invalid dkim selector %q or domain %q", d.selector, d.domain)
+	}
+
+	from := false
+	for _, h := range d.headers {
+		if h == "" || strings.ContainsAny(h, ": \t\r\n") {
+			return fmt.Errorf("invalid dkim header %q", h)
+		}
+		if strings.EqualFold(h, "From") {
+			from = true
+		}
+	}
+	if !from {
+		return errors.New("invalid dkim configuration: the From header must be signed")
+	}
+
+	block, _ := pem.Decode(d.keyPEM)
+	if block == nil {
+		return errors.New("invalid dkim private key: no PEM block")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		d.key = key
+		return nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("invalid dkim private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("invalid dkim private key: %T isn't an RSA key", key)
+	}
+	d.key = rsaKey
+	return nil
+}
+
+// sign returns the message with a DKIM-Signature header added at its top.
+// The signature covers the body and those of the signer's headers the
+// message has.
+func (d *dkimSigner) sign(raw []byte, now time.Time) ([]byte, error) {
+	header, body := splitMessage(raw)
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	fields := headerFields(header)
+	var (
+		names  []string
+		signed bytes.Buffer
+	)
+	// Each name signs the last of the fields with it not signed already, so
+	// a name listed twice signs two of them.
+	used := make(map[int]bool)
+	for _, name := range d.headers {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(fieldName(fields[i]), name) {
+				continue
+			}
+			used[i] = true
+			names = append(names, name)
+			signed.WriteString(relaxedHeader(fields[i]))
+			break
+		}
+	}
+
+	value := strings.Join([]string{
+		"v=1",
+		"a=rsa-sha256",
+		"c=relaxed/relaxed",
+		"d=" + d.domain,
+		"s=" + d.selector,
+		"t=" + strconv.FormatInt(now.Unix(), 10),
+		"h=" + strings.Join(names, ":"),
+		"bh=" + base64.StdEncoding.EncodeToString(bodyHash[:]),
+		"b=",
+	}, "; ")
+	// The signature covers its own header, without the value of b= and
+	// without the trailing CRLF.
+	signed.WriteString(strings.TrimSuffix(relaxedHeader(HdrDKIMSignature+": "+value), "\r\n"))
+
+	digest := sha256.Sum256(signed.Bytes())
+	sig, err := rsa.SignPKCS1v15(rand.Reader, d.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, fmt.Errorf("error signing message with dkim: %v", err)
+	}
+
+	// Whitespace in b= is ignored, so the signature is split into words
+	// which foldHeader can fold.
+	b := base64.StdEncoding.EncodeToString(sig)
+	var words []string
+	for len(b) > 64 {
+		words = append(words, b[:64])
+		b = b[64:]
+	}
+	words = append(words, b)
+
+	var out bytes.Buffer
+	out.Grow(len(raw) + 512)
+	if err := foldHeader(&out, HdrDKIMSignature, value+strings.Join(words, " ")); err != nil {
+		return nil, err
+	}
+	out.Write(raw)
+	return out.Bytes(), nil
+}
+
+// splitMessage splits a message into its header, including the CRLF ending
+// its last field, and its body.
+func splitMessage(raw []byte) (header, body []byte) {
+	if bytes.HasPrefix(raw, []byte("\r\n")) {
+		return nil, raw[2:]
+	}
+	i := bytes.Index(raw, []byte("\r\n\r\n"))
+	if i < 0 {
+		return raw, nil
+	}
+	return raw[:i+2], raw[i+4:]
+}
+
+// headerFields returns the fields of a message header, each with its folded
+// lines and the CRLF ending it.
+func headerFields(header []byte) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(string(header), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+// fieldName returns the name of a header field.
+func fieldName(field string) string {
+	name, _, _ := strings.Cut(field, ":")
+	return strings.TrimRight(name, " \t")
+}
+
+// relaxedHeader canonicalizes a header field with the relaxed algorithm of
+// RFC 6376, section 3.4.2.
+func relaxedHeader(field string) string {
+	name, value, _ := strings.Cut(field, ":")
+	name = strings.ToLower(strings.TrimRight(name, " \t"))
+	value = strings.ReplaceAll(value, "\r\n", "")
+	return name + ":" + strings.Trim(compressWSP(value), " ") + "\r\n"
+}
+
+// relaxedBody canonicalizes a message body with the relaxed algorithm of
+// RFC 6376, section 3.4.4.
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRight(compressWSP(l), " ")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// compressWSP replaces every run of spaces and tabs in s with a single space.
+func compressWSP(s string) string {
+	var (
+		b     strings.Builder
+		inWSP bool
+	)
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			if !inWSP {
+				b.WriteByte(' ')
+			}
+			inWSP = true
+			continue
+		}
+		inWSP = false
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
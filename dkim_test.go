@@ -0,0 +1,187 @@
+package postal
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// newDKIMKey returns a new RSA key and its PKCS #1 PEM encoding.
+func newDKIMKey(t *testing.T) (*rsa.PrivateKey, []byte) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// verifyDKIM verifies the DKIM-Signature at the top of a relaxed/relaxed
+// signed message and returns its tags.
+func verifyDKIM(raw []byte, pub *rsa.PublicKey) (map[string]string, error) {
+	header, body := splitMessage(raw)
+	fields := headerFields(header)
+	if len(fields) == 0 || fieldName(fields[0]) != HdrDKIMSignature {
+		return nil, fmt.Errorf("no %s header", HdrDKIMSignature)
+	}
+	sigField, fields := fields[0], fields[1:]
+
+	tags := make(map[string]string)
+	_, value, _ := strings.Cut(sigField, ":")
+	for _, tag := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(tag, "=")
+		tags[strings.TrimSpace(k)] = regexp.MustCompile(`\s+`).ReplaceAllString(v, "")
+	}
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+	if got := base64.StdEncoding.EncodeToString(bodyHash[:]); got != tags["bh"] {
+		return tags, fmt.Errorf("body hash %s doesn't match bh=%s", got, tags["bh"])
+	}
+
+	var signed bytes.Buffer
+	used := make(map[int]bool)
+	for _, name := range strings.Split(tags["h"], ":") {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if !used[i] && strings.EqualFold(fieldName(fields[i]), name) {
+				used[i] = true
+				signed.WriteString(relaxedHeader(fields[i]))
+				break
+			}
+		}
+	}
+	unsigned := regexp.MustCompile(`b=[^;]*$`).ReplaceAllString(strings.TrimSuffix(sigField, "\r\n"), "b=")
+	signed.WriteString(strings.TrimSuffix(relaxedHeader(unsigned), "\r\n"))
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return tags, fmt.Errorf("error decoding signature: %v", err)
+	}
+	digest := sha256.Sum256(signed.Bytes())
+	return tags, rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig)
+}
+
+func TestRelaxedCanonicalization(t *testing.T) {
+	// The example of RFC 6376, section 3.4.6.
+	header := []byte("A: X\r\nB : Y\t\r\n\tZ  \r\n")
+	var got strings.Builder
+	for _, f := range headerFields(header) {
+		got.WriteString(relaxedHeader(f))
+	}
+	if want := "a:X\r\nb:Y Z\r\n"; got.String() != want {
+		t.Fatalf("expected headers %q, got %q", want, got.String())
+	}
+
+	body := []byte(" C \r\nD \t E\r\n\r\n\r\n")
+	if got, want := string(relaxedBody(body)), " C\r\nD E\r\n"; got != want {
+		t.Fatalf("expected body %q, got %q", want, got)
+	}
+	if got := relaxedBody([]byte("\r\n\r\n")); len(got) != 0 {
+		t.Fatalf("expected an empty body, got %q", got)
+	}
+	if got, want := string(relaxedBody([]byte("no newline"))), "no newline\r\n"; got != want {
+		t.Fatalf("expected body %q, got %q", want, got)
+	}
+}
+
+func TestWithDKIM(t *testing.T) {
+	key, keyPEM := newDKIMKey(t)
+	clock := newFakeClock()
+	client, rec := newRecordingClient(t, WithClock(clock), WithDKIM("mail", "example.com", keyPEM, nil))
+
+	msg := Message{
+		From:      "Sender <from@example.com>",
+		To:        []string{"to@example.com"},
+		Subject:   "a subject which is long enough to be folded over more than one line of the header",
+		PlainBody: "hello  \r\nworld\r\n\r\n",
+		HTMLBody:  "<p>hello</p>",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	raw := rec.last(t)
+
+	tags, err := verifyDKIM(raw, &key.PublicKey)
+	if err != nil {
+		t.Fatalf("error verifying signature: %v\n%s", err, raw)
+	}
+	want := map[string]string{
+		"v": "1",
+		"a": "rsa-sha256",
+		"c": "relaxed/relaxed",
+		"d": "example.com",
+		"s": "mail",
+		"t": fmt.Sprint(clock.Now().Unix()),
+		"h": "From:To:Subject:Date:Message-ID:MIME-Version:Content-Type",
+	}
+	for k, v := range want {
+		if tags[k] != v {
+			t.Errorf("expected %s=%s, got %q", k, v, tags[k])
+		}
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		if len(line) > maxHeaderLineLength {
+			t.Fatalf("line over %d characters: %q", maxHeaderLineLength, line)
+		}
+	}
+
+	tampered := bytes.Replace(raw, []byte("hello"), []byte("jello"), 1)
+	if _, err := verifyDKIM(tampered, &key.PublicKey); err == nil {
+		t.Fatal("expected a changed body to fail verification")
+	}
+	tampered = bytes.Replace(raw, []byte("Subject: a subject"), []byte("Subject: b subject"), 1)
+	if _, err := verifyDKIM(tampered, &key.PublicKey); err == nil {
+		t.Fatal("expected a changed subject to fail verification")
+	}
+}
+
+func TestWithDKIMHeaders(t *testing.T) {
+	key, keyPEM := newDKIMKey(t)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("error encoding key: %v", err)
+	}
+	keyPEM8 := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8})
+	client, rec := newRecordingClient(t, WithDKIM("mail", "example.com", keyPEM8, []string{"from", "subject", "x-missing"}))
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, Subject: "hello", PlainBody: "hello"}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	tags, err := verifyDKIM(rec.last(t), &key.PublicKey)
+	if err != nil {
+		t.Fatalf("error verifying signature: %v", err)
+	}
+	// Headers the message doesn't have aren't signed.
+	if tags["h"] != "from:subject" {
+		t.Fatalf("expected h=from:subject, got %q", tags["h"])
+	}
+
+	tests := []struct {
+		name     string
+		selector string
+		key      []byte
+		headers  []string
+	}{
+		{"no selector", "", keyPEM, nil},
+		{"bad selector", "mail; x=y", keyPEM, nil},
+		{"no from", "mail", keyPEM, []string{"Subject"}},
+		{"bad header", "mail", keyPEM, []string{"From", "X:Y"}},
+		{"no key", "mail", []byte("not a key"), nil},
+	}
+	for _, tt := range tests {
+		if _, err := NewAPIClient("http://localhost", "token", http.DefaultClient, WithDKIM(tt.selector, "example.com", tt.key, tt.headers)); err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		}
+	}
+}
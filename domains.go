@@ -0,0 +1,78 @@
+package postal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrNotSupported is returned when the postal server doesn't have the API
+// endpoint a method relies on, or by a Client which can't do what's asked,
+// such as an SMTPClient looking up a message.
+var ErrNotSupported = errors.New("postal: not supported")
+
+// defaultDomainsPath is the path of the endpoint, within the client's version
+// of the API, ListDomains uses unless set with WithDomainsPath.
+const defaultDomainsPath = "/domains/list"
+
+// Domain is a domain set up on a postal server.
+type Domain struct {
+	Name string `json:"name"`
+	// Verified is set once postal has verified the domain's ownership.
+	Verified   bool   `json:"verified"`
+	SPFStatus  string `json:"spf_status"`
+	DKIMStatus string `json:"dkim_status"`
+}
+
+// ListDomains fetches the domains set up on the client's postal server.
+//
+// Postal's legacy API doesn't have an endpoint for this on every version, or
+// at all, so it's fetched from a path which can be changed with
+// WithDomainsPath; for example to a proxy which serves it from postal's
+// database. The endpoint is expected to respond like every other endpoint of
+// the API, with the domains in data.domains. If it doesn't exist, ListDomains
+// fails with ErrNotSupported.
+func (a *ApiClient) ListDomains() ([]Domain, error) {
+	return a.ListDomainsContext(context.Background())
+}
+
+// ListDomainsContext is like ListDomains, but the request to postal is bound
+// to the given context.
+func (a *ApiClient) ListDomainsContext(ctx context.Context) ([]Domain, error) {
+	path := a.domainsPath
+	if path == "" {
+		path = a.apiPath(defaultDomainsPath)
+	}
+
+	data := struct {
+		Domains []Domain `json:"domains"`
+	}{}
+	if err := a.fetchOptional(ctx, "listing domains", path, &data); err != nil {
+		return nil, err
+	}
+	return data.Domains, nil
+}
+
+// fetchOptional requests an endpoint which postal servers may not have and
+// decodes the data of its response into v. It fails with ErrNotSupported if
+// the endpoint doesn't exist.
+func (a *ApiClient) fetchOptional(ctx context.Context, what, path string, v interface{}) error {
+	res, _, err := a.post(ctx, SendOptions{}, path, struct{}{})
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w: %s: %v", ErrNotSupported, what, err)
+	}
+	if err != nil {
+		return err
+	}
+	if err := errorFromResponse(res); err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(res.Data, v); err != nil {
+		return withKind(ErrDecode, fmt.Errorf("error unmarshalling json from postal response: %v", err))
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package postal
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestListDomains(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/custom/domains" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"status":"success","time":0.01,"data":{"domains":[{"name":"example.com","verified":true,"spf_status":"OK","dkim_status":"OK"},{"name":"new.example.com","verified":false}]}}`))
+	}, WithDomainsPath("/custom/domains"))
+
+	domains, err := client.ListDomains()
+	if err != nil {
+		t.Fatalf("error listing domains: %v", err)
+	}
+	want := []Domain{
+		{Name: "example.com", Verified: true, SPFStatus: "OK", DKIMStatus: "OK"},
+		{Name: "new.example.com"},
+	}
+	if !reflect.DeepEqual(domains, want) {
+		t.Fatalf("unexpected domains: %+v", domains)
+	}
+}
+
+func TestListDomainsNotSupported(t *testing.T) {
+	client := newTestClient(t, http.NotFound)
+
+	if _, err := client.ListDomains(); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
@@ -0,0 +1,356 @@
+package postal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Errors for the common reasons postal rejects a request. The *APIError
+// returned for a rejection wraps one of these, so they can be checked with
+// errors.Is.
+//
+// Postal doesn't reject messages to suppressed recipients, it accepts and
+// holds them instead. See HeldRecipients for detecting held messages.
+var (
+	ErrTooManyRecipients = errors.New("postal: too many recipients")
+	ErrNoRecipients      = errors.New("postal: no recipients")
+	ErrInvalidFrom       = errors.New("postal: invalid from address")
+	ErrUnauthorizedFrom  = errors.New("postal: from address not authorized for this server")
+	ErrNoContent         = errors.New("postal: message has no content")
+	ErrInvalidToken      = errors.New("postal: invalid api token")
+	ErrAccessDenied      = errors.New("postal: api token not permitted")
+	ErrServerSuspended   = errors.New("postal: server is suspended")
+	ErrMessageNotFound   = errors.New("postal: message not found")
+	ErrInvalidParameters = errors.New("postal: invalid parameters")
+)
+
+// Kinds of errors, which the errors of a send from checking the message,
+// from the request to postal and from postal's response can be checked for
+// with errors.Is:
+//
+//   - ErrInvalidMessage: the message is invalid, or postal rejected it as
+//     invalid. Sending it again won't help.
+//   - ErrUnauthorized: the API token, server or From address isn't allowed
+//     to send.
+//   - ErrRateLimited: postal, or a proxy in front of it, limited the rate of
+//     requests.
+//   - ErrServer: postal failed with a 5xx response.
+//   - ErrServerUnavailable: postal, or a proxy in front of it, is
+//     unavailable, such as during maintenance: a 503 response. It's also
+//     ErrServer, and is retried with a longer wait, see RetryPolicy.
+//   - ErrNetwork: postal couldn't be reached, or the connection failed.
+//   - ErrAPI: postal responded with an error. Every APIError is ErrAPI, as
+//     well as one of the kinds above.
+//   - ErrDecode: postal's response couldn't be decoded.
+//
+// They're independent of the errors for postal's error codes above: an error
+// for postal's NoRecipients code is both ErrNoRecipients and
+// ErrInvalidMessage.
+//
+// Errors of sends which were stopped before reaching postal have no kind:
+// the context's errors, ErrCircuitOpen and ErrNotAttempted. Neither do the
+// errors of the client's hooks, such as a SendLog or ThreadTracker, which are
+// wrapped as they are.
+var (
+	ErrInvalidMessage    = errors.New("postal: invalid message")
+	ErrUnauthorized      = errors.New("postal: unauthorized")
+	ErrRateLimited       = errors.New("postal: rate limited")
+	ErrServer            = errors.New("postal: server error")
+	ErrServerUnavailable = errors.New("postal: server unavailable")
+	ErrNetwork           = errors.New("postal: network error")
+	ErrAPI               = errors.New("postal: api error")
+	ErrDecode            = errors.New("postal: error decoding response")
+)
+
+// kindError marks err as being of one of the kinds of errors, without
+// changing its message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string {
+	return e.err.Error()
+}
+
+func (e *kindError) Unwrap() error {
+	return e.err
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
+
+// withKind marks err as being of the given kind. It returns nil if err is nil.
+func withKind(kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+// networkError marks err, from sending a request with ctx, as a network
+// error unless it's caused by the request's context. Timeouts of the http
+// client or its transport look like context errors, so ctx itself is checked.
+func networkError(ctx context.Context, err error) error {
+	if ctx.Err() != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+		return err
+	}
+	return withKind(ErrNetwork, err)
+}
+
+// unauthorizedCodes are postal's error codes for requests which aren't
+// allowed.
+var unauthorizedCodes = map[string]bool{
+	codeAccessDenied:             true,
+	codeInvalidServerAPIKey:      true,
+	codeServerSuspended:          true,
+	"UnauthenticatedFromAddress": true,
+}
+
+// errorCodes maps postal's error codes to the corresponding errors.
+var errorCodes = map[string]error{
+	"TooManyToAddresses":         ErrTooManyRecipients,
+	"TooManyCCAddresses":         ErrTooManyRecipients,
+	"TooManyBCCAddresses":        ErrTooManyRecipients,
+	"NoRecipients":               ErrNoRecipients,
+	"FromAddressMissing":         ErrInvalidFrom,
+	"UnauthenticatedFromAddress": ErrUnauthorizedFrom,
+	"NoContent":                  ErrNoContent,
+	codeInvalidServerAPIKey:      ErrInvalidToken,
+	codeAccessDenied:             ErrAccessDenied,
+	codeServerSuspended:          ErrServerSuspended,
+	"MessageNotFound":            ErrMessageNotFound,
+}
+
+// APIError is returned when postal responds with an unexpected HTTP status,
+// or rejects the request.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// Body is the raw body of the response.
+	Body []byte
+
+	// Status, Code and Message are the status, error code and message in
+	// postal's response, if postal rejected the request.
+	Status  string
+	Code    string
+	Message string
+
+	// maxBody is the maximum number of bytes of Body included in the error
+	// message. See WithErrorBodyLimit.
+	maxBody int
+	// request is the JSON body of the request, without the message, for
+	// DumpFailure.
+	request []byte
+}
+
+// defaultErrorBodyLimit is the default maximum number of bytes of the
+// response body included in the message of an APIError.
+const defaultErrorBodyLimit = 2048
+
+func (e *APIError) Error() string {
+	if e.Status != "" {
+		return fmt.Sprintf("error from postal, status: %s, code: %s, error: %s", e.Status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("error sending message to postal, status code: %d, error: %s", e.StatusCode, e.bodySnippet())
+}
+
+// bodySnippet returns the body, truncated to the error's limit.
+func (e *APIError) bodySnippet() []byte {
+	limit := e.maxBody
+	if limit == 0 {
+		limit = defaultErrorBodyLimit
+	}
+	if limit < 0 || len(e.Body) <= limit {
+		return e.Body
+	}
+
+	// Don't cut a multi-byte character in half.
+	for limit > 0 && !utf8.RuneStart(e.Body[limit]) {
+		limit--
+	}
+	return append(e.Body[:limit:limit], "…"...)
+}
+
+// Unwrap returns the error corresponding to postal's error code, if any.
+func (e *APIError) Unwrap() error {
+	if err, ok := errorCodes[e.Code]; ok {
+		return err
+	}
+	if e.Status == "parameter-error" {
+		return ErrInvalidParameters
+	}
+	return nil
+}
+
+// Is reports whether the error is of the kind target, see ErrInvalidMessage
+// and the other kinds of errors.
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrAPI:
+		return true
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden || unauthorizedCodes[e.Code]
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= 500
+	case ErrServerUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	case ErrInvalidMessage:
+		switch e.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+			return false
+		}
+		if e.StatusCode >= 500 {
+			return false
+		}
+		if e.Status != "" {
+			return e.Status == "parameter-error" || (!unauthorizedCodes[e.Code] && e.Code != "MessageNotFound")
+		}
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusUnprocessableEntity
+	}
+	return false
+}
+
+// ErrRedirected is returned when postal responds with a redirect, which
+// usually means the client's base URL is outdated, or uses http where postal
+// wants https.
+var ErrRedirected = errors.New("postal: request was redirected")
+
+// LookupError is returned by GetMessagesDetails when some of the messages
+// couldn't be fetched.
+type LookupError struct {
+	// Errors is the error for each message ID which couldn't be fetched.
+	Errors map[int64]error
+}
+
+func (e *LookupError) Error() string {
+	if len(e.Errors) == 0 {
+		return "error fetching messages"
+	}
+	ids := make([]int64, 0, len(e.Errors))
+	for id := range e.Errors {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return fmt.Sprintf("error fetching %d messages, first message %d: %v", len(ids), ids[0], e.Errors[ids[0]])
+}
+
+// PartialSuccessError is returned when postal accepted a message for some of
+// its recipients, but not for others.
+type PartialSuccessError struct {
+	// Rejected are the recipients postal didn't return a message for.
+	Rejected []string
+}
+
+func (e *PartialSuccessError) Error() string {
+	return fmt.Sprintf("postal accepted the message for only some recipients, rejected: %s", strings.Join(e.Rejected, ", "))
+}
+
+// UnauthorizedSenderError is returned when postal rejects a message because
+// its From domain isn't authorized to send from the server, usually as the
+// domain isn't set up or verified on it. It wraps the *APIError, so
+// errors.Is(err, ErrUnauthorizedFrom) holds for it.
+type UnauthorizedSenderError struct {
+	// Domain is the From domain postal rejected.
+	Domain string
+	Err    error
+}
+
+func (e *UnauthorizedSenderError) Error() string {
+	return fmt.Sprintf("domain %s isn't authorized to send from this postal server: %v", e.Domain, e.Err)
+}
+
+func (e *UnauthorizedSenderError) Unwrap() error {
+	return e.Err
+}
+
+// unauthorizedSender returns err as an *UnauthorizedSenderError if postal
+// rejected the message with the From address from, and err otherwise. The
+// domain is taken from postal's error message if it names an address, or
+// else from the first From address.
+func unauthorizedSender(err error, from string) error {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrUnauthorizedFrom) {
+		return err
+	}
+
+	domain := ""
+	for _, word := range strings.Fields(apiErr.Message) {
+		if addr, err := mail.ParseAddress(strings.Trim(word, "\"'()<>,.")); err == nil {
+			domain = addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+			break
+		}
+	}
+	if domain == "" {
+		if addrs, err := mail.ParseAddressList(from); err == nil {
+			domain = addrs[0].Address[strings.LastIndex(addrs[0].Address, "@")+1:]
+		}
+	}
+	return &UnauthorizedSenderError{Domain: strings.ToLower(domain), Err: err}
+}
+
+// rejectedRecipients returns the recipients for which the response has no
+// message with an ID and token.
+func rejectedRecipients(resp Response, rcpts []string) []string {
+	accepted := make(map[string]bool, len(resp.Messages))
+	for addr, m := range resp.Messages {
+		if m.accepted() {
+			accepted[strings.ToLower(addr)] = true
+		}
+	}
+
+	var rejected []string
+	for _, r := range rcpts {
+		if !accepted[strings.ToLower(r)] {
+			rejected = append(rejected, r)
+		}
+	}
+	return rejected
+}
+
+// statusError returns the error for a response with an unexpected HTTP
+// status. Postal's status, error code and message are taken from the body,
+// if it's one of postal's JSON error responses.
+func statusError(statusCode int, body []byte, maxBody int, request []byte) *APIError {
+	e := &APIError{StatusCode: statusCode, Body: body, maxBody: maxBody, request: request}
+
+	var res response
+	if json.Unmarshal(body, &res) != nil || res.Status == "" || res.Status == "success" {
+		return e
+	}
+	var data errorData
+	_ = json.Unmarshal(res.Data, &data)
+	e.Status, e.Code, e.Message = res.Status, data.Code, data.Message
+	return e
+}
+
+// errorFromResponse returns the error postal responded with, or nil if the
+// request succeeded.
+func errorFromResponse(res response) error {
+	if res.Status == "success" {
+		return nil
+	}
+
+	e := errorData{}
+	if err := json.Unmarshal(res.Data, &e); err != nil {
+		return withKind(ErrDecode, fmt.Errorf("error unmarshalling json from postal response: %v", err))
+	}
+	return &APIError{
+		StatusCode: http.StatusOK,
+		Body:       res.body,
+		request:    res.request,
+		Status:     res.Status,
+		Code:       e.Code,
+		Message:    e.Message,
+	}
+}
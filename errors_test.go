@@ -0,0 +1,356 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestPostalErrors(t *testing.T) {
+	tests := []struct {
+		code string
+		want error
+	}{
+		{"TooManyToAddresses", ErrTooManyRecipients},
+		{"TooManyBCCAddresses", ErrTooManyRecipients},
+		{"NoRecipients", ErrNoRecipients},
+		{"FromAddressMissing", ErrInvalidFrom},
+		{"UnauthenticatedFromAddress", ErrUnauthorizedFrom},
+		{"NoContent", ErrNoContent},
+		{"InvalidServerAPIKey", ErrInvalidToken},
+		{"AccessDenied", ErrAccessDenied},
+		{"ServerSuspended", ErrServerSuspended},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"status":"error","time":0.01,"data":{"code":"` + tt.code + `","message":"rejected"}}`))
+			})
+
+			_, err := client.SendMessage(Message{
+				From:      "from@example.com",
+				To:        []string{"to@example.com"},
+				PlainBody: "hello",
+			})
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			if tt.want != ErrInvalidToken && errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("expected %v not to be ErrInvalidToken", err)
+			}
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected an *APIError, got %T", err)
+			}
+			if apiErr.Code != tt.code || apiErr.Message != "rejected" {
+				t.Fatalf("unexpected error fields: %+v", apiErr)
+			}
+		})
+	}
+}
+
+func TestPostalParameterError(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"parameter-error","data":{"message":"mail_from is required"}}`))
+	})
+
+	_, err := client.SendMessage(Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	})
+	if !errors.Is(err, ErrInvalidParameters) {
+		t.Fatalf("expected ErrInvalidParameters, got %v", err)
+	}
+}
+
+func TestPartialSuccess(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"message_id":"abc@postal","messages":{
+			"to@example.com":{"id":1,"token":"abc"},
+			"cc@example.com":{"id":0,"token":""}
+		}}}`))
+	})
+
+	resp, err := client.SendMessage(Message{
+		From:      "from@example.com",
+		To:        []string{"To <TO@example.com>"},
+		Cc:        []string{"cc@example.com"},
+		Bcc:       []string{"bcc@example.com"},
+		PlainBody: "hello",
+	})
+
+	var partial *PartialSuccessError
+	if !errors.As(err, &partial) {
+		t.Fatalf("expected a *PartialSuccessError, got %v", err)
+	}
+	if len(partial.Rejected) != 2 || partial.Rejected[0] != "cc@example.com" || partial.Rejected[1] != "bcc@example.com" {
+		t.Fatalf("unexpected rejected recipients: %v", partial.Rejected)
+	}
+	if resp.MessageID != "abc@postal" {
+		t.Fatalf("expected the response along with the error, got %+v", resp)
+	}
+}
+
+func TestEnvelopeRecipients(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	if _, err := client.SendMessage(Message{
+		From:      "from@example.com",
+		To:        []string{"To <to@example.com>"},
+		Cc:        []string{"cc@example.com"},
+		Bcc:       []string{"bcc@example.com"},
+		PlainBody: "hello",
+	}); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	got := rec.reqs[0].To
+	if len(got) != 3 || got[0] != "to@example.com" || got[1] != "cc@example.com" || got[2] != "bcc@example.com" {
+		t.Fatalf("unexpected rcpt_to: %v", got)
+	}
+}
+
+func TestAPIErrorBodyLimit(t *testing.T) {
+	page := "<html>" + strings.Repeat("é", 2000) + "</html>"
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write([]byte(page))
+	})
+
+	_, err := client.SendMessage(Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if string(apiErr.Body) != page {
+		t.Fatal("expected the full body on the error")
+	}
+
+	msg := err.Error()
+	if !strings.HasSuffix(msg, "…") || !utf8.ValidString(msg) {
+		t.Fatalf("expected a truncated, valid UTF-8 message, got %q", msg)
+	}
+	if len(msg) > defaultErrorBodyLimit+100 {
+		t.Fatalf("message is too long: %d bytes", len(msg))
+	}
+}
+
+func TestWithErrorBodyLimit(t *testing.T) {
+	body := []byte(strings.Repeat("x", 100))
+
+	err := &APIError{StatusCode: http.StatusBadGateway, Body: body, maxBody: 10}
+	if got := string(err.bodySnippet()); got != strings.Repeat("x", 10)+"…" {
+		t.Fatalf("unexpected snippet %q", got)
+	}
+
+	err = &APIError{StatusCode: http.StatusBadGateway, Body: body, maxBody: -1}
+	if got := err.bodySnippet(); len(got) != len(body) {
+		t.Fatalf("expected the full body, got %d bytes", len(got))
+	}
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		w.Write(body)
+	}, WithErrorBodyLimit(10))
+	_, sendErr := client.SendMessage(Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"})
+	if sendErr == nil || !strings.HasSuffix(sendErr.Error(), "error: "+strings.Repeat("x", 10)+"…") {
+		t.Fatalf("expected the body truncated to 10 bytes, got %v", sendErr)
+	}
+}
+
+func TestUnauthorizedSender(t *testing.T) {
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{"domain from message", "The From address is not authorised to send mail from this server", "tenant.example.com"},
+		{"domain from postal", "The From address (bob@other.example.com) is not authorised to send mail from this server", "other.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"status":"error","time":0.01,"data":{"code":"UnauthenticatedFromAddress","message":"` + tt.message + `"}}`))
+			})
+
+			_, err := client.SendMessage(Message{
+				From:      "Bob <bob@Tenant.example.com>",
+				To:        []string{"to@example.com"},
+				PlainBody: "hello",
+			})
+
+			var senderErr *UnauthorizedSenderError
+			if !errors.As(err, &senderErr) {
+				t.Fatalf("expected an UnauthorizedSenderError, got %v", err)
+			}
+			if senderErr.Domain != tt.want {
+				t.Fatalf("expected domain %s, got %s", tt.want, senderErr.Domain)
+			}
+			if !errors.Is(err, ErrUnauthorizedFrom) {
+				t.Fatal("expected the error to be ErrUnauthorizedFrom")
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Code != "UnauthenticatedFromAddress" {
+				t.Fatalf("expected the APIError to be wrapped, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAPIErrorStatusPayload(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"status":"error","time":0.01,"flags":{},"data":{"code":"InvalidServerAPIKey","message":"The API token provided in X-Server-API-Key was not valid."}}`))
+	})
+
+	_, err := client.SendMessage(Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusForbidden || apiErr.Status != "error" || apiErr.Code != "InvalidServerAPIKey" ||
+		apiErr.Message != "The API token provided in X-Server-API-Key was not valid." {
+		t.Fatalf("unexpected APIError: %+v", apiErr)
+	}
+	if !errors.Is(err, ErrInvalidToken) || !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected ErrInvalidToken and ErrUnauthorized, got %v", err)
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	valid := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+
+	respond := func(status int, body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(body))
+		}
+	}
+	postalError := func(status, code string) http.HandlerFunc {
+		return respond(http.StatusOK, `{"status":"`+status+`","time":0.01,"data":{"code":"`+code+`","message":"rejected"}}`)
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		msg     Message
+		want    error
+	}{
+		{"validation", nil, Message{From: "from@example.com"}, ErrInvalidMessage},
+		{"invalid recipient", nil, Message{From: "from@example.com", To: []string{"not an address"}, PlainBody: "hello"}, ErrInvalidMessage},
+		{"postal invalid", postalError("error", "NoContent"), valid, ErrInvalidMessage},
+		{"parameter error", postalError("parameter-error", ""), valid, ErrInvalidMessage},
+		{"invalid token", postalError("error", "InvalidServerAPIKey"), valid, ErrUnauthorized},
+		{"unauthorized from", postalError("error", "UnauthenticatedFromAddress"), valid, ErrUnauthorized},
+		{"forbidden", respond(http.StatusForbidden, "forbidden"), valid, ErrUnauthorized},
+		{"forbidden postal error", respond(http.StatusForbidden, `{"status":"error","data":{"code":"NoContent","message":"rejected"}}`), valid, ErrUnauthorized},
+		{"server postal error", respond(http.StatusInternalServerError, `{"status":"error","data":{"code":"InternalError","message":"failed"}}`), valid, ErrServer},
+		{"rate limited", respond(http.StatusTooManyRequests, "slow down"), valid, ErrRateLimited},
+		{"server", respond(http.StatusBadGateway, "bad gateway"), valid, ErrServer},
+		{"unavailable", respond(http.StatusServiceUnavailable, "maintenance"), valid, ErrServerUnavailable},
+		{"decode", respond(http.StatusOK, "not json"), valid, ErrDecode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.handler
+			if h == nil {
+				h = func(w http.ResponseWriter, r *http.Request) {
+					t.Error("unexpected request")
+				}
+			}
+			client := newTestClient(t, h)
+
+			_, err := client.SendMessage(tt.msg)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+			for _, kind := range []error{ErrInvalidMessage, ErrUnauthorized, ErrRateLimited, ErrServer, ErrServerUnavailable, ErrNetwork, ErrDecode} {
+				if kind == ErrServer && tt.want == ErrServerUnavailable {
+					continue
+				}
+				if kind != tt.want && errors.Is(err, kind) {
+					t.Fatalf("error %v is also %v", err, kind)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorKindNetwork(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+
+	client, err := NewAPIClient(srv.URL, "token", nil)
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+	_, err = client.SendMessage(Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"})
+	if !errors.Is(err, ErrNetwork) {
+		t.Fatalf("expected ErrNetwork, got %v", err)
+	}
+
+	// Context errors aren't network errors.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = client.SendMessageContext(ctx, Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrNetwork) {
+		t.Fatalf("expected context.Canceled only, got %v", err)
+	}
+}
+
+func TestErrorKindAPI(t *testing.T) {
+	valid := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+
+	for _, status := range []int{http.StatusOK, http.StatusUnprocessableEntity, http.StatusBadGateway} {
+		client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			fmt.Fprint(w, `{"status":"error","data":{"code":"NoContent","message":"no content"}}`)
+		})
+		_, err := client.SendMessage(valid)
+		var apiErr *APIError
+		if !errors.Is(err, ErrAPI) || !errors.As(err, &apiErr) || errors.Is(err, ErrNetwork) {
+			t.Fatalf("status %d: expected an APIError which is ErrAPI only, got %v", status, err)
+		}
+	}
+
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	client, err := NewAPIClient(srv.URL, "token", nil)
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+	_, err = client.SendMessage(valid)
+	if !errors.Is(err, ErrNetwork) || errors.Is(err, ErrAPI) {
+		t.Fatalf("expected ErrNetwork only, got %v", err)
+	}
+}
+
+func TestErrorKindInvalidMessage(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	prepared, err := client.PrepareMessage(Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"})
+	if err != nil {
+		t.Fatalf("error preparing message: %v", err)
+	}
+	if _, err := prepared.SendTo(context.Background()); !errors.Is(err, ErrInvalidMessage) || !errors.Is(err, ErrNoRecipients) {
+		t.Fatalf("expected ErrInvalidMessage for a prepared send without recipients, got %v", err)
+	}
+
+	_, err = client.SendMessage(Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello", Sandbox: true})
+	if !errors.Is(err, ErrInvalidMessage) || !errors.Is(err, ErrNoSandboxRecipient) {
+		t.Fatalf("expected ErrInvalidMessage for a sandbox message without a sandbox recipient, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatal("expected nothing to be sent")
+	}
+}
@@ -0,0 +1,84 @@
+package postal
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileClient is a Client which writes messages to .eml files in a directory
+// instead of sending them, for development without a postal server. The
+// files can be opened with most mail clients.
+type FileClient struct {
+	dir string
+	// builder builds the messages the way an ApiClient with the same
+	// options would.
+	builder *ApiClient
+
+	mu sync.Mutex
+	// n is the number of messages written, used for file names.
+	n int
+	// lastID is the last ID given to a recipient.
+	lastID int64
+}
+
+// NewFileClient returns a FileClient which writes messages to dir, creating
+// it if needed. The options configure how messages are built, as for
+// NewAPIClient; options about sending have no effect.
+func NewFileClient(dir string, opts ...Option) (*FileClient, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating message directory: %v", err)
+	}
+
+	builder, err := NewAPIClient("", "", nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &FileClient{dir: dir, builder: builder}, nil
+}
+
+// GetMessageDetails fails with ErrNotSupported, as the messages aren't sent
+// to postal.
+func (c *FileClient) GetMessageDetails(id int64) (MessageDetails, error) {
+	return MessageDetails{}, fmt.Errorf("%w: file client can't look up message %d", ErrNotSupported, id)
+}
+
+// SendMessage writes the message to a new file in the client's directory.
+// The response is made up: every recipient gets an ID, counting up from 1,
+// and the message's postal ID is its Message-ID.
+func (c *FileClient) SendMessage(msg Message) (Response, error) {
+	msg = c.builder.normalize(context.Background(), msg)
+	raw, id, err := c.builder.buildMIME(msg)
+	if err != nil {
+		return Response{}, err
+	}
+	rcpts, err := envelopeRecipients(msg)
+	if err != nil {
+		return Response{}, withKind(ErrInvalidMessage, err)
+	}
+
+	c.mu.Lock()
+	c.n++
+	n, firstID := c.n, c.lastID+1
+	c.lastID += int64(len(rcpts))
+	c.mu.Unlock()
+
+	name := fmt.Sprintf("%s-%04d.eml", c.builder.clock.Now().UTC().Format("20060102T150405"), n)
+	if err := os.WriteFile(filepath.Join(c.dir, name), raw, 0o644); err != nil {
+		return Response{}, fmt.Errorf("error writing message: %v", err)
+	}
+
+	resp := Response{
+		MessageID:    strings.Trim(id, "<>"),
+		Messages:     make(map[string]ResponseMessage, len(rcpts)),
+		RFCMessageID: id,
+	}
+	for i, r := range rcpts {
+		id := firstID + int64(i)
+		resp.Messages[r] = ResponseMessage{ID: id, Token: fmt.Sprintf("file-%d", id)}
+	}
+	return resp, nil
+}
@@ -0,0 +1,60 @@
+package postal
+
+import (
+	"bytes"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FileClient must satisfy Client.
+var _ Client = (*FileClient)(nil)
+
+func TestFileClient(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	client, err := NewFileClient(dir, WithClock(newFakeClock()))
+	if err != nil {
+		t.Fatalf("error creating file client: %v", err)
+	}
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		Cc:        []string{"cc@example.com"},
+		Subject:   "hello",
+		PlainBody: "hello",
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendMessage(msg); err != nil {
+			t.Fatalf("error sending message: %v", err)
+		}
+	}
+	resp, err := client.SendMessage(msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if resp.Messages["cc@example.com"].ID != 6 || resp.RFCMessageID == "" {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 3 {
+		t.Fatalf("expected 3 files, got %v: %v", files, err)
+	}
+	raw, err := os.ReadFile(files[2])
+	if err != nil {
+		t.Fatalf("error reading message: %v", err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if m.Header.Get("Subject") != "hello" || m.Header.Get("Message-ID") != resp.RFCMessageID {
+		t.Fatalf("unexpected headers: %v", m.Header)
+	}
+
+	if _, err := client.SendMessage(Message{}); err == nil {
+		t.Fatal("expected an error for an invalid message")
+	}
+}
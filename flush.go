@@ -0,0 +1,138 @@
+package postal
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// FlushError is returned by Flush when some of the sends it waited for
+// failed.
+type FlushError struct {
+	// Errors is the error of each send which failed, by the ID of its
+	// message in the outbox for Outbox.Flush, or by the number of the send,
+	// counting the client's SendAsync calls from 1, for ApiClient.Flush.
+	Errors map[string]error
+
+	// order are the keys of Errors in the order the sends failed.
+	order []string
+}
+
+func (e *FlushError) Error() string {
+	if len(e.Errors) == 0 {
+		return "error flushing sends"
+	}
+	first := ""
+	if len(e.order) > 0 {
+		first = e.order[0]
+	} else {
+		keys := make([]string, 0, len(e.Errors))
+		for k := range e.Errors {
+			keys = append(keys, k)
+		}
+		// Numeric keys, such as the numbers of sends, sort as numbers.
+		sort.Slice(keys, func(i, j int) bool {
+			if len(keys[i]) != len(keys[j]) && isDigits(keys[i]) && isDigits(keys[j]) {
+				return len(keys[i]) < len(keys[j])
+			}
+			return keys[i] < keys[j]
+		})
+		first = keys[0]
+	}
+	return fmt.Sprintf("%d sends failed, first %s: %v", len(e.Errors), first, e.Errors[first])
+}
+
+// isDigits reports whether s is made of decimal digits only.
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// flushGroup tracks the sends in flight, for Flush to wait for. Its zero
+// value is ready to use.
+type flushGroup struct {
+	mu      sync.Mutex
+	pending map[*flushEntry]bool
+	// started counts the sends added without a key.
+	started int
+	// finished counts the sends which finished.
+	finished int
+}
+
+// flushEntry is a send tracked by a flushGroup.
+type flushEntry struct {
+	key  string
+	done chan struct{}
+	err  error
+	// seq is the number of the send among those which finished.
+	seq int
+}
+
+// add tracks a send, keyed by key or, if it's empty, by its number.
+func (g *flushGroup) add(key string) *flushEntry {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.pending == nil {
+		g.pending = make(map[*flushEntry]bool)
+	}
+	g.started++
+	if key == "" {
+		key = strconv.Itoa(g.started)
+	}
+	e := &flushEntry{key: key, done: make(chan struct{})}
+	g.pending[e] = true
+	return e
+}
+
+// finish records the end of a send which failed with err, if it isn't nil.
+func (g *flushGroup) finish(e *flushEntry, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	e.err = err
+	g.finished++
+	e.seq = g.finished
+	delete(g.pending, e)
+	close(e.done)
+}
+
+// wait waits for the sends in flight to finish, or ctx to be done, and
+// returns a *FlushError of those which failed.
+func (g *flushGroup) wait(ctx context.Context) error {
+	g.mu.Lock()
+	entries := make([]*flushEntry, 0, len(g.pending))
+	for e := range g.pending {
+		entries = append(entries, e)
+	}
+	g.mu.Unlock()
+
+	var failed []*flushEntry
+	for _, e := range entries {
+		select {
+		case <-e.done:
+		case <-ctx.Done():
+			return fmt.Errorf("error flushing sends: %w", ctx.Err())
+		}
+		if e.err != nil {
+			failed = append(failed, e)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+
+	sort.Slice(failed, func(i, j int) bool { return failed[i].seq < failed[j].seq })
+	flushErr := &FlushError{Errors: make(map[string]error, len(failed))}
+	for _, e := range failed {
+		flushErr.Errors[e.key] = e.err
+		flushErr.order = append(flushErr.order, e.key)
+	}
+	return flushErr
+}
@@ -0,0 +1,136 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFlush(t *testing.T) {
+	release := make(chan struct{})
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	})
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("expected nothing to flush, got %v", err)
+	}
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	client.SendAsync(context.Background(), msg)
+	client.SendAsync(context.Background(), msg)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := client.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the flush to time out while the sends are in flight, got %v", err)
+	}
+
+	flushed := make(chan error, 1)
+	go func() { flushed <- client.Flush(context.Background()) }()
+	select {
+	case err := <-flushed:
+		t.Fatalf("expected the flush to wait for the sends, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+	if err := <-flushed; err != nil {
+		t.Fatalf("expected the sends to succeed, got %v", err)
+	}
+}
+
+func TestFlushErrors(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	client.SendAsync(context.Background(), msg)
+	client.SendAsync(context.Background(), Message{From: "from@example.com", PlainBody: "hello"})
+
+	var flushErr *FlushError
+	if err := client.Flush(context.Background()); !errors.As(err, &flushErr) || len(flushErr.Errors) != 2 {
+		t.Fatalf("expected both sends to fail, got %v", err)
+	}
+	if !errors.Is(flushErr.Errors["1"], ErrServerUnavailable) || !errors.Is(flushErr.Errors["2"], ErrNoRecipients) {
+		t.Fatalf("unexpected errors: %v", flushErr.Errors)
+	}
+	// Failures are only reported once.
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("expected nothing left to flush, got %v", err)
+	}
+}
+
+func TestFlushErrorFirst(t *testing.T) {
+	var g flushGroup
+	entries := make([]*flushEntry, 12)
+	for i := range entries {
+		entries[i] = g.add("")
+	}
+	flushed := make(chan error, 1)
+	go func() { flushed <- g.wait(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+
+	// Send 10 fails before send 2, which sorts before it as a string.
+	g.finish(entries[9], errors.New("tenth"))
+	g.finish(entries[1], errors.New("second"))
+	for i, e := range entries {
+		if i != 9 && i != 1 {
+			g.finish(e, nil)
+		}
+	}
+
+	err := <-flushed
+	if err == nil || !strings.Contains(err.Error(), "2 sends failed, first 10: tenth") {
+		t.Fatalf("expected the first failure to be send 10, got %v", err)
+	}
+
+	// Without the order of the failures, the lowest number comes first.
+	err = &FlushError{Errors: map[string]error{"10": errors.New("tenth"), "2": errors.New("second")}}
+	if !strings.Contains(err.Error(), "first 2: second") {
+		t.Fatalf("expected send 2 to come first, got %v", err)
+	}
+}
+
+func TestOutboxFlush(t *testing.T) {
+	release := make(chan struct{})
+	client := &outboxClient{fail: func(_ context.Context, msg Message, _ int) error {
+		<-release
+		if msg.Subject == "invalid" {
+			return withKind(ErrInvalidMessage, errors.New("bad message"))
+		}
+		return nil
+	}}
+	o := NewOutbox(client, NewMemoryOutboxStore(), testOutboxOptions)
+	var ids []string
+	for _, s := range []string{"hello", "invalid"} {
+		id, err := o.Enqueue(context.Background(), Message{Subject: s})
+		if err != nil {
+			t.Fatalf("error queuing message: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Run(ctx)
+
+	flushed := make(chan error, 1)
+	go func() { flushed <- o.Flush(context.Background()) }()
+	select {
+	case err := <-flushed:
+		t.Fatalf("expected the flush to wait for the queued messages, got %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+	close(release)
+
+	var flushErr *FlushError
+	if err := <-flushed; !errors.As(err, &flushErr) || len(flushErr.Errors) != 1 || !errors.Is(flushErr.Errors[ids[1]], ErrInvalidMessage) {
+		t.Fatalf("expected the invalid message to fail, got %v", err)
+	}
+	if got := client.subjects(); len(got) != 2 {
+		t.Fatalf("expected both messages to be sent before the flush returned, got %v", got)
+	}
+}
@@ -0,0 +1,67 @@
+package postal
+
+import "fmt"
+
+// RequestFormat names the JSON fields of the raw send request, for servers
+// with a Postal-compatible API which name them differently, such as "from"
+// instead of "mail_from". Empty names are postal's. See WithRequestFormat.
+type RequestFormat struct {
+	MailFrom string
+	RcptTo   string
+	Data     string
+	Bounce   string
+}
+
+// PostalRequestFormat is the format of postal's raw send endpoint, which the
+// client uses by default.
+var PostalRequestFormat = RequestFormat{
+	MailFrom: "mail_from",
+	RcptTo:   "rcpt_to",
+	Data:     "data",
+	Bounce:   "bounce",
+}
+
+// withDefaults returns the format with postal's names for the fields it
+// doesn't name.
+func (f RequestFormat) withDefaults() RequestFormat {
+	if f.MailFrom == "" {
+		f.MailFrom = PostalRequestFormat.MailFrom
+	}
+	if f.RcptTo == "" {
+		f.RcptTo = PostalRequestFormat.RcptTo
+	}
+	if f.Data == "" {
+		f.Data = PostalRequestFormat.Data
+	}
+	if f.Bounce == "" {
+		f.Bounce = PostalRequestFormat.Bounce
+	}
+	return f
+}
+
+// check checks that the format names every field differently.
+func (f RequestFormat) check() error {
+	seen := make(map[string]bool, 4)
+	for _, name := range []string{f.MailFrom, f.RcptTo, f.Data, f.Bounce} {
+		if seen[name] {
+			return fmt.Errorf("invalid request format: field name %q is used twice", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// rawPayload returns the JSON payload of the raw send request in the client's
+// request format.
+func (a *ApiClient) rawPayload(r request) interface{} {
+	f := a.requestFormat
+	if f == PostalRequestFormat {
+		return r
+	}
+	return map[string]interface{}{
+		f.MailFrom: r.From,
+		f.RcptTo:   r.To,
+		f.Data:     r.Data,
+		f.Bounce:   r.Bounce,
+	}
+}
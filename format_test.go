@@ -0,0 +1,62 @@
+package postal
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestWithRequestFormat(t *testing.T) {
+	var body map[string]interface{}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &body); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithRequestFormat(RequestFormat{MailFrom: "from", RcptTo: "to"}))
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	keys := make(map[string]bool, len(body))
+	for k := range body {
+		keys[k] = true
+	}
+	if want := map[string]bool{"from": true, "to": true, "data": true, "bounce": true}; !reflect.DeepEqual(keys, want) {
+		t.Fatalf("expected fields %v, got %v", want, keys)
+	}
+	if body["from"] != "from@example.com" {
+		t.Fatalf("unexpected from %v", body["from"])
+	}
+}
+
+func TestRequestFormatDefault(t *testing.T) {
+	// The clock and Message-ID are fixed so both builds are the same.
+	client, _ := newRecordingClient(t, WithClock(newFakeClock()))
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello", Headers: map[string][]string{"Message-Id": {"<fixed@example.com>"}}}
+
+	got, err := client.BuildSendRequest(msg)
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	req, _, err := client.buildRequest(client.normalize(context.Background(), msg))
+	if err != nil {
+		t.Fatalf("error building request: %v", err)
+	}
+	want, _ := json.Marshal(req)
+	if string(got) != string(want) {
+		t.Fatalf("expected the default format to be postal's, got %s", got)
+	}
+}
+
+func TestWithRequestFormatInvalid(t *testing.T) {
+	if _, err := NewAPIClient("http://localhost", "token", nil, WithRequestFormat(RequestFormat{MailFrom: "data"})); err == nil {
+		t.Fatal("expected an error for a field name used twice")
+	}
+}
@@ -0,0 +1,238 @@
+package postal
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+)
+
+const (
+	HdrOrganization    = "Organization"
+	HdrXMailer         = "X-Mailer"
+	HdrFeedbackID      = "Feedback-ID"
+	HdrContentLanguage = "Content-Language"
+
+	// HdrAutoResponseSuppress is the header Exchange reads which automatic
+	// responses to suppress for a message, see SuppressAutoResponse.
+	HdrAutoResponseSuppress = "X-Auto-Response-Suppress"
+)
+
+// Values of the X-Auto-Response-Suppress header: the kinds of automatic
+// responses Exchange shouldn't send for a message.
+const (
+	// SuppressNone suppresses no responses, it can't be combined with others.
+	SuppressNone = "None"
+	// SuppressAll suppresses all automatic responses.
+	SuppressAll = "All"
+	// SuppressDR suppresses delivery reports.
+	SuppressDR = "DR"
+	// SuppressNDR suppresses non-delivery reports.
+	SuppressNDR = "NDR"
+	// SuppressRN suppresses read notifications.
+	SuppressRN = "RN"
+	// SuppressNRN suppresses not read notifications.
+	SuppressNRN = "NRN"
+	// SuppressOOF suppresses out of office replies.
+	SuppressOOF = "OOF"
+	// SuppressAutoReply suppresses auto-replies other than out of office
+	// replies.
+	SuppressAutoReply = "AutoReply"
+)
+
+// autoResponseKinds are the values of the X-Auto-Response-Suppress header,
+// by their lower cased form.
+var autoResponseKinds = map[string]string{
+	"none":      SuppressNone,
+	"all":       SuppressAll,
+	"dr":        SuppressDR,
+	"ndr":       SuppressNDR,
+	"rn":        SuppressRN,
+	"nrn":       SuppressNRN,
+	"oof":       SuppressOOF,
+	"autoreply": SuppressAutoReply,
+}
+
+// maxFeedbackIDLength is the maximum length of a Feedback-ID header value.
+const maxFeedbackIDLength = 255
+
+// defaultMailer is the X-Mailer header of messages, unless changed with
+// WithMailer.
+const defaultMailer = "postal_go"
+
+// SetOrganization sets the Organization header of the message.
+func (m *Message) SetOrganization(name string) error {
+	name = strings.TrimSpace(name)
+	if err := checkHeaderValue(HdrOrganization, name); err != nil {
+		return err
+	}
+
+	if m.Headers == nil {
+		m.Headers = textproto.MIMEHeader{}
+	}
+	m.Headers.Set(HdrOrganization, name)
+	return nil
+}
+
+// SetFeedbackID sets the Feedback-ID header, which Gmail uses to report
+// spam rates per campaign, customer and type of mail of a sender. senderID,
+// a stable identifier of the sender, is required; the other parts can be
+// empty. None of the parts may contain colons or whitespace.
+func (m *Message) SetFeedbackID(campaign, customer, mailType, senderID string) error {
+	if senderID == "" {
+		return fmt.Errorf("%s header needs a sender id", HdrFeedbackID)
+	}
+
+	parts := []string{campaign, customer, mailType, senderID}
+	for _, p := range parts {
+		for _, c := range p {
+			if c <= ' ' || c > '~' || c == ':' {
+				return fmt.Errorf("invalid character %q in %s header part %q", c, HdrFeedbackID, p)
+			}
+		}
+	}
+
+	value := strings.Join(parts, ":")
+	if len(value) > maxFeedbackIDLength {
+		return fmt.Errorf("%s header is over %d characters", HdrFeedbackID, maxFeedbackIDLength)
+	}
+
+	if m.Headers == nil {
+		m.Headers = textproto.MIMEHeader{}
+	}
+	m.Headers.Set(HdrFeedbackID, value)
+	return nil
+}
+
+// SuppressAutoResponse sets the X-Auto-Response-Suppress header, which makes
+// Exchange and Outlook recipients not send the given kinds of automatic
+// responses, such as SuppressOOF and SuppressAutoReply, to the message. The
+// kinds are matched case insensitively and written in their usual case.
+// Along with an Auto-Submitted header, it keeps automated mail from starting
+// auto-reply loops with Exchange recipients.
+func (m *Message) SuppressAutoResponse(kinds ...string) error {
+	if len(kinds) == 0 {
+		return fmt.Errorf("%s header needs at least one kind", HdrAutoResponseSuppress)
+	}
+
+	values := make([]string, 0, len(kinds))
+	seen := make(map[string]bool, len(kinds))
+	for _, k := range kinds {
+		v, ok := autoResponseKinds[strings.ToLower(strings.TrimSpace(k))]
+		if !ok {
+			return fmt.Errorf("invalid %s kind %q", HdrAutoResponseSuppress, k)
+		}
+		if !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	if seen[SuppressNone] && len(values) > 1 {
+		return fmt.Errorf("%s kind %s can't be combined with others", HdrAutoResponseSuppress, SuppressNone)
+	}
+
+	if m.Headers == nil {
+		m.Headers = textproto.MIMEHeader{}
+	}
+	m.Headers.Set(HdrAutoResponseSuppress, strings.Join(values, ", "))
+	return nil
+}
+
+// checkLanguageTag checks that tag looks like a BCP 47 language tag: a
+// primary language of 2 to 3 letters, or 4 to 8 for registered ones, followed
+// by subtags of 1 to 8 letters and digits.
+func checkLanguageTag(tag string) error {
+	subtags := strings.Split(tag, "-")
+	if n := len(subtags[0]); n < 2 || n > 8 || !isAlpha(subtags[0]) {
+		return fmt.Errorf("invalid language tag %q", tag)
+	}
+	for _, s := range subtags[1:] {
+		if len(s) < 1 || len(s) > 8 || !isAlphanumeric(s) {
+			return fmt.Errorf("invalid language tag %q", tag)
+		}
+	}
+	return nil
+}
+
+func isAlpha(s string) bool {
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlphanumeric(s string) bool {
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkHeaderValue checks that value can be used for the header key: it must
+// not be empty, or contain line breaks or other control characters which
+// could end the header.
+func checkHeaderValue(key, value string) error {
+	if value == "" {
+		return fmt.Errorf("empty %s header", key)
+	}
+	for _, c := range value {
+		if (c < ' ' && c != '\t') || c == 0x7f {
+			return fmt.Errorf("invalid character %q in %s header", c, key)
+		}
+	}
+	return nil
+}
+
+// DefaultMaxHeaderSize is the header size limit of many MTAs, 256 KiB, which
+// CheckHeaderSize and WithMaxHeaderSize use unless given another.
+const DefaultMaxHeaderSize = 256 << 10
+
+// ErrHeaderTooLarge is returned when the header of a message is larger than
+// the client allows, see WithMaxHeaderSize.
+var ErrHeaderTooLarge = errors.New("postal: message header too large")
+
+// CheckHeaderSize warns if the header of the message is likely to be larger
+// than limit bytes, or DefaultMaxHeaderSize if limit isn't positive, such as
+// with a long References chain or many custom headers. MTAs reject messages
+// with headers over their limit. The size is estimated from the message's
+// fields without building it; use WithMaxHeaderSize to reject messages
+// whose built header is too large.
+func (m Message) CheckHeaderSize(limit int) []Warning {
+	if limit <= 0 {
+		limit = DefaultMaxHeaderSize
+	}
+	if size := m.headerSize(); size > limit {
+		return []Warning{{Field: "Headers", Message: fmt.Sprintf("header is about %d bytes, over the limit of %d", size, limit)}}
+	}
+	return nil
+}
+
+// headerSize estimates the size of the message's header, before encoding
+// and folding, from its addresses, subject and headers.
+func (m Message) headerSize() int {
+	size := len(m.From) + len(m.Sender) + len(m.Subject)
+	for _, list := range [][]string{m.To, m.Cc, m.ReplyTo} {
+		for _, a := range list {
+			size += len(a) + 2
+		}
+	}
+	for k, vals := range m.Headers {
+		for _, v := range vals {
+			size += len(k) + len(v) + 4
+		}
+	}
+	return size
+}
+
+// checkHeaderSize checks the size of a header against the client's maximum
+// header size.
+func (a *ApiClient) checkHeaderSize(size int) error {
+	if a.maxHeaderSize > 0 && size > a.maxHeaderSize {
+		return withKind(ErrInvalidMessage, fmt.Errorf("%w: header is %d bytes, the limit is %d", ErrHeaderTooLarge, size, a.maxHeaderSize))
+	}
+	return nil
+}
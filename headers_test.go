@@ -0,0 +1,217 @@
+package postal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestSetOrganization(t *testing.T) {
+	var msg Message
+	if err := msg.SetOrganization(" Example Corp "); err != nil {
+		t.Fatalf("error setting organization: %v", err)
+	}
+	if got := msg.Headers.Get(HdrOrganization); got != "Example Corp" {
+		t.Fatalf("unexpected organization %q", got)
+	}
+
+	for _, name := range []string{"", "Evil\r\nBcc: victim@example.com", "Null\x00"} {
+		if err := msg.SetOrganization(name); err == nil {
+			t.Fatalf("expected an error for %q", name)
+		}
+	}
+	if got := msg.Headers.Get(HdrOrganization); got != "Example Corp" {
+		t.Fatalf("invalid organization replaced the header: %q", got)
+	}
+}
+
+func TestMailer(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		headers textproto.MIMEHeader
+		want    string
+	}{
+		{"default", nil, nil, defaultMailer},
+		{"client", []Option{WithMailer("billing-service/1.2")}, nil, "billing-service/1.2"},
+		{"message", []Option{WithMailer("billing-service/1.2")}, textproto.MIMEHeader{HdrXMailer: {"custom"}}, "custom"},
+		{"disabled", []Option{WithMailer("")}, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, rec := newRecordingClient(t, tt.opts...)
+			msg := Message{
+				From:      "from@example.com",
+				To:        []string{"to@example.com"},
+				PlainBody: "hello",
+				Headers:   tt.headers,
+			}
+			if _, err := client.SendMessage(msg); err != nil {
+				t.Fatalf("error sending message: %v", err)
+			}
+
+			m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+			if err != nil {
+				t.Fatalf("error parsing message: %v", err)
+			}
+			if got := m.Header.Get(HdrXMailer); got != tt.want {
+				t.Fatalf("expected X-Mailer %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWithMailerInvalid(t *testing.T) {
+	if _, err := NewAPIClient("https://postal.example.com", "token", nil, WithMailer("bad\r\nname")); err == nil {
+		t.Fatal("expected an error for an invalid mailer")
+	}
+}
+
+func TestSetFeedbackID(t *testing.T) {
+	var msg Message
+	if err := msg.SetFeedbackID("spring-sale", "acme", "promo", "mailer1"); err != nil {
+		t.Fatalf("error setting feedback id: %v", err)
+	}
+	if got := msg.Headers.Get(HdrFeedbackID); got != "spring-sale:acme:promo:mailer1" {
+		t.Fatalf("unexpected feedback id %q", got)
+	}
+
+	if err := msg.SetFeedbackID("", "", "", "mailer1"); err != nil {
+		t.Fatalf("error setting feedback id with only a sender id: %v", err)
+	}
+	if got := msg.Headers.Get(HdrFeedbackID); got != ":::mailer1" {
+		t.Fatalf("unexpected feedback id %q", got)
+	}
+
+	invalid := [][4]string{
+		{"campaign", "customer", "promo", ""},
+		{"a:b", "customer", "promo", "mailer1"},
+		{"campaign", "acme corp", "promo", "mailer1"},
+		{"campaign", "customer", "promo\r\n", "mailer1"},
+		{strings.Repeat("x", 250), "customer", "promo", "mailer1"},
+	}
+	for _, p := range invalid {
+		if err := msg.SetFeedbackID(p[0], p[1], p[2], p[3]); err == nil {
+			t.Fatalf("expected an error for %q", p)
+		}
+	}
+}
+
+func TestContentLanguage(t *testing.T) {
+	client, rec := newRecordingClient(t)
+	msg := Message{
+		From:            "from@example.com",
+		To:              []string{"to@example.com"},
+		PlainBody:       "olá",
+		ContentLanguage: "pt-BR",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get(HdrContentLanguage); got != "pt-BR" {
+		t.Fatalf("expected Content-Language pt-BR, got %q", got)
+	}
+
+	for _, tag := range []string{"e", "en_US", "en-", "pt-BR\r\nBcc: victim@example.com", "zh-Hant-toolongsubtag"} {
+		msg.ContentLanguage = tag
+		if err := msg.Validate(); !errors.Is(err, ErrInvalidMessage) {
+			t.Fatalf("expected ErrInvalidMessage for %q, got %v", tag, err)
+		}
+	}
+	for _, tag := range []string{"en", "zh-Hant-TW", "sr-Latn-RS", "es-419"} {
+		if err := checkLanguageTag(tag); err != nil {
+			t.Fatalf("unexpected error for %q: %v", tag, err)
+		}
+	}
+}
+
+func TestContentLanguageExplicitHeader(t *testing.T) {
+	client, rec := newRecordingClient(t)
+	msg := Message{
+		From:            "from@example.com",
+		To:              []string{"to@example.com"},
+		PlainBody:       "hello",
+		ContentLanguage: "pt-BR",
+		Headers:         textproto.MIMEHeader{HdrContentLanguage: {"en, pt"}},
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header[HdrContentLanguage]; len(got) != 1 || got[0] != "en, pt" {
+		t.Fatalf("expected the explicit Content-Language header, got %q", got)
+	}
+}
+
+func TestSuppressAutoResponse(t *testing.T) {
+	var msg Message
+	if err := msg.SuppressAutoResponse("oof", "AUTOREPLY", SuppressOOF); err != nil {
+		t.Fatalf("error setting auto response suppress: %v", err)
+	}
+	if got := msg.Headers.Get(HdrAutoResponseSuppress); got != "OOF, AutoReply" {
+		t.Fatalf("unexpected %s header %q", HdrAutoResponseSuppress, got)
+	}
+
+	for _, kinds := range [][]string{nil, {"vacation"}, {"OOF\r\nBcc: victim@example.com"}, {SuppressNone, SuppressOOF}} {
+		if err := msg.SuppressAutoResponse(kinds...); err == nil {
+			t.Fatalf("expected an error for %q", kinds)
+		}
+	}
+}
+
+func TestHeaderSize(t *testing.T) {
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, Subject: "hello", PlainBody: "hello"}
+	if w := msg.CheckHeaderSize(0); w != nil {
+		t.Fatalf("expected no warnings, got %v", w)
+	}
+
+	// A long References chain, like that of a thread with thousands of
+	// replies.
+	refs := make([]string, 0, 10000)
+	for i := 0; i < cap(refs); i++ {
+		refs = append(refs, fmt.Sprintf("<message-%d@mail.example.com>", i))
+	}
+	msg.Headers = textproto.MIMEHeader{HdrReferences: {strings.Join(refs, " ")}}
+	if w := msg.CheckHeaderSize(0); len(w) != 1 || w[0].Field != "Headers" {
+		t.Fatalf("expected a header size warning, got %v", w)
+	}
+
+	for _, structured := range []bool{false, true} {
+		opts := []Option{WithMaxHeaderSize(0)}
+		if structured {
+			opts = append(opts, WithStructuredSend())
+		}
+		client, rec := newRecordingClient(t, opts...)
+		_, err := client.SendMessage(msg)
+		if !errors.Is(err, ErrHeaderTooLarge) || !errors.Is(err, ErrInvalidMessage) {
+			t.Fatalf("structured %v: expected ErrHeaderTooLarge, got %v", structured, err)
+		}
+		if len(rec.reqs) != 0 {
+			t.Fatalf("structured %v: expected nothing to be sent", structured)
+		}
+	}
+
+	// Without the option, or within the limit, the message is sent.
+	client, _ := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	client, _ = newRecordingClient(t, WithMaxHeaderSize(1<<20))
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package postal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// maxInlineStyle is the length of a style attribute above which CheckHTML
+// warns about it.
+const maxInlineStyle = 1024
+
+// voidElements are the HTML elements which have no end tag.
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// optionalEndElements are the HTML elements whose end tag may be left out.
+var optionalEndElements = map[string]bool{
+	"html": true, "head": true, "body": true, "p": true, "li": true, "dt": true, "dd": true,
+	"option": true, "optgroup": true, "thead": true, "tbody": true, "tfoot": true, "tr": true,
+	"td": true, "th": true, "colgroup": true, "caption": true, "rt": true, "rp": true,
+}
+
+var styleAttr = regexp.MustCompile(`(?is)\sstyle\s*=\s*("[^"]*"|'[^']*')`)
+
+// CheckHTML does a lightweight check of the message's HTML body for
+// problems which make it render poorly in some clients or trip spam
+// filters: unclosed and unmatched tags, a missing <html> or <body>, and
+// oversized inline styles. It's advisory, the HTML isn't fully parsed, and
+// a message with warnings can still be sent.
+func (m Message) CheckHTML() []Warning {
+	if m.HTMLBody == "" {
+		return nil
+	}
+
+	var (
+		warnings []Warning
+		open     []string
+		seen     = map[string]bool{}
+		body     = m.HTMLBody
+	)
+	warn := func(format string, args ...interface{}) {
+		warnings = append(warnings, Warning{Field: "HTMLBody", Message: fmt.Sprintf(format, args...)})
+	}
+
+	for {
+		i := strings.IndexByte(body, '<')
+		if i < 0 {
+			break
+		}
+		body = body[i:]
+
+		switch {
+		case strings.HasPrefix(body, "<!--"):
+			end := strings.Index(body, "-->")
+			if end < 0 {
+				warn("unclosed comment")
+				body = ""
+				continue
+			}
+			body = body[end+3:]
+			continue
+		case strings.HasPrefix(body, "<!") || strings.HasPrefix(body, "<?"):
+			body = skipTag(body)
+			continue
+		}
+
+		closing := strings.HasPrefix(body, "</")
+		name := tagName(strings.TrimPrefix(body[1:], "/"))
+		if name == "" {
+			// A lone "<" in text.
+			body = body[1:]
+			continue
+		}
+		tag := body[:len(body)-len(skipTag(body))]
+		body = body[len(tag):]
+
+		if closing {
+			j := len(open) - 1
+			for j >= 0 && open[j] != name {
+				j--
+			}
+			if j < 0 {
+				warn("</%s> closes a tag which isn't open", name)
+				continue
+			}
+			for _, unclosed := range open[j+1:] {
+				if !optionalEndElements[unclosed] {
+					warn("<%s> isn't closed before </%s>", unclosed, name)
+				}
+			}
+			open = open[:j]
+			continue
+		}
+
+		seen[name] = true
+		for _, attr := range styleAttr.FindAllStringSubmatch(tag, -1) {
+			if n := len(attr[1]) - 2; n > maxInlineStyle {
+				warn("<%s> has a %d character inline style, clients may cut it", name, n)
+			}
+		}
+		if voidElements[name] || strings.HasSuffix(tag, "/>") {
+			continue
+		}
+		if name == "script" || name == "style" {
+			if end := strings.Index(strings.ToLower(body), "</"+name); end >= 0 {
+				body = body[end:]
+			}
+		}
+		open = append(open, name)
+	}
+
+	for _, unclosed := range open {
+		if !optionalEndElements[unclosed] {
+			warn("<%s> isn't closed", unclosed)
+		}
+	}
+	if !seen["html"] {
+		warn("missing <html> element")
+	}
+	if !seen["body"] {
+		warn("missing <body> element")
+	}
+	return warnings
+}
+
+// tagName returns the lower cased name of the tag starting at s, or an empty
+// string if s doesn't start with one.
+func tagName(s string) string {
+	if s == "" || !isAlpha(s[:1]) {
+		return ""
+	}
+	i := 1
+	for i < len(s) && (isAlphanumeric(s[i:i+1]) || s[i] == '-') {
+		i++
+	}
+	return strings.ToLower(s[:i])
+}
+
+// skipTag returns s after the tag it starts with, skipping quoted attribute
+// values. It returns an empty string if the tag isn't closed.
+func skipTag(s string) string {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return s[i+1:]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package postal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want []string
+	}{
+		{"well formed", `<html><head><style>p > a { color: red }</style></head><body><p>Hi<br><img src="a.png" alt="a > b"/><!-- <div> --></body></html>`, nil},
+		{"optional end tags", `<html><body><ul><li>one<li>two</ul><p>text</body></html>`, nil},
+		{"unclosed", `<html><body><div><table><tr><td>cell</table></body></html>`, []string{"<div> isn't closed before </body>"}},
+		{"unmatched", `<html><body><p>text</span></p></body></html>`, []string{"</span> closes a tag which isn't open"}},
+		{"fragment", `<p>Hello <b>there</b></p>`, []string{"missing <html> element", "missing <body> element"}},
+		{"inline style", `<html><body><div style="` + strings.Repeat("color:red;", 200) + `">x</div></body></html>`, []string{"<div> has a 2000 character inline style, clients may cut it"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := Message{HTMLBody: tt.html}.CheckHTML()
+			var got []string
+			for _, w := range warnings {
+				if w.Field != "HTMLBody" {
+					t.Fatalf("unexpected field %q", w.Field)
+				}
+				got = append(got, w.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Fatalf("expected warnings %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	if w := (Message{PlainBody: "hello"}).CheckHTML(); w != nil {
+		t.Fatalf("expected no warnings without an HTML body, got %v", w)
+	}
+}
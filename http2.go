@@ -0,0 +1,53 @@
+package postal
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// http2BufferSize is the size of the read and write buffers of the HTTP/2
+// transport, large enough for a request body carrying a message with
+// attachments to be written in few syscalls.
+const http2BufferSize = 64 << 10
+
+// NewHTTP2Transport returns a transport for the http client given to
+// NewAPIClient which sends requests over HTTP/2 when postal, or the load
+// balancer in front of it, supports it, so concurrent sends are multiplexed
+// over a single connection rather than each taking one. tlsConfig, which may
+// be nil, configures the TLS connections; it's cloned, and h2 is added to
+// its NextProtos.
+//
+// HTTP/2 is only negotiated over TLS: requests to an http:// base URL still
+// use HTTP/1.1. The client's requests need nothing else for HTTP/2: their
+// bodies have a known length, and header names are sent lower cased like
+// HTTP/2 requires, which postal reads regardless of case.
+func NewHTTP2Transport(tlsConfig *tls.Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	// A transport with its own TLS config only attempts HTTP/2 if it's
+	// forced to.
+	t.ForceAttemptHTTP2 = true
+	if tlsConfig != nil {
+		t.TLSClientConfig = tlsConfig.Clone()
+	} else {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	if !hasProto(t.TLSClientConfig.NextProtos, "h2") {
+		t.TLSClientConfig.NextProtos = append([]string{"h2"}, t.TLSClientConfig.NextProtos...)
+	}
+	if !hasProto(t.TLSClientConfig.NextProtos, "http/1.1") {
+		t.TLSClientConfig.NextProtos = append(t.TLSClientConfig.NextProtos, "http/1.1")
+	}
+	t.ReadBufferSize = http2BufferSize
+	t.WriteBufferSize = http2BufferSize
+	return t
+}
+
+// hasProto reports whether protos has the ALPN protocol proto.
+func hasProto(protos []string, proto string) bool {
+	for _, p := range protos {
+		if p == proto {
+			return true
+		}
+	}
+	return false
+}
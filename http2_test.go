@@ -0,0 +1,60 @@
+package postal
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestHTTP2Transport(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		protos = map[int]int{}
+	)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		protos[r.ProtoMajor]++
+		mu.Unlock()
+
+		if r.Header.Get("X-Server-API-Key") != "test-token" {
+			t.Errorf("expected the token header, got %v", r.Header)
+		}
+		req := request{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		w.Write(successResponse("abc@postal", req.To))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	client, err := NewAPIClient(srv.URL, "test-token", &http.Client{Transport: NewHTTP2Transport(&tls.Config{RootCAs: roots})})
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SendMessage(retryMsg); err != nil {
+				t.Errorf("error sending message: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if protos[2] != 5 {
+		t.Fatalf("expected every request over HTTP/2, got %v", protos)
+	}
+}
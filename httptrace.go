@@ -0,0 +1,110 @@
+package postal
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// RequestTiming is the breakdown of the time a request to postal took, see
+// WithHTTPTrace. The durations of steps which didn't happen, such as DNS,
+// Connect and TLS for a request over a reused connection, are zero.
+type RequestTiming struct {
+	// Path is the API path of the request, such as /api/v1/send/raw.
+	Path string
+	// DNS is the time taken to look up the server's address, Connect to
+	// connect to it, and TLS the TLS handshake.
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// ReusedConn is set if the request was sent over a connection kept from
+	// an earlier request.
+	ReusedConn bool
+	// TimeToFirstByte is the time from the request being written to the
+	// first byte of the response: mostly the time postal took to process
+	// it.
+	TimeToFirstByte time.Duration
+	// Total is the time from the request being started to the response
+	// being read, or the request failing.
+	Total time.Duration
+}
+
+// requestTracer records the timing of a request with an httptrace
+// ClientTrace. The trace's hooks may be called from other goroutines, such
+// as those dialing, hence the lock.
+type requestTracer struct {
+	clock Clock
+
+	mu                                   sync.Mutex
+	start, dns, connect, tlsStart, wrote time.Time
+	timing                               RequestTiming
+}
+
+func newRequestTracer(clock Clock, path string) *requestTracer {
+	return &requestTracer{clock: clock, start: clock.Now(), timing: RequestTiming{Path: path}}
+}
+
+// since returns the time since t, or 0 if t is zero.
+func (r *requestTracer) since(t time.Time) time.Duration {
+	if t.IsZero() {
+		return 0
+	}
+	return r.clock.Now().Sub(t)
+}
+
+// withTrace returns ctx with the tracer's ClientTrace.
+func (r *requestTracer) withTrace(ctx context.Context) context.Context {
+	record := func(f func()) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		f()
+	}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func() { r.timing.ReusedConn = info.Reused })
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			record(func() { r.dns = r.clock.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			record(func() { r.timing.DNS = r.since(r.dns) })
+		},
+		ConnectStart: func(network, addr string) {
+			record(func() {
+				if r.connect.IsZero() {
+					r.connect = r.clock.Now()
+				}
+			})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			// With several addresses, the connection which succeeded
+			// ends the step.
+			if err == nil {
+				record(func() { r.timing.Connect = r.since(r.connect) })
+			}
+		},
+		TLSHandshakeStart: func() {
+			record(func() { r.tlsStart = r.clock.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func() { r.timing.TLS = r.since(r.tlsStart) })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			record(func() { r.wrote = r.clock.Now() })
+		},
+		GotFirstResponseByte: func() {
+			record(func() { r.timing.TimeToFirstByte = r.since(r.wrote) })
+		},
+	})
+}
+
+// done returns the timing of the request, once it's finished.
+func (r *requestTracer) done() RequestTiming {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.timing.Total = r.since(r.start)
+	return r.timing
+}
@@ -0,0 +1,78 @@
+package postal
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestWithHTTPTrace(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		timings []RequestTiming
+	)
+	client, _ := newRecordingClient(t, WithHTTPTrace(func(ctx context.Context, timing RequestTiming) {
+		mu.Lock()
+		timings = append(timings, timing)
+		mu.Unlock()
+	}))
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	for i := 0; i < 2; i++ {
+		res, err := client.SendMessageFull(context.Background(), msg)
+		if err != nil {
+			t.Fatalf("error sending message: %v", err)
+		}
+		if res.Timing == nil || res.Timing.Path != "/api/v1/send/raw" {
+			t.Fatalf("expected the timing in the result, got %+v", res.Timing)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(timings) != 2 {
+		t.Fatalf("expected the callback to fire for both sends, got %d", len(timings))
+	}
+	first, second := timings[0], timings[1]
+	if first.ReusedConn || first.Connect <= 0 {
+		t.Fatalf("expected the first request to connect, got %+v", first)
+	}
+	if !second.ReusedConn || second.Connect != 0 {
+		t.Fatalf("expected the second request to reuse the connection, got %+v", second)
+	}
+	for _, timing := range timings {
+		if timing.Total <= 0 || timing.Total < timing.TimeToFirstByte {
+			t.Fatalf("unexpected timing: %+v", timing)
+		}
+	}
+}
+
+func TestWithHTTPTraceFailure(t *testing.T) {
+	calls := 0
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}, WithHTTPTrace(func(ctx context.Context, timing RequestTiming) {
+		calls++
+	}))
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if _, err := client.SendMessage(msg); err == nil {
+		t.Fatal("expected the send to fail")
+	}
+	if calls != 1 {
+		t.Fatalf("expected the failed request to be reported once, got %d", calls)
+	}
+}
+
+func TestFullResultTimingUntraced(t *testing.T) {
+	client, _ := newRecordingClient(t)
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	res, err := client.SendMessageFull(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if res.Timing != nil {
+		t.Fatalf("expected no timing without WithHTTPTrace, got %+v", res.Timing)
+	}
+}
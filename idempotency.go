@@ -0,0 +1,234 @@
+package postal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/mail"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrNoIdempotencyStore is returned by SendIdempotent when the client has no
+// idempotency store.
+var ErrNoIdempotencyStore = errors.New("postal: no idempotency store, see WithIdempotencyStore")
+
+// IdempotencyStore records the responses of the sends made with
+// SendIdempotent by key, so a message is only sent once per key even if it's
+// retried by another process. Back it with a store shared by every instance
+// of the application, such as Redis or a database, to make at-least-once
+// delivery safe across processes. See WithIdempotencyStore.
+type IdempotencyStore interface {
+	// Seen returns the response of the send with the key. ok is false if
+	// there was none.
+	Seen(ctx context.Context, key string) (resp Response, ok bool, err error)
+	// Record records a send with the key.
+	Record(ctx context.Context, key string, resp Response) error
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore which keeps sends in memory,
+// so it only deduplicates sends made by one process. It's safe for
+// concurrent use.
+type MemoryIdempotencyStore struct {
+	mu    sync.Mutex
+	sends map[string]Response
+}
+
+// NewMemoryIdempotencyStore returns an empty MemoryIdempotencyStore.
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{sends: make(map[string]Response)}
+}
+
+func (m *MemoryIdempotencyStore) Seen(_ context.Context, key string) (Response, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	resp, ok := m.sends[key]
+	return resp, ok, nil
+}
+
+func (m *MemoryIdempotencyStore) Record(_ context.Context, key string, resp Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sends[key] = resp
+	return nil
+}
+
+// SendIdempotent sends the message unless a send with the same key is in the
+// client's idempotency store, in which case it returns that send's response
+// and false without sending anything. An empty key is replaced by the
+// message's IdempotencyKey, derived from its content. Failed sends aren't
+// recorded, so they can be retried with the same key.
+//
+// The store is checked and then updated, so two concurrent sends with the
+// same key can both go out unless the store serializes them.
+func (a *ApiClient) SendIdempotent(ctx context.Context, msg Message, key string) (Response, bool, error) {
+	if a.idempotency == nil {
+		return Response{}, false, ErrNoIdempotencyStore
+	}
+	if key == "" {
+		key = msg.IdempotencyKey()
+	}
+
+	prev, ok, err := a.idempotency.Seen(ctx, key)
+	if err != nil {
+		return Response{}, false, fmt.Errorf("error looking up send %s: %w", key, err)
+	}
+	if ok {
+		return prev, false, nil
+	}
+
+	resp, err := a.SendMessageContext(ctx, msg)
+	if err != nil {
+		return resp, false, err
+	}
+	if err := a.idempotency.Record(ctx, key, resp); err != nil {
+		return resp, true, fmt.Errorf("error recording send %s: %w", key, err)
+	}
+	return resp, true, nil
+}
+
+// IdempotencyKey returns a key derived from the message's content: the
+// SHA-256 hash, in hex, of its addresses, subject, bodies, headers and
+// attachments. Messages with the same content have the same key, so it
+// identifies a message which is being sent again.
+func (m Message) IdempotencyKey() string {
+	h := sha256.New()
+	for _, s := range []string{m.From, m.Sender, m.Subject, m.PlainBody, m.HTMLBody} {
+		writeHashField(h, s)
+	}
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc, m.ReplyTo} {
+		writeHashField(h, list...)
+	}
+	// EnvelopeTo is only hashed when it's set, so messages without it keep
+	// their keys.
+	if len(m.EnvelopeTo) > 0 {
+		writeHashField(h, m.EnvelopeTo...)
+	}
+	// So is UnsubscribeURL, which the footer in the bodies is made of.
+	if m.UnsubscribeURL != "" {
+		writeHashField(h, m.UnsubscribeURL)
+	}
+
+	keys := make([]string, 0, len(m.Headers))
+	for k := range m.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		writeHashField(h, k)
+		writeHashField(h, m.Headers[k]...)
+	}
+
+	for _, at := range m.attachments {
+		if at.Source == nil {
+			writeHashField(h, at.Filename, string(at.Content))
+			continue
+		}
+		writeHashSource(h, at)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Fingerprint returns a fingerprint of the message's content: the SHA-256
+// hash, in hex, of its sender, recipients, subject, bodies and attachments,
+// normalized so that the same logical message has the same fingerprint.
+// Unlike IdempotencyKey, it ignores the headers, the display names of
+// addresses, the order of recipients and attachments, line endings and
+// trailing whitespace in the bodies, and runs of whitespace in the subject.
+//
+// Addresses which can't be parsed are hashed as they are, lower cased.
+func (m Message) Fingerprint() string {
+	h := sha256.New()
+	writeHashField(h, fingerprintAddresses([]string{m.From})...)
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc, m.EnvelopeTo} {
+		writeHashField(h, fingerprintAddresses(list)...)
+	}
+	writeHashField(h, strings.Join(strings.Fields(m.Subject), " "))
+	for _, b := range []string{m.PlainBody, m.HTMLBody} {
+		writeHashField(h, strings.TrimRight(normalizeWhitespace(b), "\r\n"))
+	}
+
+	attachments := make([]string, 0, len(m.attachments))
+	for _, at := range m.attachments {
+		attachments = append(attachments, at.Filename+"\x00"+attachmentHash(at))
+	}
+	sort.Strings(attachments)
+	writeHashField(h, attachments...)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// fingerprintAddresses returns the bare addresses of the list, lower cased
+// and sorted.
+func fingerprintAddresses(list []string) []string {
+	out := make([]string, 0, len(list))
+	for _, a := range list {
+		if strings.TrimSpace(a) == "" {
+			continue
+		}
+		if addrs, err := mail.ParseAddressList(a); err == nil {
+			for _, addr := range addrs {
+				out = append(out, strings.ToLower(addr.Address))
+			}
+			continue
+		}
+		out = append(out, strings.ToLower(strings.TrimSpace(a)))
+	}
+	sort.Strings(out)
+	return out
+}
+
+// attachmentHash returns the SHA-256 hash, in hex, of the attachment's
+// content. The content of a source which can't be read hashes as empty.
+func attachmentHash(at Attachment) string {
+	h := sha256.New()
+	if at.Source == nil {
+		h.Write(at.Content)
+	} else if r, err := at.Source.Open(); err == nil {
+		_, _ = io.Copy(h, r)
+		r.Close()
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeHashSource writes the filename and content of an attachment read from
+// a source to h, as writeHashField would, streaming the content. A source
+// which can't be read is hashed by its size, and the send fails when the
+// message is built.
+func writeHashSource(h hash.Hash, at Attachment) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], 2)
+	h.Write(n[:])
+	binary.BigEndian.PutUint64(n[:], uint64(len(at.Filename)))
+	h.Write(n[:])
+	h.Write([]byte(at.Filename))
+
+	binary.BigEndian.PutUint64(n[:], uint64(at.Source.Size()))
+	h.Write(n[:])
+	r, err := at.Source.Open()
+	if err != nil {
+		return
+	}
+	defer r.Close()
+	_, _ = io.Copy(h, r)
+}
+
+// writeHashField writes the values to h, each prefixed with its length, so
+// that different fields can't hash the same.
+func writeHashField(h hash.Hash, values ...string) {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(values)))
+	h.Write(n[:])
+	for _, v := range values {
+		binary.BigEndian.PutUint64(n[:], uint64(len(v)))
+		h.Write(n[:])
+		h.Write([]byte(v))
+	}
+}
@@ -0,0 +1,146 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestSendIdempotent(t *testing.T) {
+	client, rec := newRecordingClient(t, WithIdempotencyStore(NewMemoryIdempotencyStore()))
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	ctx := context.Background()
+
+	first, sent, err := client.SendIdempotent(ctx, msg, "order-42")
+	if err != nil || !sent {
+		t.Fatalf("expected the first send to be made, got %v, %v", sent, err)
+	}
+	again, sent, err := client.SendIdempotent(ctx, msg, "order-42")
+	if err != nil || sent {
+		t.Fatalf("expected the second send to be skipped, got %v, %v", sent, err)
+	}
+	if again.MessageID != first.MessageID {
+		t.Fatalf("expected the first send's response, got %+v", again)
+	}
+	if _, sent, err := client.SendIdempotent(ctx, msg, "order-43"); err != nil || !sent {
+		t.Fatalf("expected a send with another key to be made, got %v, %v", sent, err)
+	}
+	if len(rec.reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(rec.reqs))
+	}
+}
+
+func TestSendIdempotentContentKey(t *testing.T) {
+	client, rec := newRecordingClient(t, WithIdempotencyStore(NewMemoryIdempotencyStore()))
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := client.SendIdempotent(ctx, msg, ""); err != nil {
+			t.Fatalf("error sending message: %v", err)
+		}
+	}
+	msg.PlainBody = "hello again"
+	if _, sent, err := client.SendIdempotent(ctx, msg, ""); err != nil || !sent {
+		t.Fatalf("expected a message with other content to be sent, got %v, %v", sent, err)
+	}
+	if len(rec.reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(rec.reqs))
+	}
+}
+
+func TestSendIdempotentNoStore(t *testing.T) {
+	client, _ := newRecordingClient(t)
+	if _, _, err := client.SendIdempotent(context.Background(), Message{}, "key"); !errors.Is(err, ErrNoIdempotencyStore) {
+		t.Fatalf("expected ErrNoIdempotencyStore, got %v", err)
+	}
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	base := Message{From: "from@example.com", To: []string{"a@example.com", "b@example.com"}, PlainBody: "hello"}
+	key := base.IdempotencyKey()
+	if len(key) != 64 || strings.Trim(key, "0123456789abcdef") != "" {
+		t.Fatalf("expected a hex SHA-256 key, got %q", key)
+	}
+	if base.IdempotencyKey() != key {
+		t.Fatal("expected the same key for the same message")
+	}
+
+	moved := base
+	moved.To = []string{"a@example.com"}
+	moved.Cc = []string{"b@example.com"}
+	withAttachment := base
+	if err := withAttachment.Attach(strings.NewReader("data"), "data.csv", "", nil); err != nil {
+		t.Fatalf("error attaching file: %v", err)
+	}
+	for _, m := range []Message{moved, withAttachment} {
+		if m.IdempotencyKey() == key {
+			t.Fatalf("expected a different key for %+v", m)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	base := Message{
+		From:      "News <news@example.com>",
+		To:        []string{"a@example.com", "B@example.com"},
+		Subject:   "Weekly  update",
+		PlainBody: "hello\nworld\n",
+		HTMLBody:  "<p>hello</p>",
+	}
+	if err := base.Attach(strings.NewReader("one"), "one.txt", "", nil); err != nil {
+		t.Fatalf("error attaching file: %v", err)
+	}
+	if err := base.Attach(strings.NewReader("two"), "two.txt", "", nil); err != nil {
+		t.Fatalf("error attaching file: %v", err)
+	}
+	fp := base.Fingerprint()
+	if len(fp) != 64 || strings.Trim(fp, "0123456789abcdef") != "" {
+		t.Fatalf("expected a hex SHA-256 fingerprint, got %q", fp)
+	}
+	// The fingerprint is a fixed function of the content, so it's the same
+	// across runs.
+	if base.Fingerprint() != fp {
+		t.Fatal("expected the same fingerprint for the same message")
+	}
+
+	same := Message{
+		From:      "news@EXAMPLE.com",
+		To:        []string{"b@example.com", "Alice <a@example.com>"},
+		Subject:   "Weekly update",
+		PlainBody: "hello  \r\nworld",
+		HTMLBody:  "<p>hello</p>\n",
+		Headers:   textproto.MIMEHeader{"X-Campaign": {"42"}},
+	}
+	if err := same.Attach(strings.NewReader("two"), "two.txt", "", nil); err != nil {
+		t.Fatalf("error attaching file: %v", err)
+	}
+	if err := same.AttachSource(BytesSource("one.txt", "", []byte("one")), nil); err != nil {
+		t.Fatalf("error attaching source: %v", err)
+	}
+	if got := same.Fingerprint(); got != fp {
+		t.Fatalf("expected the same fingerprint for the same logical message, got %s and %s", got, fp)
+	}
+
+	changes := map[string]func(m *Message){
+		"from":        func(m *Message) { m.From = "other@example.com" },
+		"recipient":   func(m *Message) { m.To = []string{"a@example.com"} },
+		"moved to cc": func(m *Message) { m.To = []string{"a@example.com"}; m.Cc = []string{"b@example.com"} },
+		"subject":     func(m *Message) { m.Subject = "Monthly update" },
+		"plain body":  func(m *Message) { m.PlainBody = "hello" },
+		"html body":   func(m *Message) { m.HTMLBody = "<p>hi</p>" },
+		"attachment": func(m *Message) {
+			m.attachments = append([]Attachment(nil), m.attachments...)
+			m.attachments[0].Content = []byte("changed")
+		},
+	}
+	for name, change := range changes {
+		m := base
+		change(&m)
+		if m.Fingerprint() == fp {
+			t.Errorf("expected a different fingerprint after changing the %s", name)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package postal
+
+import (
+	"context"
+	"time"
+)
+
+// defaultLimitsPath is the path of the endpoint, within the client's version
+// of the API, GetSendLimits uses unless set with WithLimitsPath.
+const defaultLimitsPath = "/limits"
+
+// maxSizeFetchTimeout bounds the request WithMaxSizeFromServer makes when the
+// client is created.
+const maxSizeFetchTimeout = 10 * time.Second
+
+// Limits are the send limits of a postal server.
+//
+// Postal limits the number of messages a server sends an hour; there's no
+// per minute limit.
+type Limits struct {
+	// HourlyLimit is the number of messages the server may send an hour, or
+	// 0 if it's unlimited.
+	HourlyLimit int `json:"send_limit"`
+	// HourlyVolume is the number of messages the server sent in the last
+	// hour.
+	HourlyVolume int `json:"send_volume"`
+	// MaxMessageSize is the size, in bytes, of the largest message the
+	// server accepts, or 0 if the server doesn't report it.
+	MaxMessageSize int64 `json:"max_message_size"`
+}
+
+// Remaining returns the number of messages the server can still send this
+// hour, or -1 if it's unlimited.
+func (l Limits) Remaining() int {
+	if l.HourlyLimit == 0 {
+		return -1
+	}
+	if l.HourlyVolume >= l.HourlyLimit {
+		return 0
+	}
+	return l.HourlyLimit - l.HourlyVolume
+}
+
+// GetSendLimits fetches the send limits of the server the client's token
+// belongs to.
+//
+// Like ListDomains, it relies on an endpoint postal's legacy API doesn't
+// have, so the limits are fetched from a path which can be changed with
+// WithLimitsPath, with the limits in the response's data. If the endpoint
+// doesn't exist, GetSendLimits fails with ErrNotSupported, so callers can
+// fall back to their own limits.
+func (a *ApiClient) GetSendLimits() (Limits, error) {
+	return a.GetSendLimitsContext(context.Background())
+}
+
+// GetSendLimitsContext is like GetSendLimits, but the request to postal is
+// bound to the given context.
+func (a *ApiClient) GetSendLimitsContext(ctx context.Context) (Limits, error) {
+	path := a.limitsPath
+	if path == "" {
+		path = a.apiPath(defaultLimitsPath)
+	}
+
+	var l Limits
+	if err := a.fetchOptional(ctx, "fetching send limits", path, &l); err != nil {
+		return Limits{}, err
+	}
+	return l, nil
+}
+
+// loadMaxMessageSize replaces the client's maximum message size with the
+// server's. If the limits can't be fetched or don't include it, the client's
+// is kept.
+func (a *ApiClient) loadMaxMessageSize() {
+	ctx, cancel := context.WithTimeout(context.Background(), maxSizeFetchTimeout)
+	defer cancel()
+
+	l, err := a.GetSendLimitsContext(ctx)
+	if err != nil {
+		if a.logger != nil {
+			a.logger.Printf("postal: error fetching the server's maximum message size, using %d: %v", a.maxMessageSize, err)
+		}
+		return
+	}
+	if l.MaxMessageSize > 0 {
+		a.maxMessageSize = l.MaxMessageSize
+	}
+}
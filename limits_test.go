@@ -0,0 +1,100 @@
+package postal
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetSendLimits(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/limits" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"status":"success","time":0.01,"data":{"send_limit":1000,"send_volume":250}}`))
+	})
+
+	limits, err := client.GetSendLimits()
+	if err != nil {
+		t.Fatalf("error getting send limits: %v", err)
+	}
+	if limits != (Limits{HourlyLimit: 1000, HourlyVolume: 250}) {
+		t.Fatalf("unexpected limits: %+v", limits)
+	}
+	if got := limits.Remaining(); got != 750 {
+		t.Fatalf("expected 750 remaining, got %d", got)
+	}
+	if got := (Limits{}).Remaining(); got != -1 {
+		t.Fatalf("expected -1 remaining without a limit, got %d", got)
+	}
+}
+
+func TestGetSendLimitsNotSupported(t *testing.T) {
+	client := newTestClient(t, http.NotFound)
+
+	if _, err := client.GetSendLimits(); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestMaxSizeFromServer(t *testing.T) {
+	var sends int
+	h := func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/limits":
+			w.Write([]byte(`{"status":"success","time":0.01,"data":{"send_limit":0,"send_volume":0,"max_message_size":2048}}`))
+		case "/api/v1/send/raw", "/api/v1/send/message":
+			sends++
+			w.Write(successResponse("id", []string{"to@example.com"}))
+		default:
+			http.NotFound(w, r)
+		}
+	}
+	small := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	large := small
+	large.PlainBody = strings.Repeat("hello ", 1000)
+
+	for _, structured := range []bool{false, true} {
+		opts := []Option{WithMaxSizeFromServer(), WithMaxMessageSize(1 << 20)}
+		if structured {
+			opts = append(opts, WithStructuredSend())
+		}
+		client := newTestClient(t, h, opts...)
+		if client.maxMessageSize != 2048 {
+			t.Fatalf("expected the server's limit of 2048, got %d", client.maxMessageSize)
+		}
+
+		sends = 0
+		if _, err := client.SendMessage(small); err != nil {
+			t.Fatalf("structured %v: error sending message: %v", structured, err)
+		}
+		_, err := client.SendMessage(large)
+		if !errors.Is(err, ErrMessageTooLarge) || !errors.Is(err, ErrInvalidMessage) {
+			t.Fatalf("structured %v: expected ErrMessageTooLarge, got %v", structured, err)
+		}
+		if sends != 1 {
+			t.Fatalf("structured %v: expected only the small message to be sent, got %d sends", structured, sends)
+		}
+	}
+}
+
+func TestMaxSizeFromServerFallback(t *testing.T) {
+	logger := &testLogger{}
+	client := newTestClient(t, http.NotFound, WithMaxSizeFromServer(), WithMaxMessageSize(100), WithLogger(logger))
+	if client.maxMessageSize != 100 {
+		t.Fatalf("expected the client's limit of 100, got %d", client.maxMessageSize)
+	}
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "not supported") {
+		t.Fatalf("expected the failed fetch to be logged, got %q", logger.lines)
+	}
+
+	// A server which doesn't report a maximum size leaves the limit alone.
+	client = newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","time":0.01,"data":{"send_limit":1000,"send_volume":250}}`))
+	}, WithMaxSizeFromServer())
+	if client.maxMessageSize != 0 {
+		t.Fatalf("expected no limit, got %d", client.maxMessageSize)
+	}
+}
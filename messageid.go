@@ -0,0 +1,69 @@
+package postal
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/textproto"
+	"time"
+
+	"github.com/knadh/smtppool"
+)
+
+// generateMessageID returns a new RFC5322 Message-ID on the given domain,
+// generated at now, e.g.
+// <1444789264909237300.5f3c2a9e8d7b6a51@example.com>.
+func generateMessageID(domain string, now time.Time) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generating message id: %v", err)
+	}
+	return fmt.Sprintf("<%d.%s@%s>", now.UnixNano(), hex.EncodeToString(b), domain), nil
+}
+
+// ensureMessageID returns the Message-ID of the email, generating and
+// setting one generated at now if it doesn't have one yet.
+func ensureMessageID(e *smtppool.Email, now time.Time) (string, error) {
+	if id := e.Headers.Get(smtppool.HdrMessageID); id != "" {
+		return id, nil
+	}
+
+	id, err := generateMessageID(messageIDDomain(e.From), now)
+	if err != nil {
+		return "", err
+	}
+	if e.Headers == nil {
+		e.Headers = textproto.MIMEHeader{}
+	}
+	e.Headers.Set(smtppool.HdrMessageID, id)
+	return id, nil
+}
+
+// EnsureMessageID returns the message's Message-ID header, generating one
+// on the domain of its From address and setting it in its Headers if it has
+// none yet, so the ID is known before the message is sent, such as to log
+// it ahead of the send. The client sends a message with a Message-ID as it
+// is, so the sent message, and the RFCMessageID of its FullResult, have the
+// same ID.
+//
+// The ID is only used by sends to the raw endpoint: postal generates its own
+// for messages sent to the structured endpoint. Copies of the message, such
+// as those of SendPersonalized, share it.
+func (m *Message) EnsureMessageID() (string, error) {
+	if id := m.Headers.Get(smtppool.HdrMessageID); id != "" {
+		return id, nil
+	}
+
+	id, err := generateMessageID(messageIDDomain(m.From), time.Now())
+	if err != nil {
+		return "", err
+	}
+	// The headers may be shared with copies of the message.
+	hdr := make(textproto.MIMEHeader, len(m.Headers)+1)
+	for k, v := range m.Headers {
+		hdr[k] = v
+	}
+	hdr.Set(smtppool.HdrMessageID, id)
+	m.Headers = hdr
+	return id, nil
+}
@@ -0,0 +1,82 @@
+package postal
+
+import (
+	"bytes"
+	"net/mail"
+	"net/textproto"
+	"testing"
+)
+
+func TestRFCMessageID(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	resp, err := client.SendMessage(Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	})
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if resp.RFCMessageID == "" || resp.RFCMessageID != m.Header.Get("Message-Id") {
+		t.Fatalf("RFCMessageID %q doesn't match the sent Message-ID %q", resp.RFCMessageID, m.Header.Get("Message-Id"))
+	}
+	if _, err := normalizeMessageID(resp.RFCMessageID); err != nil {
+		t.Fatalf("generated message id is invalid: %v", err)
+	}
+}
+
+func TestRFCMessageIDFromHeaders(t *testing.T) {
+	client, _ := newRecordingClient(t)
+
+	resp, err := client.SendMessage(Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+		Headers:   textproto.MIMEHeader{"Message-Id": {"<mine@example.com>"}},
+	})
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if resp.RFCMessageID != "<mine@example.com>" {
+		t.Fatalf("expected the message's own Message-ID, got %q", resp.RFCMessageID)
+	}
+}
+
+func TestEnsureMessageID(t *testing.T) {
+	shared := textproto.MIMEHeader{"X-Campaign": {"spring"}}
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello", Headers: shared}
+	copied := msg
+
+	id, err := msg.EnsureMessageID()
+	if err != nil {
+		t.Fatalf("error ensuring message id: %v", err)
+	}
+	if _, err := normalizeMessageID(id); err != nil {
+		t.Fatalf("generated message id is invalid: %v", err)
+	}
+	if again, _ := msg.EnsureMessageID(); again != id {
+		t.Fatalf("expected the same message id again, got %q and %q", id, again)
+	}
+	if copied.Headers.Get("Message-Id") != "" || msg.Headers.Get("X-Campaign") != "spring" {
+		t.Fatalf("expected the headers to be copied, got %v and %v", copied.Headers, msg.Headers)
+	}
+
+	client, rec := newRecordingClient(t)
+	resp, err := client.SendMessage(msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get("Message-Id"); got != id || resp.RFCMessageID != id {
+		t.Fatalf("expected the logged message id %q to be sent, got %q and %q", id, got, resp.RFCMessageID)
+	}
+}
@@ -0,0 +1,320 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultMessageRetention is how long postal keeps messages by default, 60
+// days, after which looking one up by its ID or token fails. Postal doesn't
+// report a server's retention in its API; it's set per server in postal's
+// web interface, see WithMessageRetention.
+const DefaultMessageRetention = 60 * 24 * time.Hour
+
+// DeliveryStatus is the delivery status of a message in postal.
+type DeliveryStatus string
+
+const (
+	StatusPending  DeliveryStatus = "Pending"
+	StatusSent     DeliveryStatus = "Sent"
+	StatusHeld     DeliveryStatus = "Held"
+	StatusSoftFail DeliveryStatus = "SoftFail"
+	StatusHardFail DeliveryStatus = "HardFail"
+	StatusBounced  DeliveryStatus = "Bounced"
+)
+
+// Terminal reports whether postal is done trying to deliver a message with
+// the status. A held message isn't terminal as it can still be released.
+func (s DeliveryStatus) Terminal() bool {
+	switch s {
+	case StatusSent, StatusHardFail, StatusBounced:
+		return true
+	}
+	return false
+}
+
+// Timestamp is a time sent by postal as seconds since the epoch.
+type Timestamp struct {
+	time.Time
+}
+
+// UnmarshalJSON decodes a timestamp from a number of seconds, which may be
+// fractional. A null timestamp is decoded as the zero time.
+func (t *Timestamp) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+
+	var secs float64
+	if err := json.Unmarshal(b, &secs); err != nil {
+		return fmt.Errorf("error decoding timestamp: %v", err)
+	}
+	whole, frac := math.Modf(secs)
+	t.Time = time.Unix(int64(whole), int64(frac*1e9))
+	return nil
+}
+
+// MessageDetails is a message as returned by postal's message API.
+type MessageDetails struct {
+	ID      int64         `json:"id"`
+	Token   string        `json:"token"`
+	Status  MessageStatus `json:"status"`
+	Details MessageInfo   `json:"details"`
+}
+
+// MessageStatus is the delivery status of a message.
+//
+// Postal's API can't cancel a queued message or release a held one, that's
+// only possible from postal's web interface. Held tells whether a message
+// is being held, and HoldExpiry when postal will stop holding it.
+type MessageStatus struct {
+	Status              DeliveryStatus `json:"status"`
+	LastDeliveryAttempt Timestamp      `json:"last_delivery_attempt"`
+	Held                bool           `json:"held"`
+	HoldExpiry          Timestamp      `json:"hold_expiry"`
+}
+
+// MessageInfo holds the details of a message.
+type MessageInfo struct {
+	RcptTo          string    `json:"rcpt_to"`
+	MailFrom        string    `json:"mail_from"`
+	Subject         string    `json:"subject"`
+	MessageID       string    `json:"message_id"`
+	Timestamp       Timestamp `json:"timestamp"`
+	Direction       string    `json:"direction"`
+	Size            int64     `json:"size"`
+	Bounce          bool      `json:"bounce"`
+	BounceForID     int64     `json:"bounce_for_id"`
+	Tag             string    `json:"tag"`
+	ReceivedWithSSL bool      `json:"received_with_ssl"`
+}
+
+type messageRequest struct {
+	ID         int64    `json:"id"`
+	Expansions []string `json:"_expansions"`
+}
+
+// GetMessageDetails fetches the status and details of the message with the
+// given ID, which is the ID postal returns for each recipient of a send.
+func (a *ApiClient) GetMessageDetails(id int64) (MessageDetails, error) {
+	return a.GetMessageDetailsContext(context.Background(), id)
+}
+
+// GetMessageDetailsContext is like GetMessageDetails, but the request to
+// postal is bound to the given context.
+func (a *ApiClient) GetMessageDetailsContext(ctx context.Context, id int64) (MessageDetails, error) {
+	res, _, err := a.post(ctx, SendOptions{}, a.apiPath("/messages/message"), messageRequest{
+		ID:         id,
+		Expansions: []string{"status", "details"},
+	})
+	if err != nil {
+		return MessageDetails{}, err
+	}
+	if err := errorFromResponse(res); err != nil {
+		return MessageDetails{}, err
+	}
+
+	details := MessageDetails{}
+	if err := json.Unmarshal(res.Data, &details); err != nil {
+		return MessageDetails{}, withKind(ErrDecode, fmt.Errorf("error unmarshalling json from postal response: %v", err))
+	}
+	return details, nil
+}
+
+// GetMessagesDetails fetches the details of many messages, returning them by
+// ID. Postal can only look up one message per request, so up to the client's
+// send concurrency messages are fetched at once, see WithSendConcurrency.
+//
+// If some messages can't be fetched, the others are still returned along
+// with a *LookupError holding the error for each failed ID. Once the context
+// is done, the remaining messages fail with its error.
+func (a *ApiClient) GetMessagesDetails(ctx context.Context, ids []int64) (map[int64]MessageDetails, error) {
+	n := a.sendConcurrency
+	if n < 1 {
+		n = defaultSendConcurrency
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		jobs    = make(chan int64)
+		details = make(map[int64]MessageDetails, len(ids))
+		errs    = make(map[int64]error)
+	)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				d, err := a.GetMessageDetailsContext(ctx, id)
+				mu.Lock()
+				if err != nil {
+					errs[id] = err
+				} else {
+					details[id] = d
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	seen := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		if err := ctx.Err(); err != nil {
+			mu.Lock()
+			errs[id] = err
+			mu.Unlock()
+			continue
+		}
+		jobs <- id
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return details, &LookupError{Errors: errs}
+	}
+	return details, nil
+}
+
+// HeldRecipients returns the status of the messages of a send which postal
+// is holding, by recipient, for example because of a suppressed recipient or
+// a server in development mode. Postal accepts held messages like any other,
+// so the send's response doesn't tell them apart; their status is fetched
+// with GetMessagesDetails, and a *LookupError is returned along with the
+// held messages found if some can't be fetched.
+func (a *ApiClient) HeldRecipients(ctx context.Context, resp Response) (map[string]MessageStatus, error) {
+	rcpts := resp.AcceptedRecipients()
+	ids := make([]int64, 0, len(rcpts))
+	for _, rcpt := range rcpts {
+		ids = append(ids, resp.Messages[rcpt].ID)
+	}
+
+	details, err := a.GetMessagesDetails(ctx, ids)
+	held := make(map[string]MessageStatus)
+	for _, rcpt := range rcpts {
+		d, ok := details[resp.Messages[rcpt].ID]
+		if ok && (d.Status.Held || d.Status.Status == StatusHeld) {
+			held[rcpt] = d.Status
+		}
+	}
+	return held, err
+}
+
+// defaultPollInterval is how often postal is polled for the status of a
+// message when no interval, or a negative one, is given.
+const defaultPollInterval = 5 * time.Second
+
+// pollEvery returns the interval, or defaultPollInterval if it's not
+// positive, so a zero interval doesn't poll postal in a busy loop.
+func pollEvery(d time.Duration) time.Duration {
+	if d <= 0 {
+		return defaultPollInterval
+	}
+	return d
+}
+
+// SendAndTrack sends the message and then polls postal every pollInterval
+// until the message to each recipient reaches a terminal status, returning
+// the final status of each recipient. It polls every five seconds if
+// pollInterval isn't positive.
+//
+// A successful send only means postal has accepted the message into its
+// queue, SendAndTrack waits for it to actually be delivered or fail. If the
+// context is done before that, the statuses seen so far are returned along
+// with the context's error.
+func (a *ApiClient) SendAndTrack(ctx context.Context, msg Message, pollInterval time.Duration) (Response, map[string]DeliveryStatus, error) {
+	pollInterval = pollEvery(pollInterval)
+	resp, err := a.SendMessageContext(ctx, msg)
+	if err != nil {
+		return resp, nil, err
+	}
+
+	statuses := make(map[string]DeliveryStatus, len(resp.Messages))
+	for {
+		done := true
+		for rcpt, m := range resp.Messages {
+			if statuses[rcpt].Terminal() {
+				continue
+			}
+
+			details, err := a.GetMessageDetailsContext(ctx, m.ID)
+			if err != nil {
+				return resp, statuses, err
+			}
+			statuses[rcpt] = details.Status.Status
+			if !details.Status.Status.Terminal() {
+				done = false
+			}
+		}
+		if done {
+			return resp, statuses, nil
+		}
+
+		if err := sleep(ctx, a.clock, pollInterval); err != nil {
+			return resp, statuses, err
+		}
+	}
+}
+
+// WatchMessage polls postal every interval for the status of the message with
+// the given ID, sending the status on the returned channel each time it
+// changes. The channel is closed once the message reaches a terminal status,
+// the context is done, or a poll fails. It polls every five seconds if
+// interval isn't positive.
+//
+// The message is fetched once before WatchMessage returns, so an unknown ID
+// or a bad token is returned as an error, and the first status is sent right
+// away. Later failed polls are logged, see WithLogger, as they can't be
+// returned.
+func (a *ApiClient) WatchMessage(ctx context.Context, id int64, interval time.Duration) (<-chan MessageStatus, error) {
+	interval = pollEvery(interval)
+	details, err := a.GetMessageDetailsContext(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan MessageStatus, 1)
+	out <- details.Status
+	go func() {
+		defer close(out)
+
+		last := details.Status
+		for !last.Status.Terminal() {
+			if err := sleep(ctx, a.clock, interval); err != nil {
+				return
+			}
+
+			details, err := a.GetMessageDetailsContext(ctx, id)
+			if err != nil {
+				if ctx.Err() == nil {
+					a.logf(ctx, "postal: error watching message %d: %v", id, err)
+				}
+				return
+			}
+			s := details.Status
+			if s.Status == last.Status && s.Held == last.Held {
+				continue
+			}
+			last = s
+
+			select {
+			case out <- s:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
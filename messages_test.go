@@ -0,0 +1,408 @@
+package postal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const testMessageDetails = `{"status":"success","time":0.01,"data":{
+	"id":42,
+	"token":"abc",
+	"status":{"status":"Sent","last_delivery_attempt":1700000000.5,"held":false,"hold_expiry":null},
+	"details":{"rcpt_to":"to@example.com","mail_from":"from@example.com","subject":"Hello","message_id":"id@example.com","timestamp":1700000000,"direction":"outgoing","size":1024,"tag":"welcome"}
+}}`
+
+func TestGetMessageDetails(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/messages/message" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		req := messageRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		if req.ID != 42 {
+			t.Errorf("unexpected id: %d", req.ID)
+		}
+		w.Write([]byte(testMessageDetails))
+	})
+
+	details, err := client.GetMessageDetails(42)
+	if err != nil {
+		t.Fatalf("error getting message details: %v", err)
+	}
+	if details.Status.Status != StatusSent || !details.Status.Status.Terminal() {
+		t.Fatalf("unexpected status: %s", details.Status.Status)
+	}
+	if want := time.Unix(1700000000, 5e8); !details.Status.LastDeliveryAttempt.Equal(want) {
+		t.Fatalf("unexpected last delivery attempt: %s", details.Status.LastDeliveryAttempt)
+	}
+	if !details.Status.HoldExpiry.IsZero() {
+		t.Fatalf("expected no hold expiry, got %s", details.Status.HoldExpiry)
+	}
+	if details.Details.RcptTo != "to@example.com" || details.Details.Tag != "welcome" {
+		t.Fatalf("unexpected details: %+v", details.Details)
+	}
+}
+
+func TestClientGetMessageDetails(t *testing.T) {
+	api := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(testMessageDetails))
+	})
+	smtp, err := NewSMTPClient("smtp.example.com", 25, "", "")
+	if err != nil {
+		t.Fatalf("error creating smtp client: %v", err)
+	}
+	file, err := NewFileClient(t.TempDir())
+	if err != nil {
+		t.Fatalf("error creating file client: %v", err)
+	}
+
+	// Wrapping clients look messages up through the client they wrap.
+	var client Client = NewRecordingClient(api)
+	if details, err := client.GetMessageDetails(42); err != nil || details.ID != 42 {
+		t.Fatalf("unexpected details: %+v, %v", details, err)
+	}
+	for _, client := range []Client{smtp, file, NewReplayClient(nil)} {
+		if _, err := client.GetMessageDetails(42); !errors.Is(err, ErrNotSupported) {
+			t.Fatalf("expected ErrNotSupported from %T, got %v", client, err)
+		}
+	}
+}
+
+func TestGetMessageDetailsNotFound(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"error","data":{"code":"MessageNotFound","message":"No message found matching provided ID"}}`))
+	})
+
+	if _, err := client.GetMessageDetails(42); err == nil {
+		t.Fatal("expected error for missing message")
+	}
+}
+
+func TestSendAndTrack(t *testing.T) {
+	var polls int32
+	clock := newFakeClock()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/send/raw":
+			w.Write([]byte(`{"status":"success","data":{"message_id":"abc@postal","messages":{"to@example.com":{"id":42,"token":"abc"}}}}`))
+		case "/api/v1/messages/message":
+			status := StatusPending
+			if atomic.AddInt32(&polls, 1) > 1 {
+				status = StatusSent
+			}
+			w.Write([]byte(`{"status":"success","data":{"id":42,"status":{"status":"` + string(status) + `"}}}`))
+		}
+	}, WithClock(clock))
+
+	type result struct {
+		statuses map[string]DeliveryStatus
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		_, statuses, err := client.SendAndTrack(context.Background(), Message{
+			From:      "from@example.com",
+			To:        []string{"to@example.com"},
+			PlainBody: "hello",
+		}, time.Second)
+		done <- result{statuses, err}
+	}()
+
+	// The first poll sees a pending message, so it waits before polling again.
+	clock.waitForWaiters(t, 1)
+	clock.Advance(time.Second)
+
+	res := <-done
+	if res.err != nil {
+		t.Fatalf("error tracking message: %v", res.err)
+	}
+	if res.statuses["to@example.com"] != StatusSent {
+		t.Fatalf("unexpected statuses: %v", res.statuses)
+	}
+	if n := atomic.LoadInt32(&polls); n != 2 {
+		t.Fatalf("expected 2 polls, got %d", n)
+	}
+}
+
+func TestSendAndTrackZeroInterval(t *testing.T) {
+	var polls int32
+	clock := newFakeClock()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/send/raw":
+			w.Write([]byte(`{"status":"success","data":{"message_id":"abc@postal","messages":{"to@example.com":{"id":42,"token":"abc"}}}}`))
+		case "/api/v1/messages/message":
+			status := StatusPending
+			if atomic.AddInt32(&polls, 1) > 1 {
+				status = StatusSent
+			}
+			w.Write([]byte(`{"status":"success","data":{"id":42,"status":{"status":"` + string(status) + `"}}}`))
+		}
+	}, WithClock(clock))
+
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := client.SendAndTrack(context.Background(), Message{
+			From:      "from@example.com",
+			To:        []string{"to@example.com"},
+			PlainBody: "hello",
+		}, 0)
+		done <- err
+	}()
+
+	// A zero interval polls at the default interval, not right away.
+	clock.waitForWaiters(t, 1)
+	clock.Advance(defaultPollInterval - time.Millisecond)
+	if n := clock.Waiters(); n != 1 {
+		t.Fatalf("expected to still wait before polling again, got %d waiters", n)
+	}
+	clock.Advance(time.Millisecond)
+
+	if err := <-done; err != nil {
+		t.Fatalf("error tracking message: %v", err)
+	}
+	if n := atomic.LoadInt32(&polls); n != 2 {
+		t.Fatalf("expected 2 polls, got %d", n)
+	}
+}
+
+func TestSendAndTrackContextDone(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/send/raw":
+			w.Write([]byte(`{"status":"success","data":{"message_id":"abc@postal","messages":{"to@example.com":{"id":42,"token":"abc"}}}}`))
+		case "/api/v1/messages/message":
+			w.Write([]byte(`{"status":"success","data":{"id":42,"status":{"status":"Held","held":true}}}`))
+		}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, statuses, err := client.SendAndTrack(ctx, Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}, 10*time.Millisecond)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if statuses["to@example.com"] != StatusHeld {
+		t.Fatalf("expected the held status to be returned, got %v", statuses)
+	}
+}
+
+func TestGetMessageDetailsHeld(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","time":0.01,"data":{"id":7,"token":"abc","status":{"status":"Held","last_delivery_attempt":null,"held":true,"hold_expiry":1700000000}}}`))
+	})
+
+	details, err := client.GetMessageDetails(7)
+	if err != nil {
+		t.Fatalf("error getting message details: %v", err)
+	}
+	if !details.Status.Held || details.Status.Status != StatusHeld {
+		t.Fatalf("expected a held message, got %+v", details.Status)
+	}
+	if !details.Status.HoldExpiry.Equal(time.Unix(1700000000, 0)) {
+		t.Fatalf("unexpected hold expiry %v", details.Status.HoldExpiry)
+	}
+}
+
+func TestGetMessagesDetails(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		req := messageRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		if req.ID == 7 {
+			w.Write([]byte(`{"status":"error","data":{"code":"MessageNotFound","message":"No message found matching provided ID"}}`))
+			return
+		}
+		w.Write([]byte(testMessageDetails))
+	}, WithSendConcurrency(2))
+
+	details, err := client.GetMessagesDetails(context.Background(), []int64{1, 2, 7, 2, 3})
+	var lookupErr *LookupError
+	if !errors.As(err, &lookupErr) {
+		t.Fatalf("expected a LookupError, got %v", err)
+	}
+	if len(lookupErr.Errors) != 1 || lookupErr.Errors[7] == nil {
+		t.Fatalf("unexpected lookup errors: %v", lookupErr.Errors)
+	}
+	if len(details) != 3 || details[1].Token != "abc" || details[3].Token != "abc" {
+		t.Fatalf("unexpected details: %+v", details)
+	}
+	if got := atomic.LoadInt32(&calls); got != 4 {
+		t.Fatalf("expected 4 requests, got %d", got)
+	}
+}
+
+func TestGetMessagesDetailsContextDone(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	details, err := client.GetMessagesDetails(ctx, []int64{1, 2})
+	var lookupErr *LookupError
+	if !errors.As(err, &lookupErr) || len(details) != 0 {
+		t.Fatalf("expected a LookupError and no details, got %v, %v", details, err)
+	}
+	for id, err := range lookupErr.Errors {
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled for %d, got %v", id, err)
+		}
+	}
+}
+
+func TestWatchMessage(t *testing.T) {
+	statuses := []string{
+		`{"status":"Pending"}`,
+		`{"status":"Pending"}`,
+		`{"status":"Held","held":true}`,
+		`{"status":"Sent"}`,
+	}
+	var polls int32
+	clock := newFakeClock()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&polls, 1)
+		w.Write([]byte(`{"status":"success","data":{"id":42,"status":` + statuses[n-1] + `}}`))
+	}, WithClock(clock))
+
+	ch, err := client.WatchMessage(context.Background(), 42, time.Second)
+	if err != nil {
+		t.Fatalf("error watching message: %v", err)
+	}
+
+	next := func() DeliveryStatus {
+		t.Helper()
+		s, ok := <-ch
+		if !ok {
+			t.Fatal("channel closed early")
+		}
+		return s.Status
+	}
+	poll := func() {
+		t.Helper()
+		clock.waitForWaiters(t, 1)
+		clock.Advance(time.Second)
+	}
+
+	if s := next(); s != StatusPending {
+		t.Fatalf("expected the first status to be pending, got %s", s)
+	}
+	// The second poll is still pending, so nothing is sent for it.
+	poll()
+	poll()
+	if s := next(); s != StatusHeld {
+		t.Fatalf("expected held, got %s", s)
+	}
+	poll()
+	if s := next(); s != StatusSent {
+		t.Fatalf("expected sent, got %s", s)
+	}
+	if _, ok := <-ch; ok {
+		t.Fatal("expected the channel to be closed after a terminal status")
+	}
+	if n := atomic.LoadInt32(&polls); n != 4 {
+		t.Fatalf("expected 4 polls, got %d", n)
+	}
+}
+
+func TestWatchMessageZeroInterval(t *testing.T) {
+	var polls int32
+	clock := newFakeClock()
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		status := `{"status":"Pending"}`
+		if atomic.AddInt32(&polls, 1) > 1 {
+			status = `{"status":"Sent"}`
+		}
+		w.Write([]byte(`{"status":"success","data":{"id":42,"status":` + status + `}}`))
+	}, WithClock(clock))
+
+	ch, err := client.WatchMessage(context.Background(), 42, 0)
+	if err != nil {
+		t.Fatalf("error watching message: %v", err)
+	}
+	if s := <-ch; s.Status != StatusPending {
+		t.Fatalf("expected the first status to be pending, got %s", s.Status)
+	}
+
+	// A zero interval polls at the default interval, not right away.
+	clock.waitForWaiters(t, 1)
+	clock.Advance(defaultPollInterval - time.Millisecond)
+	if n := clock.Waiters(); n != 1 {
+		t.Fatalf("expected to still wait before polling again, got %d waiters", n)
+	}
+	clock.Advance(time.Millisecond)
+
+	if s := <-ch; s.Status != StatusSent {
+		t.Fatalf("expected sent, got %s", s.Status)
+	}
+	if n := atomic.LoadInt32(&polls); n != 2 {
+		t.Fatalf("expected 2 polls, got %d", n)
+	}
+}
+
+func TestWatchMessageNotFound(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"error","data":{"code":"MessageNotFound","message":"No message found matching provided ID"}}`))
+	})
+
+	if _, err := client.WatchMessage(context.Background(), 42, time.Second); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected ErrMessageNotFound, got %v", err)
+	}
+}
+
+func TestLookupErrorEmpty(t *testing.T) {
+	if got := (&LookupError{}).Error(); got == "" {
+		t.Fatal("expected a message for an empty LookupError")
+	}
+}
+
+func TestHeldRecipients(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req messageRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		switch req.ID {
+		case 1:
+			w.Write([]byte(`{"status":"success","data":{"id":1,"status":{"status":"Pending","held":false}}}`))
+		case 2:
+			w.Write([]byte(`{"status":"success","data":{"id":2,"status":{"status":"Held","held":true,"hold_expiry":1700000000}}}`))
+		default:
+			w.Write([]byte(`{"status":"error","data":{"code":"MessageNotFound","message":"No message found matching provided ID"}}`))
+		}
+	})
+
+	resp := Response{Messages: map[string]ResponseMessage{
+		"queued@example.com":   {ID: 1, Token: "a"},
+		"held@example.com":     {ID: 2, Token: "b"},
+		"missing@example.com":  {ID: 3, Token: "c"},
+		"rejected@example.com": {},
+	}}
+	held, err := client.HeldRecipients(context.Background(), resp)
+	var lookupErr *LookupError
+	if !errors.As(err, &lookupErr) || len(lookupErr.Errors) != 1 || !errors.Is(lookupErr.Errors[3], ErrMessageNotFound) {
+		t.Fatalf("expected a lookup error for message 3, got %v", err)
+	}
+	if len(held) != 1 {
+		t.Fatalf("expected one held recipient, got %v", held)
+	}
+	status := held["held@example.com"]
+	if status.Status != StatusHeld || !status.Held || status.HoldExpiry.Unix() != 1700000000 {
+		t.Fatalf("unexpected held status: %+v", status)
+	}
+}
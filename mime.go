@@ -0,0 +1,518 @@
+package postal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knadh/smtppool"
+)
+
+const (
+	// maxLineLength is the length lines of the message are kept within,
+	// where possible, per RFC5322.
+	maxLineLength = 78
+	// maxHeaderLineLength is the hard limit on the length of a line per
+	// RFC5322, excluding the CRLF.
+	maxHeaderLineLength = 998
+
+	contentEncQuotedPrintable = "quoted-printable"
+	defaultCharset            = "UTF-8"
+	defaultMimeVersion        = "1.0"
+)
+
+// Headers which are written at the top of the message, in this order. Any
+// other header follows them in alphabetical order.
+var leadingHeaders = []string{"Date", "From", "Sender", "Reply-To", "To", "Cc", "Subject", "Message-Id", "Mime-Version"}
+
+// headerNames maps canonical header keys to the spelling used in the
+// message, for headers whose conventional spelling differs.
+var headerNames = map[string]string{
+	"Message-Id":   "Message-ID",
+	"Mime-Version": "MIME-Version",
+	"Content-Id":   "Content-ID",
+
+	"X-Correlation-Id": HdrCorrelationID,
+}
+
+// mimeBuilder builds an RFC5322 message out of an smtppool.Email.
+//
+// The structure of the message is the same as the one smtppool builds, but
+// the top level headers are written in a deterministic order and long headers
+// are folded.
+type mimeBuilder struct {
+	// now is used for the Date header, when the email doesn't set one.
+	now time.Time
+	// boundary is the prefix of the boundaries of multipart parts. They're
+	// random if it's empty.
+	boundary string
+	// attachments are the message's attachments, which the email's
+	// attachments read from a source refer to, see hdrAttachmentSource.
+	attachments []Attachment
+}
+
+// mimeBuilder returns the builder used for the client's messages.
+func (a *ApiClient) mimeBuilder() mimeBuilder {
+	return mimeBuilder{now: a.clock.Now(), boundary: a.boundary}
+}
+
+// build returns the RFC5322 message for the email.
+func (b mimeBuilder) build(e *smtppool.Email) ([]byte, error) {
+	buff := bytes.NewBuffer(make([]byte, 0, 4096))
+
+	if err := checkAttachments(e.Attachments); err != nil {
+		return nil, err
+	}
+	headers, err := b.headers(e)
+	if err != nil {
+		return nil, err
+	}
+
+	var htmlAttachments, otherAttachments []smtppool.Attachment
+	for _, a := range e.Attachments {
+		if a.HTMLRelated {
+			htmlAttachments = append(htmlAttachments, a)
+		} else {
+			otherAttachments = append(otherAttachments, a)
+		}
+	}
+	if len(e.HTML) == 0 && len(htmlAttachments) > 0 {
+		return nil, errors.New("there are HTML attachments, but no HTML body")
+	}
+
+	var (
+		isMixed       = len(otherAttachments) > 0
+		isAlternative = len(e.Text) > 0 && len(e.HTML) > 0
+		isRelated     = len(htmlAttachments) > 0
+		// onlyRelated is set when the HTML and its related attachments
+		// are the only parts of the message.
+		onlyRelated = isRelated && !isMixed && !isAlternative
+		w           *multipart.Writer
+	)
+	// newWriter returns a writer for a multipart part. With a fixed
+	// boundary, nested parts are told apart by a counter.
+	parts := 0
+	newWriter := func() *multipart.Writer {
+		w := multipart.NewWriter(buff)
+		if b.boundary != "" {
+			parts++
+			// The boundary is checked by checkBoundary.
+			_ = w.SetBoundary(fmt.Sprintf("%s-%d", b.boundary, parts))
+		}
+		return w
+	}
+	if isMixed || isAlternative || isRelated {
+		w = newWriter()
+	}
+	switch {
+	case onlyRelated:
+		headers.Set(HdrContentType, smtppool.ContentTypeMultipartRelated+"; boundary="+w.Boundary())
+	case isMixed:
+		headers.Set(HdrContentType, smtppool.ContentTypeMultipartMixed+"; boundary="+w.Boundary())
+	case isAlternative:
+		headers.Set(HdrContentType, smtppool.ContentTypeMultipartAlt+"; boundary="+w.Boundary())
+	case len(e.HTML) > 0:
+		headers.Set(HdrContentType, smtppool.ContentTypeHTML+"; charset="+defaultCharset)
+		headers.Set(HdrContentTransferEncoding, contentEncQuotedPrintable)
+	default:
+		headers.Set(HdrContentType, smtppool.ContentTypePlain+"; charset="+defaultCharset)
+		headers.Set(HdrContentTransferEncoding, contentEncQuotedPrintable)
+	}
+
+	if err := writeHeaders(buff, headers); err != nil {
+		return nil, err
+	}
+	io.WriteString(buff, "\r\n")
+
+	if len(e.Text) > 0 || len(e.HTML) > 0 {
+		subWriter := w
+		if isMixed && isAlternative {
+			// The bodies go in a multipart/alternative part of their own.
+			subWriter = newWriter()
+			if _, err := w.CreatePart(textproto.MIMEHeader{
+				HdrContentType: {smtppool.ContentTypeMultipartAlt + "; boundary=" + subWriter.Boundary()},
+			}); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(e.Text) > 0 {
+			if err := writeBody(buff, subWriter, e.Text, smtppool.ContentTypePlain); err != nil {
+				return nil, err
+			}
+		}
+
+		if len(e.HTML) > 0 {
+			htmlWriter := subWriter
+			var relatedWriter *multipart.Writer
+			switch {
+			case onlyRelated:
+				relatedWriter = w
+				htmlWriter = w
+			case isRelated:
+				// The HTML and its related attachments go in a
+				// multipart/related part.
+				relatedWriter = newWriter()
+				if _, err := subWriter.CreatePart(textproto.MIMEHeader{
+					HdrContentType: {smtppool.ContentTypeMultipartRelated + "; boundary=" + relatedWriter.Boundary()},
+				}); err != nil {
+					return nil, err
+				}
+				htmlWriter = relatedWriter
+			}
+
+			if err := writeBody(buff, htmlWriter, e.HTML, smtppool.ContentTypeHTML); err != nil {
+				return nil, err
+			}
+
+			for _, a := range htmlAttachments {
+				if err := b.writeAttachment(relatedWriter, a); err != nil {
+					return nil, err
+				}
+			}
+			if relatedWriter != nil && relatedWriter != w {
+				if err := relatedWriter.Close(); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		if isMixed && isAlternative {
+			if err := subWriter.Close(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, a := range otherAttachments {
+		if err := b.writeAttachment(w, a); err != nil {
+			return nil, err
+		}
+	}
+
+	if w != nil {
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+	}
+	return buff.Bytes(), nil
+}
+
+// headers returns the top level headers of the message. Headers set on the
+// email take precedence over the ones derived from its fields.
+func (b mimeBuilder) headers(e *smtppool.Email) (textproto.MIMEHeader, error) {
+	res := make(textproto.MIMEHeader, len(e.Headers)+8)
+	for k, v := range e.Headers {
+		res[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+
+	setAddrs := func(key string, addrs []string) error {
+		if _, ok := res[key]; ok || len(addrs) == 0 {
+			return nil
+		}
+		formatted, err := formatAddresses(addrs)
+		if err != nil {
+			return fmt.Errorf("error formatting %s addresses: %w", key, err)
+		}
+		res.Set(key, strings.Join(formatted, ", "))
+		return nil
+	}
+	if err := setAddrs("Reply-To", e.ReplyTo); err != nil {
+		return nil, err
+	}
+	if err := setAddrs("To", e.To); err != nil {
+		return nil, err
+	}
+	if err := setAddrs("Cc", e.Cc); err != nil {
+		return nil, err
+	}
+
+	if _, ok := res["Subject"]; !ok && e.Subject != "" {
+		res.Set("Subject", e.Subject)
+	}
+
+	// From and Date are required.
+	if _, ok := res["From"]; !ok {
+		from, err := mail.ParseAddressList(e.From)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing From address %q: %w", e.From, err)
+		}
+		formatted := make([]string, 0, len(from))
+		for _, a := range from {
+			formatted = append(formatted, a.String())
+		}
+		res.Set("From", strings.Join(formatted, ", "))
+	}
+	if _, ok := res[HdrSender]; !ok {
+		sender, err := requiredSender(e.From, e.Sender)
+		if err != nil {
+			return nil, err
+		}
+		if sender != "" {
+			res.Set(HdrSender, sender)
+		}
+	}
+	if _, ok := res["Date"]; !ok {
+		res.Set("Date", b.now.Format(time.RFC1123Z))
+	}
+
+	if _, ok := res["Message-Id"]; !ok {
+		id, err := generateMessageID(messageIDDomain(e.From), b.now)
+		if err != nil {
+			return nil, err
+		}
+		res.Set("Message-Id", id)
+	}
+	if _, ok := res["Mime-Version"]; !ok {
+		res.Set("Mime-Version", defaultMimeVersion)
+	}
+
+	return res, nil
+}
+
+// checkAttachments checks that the headers of the attachments can be
+// written, so that a malformed attachment fails with the attachment it's
+// about rather than somewhere while building the message.
+func checkAttachments(attachments []smtppool.Attachment) error {
+	for i, a := range attachments {
+		for k, vals := range a.Header {
+			for _, v := range vals {
+				// Values may be folded, as Content-Disposition is.
+				unfolded := strings.NewReplacer("\r\n ", " ", "\r\n\t", " ").Replace(v)
+				for _, c := range unfolded {
+					if (c < ' ' && c != '\t') || c == 0x7f {
+						return fmt.Errorf("attachment %d (%s): invalid character %q in %s header", i, a.Filename, c, k)
+					}
+				}
+			}
+		}
+
+		if ct := a.Header.Get(HdrContentType); ct != "" {
+			if _, _, err := mime.ParseMediaType(ct); err != nil {
+				return fmt.Errorf("attachment %d (%s): invalid %s %q: %v", i, a.Filename, HdrContentType, ct, err)
+			}
+		}
+	}
+	return nil
+}
+
+// formatAddresses formats the addresses as RFC5322 addresses, encoding any
+// non-ASCII names per RFC2047.
+func formatAddresses(addrs []string) ([]string, error) {
+	out := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		a, err := mail.ParseAddress(addr)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", addr, err)
+		}
+		out = append(out, a.String())
+	}
+	return out, nil
+}
+
+// messageIDDomain returns the domain used for generated Message-IDs, which
+// is the domain of the sender.
+func messageIDDomain(from string) string {
+	if addrs, err := mail.ParseAddressList(from); err == nil {
+		if i := strings.LastIndex(addrs[0].Address, "@"); i >= 0 {
+			return addrs[0].Address[i+1:]
+		}
+	}
+
+	if h, err := os.Hostname(); err == nil {
+		return h
+	}
+	return "localhost.localdomain"
+}
+
+// writeHeaders writes the headers, folding long ones.
+func writeHeaders(w io.Writer, header textproto.MIMEHeader) error {
+	keys := make([]string, 0, len(header))
+	leading := make(map[string]bool, len(leadingHeaders))
+	for _, k := range leadingHeaders {
+		if _, ok := header[k]; ok {
+			keys = append(keys, k)
+		}
+		leading[k] = true
+	}
+
+	rest := make([]string, 0, len(header))
+	for k := range header {
+		if !leading[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	keys = append(keys, rest...)
+
+	for _, k := range keys {
+		name := k
+		if n, ok := headerNames[k]; ok {
+			name = n
+		}
+
+		for _, v := range header[k] {
+			// Structured MIME headers are written as is, everything else
+			// is encoded if it isn't printable ASCII. This also encodes
+			// CR and LF, so header values can't inject headers.
+			if k != HdrContentType && k != HdrContentDisposition {
+				v = mime.QEncoding.Encode(defaultCharset, v)
+			}
+			if err := foldHeader(w, name, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// foldHeader writes the header, folding it at whitespace so that lines stay
+// within 78 characters where possible. It returns an error if the header
+// can't be folded within the 998 character limit on lines.
+func foldHeader(w io.Writer, name, value string) error {
+	var (
+		line  strings.Builder
+		lines []string
+	)
+	line.WriteString(name + ":")
+
+	// The first word always goes on the first line, after the name.
+	first := true
+	for _, word := range strings.Split(value, " ") {
+		if !first && word != "" && line.Len()+1+len(word) > maxLineLength {
+			lines = append(lines, line.String())
+			line.Reset()
+		}
+		line.WriteString(" " + word)
+		first = false
+	}
+	lines = append(lines, line.String())
+
+	for _, l := range lines {
+		if len(l) > maxHeaderLineLength {
+			return fmt.Errorf("header %s can't be folded to %d characters per line", name, maxHeaderLineLength)
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\r\n")+"\r\n")
+	return err
+}
+
+// writeBody writes a body of the message as quoted-printable. If w is not
+// nil, the body is written as a part of w.
+func writeBody(buff io.Writer, w *multipart.Writer, body []byte, mediaType string) error {
+	if w != nil {
+		if _, err := w.CreatePart(textproto.MIMEHeader{
+			HdrContentType:             {mediaType + "; charset=" + defaultCharset},
+			HdrContentTransferEncoding: {contentEncQuotedPrintable},
+		}); err != nil {
+			return err
+		}
+	}
+
+	qp := quotedprintable.NewWriter(buff)
+	if _, err := qp.Write(body); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// writeAttachment writes the attachment as a base64 encoded part of w. The
+// content of attachments read from a source is streamed from it.
+func (b mimeBuilder) writeAttachment(w *multipart.Writer, a smtppool.Attachment) error {
+	src, hdr, err := emailSource(b.attachments, a)
+	if err != nil {
+		return err
+	}
+	p, err := w.CreatePart(hdr)
+	if err != nil {
+		return err
+	}
+	if src == nil {
+		return base64Wrap(p, a.Content)
+	}
+
+	r, err := src.Open()
+	if err != nil {
+		return fmt.Errorf("error opening attachment %s: %w", a.Filename, err)
+	}
+	defer r.Close()
+	if err := base64WrapReader(p, r); err != nil {
+		return fmt.Errorf("error reading attachment %s: %w", a.Filename, err)
+	}
+	return nil
+}
+
+// base64Wrap writes b base64 encoded, wrapped at 76 characters per line as
+// required by RFC2045.
+func base64Wrap(w io.Writer, b []byte) error {
+	// 57 raw bytes per 76 character line.
+	const maxRaw = 57
+
+	line := make([]byte, 0, base64.StdEncoding.EncodedLen(maxRaw)+2)
+	for len(b) > 0 {
+		n := maxRaw
+		if len(b) < n {
+			n = len(b)
+		}
+
+		line = line[:base64.StdEncoding.EncodedLen(n)]
+		base64.StdEncoding.Encode(line, b[:n])
+		line = append(line, "\r\n"...)
+		if _, err := w.Write(line); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// base64WrapReader is like base64Wrap, but reads the content from r, a
+// chunk of whole lines at a time.
+func base64WrapReader(w io.Writer, r io.Reader) error {
+	buf := make([]byte, 57*64)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			if err := base64Wrap(w, buf[:n]); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// maxBoundaryLength is the maximum length of a fixed boundary, leaving room
+// for the counter of nested parts within the 70 characters RFC 2046 allows.
+const maxBoundaryLength = 60
+
+// checkBoundary checks that b can be used as a fixed boundary. It's limited
+// to characters which don't need quoting in the Content-Type header.
+func checkBoundary(b string) error {
+	if b == "" || len(b) > maxBoundaryLength {
+		return fmt.Errorf("boundary must be 1 to %d characters long", maxBoundaryLength)
+	}
+	for _, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.':
+		default:
+			return fmt.Errorf("invalid character %q in boundary", c)
+		}
+	}
+	return nil
+}
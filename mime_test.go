@@ -0,0 +1,236 @@
+package postal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knadh/smtppool"
+)
+
+func TestFoldLongHeader(t *testing.T) {
+	var refs []string
+	for i := 0; i < 40; i++ {
+		refs = append(refs, fmt.Sprintf("<%d.abcdefghijklmnop@example.com>", i))
+	}
+	references := strings.Join(refs, " ")
+	if len(references) <= maxHeaderLineLength {
+		t.Fatalf("test header is too short: %d", len(references))
+	}
+
+	e := smtppool.Email{
+		From:    "from@example.com",
+		To:      []string{"to@example.com"},
+		Text:    []byte("hello"),
+		Headers: textproto.MIMEHeader{"References": {references}},
+	}
+	raw, err := mimeBuilder{now: time.Now()}.build(&e)
+	if err != nil {
+		t.Fatalf("error building message: %v", err)
+	}
+
+	head := raw[:bytes.Index(raw, []byte("\r\n\r\n"))]
+	lines := strings.Split(string(head), "\r\n")
+	var continuations int
+	for _, l := range lines {
+		if len(l) > maxLineLength {
+			t.Fatalf("line exceeds %d characters: %q", maxLineLength, l)
+		}
+		if strings.HasPrefix(l, " ") {
+			continuations++
+		}
+	}
+	if continuations == 0 {
+		t.Fatal("expected the header to be folded into continuation lines")
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get("References"); got != references {
+		t.Fatalf("header didn't survive folding:\n got: %q\nwant: %q", got, references)
+	}
+}
+
+func TestFoldUnbreakableHeader(t *testing.T) {
+	e := smtppool.Email{
+		From:    "from@example.com",
+		To:      []string{"to@example.com"},
+		Text:    []byte("hello"),
+		Headers: textproto.MIMEHeader{"X-Long": {strings.Repeat("a", maxHeaderLineLength)}},
+	}
+	if _, err := (mimeBuilder{now: time.Now()}).build(&e); err == nil {
+		t.Fatal("expected error for a header which can't be folded")
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	e := smtppool.Email{
+		From:    "from@example.com",
+		To:      []string{"to@example.com"},
+		Text:    []byte("hello"),
+		Headers: textproto.MIMEHeader{"X-Custom": {"value\r\nBcc: victim@example.com"}},
+	}
+	raw, err := mimeBuilder{now: time.Now()}.build(&e)
+	if err != nil {
+		t.Fatalf("error building message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if m.Header.Get("Bcc") != "" {
+		t.Fatal("header value injected a header")
+	}
+}
+
+func TestWithBoundary(t *testing.T) {
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+		HTMLBody:  `<img src="cid:logo.png">`,
+		Headers:   textproto.MIMEHeader{"Message-Id": {"<fixed@example.com>"}},
+	}
+	if _, err := msg.AttachInline(strings.NewReader("png"), "logo.png", "image/png"); err != nil {
+		t.Fatalf("error attaching inline: %v", err)
+	}
+	if err := msg.Attach(strings.NewReader("pdf"), "report.pdf", "application/pdf", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	client, rec := newRecordingClient(t, WithBoundary("golden"), WithClock(newFakeClock()))
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendMessage(msg); err != nil {
+			t.Fatalf("error sending message: %v", err)
+		}
+	}
+
+	raw := string(rec.last(t))
+	for _, b := range []string{"golden-1", "golden-2", "golden-3"} {
+		if !strings.Contains(raw, "boundary="+b+"\r\n") && !strings.Contains(raw, "--"+b+"--") {
+			t.Fatalf("expected boundary %s in message:\n%s", b, raw)
+		}
+	}
+	if rec.reqs[0].Data != rec.reqs[1].Data {
+		t.Fatal("expected identical messages with a fixed boundary")
+	}
+	if root := parseMIMETree(t, rec.last(t)); len(root.children) != 2 {
+		t.Fatalf("unexpected MIME tree: %+v", root)
+	}
+}
+
+func TestWithBoundaryInvalid(t *testing.T) {
+	for _, b := range []string{"has space", "quote\"", strings.Repeat("x", 61)} {
+		if _, err := NewAPIClient("https://postal.example.com", "token", nil, WithBoundary(b)); err == nil {
+			t.Fatalf("expected an error for boundary %q", b)
+		}
+	}
+}
+
+func TestBuildErrorContext(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	if err := msg.Attach(strings.NewReader("ok"), "ok.txt", "text/plain", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if err := msg.Attach(strings.NewReader("bad"), "bad.txt", "text/plain; charset", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	_, err := client.SendMessage(msg)
+	if !errors.Is(err, ErrInvalidMessage) || !strings.Contains(err.Error(), "attachment 1 (bad.txt)") {
+		t.Fatalf("expected an error about the malformed attachment, got %v", err)
+	}
+
+	msg.attachments = nil
+	if err := msg.Attach(strings.NewReader("bad"), "bad.txt", "text/plain", textproto.MIMEHeader{"X-Note": {"a\r\nBcc: victim@example.com"}}); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if _, err := client.SendMessage(msg); err == nil || !strings.Contains(err.Error(), "attachment 0 (bad.txt)") {
+		t.Fatalf("expected an error about the attachment header, got %v", err)
+	}
+
+	msg.attachments = nil
+	msg.Cc = []string{"not an address"}
+	if _, err := client.SendMessage(msg); err == nil || !strings.Contains(err.Error(), "Cc addresses") {
+		t.Fatalf("expected an error about the Cc addresses, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatal("expected nothing to be sent")
+	}
+}
+
+func TestSinglePartMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		want string
+	}{
+		{"plain", Message{PlainBody: "hello"}, "text/plain"},
+		{"html", Message{HTMLBody: "<p>hello</p>"}, "text/html"},
+		{"both", Message{PlainBody: "hello", HTMLBody: "<p>hello</p>"}, "multipart/alternative"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, rec := newRecordingClient(t)
+			tt.msg.From = "from@example.com"
+			tt.msg.To = []string{"to@example.com"}
+			if _, err := client.SendMessage(tt.msg); err != nil {
+				t.Fatalf("error sending message: %v", err)
+			}
+
+			root := parseMIMETree(t, rec.last(t))
+			if root.contentType != tt.want {
+				t.Fatalf("expected a %s message, got %s", tt.want, root.contentType)
+			}
+			if !strings.HasPrefix(tt.want, "multipart/") && len(root.children) != 0 {
+				t.Fatalf("expected no parts, got %d", len(root.children))
+			}
+		})
+	}
+}
+
+func TestHTMLPartQuotedPrintable(t *testing.T) {
+	client, rec := newRecordingClient(t)
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "Hello, world",
+		HTMLBody:  "<html><body><p>Hello, world</p></body></html>",
+	}
+	if err := msg.Attach(strings.NewReader("data"), "data.csv", "", nil); err != nil {
+		t.Fatalf("error attaching file: %v", err)
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	// The HTML part is found in the raw message, as NextPart decodes
+	// quoted-printable parts and drops their encoding header.
+	raw := string(rec.last(t))
+	i := strings.Index(raw, "Content-Type: text/html")
+	if i < 0 {
+		t.Fatalf("expected an HTML part in %q", raw)
+	}
+	start := strings.LastIndex(raw[:i], "\r\n--")
+	header, body, _ := strings.Cut(raw[start:], "\r\n\r\n")
+	if !strings.Contains(header, "Content-Transfer-Encoding: "+contentEncQuotedPrintable) {
+		t.Fatalf("expected the HTML part to be quoted-printable, got headers %q", header)
+	}
+	if !strings.HasPrefix(body, msg.HTMLBody) {
+		t.Fatalf("expected the HTML to be readable in the raw message, got %q", body)
+	}
+}
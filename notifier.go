@@ -0,0 +1,110 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"net/textproto"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Template is a notification template for a Notifier. The subject and the
+// plain text body are text templates, the HTML body an HTML template, so
+// the data in it is escaped. Either body may be left out.
+type Template struct {
+	Subject   *texttemplate.Template
+	PlainBody *texttemplate.Template
+	HTMLBody  *htmltemplate.Template
+}
+
+// NewTemplate parses the subject, plain text body and HTML body of a
+// notification template. Empty bodies are left out.
+func NewTemplate(subject, plainBody, htmlBody string) (*Template, error) {
+	t := &Template{}
+	var err error
+	if t.Subject, err = texttemplate.New("subject").Parse(subject); err != nil {
+		return nil, fmt.Errorf("error parsing subject template: %w", err)
+	}
+	if plainBody != "" {
+		if t.PlainBody, err = texttemplate.New("plain").Parse(plainBody); err != nil {
+			return nil, fmt.Errorf("error parsing plain body template: %w", err)
+		}
+	}
+	if htmlBody != "" {
+		if t.HTMLBody, err = htmltemplate.New("html").Parse(htmlBody); err != nil {
+			return nil, fmt.Errorf("error parsing html body template: %w", err)
+		}
+	}
+	if t.PlainBody == nil && t.HTMLBody == nil {
+		return nil, errors.New("notification template has no body")
+	}
+	return t, nil
+}
+
+// Notifier sends transactional notifications rendered from templates,
+// without building a Message for each. It's a thin layer over a Client:
+// messages are sent with the client's SendMessageContext if it has one, as
+// ApiClient does, so they're bound to Notify's context, or else with its
+// SendMessage.
+type Notifier struct {
+	client  Client
+	from    string
+	headers textproto.MIMEHeader
+}
+
+// NewNotifier returns a Notifier sending notifications from the from
+// address through the client. The headers are added to every notification.
+func NewNotifier(client Client, from string, headers textproto.MIMEHeader) *Notifier {
+	return &Notifier{client: client, from: from, headers: headers}
+}
+
+// Notify renders the template with the data and sends the result to the
+// recipient.
+func (n *Notifier) Notify(ctx context.Context, to string, t *Template, data interface{}) error {
+	msg, err := n.render(t, data)
+	if err != nil {
+		return err
+	}
+	msg.To = []string{to}
+
+	_, err = sendContext(ctx, n.client, msg)
+	return err
+}
+
+// render returns the notification message for the template and data.
+func (n *Notifier) render(t *Template, data interface{}) (Message, error) {
+	msg := Message{From: n.from}
+	if len(n.headers) > 0 {
+		msg.Headers = make(textproto.MIMEHeader, len(n.headers))
+		for k, v := range n.headers {
+			msg.Headers[k] = append([]string(nil), v...)
+		}
+	}
+
+	var b bytes.Buffer
+	if t.Subject != nil {
+		if err := t.Subject.Execute(&b, data); err != nil {
+			return Message{}, fmt.Errorf("error rendering subject: %w", err)
+		}
+		// A subject spans a single line.
+		msg.Subject = strings.Join(strings.Fields(b.String()), " ")
+	}
+	if t.PlainBody != nil {
+		b.Reset()
+		if err := t.PlainBody.Execute(&b, data); err != nil {
+			return Message{}, fmt.Errorf("error rendering plain body: %w", err)
+		}
+		msg.PlainBody = b.String()
+	}
+	if t.HTMLBody != nil {
+		b.Reset()
+		if err := t.HTMLBody.Execute(&b, data); err != nil {
+			return Message{}, fmt.Errorf("error rendering html body: %w", err)
+		}
+		msg.HTMLBody = b.String()
+	}
+	return msg, nil
+}
@@ -0,0 +1,110 @@
+package postal
+
+import (
+	"context"
+	"fmt"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+// messageRecorder is a Client which records the messages sent with it.
+type messageRecorder struct {
+	msgs []Message
+}
+
+func (r *messageRecorder) SendMessage(msg Message) (Response, error) {
+	r.msgs = append(r.msgs, msg)
+	return Response{}, nil
+}
+
+func (r *messageRecorder) GetMessageDetails(id int64) (MessageDetails, error) {
+	return MessageDetails{}, ErrNotSupported
+}
+
+func TestNotifier(t *testing.T) {
+	tmpl, err := NewTemplate(
+		"Welcome, {{.Name}}\n",
+		"Hi {{.Name}}, your code is {{.Code}}.",
+		"<p>Hi {{.Name}}, your code is {{.Code}}.</p>",
+	)
+	if err != nil {
+		t.Fatalf("error parsing template: %v", err)
+	}
+
+	client, rec := newRecordingClient(t)
+	n := NewNotifier(client, "from@example.com", textproto.MIMEHeader{"X-Category": {"welcome"}})
+	data := map[string]string{"Name": "<Ana>", "Code": "1234"}
+	if err := n.Notify(context.Background(), "to@example.com", tmpl, data); err != nil {
+		t.Fatalf("error sending notification: %v", err)
+	}
+
+	raw := string(rec.last(t))
+	for _, want := range []string{
+		"From: <from@example.com>\r\n",
+		"To: <to@example.com>\r\n",
+		"Subject: Welcome, <Ana>\r\n",
+		"X-Category: welcome\r\n",
+		"Hi <Ana>, your code is 1234.",
+		"<p>Hi &lt;Ana&gt;, your code is 1234.</p>",
+	} {
+		if !strings.Contains(raw, want) {
+			t.Errorf("expected %q in message:\n%s", want, raw)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := n.Notify(ctx, "to@example.com", tmpl, data); err == nil {
+		t.Fatal("expected the notification to be bound to the context")
+	}
+}
+
+func TestNotifierErrors(t *testing.T) {
+	if _, err := NewTemplate("{{.Name", "body", ""); err == nil {
+		t.Fatal("expected an error for a bad subject")
+	}
+	if _, err := NewTemplate("subject", "", ""); err == nil {
+		t.Fatal("expected an error for a template without a body")
+	}
+
+	tmpl, err := NewTemplate("subject", "{{.Missing.Field}}", "")
+	if err != nil {
+		t.Fatalf("error parsing template: %v", err)
+	}
+	rec := &messageRecorder{}
+	n := NewNotifier(rec, "from@example.com", nil)
+	if err := n.Notify(context.Background(), "to@example.com", tmpl, struct{}{}); err == nil || !strings.Contains(err.Error(), "plain body") {
+		t.Fatalf("expected a rendering error, got %v", err)
+	}
+	if len(rec.msgs) != 0 {
+		t.Fatalf("expected nothing to be sent, got %d messages", len(rec.msgs))
+	}
+}
+
+func ExampleNotifier() {
+	// Any Client can send the notifications; an ApiClient binds them to
+	// Notify's context.
+	client := &messageRecorder{}
+	n := NewNotifier(client, "Acme <noreply@example.com>", nil)
+
+	tmpl, err := NewTemplate(
+		"Your order {{.ID}} has shipped",
+		"Hi {{.Name}}, order {{.ID}} is on its way.",
+		"",
+	)
+	if err != nil {
+		panic(err)
+	}
+	data := struct{ ID, Name string }{"A-1001", "Ana"}
+	if err := n.Notify(context.Background(), "ana@example.com", tmpl, data); err != nil {
+		panic(err)
+	}
+
+	msg := client.msgs[0]
+	fmt.Println(msg.Subject)
+	fmt.Println(msg.PlainBody)
+	// Output:
+	// Your order A-1001 has shipped
+	// Hi Ana, order A-1001 is on its way.
+}
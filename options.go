@@ -0,0 +1,746 @@
+package postal
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"regexp"
+	"time"
+
+	"github.com/knadh/smtppool"
+)
+
+// HdrPostalSource is the default header used by WithSource.
+const HdrPostalSource = "X-Postal-Source"
+
+// Logger logs warnings from the client. *log.Logger satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// Option configures an ApiClient.
+type Option func(*ApiClient)
+
+// WithSource adds the X-Postal-Source header with the given name to every
+// message sent by the client. It identifies the application sending the
+// message in postal's logs. A message which sets the header itself keeps its
+// own value.
+func WithSource(name string) Option {
+	return WithSourceHeader(HdrPostalSource, name)
+}
+
+// WithSourceHeader is like WithSource, but uses the given header instead of
+// X-Postal-Source.
+func WithSourceHeader(header, name string) Option {
+	return func(a *ApiClient) {
+		a.sourceHeader = header
+		a.source = name
+	}
+}
+
+// WithStripBOM strips a leading UTF-8 byte order mark from the plain and HTML
+// bodies before the message is built. Some mail clients render the BOM as a
+// stray character.
+func WithStripBOM() Option {
+	return func(a *ApiClient) {
+		a.stripBOM = true
+	}
+}
+
+// WithClock sets the clock used by the client. It defaults to the system
+// clock and is mostly useful to control time in tests.
+func WithClock(c Clock) Option {
+	return func(a *ApiClient) {
+		a.clock = c
+	}
+}
+
+// WithEmailCustomizer adds a function which can modify the smtppool.Email
+// before it is built into the RFC2882 message. It runs after the message's
+// fields and the client's headers have been mapped onto the email, so it sees
+// and can override everything SendMessage would send. Customizers run in the
+// order they were added.
+func WithEmailCustomizer(fn func(*smtppool.Email)) Option {
+	return func(a *ApiClient) {
+		a.emailCustomizers = append(a.emailCustomizers, fn)
+	}
+}
+
+// WithLogger sets the logger the client logs warnings to. By default nothing
+// is logged.
+func WithLogger(l Logger) Option {
+	return func(a *ApiClient) {
+		a.logger = l
+	}
+}
+
+// WithClockSkewWarning logs a warning to the client's logger whenever the
+// clock of the postal server differs from the local clock by more than
+// threshold. A skewed clock can break DKIM signatures and scheduled sends.
+func WithClockSkewWarning(threshold time.Duration) Option {
+	return func(a *ApiClient) {
+		a.skewThreshold = threshold
+	}
+}
+
+// WithPlainTextNormalization normalizes the plain text body before the
+// message is built: line endings are converted to CRLF and trailing
+// whitespace is trimmed from every line. This keeps the body bytes stable,
+// which makes DKIM body hashes reproducible.
+func WithPlainTextNormalization() Option {
+	return func(a *ApiClient) {
+		a.normalizePlain = true
+	}
+}
+
+// WithPlainTextFallback adds a short plain text body, asking to view the
+// message in an HTML capable client, to messages which only have an HTML
+// body. Spam filters penalize messages without a text/plain part.
+func WithPlainTextFallback() Option {
+	return func(a *ApiClient) {
+		a.plainFallback = true
+	}
+}
+
+// WithDefaultFrom sets the From of messages sent without one, so it doesn't
+// need to be repeated on every message. A message's own From takes
+// precedence.
+func WithDefaultFrom(addr string) Option {
+	return func(a *ApiClient) {
+		a.defaultFrom = addr
+	}
+}
+
+// WithDefaultSender sets the Sender of messages sent without one. The Sender
+// header is only written for messages with more than one From address. A
+// message's own Sender takes precedence.
+func WithDefaultSender(addr string) Option {
+	return func(a *ApiClient) {
+		a.defaultSender = addr
+	}
+}
+
+// WithAttachmentOnlyBody sets the plain body of messages sent with
+// attachments but no body, for clients which show a bodyless message as
+// blank or broken. By default such messages are sent as a multipart/mixed
+// message with only their attachments.
+func WithAttachmentOnlyBody(body string) Option {
+	return func(a *ApiClient) {
+		a.attachOnlyBody = body
+	}
+}
+
+// WithMaxAttachments makes sends of messages with more than n attachments
+// fail with ErrTooManyAttachments before anything is sent to postal. By
+// default there's no limit.
+func WithMaxAttachments(n int) Option {
+	return func(a *ApiClient) {
+		a.maxAttachments = n
+	}
+}
+
+// WithMaxMessageSize makes sends of messages larger than n bytes fail with
+// ErrMessageTooLarge before anything is sent to postal. Raw sends are checked
+// against the size of the built message; structured sends, which postal
+// builds, against the size of their bodies and attachments. By default
+// there's no limit.
+func WithMaxMessageSize(n int64) Option {
+	return func(a *ApiClient) {
+		a.maxMessageSize = n
+	}
+}
+
+// WithMaxHeaderSize makes sends of messages whose header is larger than n
+// bytes, or DefaultMaxHeaderSize if n isn't positive, fail with
+// ErrHeaderTooLarge before anything is sent to postal. Raw sends are checked
+// against the header of the built message, structured sends against the
+// estimate of Message.CheckHeaderSize. By default there's no limit.
+func WithMaxHeaderSize(n int) Option {
+	return func(a *ApiClient) {
+		if n <= 0 {
+			n = DefaultMaxHeaderSize
+		}
+		a.maxHeaderSize = n
+	}
+}
+
+// WithMessageRetention sets how long the postal server keeps messages, which
+// is set per server in postal's web interface, or DefaultMessageRetention if
+// d isn't positive. It's what FullResult.LookupUntil is derived from.
+func WithMessageRetention(d time.Duration) Option {
+	return func(a *ApiClient) {
+		if d <= 0 {
+			d = DefaultMessageRetention
+		}
+		a.retention = d
+	}
+}
+
+// WithMaxSizeFromServer makes NewAPIClient fetch the server's maximum message
+// size with GetSendLimits and use it as the client's, so the two don't drift
+// apart. If the server doesn't report one, the limit set with
+// WithMaxMessageSize, if any, is used instead.
+func WithMaxSizeFromServer() Option {
+	return func(a *ApiClient) {
+		a.maxSizeFromServer = true
+	}
+}
+
+// WithDKIM signs messages sent using the raw send endpoint with DKIM, for
+// domains postal isn't the signing authority for. The signature uses
+// rsa-sha256 with relaxed canonicalization of the headers and the body, and
+// covers the body and those of the headers the message has, which must
+// include From. Headers defaults to the address, subject, date, threading
+// and MIME headers. privateKey is the PEM encoded RSA key, in PKCS #1 or
+// PKCS #8 form, whose public key is published in the selector's DNS record.
+//
+// Messages sent using the structured send endpoint are built by postal, so
+// they aren't signed.
+func WithDKIM(selector, domain string, privateKey []byte, headers []string) Option {
+	return func(a *ApiClient) {
+		if len(headers) == 0 {
+			headers = defaultDKIMHeaders
+		}
+		a.dkim = &dkimSigner{selector: selector, domain: domain, keyPEM: privateKey, headers: headers}
+	}
+}
+
+// WithRequireSubject makes sends of messages without a subject fail with
+// ErrNoSubject before anything is sent to postal, to catch templates which
+// rendered an empty one. Without it, use Message.CheckSubject to warn about
+// them.
+func WithRequireSubject() Option {
+	return func(a *ApiClient) {
+		a.requireSubject = true
+	}
+}
+
+// WithRejectEmptyAttachments makes sends of messages with an attachment
+// without content fail with ErrEmptyAttachment before anything is sent to
+// postal, to catch files which were attached before they were written.
+func WithRejectEmptyAttachments() Option {
+	return func(a *ApiClient) {
+		a.rejectEmpty = true
+	}
+}
+
+// WithStrictContentIDs makes sends of messages with an inline attachment
+// whose Content-ID is also another attachment's fail with
+// ErrDuplicateContentID before anything is sent to postal. The HTML body's
+// cid: reference to either is ambiguous, so mail clients show one image in
+// place of the other; this catches templates attaching two inline images
+// with the same filename.
+func WithStrictContentIDs() Option {
+	return func(a *ApiClient) {
+		a.strictCIDs = true
+	}
+}
+
+// WithRawLineEndings sets what SendRaw does with messages whose lines end in
+// a bare LF, such as messages built by other tools on Unix: send them as
+// they are, the default, reject them or convert them to CRLF. See
+// RawLineEndings.
+func WithRawLineEndings(mode RawLineEndings) Option {
+	return func(a *ApiClient) {
+		a.rawLineEndings = mode
+	}
+}
+
+// WithCorrelationIDFromContext sets the function which returns the
+// correlation ID of a send's context, such as a request ID the application
+// propagates, to tie its logs to postal's. Requests to postal carry the ID in
+// an X-Correlation-ID header, so do the messages sent, unless they already
+// have one, and the client's logs about a request include it. IDs which
+// can't be sent in a header are ignored.
+func WithCorrelationIDFromContext(fn func(ctx context.Context) string) Option {
+	return func(a *ApiClient) {
+		a.correlation = fn
+	}
+}
+
+// WithFilenameTransliteration sends the filenames of attachments
+// transliterated to ASCII, such as "resume.pdf" for "résumé.pdf", for
+// recipients whose mail clients don't decode the RFC 2231 filenames
+// non-ASCII names are otherwise sent in. Accented Latin letters are replaced
+// by their base letters and other characters outside ASCII by "_". The
+// Content-ID of inline attachments is kept, so the HTML body's references to
+// them still work.
+func WithFilenameTransliteration() Option {
+	return func(a *ApiClient) {
+		a.transliterate = true
+	}
+}
+
+// WithContentTypeSniffing corrects the content type of attachments whose
+// content doesn't match their extension, such as a PDF uploaded as a .txt
+// file, with the type http.DetectContentType sniffs from it. Only the types
+// it detects by a signature, such as PDFs and common images, are corrected,
+// and only for attachments whose type is their extension's; each correction
+// is logged, see WithLogger.
+func WithContentTypeSniffing() Option {
+	return func(a *ApiClient) {
+		a.sniffTypes = true
+	}
+}
+
+// WithPerRecipientMessages makes the client send a separate message to each
+// recipient of a message, rather than one message to all of them, so each
+// recipient's message has its own Message-ID and can be tracked, replied to
+// and bounced on its own. A message with EnvelopeTo is split by its envelope
+// recipients and keeps its headers; otherwise each message is addressed To
+// its recipient alone, like those of SendPersonalized, so recipients don't
+// see each other and those in Cc and Bcc receive it in To.
+//
+// It costs a request per recipient, so sends of messages with many
+// recipients are slower and count more against rate limits, and a failure
+// can leave some recipients sent and others not: the send then fails with a
+// *PartialSuccessError listing the recipients whose sends failed, which are
+// logged. With a single message postal already returns a message ID and
+// token per recipient, which is enough to track deliveries, so this is only
+// worth it for separate Message-IDs.
+func WithPerRecipientMessages() Option {
+	return func(a *ApiClient) {
+		a.perRecipient = true
+	}
+}
+
+// WithAttachmentContentMD5 adds a Content-MD5 header, the base64 encoded MD5
+// digest of the content as defined by RFC 1864, to every attachment which
+// doesn't have one, for receivers and archives which verify the integrity
+// of attachments. The digest is computed when the message is built, so
+// attachments read from a source are read once more for it. Other digests
+// have no standard header, but can be set in the headers given to Attach.
+//
+// Postal's structured send endpoint takes no attachment headers, so it's
+// only added to messages sent to the raw endpoint.
+func WithAttachmentContentMD5() Option {
+	return func(a *ApiClient) {
+		a.contentMD5 = true
+	}
+}
+
+// WithAttachmentTypeAllowlist makes sends of messages with attachments of
+// other types fail with ErrAttachmentNotAllowed before anything is sent to
+// postal. Each entry is either a content type, such as "application/pdf" or
+// "image/*", or a file extension, such as ".pdf". If there are content types,
+// an attachment's content type must be one of them; if there are extensions,
+// its file name must have one of them.
+func WithAttachmentTypeAllowlist(types []string) Option {
+	return func(a *ApiClient) {
+		a.attachAllow = lowerAll(types)
+	}
+}
+
+// WithAttachmentTypeDenylist makes sends of messages with an attachment with
+// any of the content types or file extensions fail with
+// ErrAttachmentNotAllowed before anything is sent to postal. Entries are as
+// for WithAttachmentTypeAllowlist.
+func WithAttachmentTypeDenylist(types []string) Option {
+	return func(a *ApiClient) {
+		a.attachDeny = lowerAll(types)
+	}
+}
+
+// WithRecipientValidator checks every recipient of a message with validate
+// before it's sent, for example to enforce which domains may be mailed.
+// validate is given the bare address of each of To, Cc and Bcc; if it
+// returns an error for any of them, the send fails with ErrInvalidMessage.
+func WithRecipientValidator(validate func(addr string) error) Option {
+	return func(a *ApiClient) {
+		a.rcptValidator = validate
+	}
+}
+
+// WithAllowedFromPattern makes sends of messages with a sender address not
+// matching pattern fail with ErrSenderNotAllowed before anything is sent to
+// postal. The sender addresses are the bare addresses of From, the Sender
+// and Return-Path headers and the envelope sender; pattern should be
+// anchored, as in `^[^@]+@tenant\.example$`, since it matches anywhere in
+// them otherwise. It's a guardrail for clients shared by tenants, which may
+// each only send from their own domain.
+func WithAllowedFromPattern(pattern *regexp.Regexp) Option {
+	return func(a *ApiClient) {
+		a.allowedFrom = pattern
+	}
+}
+
+// WithAllowedFromDomains is like WithAllowedFromPattern, but the sender
+// addresses must be on one of the domains, or a subdomain of one. If both
+// are set, the addresses must match both.
+func WithAllowedFromDomains(domains ...string) Option {
+	return func(a *ApiClient) {
+		a.allowedFromDomains = lowerAll(domains)
+	}
+}
+
+// WithPlainOnlyDomains sets the domains whose recipients are sent messages
+// without their HTML body by SendSplitPlainOnly, such as corporate domains
+// whose gateways strip or mangle HTML. Subdomains of the domains match too.
+// Other sends are unaffected: a message has one body for all its
+// recipients, so only SendSplitPlainOnly, which splits it, can leave the
+// HTML out for some of them.
+func WithPlainOnlyDomains(domains ...string) Option {
+	return func(a *ApiClient) {
+		a.plainOnlyDomains = lowerAll(domains)
+	}
+}
+
+// WithPreSendHook sets a hook which is called with every request to postal
+// right before it's sent, so it can change the request, for example to sign
+// its body or add a header for a gateway, or abort it by returning an error.
+//
+// The hook is called after the client has set the request's headers, the
+// auth, content type and correlation ID headers, so it can override them,
+// and on every attempt of a retried request. msg is the message being sent,
+// as the client sends it with its defaults and rewriting applied, or the
+// zero Message for requests which don't send one, such as SendRaw's or
+// GetMessageDetails'. The request's GetBody returns its JSON body.
+//
+// An error from the hook aborts the request without it being retried or
+// counted by the circuit breaker, and is returned wrapped as it is.
+func WithPreSendHook(hook PreSendHook) Option {
+	return func(a *ApiClient) {
+		a.preSend = hook
+	}
+}
+
+// WithUnsubscribeFooter appends an unsubscribe footer to the bodies of
+// messages with an UnsubscribeURL. The footer is a text/template executed
+// with the URL as .URL, such as "Unsubscribe: {{.URL}}". It's appended to
+// the plain text body as it is, and to the HTML body escaped, with the URL
+// as a link, after UnsubscribeMarker and before the closing body tag.
+//
+// A body which already has the URL, or an HTML body which already has
+// UnsubscribeMarker, is left as it is, so a footer isn't added twice; a
+// message without a plain text or HTML body doesn't get one. NewAPIClient
+// fails if the template can't be parsed or executed.
+func WithUnsubscribeFooter(template string) Option {
+	return func(a *ApiClient) {
+		a.unsubscribeTemplate = template
+	}
+}
+
+// WithSkipRemovedRecipients makes sends of messages whose recipients were all
+// removed by the client's address rewriter, see WithAddressRewriter, succeed
+// without anything being sent, with FullResult.Skipped set and the skip
+// logged. By default they fail with ErrNoRecipients before anything is sent
+// to postal.
+func WithSkipRemovedRecipients() Option {
+	return func(a *ApiClient) {
+		a.skipRemoved = true
+	}
+}
+
+// WithHTTPTrace traces every request to postal with an httptrace
+// ClientTrace, and calls report with its timing once it's finished,
+// successfully or not, to find which step of slow sends is slow: the DNS
+// lookup, connecting, the TLS handshake, or postal processing the request.
+// Every attempt of a retried request is reported; the timing of the last is
+// also in FullResult.Timing. The steps are timed with the client's clock.
+func WithHTTPTrace(report func(ctx context.Context, timing RequestTiming)) Option {
+	return func(a *ApiClient) {
+		a.httpTrace = report
+	}
+}
+
+// WithWrappedData wraps the base64 encoded message in the data field of
+// requests at 76 columns with CRLF line breaks, as in RFC 2045. Postal
+// decodes either form; this is for proxies in front of it which can't cope
+// with very long lines. By default the data is a single line.
+func WithWrappedData() Option {
+	return func(a *ApiClient) {
+		a.wrapData = true
+	}
+}
+
+// WithRetry retries requests to postal which fail with a retryable error,
+// see IsRetryable, according to the policy. By default requests aren't
+// retried.
+//
+// Note that a send which failed with a 5xx response or a dropped connection
+// may still have been accepted by postal, so retrying it can deliver the
+// message twice.
+func WithRetry(p RetryPolicy) Option {
+	return func(a *ApiClient) {
+		a.retry = p
+	}
+}
+
+// WithStructuredSend sends messages using postal's structured send endpoint,
+// which builds the MIME message on postal's side, instead of the raw one.
+// Messages with inline attachments can't be sent this way and fail with
+// ErrInlineAttachments; set their ForceRaw to send them using the raw one.
+func WithStructuredSend() Option {
+	return func(a *ApiClient) {
+		a.structured = true
+	}
+}
+
+// WithRateLimit limits the client to perSecond requests to postal a second,
+// allowing bursts of up to burst requests. Requests wait until they're
+// allowed, or until their context is done. Retries count against the limit.
+func WithRateLimit(perSecond float64, burst int) Option {
+	return func(a *ApiClient) {
+		a.rateLimit = perSecond
+		a.rateBurst = burst
+	}
+}
+
+// WithMaxConcurrency limits the client to n requests to postal in flight at
+// once, such as to stay within postal's connection limits. Requests wait for
+// one of the others to finish, or until their context is done. Unlike
+// WithRateLimit, which limits how often requests are made, it limits how many
+// are made at the same time. A retry doesn't hold its slot while it waits to
+// be made again.
+func WithMaxConcurrency(n int) Option {
+	return func(a *ApiClient) {
+		a.maxConcurrency = n
+	}
+}
+
+// WithRetryableStatuses sets the response statuses which are retried, and
+// count as failures for the circuit breaker, replacing the default 429, 500,
+// 502, 503 and 504. This is useful behind proxies which signal transient
+// failures with other statuses.
+func WithRetryableStatuses(codes ...int) Option {
+	return func(a *ApiClient) {
+		a.retryStatuses = statusSet(codes...)
+	}
+}
+
+// WithCircuitBreaker makes the client fail fast with ErrCircuitOpen after
+// failureThreshold consecutive requests fail because postal is unavailable,
+// with errors the client would retry, see IsRetryable. After openDuration a
+// single probe request is made; if it succeeds requests are made again,
+// otherwise the breaker stays open for another openDuration.
+func WithCircuitBreaker(failureThreshold int, openDuration time.Duration) Option {
+	return func(a *ApiClient) {
+		a.breakerThreshold = failureThreshold
+		a.breakerOpenDuration = openDuration
+	}
+}
+
+// WithResponseArchiver writes the body of postal's response to every send to
+// w, exactly as postal sent it, including responses to rejected sends. Only
+// the response to the last attempt of a retried send is written. Bodies are
+// written one after the other, and since each one is a JSON document they
+// can be read back with a json.Decoder. Writes are serialized, so w doesn't
+// need to be safe for concurrent use.
+func WithResponseArchiver(w io.Writer) Option {
+	return func(a *ApiClient) {
+		a.archiver = w
+	}
+}
+
+// WithMessageArchiver calls archive after every send of a message, whether
+// it succeeded or not, for keeping an exact copy of what was sent. See
+// MessageArchiver.
+func WithMessageArchiver(archive MessageArchiver) Option {
+	return func(a *ApiClient) {
+		a.msgArchiver = archive
+	}
+}
+
+// WithSendConcurrency sets the number of messages SendStream sends, and
+// GetMessagesDetails fetches, at once. It defaults to 4.
+func WithSendConcurrency(n int) Option {
+	return func(a *ApiClient) {
+		a.sendConcurrency = n
+	}
+}
+
+// WithErrorBodyLimit sets the maximum number of bytes of postal's response
+// body included in the message of an APIError; longer bodies are truncated
+// with an ellipsis. APIError.Body always has the full body. The limit
+// defaults to 2KB, and a negative n disables truncation.
+func WithErrorBodyLimit(n int) Option {
+	return func(a *ApiClient) {
+		a.errorBodyLimit = n
+	}
+}
+
+// WithTransportTimeouts sets separate timeouts for connecting to postal, the
+// TLS handshake, and waiting for the headers of postal's response once the
+// request is written, so a slow step fails on its own timeout rather than
+// using up a send's whole timeout. Zero keeps the default of
+// http.DefaultTransport: 30 seconds to connect, 10 for the handshake, and no
+// limit on the response.
+//
+// Like WithClientCertificate, the timeouts are configured on the client's
+// default http client, so NewAPIClient must be given a nil http client.
+func WithTransportTimeouts(dial, tlsHandshake, responseHeader time.Duration) Option {
+	return func(a *ApiClient) {
+		a.dialTimeout = dial
+		a.tlsTimeout = tlsHandshake
+		a.headerTimeout = responseHeader
+	}
+}
+
+// WithClientCertificate presents the certificate to postal, or a proxy in
+// front of it, when it requests a TLS client certificate. It can be given
+// more than once to offer several certificates.
+//
+// The certificates are configured on the client's default http client, so
+// NewAPIClient must be given a nil http client; it fails otherwise. To use a
+// custom http client, set the certificates in its transport's
+// TLSClientConfig instead.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(a *ApiClient) {
+		a.clientCerts = append(a.clientCerts, cert)
+	}
+}
+
+// WithDedupRecipients removes recipients which appear more than once across
+// To, Cc and Bcc from messages before they are sent, so they don't get the
+// message twice. A recipient is kept in the first of To, Cc and Bcc it
+// appears in. Removed recipients are logged to the client's logger. Use
+// Message.DuplicateRecipients to find duplicates without removing them.
+func WithDedupRecipients() Option {
+	return func(a *ApiClient) {
+		a.dedup = true
+	}
+}
+
+// WithThreadTracker makes messages with a ThreadID replies to the last
+// message sent in their thread, by setting their In-Reply-To and References
+// headers from the tracker, and records them as the thread's last message
+// once sent. Messages which already have an In-Reply-To header are sent as
+// they are, but still recorded.
+func WithThreadTracker(t ThreadTracker) Option {
+	return func(a *ApiClient) {
+		a.threads = t
+	}
+}
+
+// WithSuppressionList sets the suppression list SendIfNotSuppressed checks
+// recipients against.
+func WithSuppressionList(l SuppressionList) Option {
+	return func(a *ApiClient) {
+		a.suppressions = l
+	}
+}
+
+// WithSendLog sets the log SendOnceWithin checks for earlier sends with a
+// key, and records its sends in.
+func WithSendLog(l SendLog) Option {
+	return func(a *ApiClient) {
+		a.sendLog = l
+	}
+}
+
+// WithIdempotencyStore sets the store SendIdempotent checks for earlier
+// sends with a key, and records its sends in.
+func WithIdempotencyStore(s IdempotencyStore) Option {
+	return func(a *ApiClient) {
+		a.idempotency = s
+	}
+}
+
+// WithRequestFormat sets the names of the JSON fields of raw send requests,
+// for servers with a Postal-compatible API which name them differently. The
+// default is PostalRequestFormat. Only raw sends use the format; the
+// structured send endpoint and the other endpoints are left as they are.
+func WithRequestFormat(f RequestFormat) Option {
+	return func(a *ApiClient) {
+		a.requestFormat = f
+	}
+}
+
+// WithMailer sets the X-Mailer header added to every message which doesn't
+// have one. It defaults to "postal_go"; an empty name leaves the header out.
+func WithMailer(name string) Option {
+	return func(a *ApiClient) {
+		a.mailer = name
+	}
+}
+
+// WithAddressRewriter rewrites the To, Cc, Bcc and EnvelopeTo of every
+// message, and the recipients of every send of a prepared message, with r
+// before they're sent.
+func WithAddressRewriter(r AddressRewriter) Option {
+	return func(a *ApiClient) {
+		a.rewriter = r
+	}
+}
+
+// WithRedirectAllTo sends every message to addr instead of its recipients,
+// for example to keep a staging environment from mailing real users. The
+// original recipients are listed in the X-Original-Recipients header.
+// Sends of prepared messages are redirected too, but their recipients aren't
+// added to the header, as the message is already built.
+func WithRedirectAllTo(addr string) Option {
+	return func(a *ApiClient) {
+		a.redirectTo = addr
+	}
+}
+
+// WithSandboxRecipient sets the recipient which messages with Sandbox set are
+// sent to instead of their own recipients. Point it at a mailbox which
+// discards mail, so that tests can exercise a real postal server without
+// mailing anyone.
+//
+// Postal has no per-message flag to accept a message without delivering it.
+// Raw sends keep the message's headers and only change its envelope, but
+// with WithStructuredSend the To, Cc and Bcc of sandbox messages are replaced
+// by the sandbox recipient. For a server which delivers nothing at all,
+// enable development mode on it in postal, which holds all its messages.
+func WithSandboxRecipient(addr string) Option {
+	return func(a *ApiClient) {
+		a.sandboxRcpt = addr
+	}
+}
+
+// WithBoundary makes the MIME boundaries of messages deterministic instead
+// of random, so the same message builds to the same bytes. Multipart parts
+// use boundary followed by a counter, e.g. "boundary-1". The boundary may
+// only contain letters, digits, '-', '_' and '.', and be at most 60
+// characters long.
+//
+// A fixed boundary must never appear in the content of a message, or the
+// message breaks, so this is meant for tests.
+func WithBoundary(boundary string) Option {
+	return func(a *ApiClient) {
+		a.boundary = boundary
+	}
+}
+
+// WithAuthScheme sends the API token in an Authorization header with the
+// given scheme, such as "Bearer", instead of the X-Server-API-Key header
+// postal reads it from. It's for gateways in front of postal which take the
+// token from the Authorization header, and pass it on to postal.
+func WithAuthScheme(scheme string) Option {
+	return func(a *ApiClient) {
+		a.authScheme = scheme
+	}
+}
+
+// WithAPIVersion sets the version of postal's API used in request paths, as
+// in /api/<version>/send/raw. It defaults to v1.
+func WithAPIVersion(version string) Option {
+	return func(a *ApiClient) {
+		a.apiVersion = version
+	}
+}
+
+// WithServerVersionHeader sets the response header ServerVersion reads the
+// server's version from, such as one already added by a proxy in front of
+// postal. It defaults to X-Postal-Version.
+func WithServerVersionHeader(name string) Option {
+	return func(a *ApiClient) {
+		a.versionHeader = name
+	}
+}
+
+// WithDomainsPath sets the API path ListDomains fetches the domains from.
+func WithDomainsPath(path string) Option {
+	return func(a *ApiClient) {
+		a.domainsPath = path
+	}
+}
+
+// WithLimitsPath sets the API path GetSendLimits fetches the limits from.
+func WithLimitsPath(path string) Option {
+	return func(a *ApiClient) {
+		a.limitsPath = path
+	}
+}
@@ -0,0 +1,242 @@
+package postal
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/knadh/smtppool"
+)
+
+func TestWithSource(t *testing.T) {
+	client, rec := newRecordingClient(t, WithSource("billing"))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get(HdrPostalSource); got != "billing" {
+		t.Fatalf("expected source header billing, got %q", got)
+	}
+}
+
+func TestWithSourceHeader(t *testing.T) {
+	client, rec := newRecordingClient(t, WithSourceHeader("X-App", "billing"))
+
+	// The message's own header takes precedence over the client's.
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+		Headers:   textproto.MIMEHeader{"X-App": {"reports"}},
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get("X-App"); got != "reports" {
+		t.Fatalf("expected header reports, got %q", got)
+	}
+	if got := msg.Headers.Get("X-App"); got != "reports" {
+		t.Fatalf("message headers were modified: %q", got)
+	}
+}
+
+func TestWithEmailCustomizer(t *testing.T) {
+	client, rec := newRecordingClient(t,
+		WithSource("billing"),
+		WithEmailCustomizer(func(e *smtppool.Email) {
+			// The standard mapping has already happened.
+			if e.Headers.Get(HdrPostalSource) != "billing" {
+				t.Errorf("customizer ran before the headers were mapped")
+			}
+			e.Subject = "customized"
+		}),
+	)
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		Subject:   "original",
+		PlainBody: "hello",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get("Subject"); got != "customized" {
+		t.Fatalf("expected customized subject, got %q", got)
+	}
+}
+
+func TestWithWrappedData(t *testing.T) {
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: strings.Repeat("hello world ", 100),
+	}
+
+	client, rec := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if data := rec.reqs[0].Data; strings.Contains(data, "\r\n") {
+		t.Fatal("data is wrapped by default")
+	}
+
+	client, rec = newRecordingClient(t, WithWrappedData())
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	data := rec.reqs[0].Data
+	lines := strings.Split(data, "\r\n")
+	if len(lines) < 2 {
+		t.Fatal("data isn't wrapped")
+	}
+	for i, l := range lines {
+		if len(l) > 76 || (i < len(lines)-1 && len(l) != 76) {
+			t.Fatalf("unexpected line length %d at line %d", len(l), i)
+		}
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(data, "\r\n", ""))
+	if err != nil {
+		t.Fatalf("error decoding data: %v", err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if m.Header.Get(smtppool.HdrMessageID) == "" {
+		t.Fatal("expected a Message-ID")
+	}
+}
+
+func TestWithClientCertificate(t *testing.T) {
+	cert := tls.Certificate{Certificate: [][]byte{[]byte("cert")}}
+
+	client, err := NewAPIClient("https://postal.example.com", "token", nil, WithClientCertificate(cert))
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+	transport, ok := client.httpClient.Transport.(*http.Transport)
+	if !ok || transport.TLSClientConfig == nil {
+		t.Fatal("expected a transport with a TLS config")
+	}
+	if certs := transport.TLSClientConfig.Certificates; len(certs) != 1 || !reflect.DeepEqual(certs[0], cert) {
+		t.Fatalf("unexpected client certificates: %v", certs)
+	}
+	if cfg := http.DefaultTransport.(*http.Transport).TLSClientConfig; cfg != nil && len(cfg.Certificates) > 0 {
+		t.Fatal("the default transport was modified")
+	}
+
+	if _, err := NewAPIClient("https://postal.example.com", "token", &http.Client{}, WithClientCertificate(cert)); err == nil {
+		t.Fatal("expected an error with a custom http client")
+	}
+}
+
+func TestWithTransportTimeouts(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	client, err := NewAPIClient(srv.URL, "token", nil, WithTransportTimeouts(0, 5*time.Second, 20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+	transport := client.httpClient.Transport.(*http.Transport)
+	if transport.TLSHandshakeTimeout != 5*time.Second || transport.ResponseHeaderTimeout != 20*time.Millisecond {
+		t.Fatalf("unexpected transport timeouts: %s, %s", transport.TLSHandshakeTimeout, transport.ResponseHeaderTimeout)
+	}
+	if transport.DialContext == nil {
+		t.Fatal("expected the default dialer to be kept")
+	}
+
+	if _, err := client.SendMessage(retryMsg); !errors.Is(err, ErrNetwork) || !strings.Contains(err.Error(), "timeout awaiting response headers") {
+		t.Fatalf("expected a response header timeout, got %v", err)
+	}
+
+	if _, err := NewAPIClient(srv.URL, "token", &http.Client{}, WithTransportTimeouts(time.Second, 0, 0)); err == nil {
+		t.Fatal("expected an error with a custom http client")
+	}
+}
+
+func TestNewAPIClientNilHTTPClient(t *testing.T) {
+	client, err := NewAPIClient("https://postal.example.com", "token", nil)
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+	if client.httpClient == nil {
+		t.Fatal("expected a default http client")
+	}
+}
+
+func TestWithAPIVersion(t *testing.T) {
+	var path string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithAPIVersion("v2"))
+
+	if _, err := client.SendMessage(retryMsg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if path != "/api/v2/send/raw" {
+		t.Fatalf("expected the v2 endpoint, got %s", path)
+	}
+
+	for _, v := range []string{"", "v2/../v1"} {
+		if _, err := NewAPIClient("https://postal.example.com", "token", nil, WithAPIVersion(v)); err == nil {
+			t.Fatalf("expected an error for api version %q", v)
+		}
+	}
+}
+
+func TestWithAuthScheme(t *testing.T) {
+	var auth, key string
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		auth, key = r.Header.Get("Authorization"), r.Header.Get("X-Server-API-Key")
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithAuthScheme("Bearer"))
+
+	if _, err := client.SendMessage(retryMsg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if auth != "Bearer "+client.token || key != "" {
+		t.Fatalf("expected the token only in the Authorization header, got %q and %q", auth, key)
+	}
+
+	if _, err := NewAPIClient("https://postal.example.com", "token", nil, WithAuthScheme("Bearer x")); err == nil {
+		t.Fatal("expected an error for a scheme with a space")
+	}
+}
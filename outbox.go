@@ -0,0 +1,300 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// OutboxStore holds the messages of an Outbox until they're sent. Back it
+// with durable storage, such as a database table, for the messages to
+// survive restarts of the process; see MemoryOutboxStore for one which
+// doesn't.
+//
+// A message stays in the store until it's acked. Dequeue hands out each
+// message once, but a message which was dequeued and never acked, because
+// the process stopped while it was being sent, must be handed out again
+// once the store is reopened. Messages are thus sent at least once: one
+// which postal accepted right before a crash is sent again.
+//
+// Messages have to be stored whole, including their attachments, which
+// aren't exported: a store can keep the built message, from Message.Reader,
+// and read it back with NewMessageFromReader, along with the Bcc and
+// EnvelopeTo the built message doesn't have.
+type OutboxStore interface {
+	// Enqueue stores the message and returns its ID.
+	Enqueue(ctx context.Context, msg Message) (id string, err error)
+	// Dequeue returns the oldest message which wasn't acked nor dequeued
+	// since the store was opened. ok is false if there's none.
+	Dequeue(ctx context.Context) (id string, msg Message, ok bool, err error)
+	// Ack removes the message, once it was sent or failed for good.
+	Ack(ctx context.Context, id string) error
+}
+
+// MemoryOutboxStore is an OutboxStore which keeps messages in memory, so
+// they're lost when the process stops. It's safe for concurrent use.
+type MemoryOutboxStore struct {
+	mu     sync.Mutex
+	nextID int
+	queue  []outboxEntry
+	// leased are the dequeued messages which weren't acked yet.
+	leased map[string]Message
+}
+
+// outboxEntry is a message of an outbox with its ID.
+type outboxEntry struct {
+	id  string
+	msg Message
+}
+
+// NewMemoryOutboxStore returns an empty MemoryOutboxStore.
+func NewMemoryOutboxStore() *MemoryOutboxStore {
+	return &MemoryOutboxStore{leased: make(map[string]Message)}
+}
+
+func (m *MemoryOutboxStore) Enqueue(_ context.Context, msg Message) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextID++
+	id := strconv.Itoa(m.nextID)
+	m.queue = append(m.queue, outboxEntry{id: id, msg: msg})
+	return id, nil
+}
+
+func (m *MemoryOutboxStore) Dequeue(_ context.Context) (string, Message, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.queue) == 0 {
+		return "", Message{}, false, nil
+	}
+	e := m.queue[0]
+	m.queue = m.queue[1:]
+	m.leased[e.id] = e.msg
+	return e.id, e.msg, true, nil
+}
+
+func (m *MemoryOutboxStore) Ack(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.leased, id)
+	return nil
+}
+
+// Len returns the number of messages in the store which weren't acked.
+func (m *MemoryOutboxStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.queue) + len(m.leased)
+}
+
+// Default options of an Outbox, see OutboxOptions.
+const (
+	defaultOutboxPollInterval   = time.Second
+	defaultOutboxInitialBackoff = time.Second
+	defaultOutboxMaxBackoff     = 5 * time.Minute
+)
+
+// OutboxOptions configures an Outbox. The zero value uses the defaults.
+type OutboxOptions struct {
+	// PollInterval is how often the store is checked for new messages once
+	// it's empty. It's one second if 0.
+	PollInterval time.Duration
+	// MaxAttempts is the maximum number of sends of a message, including the
+	// first one, before it fails for good. If it's 0, retryable failures are
+	// retried until the message is sent.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry of a message, which
+	// doubles after each retry up to MaxBackoff. They're one second and five
+	// minutes if 0.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// OnFailure is called with the messages which failed for good, before
+	// they're acked. They're dropped if it's nil.
+	OnFailure func(ctx context.Context, id string, msg Message, err error)
+	// Clock is used to wait between polls and retries. It's the real clock
+	// if nil.
+	Clock Clock
+}
+
+// Outbox queues messages in an OutboxStore and sends them in the background
+// with Run, retrying failed sends, for at-least-once delivery of messages
+// which must not be lost to a failed send or a crash. It sends through a
+// Client, with its SendMessageContext if it has one, as ApiClient does.
+//
+// Sends are retried when they fail with an error for which IsRetryable
+// reports true, or from a network failure, a rate limit or the client's
+// circuit breaker. Other failures, such as an invalid message, fail for
+// good right away. The client's own retries happen within each send.
+type Outbox struct {
+	client Client
+	store  OutboxStore
+	opts   OutboxOptions
+
+	mu sync.Mutex
+	// pending is the message which was being sent when Run returned, which
+	// is sent first by the next Run.
+	pending *outboxEntry
+
+	// queued are the messages queued with Enqueue which weren't acked yet,
+	// by ID, for Flush to wait for.
+	queuedMu sync.Mutex
+	queued   map[string]*flushEntry
+	flush    flushGroup
+}
+
+// NewOutbox returns an Outbox queuing messages in the store and sending them
+// through the client.
+func NewOutbox(client Client, store OutboxStore, opts OutboxOptions) *Outbox {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultOutboxPollInterval
+	}
+	if opts.InitialBackoff <= 0 {
+		opts.InitialBackoff = defaultOutboxInitialBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultOutboxMaxBackoff
+	}
+	if opts.Clock == nil {
+		opts.Clock = realClock{}
+	}
+	return &Outbox{client: client, store: store, opts: opts, queued: make(map[string]*flushEntry)}
+}
+
+// Enqueue queues the message to be sent by Run, and returns its ID in the
+// store.
+func (o *Outbox) Enqueue(ctx context.Context, msg Message) (string, error) {
+	// The message is tracked before Run can ack it.
+	o.queuedMu.Lock()
+	defer o.queuedMu.Unlock()
+
+	id, err := o.store.Enqueue(ctx, msg)
+	if err != nil {
+		return "", fmt.Errorf("error queuing message: %w", err)
+	}
+	o.queued[id] = o.flush.add(id)
+	return id, nil
+}
+
+// Flush waits for the messages queued with Enqueue which weren't acked when
+// it's called to be sent or fail for good, or for ctx to be done, in which
+// case it returns an error wrapping the context's. It returns a *FlushError
+// of the messages which failed for good. Messages only get sent while Run
+// runs, and messages in the store which weren't queued by this Outbox, such
+// as before a restart, aren't waited for.
+func (o *Outbox) Flush(ctx context.Context) error {
+	return o.flush.wait(ctx)
+}
+
+// acked marks the message, if it was queued with Enqueue, as sent or, if
+// err isn't nil, as failed for good.
+func (o *Outbox) acked(id string, err error) {
+	o.queuedMu.Lock()
+	e, ok := o.queued[id]
+	delete(o.queued, id)
+	o.queuedMu.Unlock()
+
+	if ok {
+		o.flush.finish(e, err)
+	}
+}
+
+// Run sends the queued messages, one at a time, until ctx is done, and then
+// returns the context's error. A message whose send is interrupted isn't
+// acked, so it's sent again by the next Run, or after a restart. Run also
+// returns when the store fails, leaving the message being sent, if any, to
+// be sent again. It mustn't be called concurrently.
+func (o *Outbox) Run(ctx context.Context) error {
+	for {
+		e, ok, err := o.next(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			if err := sleep(ctx, o.opts.Clock, o.opts.PollInterval); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := o.deliver(ctx, e); err != nil {
+			o.mu.Lock()
+			o.pending = &e
+			o.mu.Unlock()
+			return err
+		}
+	}
+}
+
+// next returns the message to send next: the one left pending by the last
+// Run, or else the next one in the store.
+func (o *Outbox) next(ctx context.Context) (outboxEntry, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return outboxEntry{}, false, err
+	}
+
+	o.mu.Lock()
+	e := o.pending
+	o.pending = nil
+	o.mu.Unlock()
+	if e != nil {
+		return *e, true, nil
+	}
+
+	id, msg, ok, err := o.store.Dequeue(ctx)
+	if err != nil {
+		return outboxEntry{}, false, fmt.Errorf("error dequeuing message: %w", err)
+	}
+	return outboxEntry{id: id, msg: msg}, ok, nil
+}
+
+// deliver sends the message until it's sent or fails for good, and then
+// acks it. It returns an error, leaving the message unacked, if ctx is done
+// first or the ack fails.
+func (o *Outbox) deliver(ctx context.Context, e outboxEntry) error {
+	backoff := RetryPolicy{InitialBackoff: o.opts.InitialBackoff, MaxBackoff: o.opts.MaxBackoff}
+	for attempt := 1; ; attempt++ {
+		_, err := sendContext(ctx, o.client, e.msg)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil && outboxRetryable(err) && (o.opts.MaxAttempts <= 0 || attempt < o.opts.MaxAttempts) {
+			if err := sleep(ctx, o.opts.Clock, backoff.backoff(attempt, err)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err != nil && o.opts.OnFailure != nil {
+			o.opts.OnFailure(ctx, e.id, e.msg, err)
+		}
+		if err := o.store.Ack(ctx, e.id); err != nil {
+			return fmt.Errorf("error acking message %s: %w", e.id, err)
+		}
+		o.acked(e.id, err)
+		return nil
+	}
+}
+
+// outboxRetryable reports whether an Outbox retries a send which failed with
+// err.
+func outboxRetryable(err error) bool {
+	return IsRetryable(err) || errors.Is(err, ErrNetwork) || errors.Is(err, ErrRateLimited) ||
+		errors.Is(err, ErrCircuitOpen)
+}
+
+// sendContext sends the message through the client with ctx if the client
+// takes one, as ApiClient does.
+func sendContext(ctx context.Context, client Client, msg Message) (Response, error) {
+	if c, ok := client.(interface {
+		SendMessageContext(context.Context, Message) (Response, error)
+	}); ok {
+		return c.SendMessageContext(ctx, msg)
+	}
+	return client.SendMessage(msg)
+}
@@ -0,0 +1,284 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// outboxClient is a Client which records the subjects of the messages it
+// sends, failing them with the errors of fail.
+type outboxClient struct {
+	mu   sync.Mutex
+	sent []string
+	fail func(ctx context.Context, msg Message, attempt int) error
+}
+
+func (c *outboxClient) SendMessage(msg Message) (Response, error) {
+	return c.SendMessageContext(context.Background(), msg)
+}
+
+func (c *outboxClient) GetMessageDetails(id int64) (MessageDetails, error) {
+	return MessageDetails{}, ErrNotSupported
+}
+
+func (c *outboxClient) SendMessageContext(ctx context.Context, msg Message) (Response, error) {
+	c.mu.Lock()
+	c.sent = append(c.sent, msg.Subject)
+	attempt := 0
+	for _, s := range c.sent {
+		if s == msg.Subject {
+			attempt++
+		}
+	}
+	c.mu.Unlock()
+
+	if c.fail != nil {
+		if err := c.fail(ctx, msg, attempt); err != nil {
+			return Response{}, err
+		}
+	}
+	return Response{MessageID: msg.Subject}, nil
+}
+
+func (c *outboxClient) subjects() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.sent...)
+}
+
+// fakeOutboxDisk is the durable storage of fakeOutboxStores: it survives
+// the stores, like a database survives the processes using it.
+type fakeOutboxDisk struct {
+	mu     sync.Mutex
+	nextID int
+	ids    []string
+	msgs   map[string]Message
+}
+
+// fakeOutboxStore is an OutboxStore over a fakeOutboxDisk. Which messages
+// were dequeued is only kept by the store, so reopening it hands out the
+// unacked ones again.
+type fakeOutboxStore struct {
+	disk     *fakeOutboxDisk
+	dequeued map[string]bool
+}
+
+func openFakeOutboxStore(disk *fakeOutboxDisk) *fakeOutboxStore {
+	return &fakeOutboxStore{disk: disk, dequeued: make(map[string]bool)}
+}
+
+func (s *fakeOutboxStore) Enqueue(_ context.Context, msg Message) (string, error) {
+	s.disk.mu.Lock()
+	defer s.disk.mu.Unlock()
+
+	s.disk.nextID++
+	id := strconv.Itoa(s.disk.nextID)
+	s.disk.ids = append(s.disk.ids, id)
+	s.disk.msgs[id] = msg
+	return id, nil
+}
+
+func (s *fakeOutboxStore) Dequeue(_ context.Context) (string, Message, bool, error) {
+	s.disk.mu.Lock()
+	defer s.disk.mu.Unlock()
+
+	for _, id := range s.disk.ids {
+		if !s.dequeued[id] {
+			s.dequeued[id] = true
+			return id, s.disk.msgs[id], true, nil
+		}
+	}
+	return "", Message{}, false, nil
+}
+
+func (s *fakeOutboxStore) Ack(_ context.Context, id string) error {
+	s.disk.mu.Lock()
+	defer s.disk.mu.Unlock()
+
+	delete(s.disk.msgs, id)
+	for i, v := range s.disk.ids {
+		if v == id {
+			s.disk.ids = append(s.disk.ids[:i:i], s.disk.ids[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (d *fakeOutboxDisk) len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return len(d.ids)
+}
+
+// runOutbox runs the outbox until done returns true, and returns Run's
+// error.
+func runOutbox(t *testing.T, o *Outbox, done func() bool) error {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() { errc <- o.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		select {
+		case err := <-errc:
+			return err
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the outbox")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	return <-errc
+}
+
+var testOutboxOptions = OutboxOptions{
+	PollInterval:   time.Millisecond,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     time.Millisecond,
+}
+
+func TestOutbox(t *testing.T) {
+	client := &outboxClient{fail: func(_ context.Context, msg Message, attempt int) error {
+		switch {
+		case msg.Subject == "retried" && attempt < 3:
+			return withKind(ErrNetwork, errors.New("connection reset"))
+		case msg.Subject == "invalid":
+			return withKind(ErrInvalidMessage, errors.New("bad message"))
+		}
+		return nil
+	}}
+	var failed []string
+	opts := testOutboxOptions
+	opts.OnFailure = func(_ context.Context, _ string, msg Message, err error) {
+		if !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("unexpected failure of %s: %v", msg.Subject, err)
+		}
+		failed = append(failed, msg.Subject)
+	}
+	store := NewMemoryOutboxStore()
+	o := NewOutbox(client, store, opts)
+	for _, s := range []string{"first", "retried", "invalid", "last"} {
+		if _, err := o.Enqueue(context.Background(), Message{Subject: s}); err != nil {
+			t.Fatalf("error queuing message: %v", err)
+		}
+	}
+
+	if err := runOutbox(t, o, func() bool { return store.Len() == 0 }); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Run to return the context's error, got %v", err)
+	}
+	want := []string{"first", "retried", "retried", "retried", "invalid", "last"}
+	if got := client.subjects(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected the sends %v, got %v", want, got)
+	}
+	if !reflect.DeepEqual(failed, []string{"invalid"}) {
+		t.Fatalf("expected only the invalid message to fail, got %v", failed)
+	}
+}
+
+func TestOutboxMaxAttempts(t *testing.T) {
+	client := &outboxClient{fail: func(context.Context, Message, int) error {
+		return &APIError{StatusCode: 503}
+	}}
+	var failures int
+	opts := testOutboxOptions
+	opts.MaxAttempts = 2
+	opts.OnFailure = func(context.Context, string, Message, error) { failures++ }
+	store := NewMemoryOutboxStore()
+	o := NewOutbox(client, store, opts)
+	if _, err := o.Enqueue(context.Background(), Message{Subject: "hello"}); err != nil {
+		t.Fatalf("error queuing message: %v", err)
+	}
+
+	runOutbox(t, o, func() bool { return store.Len() == 0 })
+	if got := len(client.subjects()); got != 2 || failures != 1 {
+		t.Fatalf("expected 2 attempts and a failure, got %d and %d", got, failures)
+	}
+}
+
+func TestOutboxCrashRecovery(t *testing.T) {
+	disk := &fakeOutboxDisk{msgs: make(map[string]Message)}
+	store := openFakeOutboxStore(disk)
+	for _, s := range []string{"one", "two", "three"} {
+		if _, err := store.Enqueue(context.Background(), Message{Subject: s}); err != nil {
+			t.Fatalf("error queuing message: %v", err)
+		}
+	}
+
+	// The process crashes while "two" is sent, after postal accepted it
+	// but before it's acked.
+	crashed := make(chan struct{})
+	client := &outboxClient{fail: func(ctx context.Context, msg Message, _ int) error {
+		if msg.Subject == "two" {
+			close(crashed)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- NewOutbox(client, store, testOutboxOptions).Run(ctx) }()
+	<-crashed
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected Run to return the context's error, got %v", err)
+	}
+	if got := disk.len(); got != 2 {
+		t.Fatalf("expected 2 unacked messages, got %d", got)
+	}
+
+	// After the restart, the interrupted message is sent again.
+	restarted := &outboxClient{}
+	o := NewOutbox(restarted, openFakeOutboxStore(disk), testOutboxOptions)
+	runOutbox(t, o, func() bool { return disk.len() == 0 })
+	sent := append(client.subjects(), restarted.subjects()...)
+	sort.Strings(sent)
+	if want := []string{"one", "three", "two", "two"}; !reflect.DeepEqual(sent, want) {
+		t.Fatalf("expected every message to be sent at least once, got %v", sent)
+	}
+}
+
+func TestOutboxResumesPending(t *testing.T) {
+	store := NewMemoryOutboxStore()
+	if _, err := store.Enqueue(context.Background(), Message{Subject: "hello"}); err != nil {
+		t.Fatalf("error queuing message: %v", err)
+	}
+
+	started := make(chan struct{})
+	client := &outboxClient{fail: func(ctx context.Context, _ Message, attempt int) error {
+		if attempt == 1 {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	}}
+	o := NewOutbox(client, store, testOutboxOptions)
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() { errc <- o.Run(ctx) }()
+	<-started
+	cancel()
+	<-errc
+
+	// The memory store already handed the message out, so the next Run of
+	// the same outbox sends it.
+	runOutbox(t, o, func() bool { return store.Len() == 0 })
+	if got := client.subjects(); len(got) != 2 {
+		t.Fatalf("expected the interrupted message to be sent again, got %v", got)
+	}
+}
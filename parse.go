@@ -0,0 +1,204 @@
+package postal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// ErrUnsupportedCharset is returned when a message being parsed has a text
+// body in a charset other than UTF-8, US-ASCII or ISO-8859-1.
+var ErrUnsupportedCharset = errors.New("postal: unsupported charset")
+
+// structureHeaders are the top level headers describing the structure of a
+// message, which is rebuilt when it's sent, so they aren't kept by
+// NewMessageFromReader.
+var structureHeaders = map[string]bool{
+	"Mime-Version":             true,
+	HdrContentType:             true,
+	HdrContentTransferEncoding: true,
+	HdrContentDisposition:      true,
+}
+
+// NewMessageFromReader parses an RFC 5322 message, such as one received for
+// forwarding, into a Message.
+//
+// The address headers, Subject and Content-Language are parsed into the
+// message's fields, and the other headers, including Date and Message-ID,
+// are kept in Headers; remove the ones which shouldn't be sent again. The
+// first text/plain and text/html parts which aren't attachments become the
+// bodies, and every other part becomes an attachment. Parts of a
+// multipart/related part, other than its first, are attached as related to
+// the HTML body and keep their Content-ID, so cid: references still work.
+func NewMessageFromReader(r io.Reader) (Message, error) {
+	raw, err := mail.ReadMessage(r)
+	if err != nil {
+		return Message{}, fmt.Errorf("error parsing message: %w", err)
+	}
+
+	var dec mime.WordDecoder
+	m := Message{Headers: textproto.MIMEHeader{}}
+	for k, v := range raw.Header {
+		key := textproto.CanonicalMIMEHeaderKey(k)
+		switch key {
+		case "From", HdrSender, "To", "Cc", "Bcc", "Reply-To":
+			addrs, err := raw.Header.AddressList(key)
+			if err != nil {
+				return Message{}, fmt.Errorf("error parsing %s addresses: %w", key, err)
+			}
+			list := make([]string, 0, len(addrs))
+			for _, a := range addrs {
+				list = append(list, a.String())
+			}
+			switch key {
+			case "From":
+				m.From = strings.Join(list, ", ")
+			case HdrSender:
+				m.Sender = strings.Join(list, ", ")
+			case "To":
+				m.To = list
+			case "Cc":
+				m.Cc = list
+			case "Bcc":
+				m.Bcc = list
+			case "Reply-To":
+				m.ReplyTo = list
+			}
+		case "Subject":
+			subject, err := dec.DecodeHeader(raw.Header.Get(key))
+			if err != nil {
+				return Message{}, fmt.Errorf("error decoding subject: %w", err)
+			}
+			m.Subject = subject
+		case HdrContentLanguage:
+			m.ContentLanguage = raw.Header.Get(key)
+		default:
+			if !structureHeaders[key] {
+				m.Headers[key] = v
+			}
+		}
+	}
+
+	if err := m.parsePart(textproto.MIMEHeader(raw.Header), raw.Body, false); err != nil {
+		return Message{}, err
+	}
+	return m, nil
+}
+
+// parsePart parses a part of a message, with the given header, into the
+// message's bodies and attachments. related is set for the parts of a
+// multipart/related part, other than its root.
+func (m *Message) parsePart(header textproto.MIMEHeader, body io.Reader, related bool) error {
+	ct := header.Get(HdrContentType)
+	if ct == "" {
+		ct = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return fmt.Errorf("error parsing content type %q: %w", ct, err)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for i := 0; ; i++ {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("error reading %s part: %w", mediaType, err)
+			}
+			if err := m.parsePart(p.Header, p, related || (mediaType == "multipart/related" && i > 0)); err != nil {
+				return err
+			}
+		}
+	}
+
+	content, err := decodeTransfer(header.Get(HdrContentTransferEncoding), body)
+	if err != nil {
+		return err
+	}
+
+	disposition, dparams, _ := mime.ParseMediaType(header.Get(HdrContentDisposition))
+	if disposition != "attachment" && !related {
+		switch {
+		case mediaType == "text/plain" && m.PlainBody == "":
+			m.PlainBody, err = decodeCharset(params["charset"], content)
+			return err
+		case mediaType == "text/html" && m.HTMLBody == "":
+			m.HTMLBody, err = decodeCharset(params["charset"], content)
+			return err
+		}
+	}
+
+	filename := dparams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	var dec mime.WordDecoder
+	if decoded, err := dec.DecodeHeader(filename); err == nil {
+		filename = decoded
+	}
+	if filename == "" {
+		filename = fmt.Sprintf("attachment%d", len(m.attachments)+1)
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+
+	if disposition == "" {
+		disposition = "attachment"
+		if related {
+			disposition = "inline"
+		}
+	}
+	at, err := newAttachment(bytes.NewReader(content), filename, ct, disposition)
+	if err != nil {
+		return err
+	}
+	if cid := header.Get(HdrContentID); cid != "" {
+		at.Header.Set(HdrContentID, cid)
+	}
+	at.HTMLRelated = related
+	m.attachments = append(m.attachments, at)
+	return nil
+}
+
+// decodeTransfer decodes the content of a part with the given
+// Content-Transfer-Encoding.
+func decodeTransfer(encoding string, r io.Reader) ([]byte, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case contentEncBase64:
+		r = base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		r = quotedprintable.NewReader(r)
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding %s part: %w", encoding, err)
+	}
+	return content, nil
+}
+
+// decodeCharset decodes a text body in the given charset to UTF-8.
+func decodeCharset(charset string, content []byte) (string, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return string(content), nil
+	case "iso-8859-1", "latin1":
+		runes := make([]rune, len(content))
+		for i, b := range content {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedCharset, charset)
+}
@@ -0,0 +1,102 @@
+package postal
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestNewMessageFromReaderRoundTrip(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	msg := Message{
+		From:      "Alice <alice@example.com>",
+		To:        []string{"bob@example.com", "Carol <carol@example.com>"},
+		Cc:        []string{"dave@example.com"},
+		ReplyTo:   []string{"replies@example.com"},
+		Subject:   "Café report",
+		PlainBody: "See the attached report.\n",
+		HTMLBody:  `<p>See the attached report.</p><img src="cid:logo.png">`,
+		Headers:   map[string][]string{"X-Campaign": {"spring"}},
+	}
+	if err := msg.Attach(strings.NewReader("%PDF-1.4 report"), "report.pdf", "application/pdf", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if _, err := msg.AttachInline(strings.NewReader("png data"), "logo.png", "image/png"); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	got, err := NewMessageFromReader(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got.From != `"Alice" <alice@example.com>` || got.Subject != msg.Subject {
+		t.Fatalf("unexpected From or Subject: %q, %q", got.From, got.Subject)
+	}
+	if len(got.To) != 2 || got.To[1] != `"Carol" <carol@example.com>` || len(got.Cc) != 1 || len(got.ReplyTo) != 1 {
+		t.Fatalf("unexpected recipients: %v %v %v", got.To, got.Cc, got.ReplyTo)
+	}
+	if strings.ReplaceAll(got.PlainBody, "\r\n", "\n") != msg.PlainBody || got.HTMLBody != msg.HTMLBody {
+		t.Fatalf("unexpected bodies: %q, %q", got.PlainBody, got.HTMLBody)
+	}
+	if got.Headers.Get("X-Campaign") != "spring" || got.Headers.Get("Message-Id") == "" || got.Headers.Get("Content-Type") != "" {
+		t.Fatalf("unexpected headers: %v", got.Headers)
+	}
+
+	if len(got.attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(got.attachments))
+	}
+	byName := map[string]Attachment{}
+	for _, at := range got.attachments {
+		byName[at.Filename] = at
+	}
+	if at := byName["report.pdf"]; string(at.Content) != "%PDF-1.4 report" || at.HTMLRelated {
+		t.Fatalf("unexpected report attachment: %+v", at)
+	}
+	if at := byName["logo.png"]; string(at.Content) != "png data" || !at.HTMLRelated || at.Header.Get(HdrContentID) != "<logo.png>" {
+		t.Fatalf("unexpected inline attachment: %+v", at)
+	}
+}
+
+func TestNewMessageFromReaderEncodings(t *testing.T) {
+	raw := "From: =?utf-8?q?Ren=C3=A9?= <rene@example.com>\r\n" +
+		"To: to@example.com\r\n" +
+		"Subject: =?iso-8859-1?q?Caf=E9?=\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Caf=E9 au lait, a long line which is soft=\r\n" +
+		" broken\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"ZGF0\r\nYQ==\r\n" +
+		"--outer--\r\n"
+
+	m, err := NewMessageFromReader(strings.NewReader(raw))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if m.Subject != "Café" || !strings.Contains(m.From, "rene@example.com") {
+		t.Fatalf("unexpected headers: %q, %q", m.Subject, m.From)
+	}
+	if m.PlainBody != "Café au lait, a long line which is soft broken" {
+		t.Fatalf("unexpected plain body: %q", m.PlainBody)
+	}
+	if len(m.attachments) != 1 || string(m.attachments[0].Content) != "data" || m.attachments[0].Filename == "" {
+		t.Fatalf("unexpected attachments: %+v", m.attachments)
+	}
+
+	raw = "From: from@example.com\r\nContent-Type: text/plain; charset=koi8-r\r\n\r\nhello"
+	if _, err := NewMessageFromReader(strings.NewReader(raw)); !errors.Is(err, ErrUnsupportedCharset) {
+		t.Fatalf("expected ErrUnsupportedCharset, got %v", err)
+	}
+}
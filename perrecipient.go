@@ -0,0 +1,80 @@
+package postal
+
+import "context"
+
+// perRecipientCopies splits the message into a copy per recipient, as sent
+// with WithPerRecipientMessages.
+func perRecipientCopies(msg Message) []Message {
+	if len(msg.EnvelopeTo) > 0 {
+		copies := make([]Message, 0, len(msg.EnvelopeTo))
+		for _, r := range msg.EnvelopeTo {
+			m := msg
+			m.EnvelopeTo = []string{r}
+			copies = append(copies, m)
+		}
+		return copies
+	}
+
+	var copies []Message
+	for _, list := range [][]string{msg.To, msg.Cc, msg.Bcc} {
+		for _, r := range list {
+			m := msg
+			m.To = []string{r}
+			m.Cc = nil
+			m.Bcc = nil
+			copies = append(copies, m)
+		}
+	}
+	return copies
+}
+
+// sendPerRecipient sends the copies of a message, one after the other, and
+// merges their results. It fails with the first copy's error if every send
+// failed, or a *PartialSuccessError of the recipients of the copies which
+// failed if only some did.
+func (a *ApiClient) sendPerRecipient(ctx context.Context, copies []Message, opts SendOptions) (FullResult, error) {
+	var (
+		merged   FullResult
+		rejected []string
+		firstErr error
+	)
+	merged.Messages = make(map[string]ResponseMessage, len(copies))
+	for _, msg := range copies {
+		rcpt := msg.To[0]
+		if len(msg.EnvelopeTo) > 0 {
+			rcpt = msg.EnvelopeTo[0]
+		}
+
+		res, err := a.sendMessage(ctx, msg, opts)
+		merged.PerRecipient = append(merged.PerRecipient, res)
+		if err != nil {
+			a.logf(ctx, "postal: error sending message %q to %s: %v", msg.Subject, rcpt, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			rejected = append(rejected, rcpt)
+			continue
+		}
+
+		if merged.MessageID == "" {
+			merged.MessageID = res.MessageID
+			merged.RFCMessageID = res.RFCMessageID
+			merged.Endpoint = res.Endpoint
+		}
+		for k, v := range res.Messages {
+			merged.Messages[k] = v
+		}
+		merged.SubmittedRecipients = append(merged.SubmittedRecipients, res.SubmittedRecipients...)
+		merged.RequestSize += res.RequestSize
+		merged.Received = res.Received
+		merged.LookupUntil = res.LookupUntil
+	}
+
+	switch {
+	case len(rejected) == len(copies):
+		return FullResult{}, firstErr
+	case len(rejected) > 0:
+		return merged, &PartialSuccessError{Rejected: rejected}
+	}
+	return merged, nil
+}
@@ -0,0 +1,111 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"testing"
+)
+
+func TestPerRecipientMessages(t *testing.T) {
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"a@example.com", "b@example.com"},
+		Cc:        []string{"c@example.com"},
+		PlainBody: "hello",
+	}
+
+	// By default, a single message is sent to every recipient.
+	client, rec := newRecordingClient(t)
+	res, err := client.SendMessageFull(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(rec.reqs) != 1 || len(res.Messages) != 3 || res.PerRecipient != nil {
+		t.Fatalf("expected a single send, got %d requests and %+v", len(rec.reqs), res)
+	}
+
+	client, rec = newRecordingClient(t, WithPerRecipientMessages())
+	res, err = client.SendMessageFull(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(rec.reqs) != 3 || len(res.PerRecipient) != 3 {
+		t.Fatalf("expected a send per recipient, got %d requests and %d results", len(rec.reqs), len(res.PerRecipient))
+	}
+	ids := map[string]bool{}
+	for i, want := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if !reflect.DeepEqual(rec.reqs[i].To, []string{want}) {
+			t.Fatalf("expected send %d to be to %s, got %v", i, want, rec.reqs[i].To)
+		}
+		m, err := mail.ReadMessage(bytes.NewReader(rec.raw(t, i)))
+		if err != nil {
+			t.Fatalf("error parsing message: %v", err)
+		}
+		if got := m.Header.Get("To"); got != "<"+want+">" || m.Header.Get("Cc") != "" {
+			t.Fatalf("expected the message to be addressed to %s alone, got To %q and Cc %q", want, got, m.Header.Get("Cc"))
+		}
+		ids[m.Header.Get("Message-Id")] = true
+		if _, ok := res.Messages[want]; !ok || res.PerRecipient[i].RFCMessageID != m.Header.Get("Message-Id") {
+			t.Fatalf("expected the result of %s, got %+v", want, res)
+		}
+	}
+	if len(ids) != 3 {
+		t.Fatalf("expected a Message-ID per recipient, got %v", ids)
+	}
+	if res.RFCMessageID != res.PerRecipient[0].RFCMessageID {
+		t.Fatalf("expected the first message's Message-ID, got %q", res.RFCMessageID)
+	}
+}
+
+func TestPerRecipientMessagesEnvelope(t *testing.T) {
+	client, rec := newRecordingClient(t, WithPerRecipientMessages())
+	msg := Message{
+		From:       "from@example.com",
+		To:         []string{"list@example.com"},
+		EnvelopeTo: []string{"a@example.com", "b@example.com"},
+		PlainBody:  "hello",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(rec.reqs) != 2 || !reflect.DeepEqual(rec.reqs[1].To, []string{"b@example.com"}) {
+		t.Fatalf("expected a send per envelope recipient, got %+v", rec.reqs)
+	}
+	if !bytes.Contains(rec.raw(t, 1), []byte("To: <list@example.com>\r\n")) {
+		t.Fatalf("expected the headers to be kept:\n%s", rec.raw(t, 1))
+	}
+}
+
+func TestPerRecipientMessagesPartialFailure(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		if req.To[0] == "bad@example.com" {
+			w.Write([]byte(`{"status":"error","time":0.1,"data":{"code":"NoRecipients","message":"no"}}`))
+			return
+		}
+		w.Write(successResponse("abc@postal", req.To))
+	}, WithPerRecipientMessages())
+
+	msg := Message{From: "from@example.com", To: []string{"a@example.com", "bad@example.com"}, PlainBody: "hello"}
+	res, err := client.SendMessageFull(context.Background(), msg)
+	var partial *PartialSuccessError
+	if !errors.As(err, &partial) || !reflect.DeepEqual(partial.Rejected, []string{"bad@example.com"}) {
+		t.Fatalf("expected a partial success rejecting bad@example.com, got %v", err)
+	}
+	if _, ok := res.Messages["a@example.com"]; !ok {
+		t.Fatalf("expected the successful send's result, got %+v", res)
+	}
+
+	msg.To = []string{"bad@example.com", "bad@example.com"}
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrNoRecipients) {
+		t.Fatalf("expected the first send's error when every send fails, got %v", err)
+	}
+}
@@ -0,0 +1,43 @@
+package postal
+
+import (
+	"context"
+	"net/textproto"
+	"sort"
+	"time"
+)
+
+// SendPersonalized sends a copy of base to each recipient of perRecipient,
+// with the recipient's headers merged into the base's, such as a
+// List-Unsubscribe header with a link for that recipient. The copies are
+// sent like SendBatch sends messages, and their results are returned in
+// the order of the recipients, sorted.
+//
+// Each copy is sent to its recipient alone: base's To, Cc and Bcc are
+// ignored. A recipient header replaces the base header with the same key.
+func (a *ApiClient) SendPersonalized(ctx context.Context, base Message, perRecipient map[string]textproto.MIMEHeader) []SendResult {
+	rcpts := make([]string, 0, len(perRecipient))
+	for r := range perRecipient {
+		rcpts = append(rcpts, r)
+	}
+	sort.Strings(rcpts)
+
+	msgs := make([]Message, len(rcpts))
+	for i, r := range rcpts {
+		msg := base
+		msg.To = []string{r}
+		msg.Cc = nil
+		msg.Bcc = nil
+
+		hdr := make(textproto.MIMEHeader, len(base.Headers)+len(perRecipient[r]))
+		for k, v := range base.Headers {
+			hdr[k] = v
+		}
+		for k, v := range perRecipient[r] {
+			hdr[textproto.CanonicalMIMEHeaderKey(k)] = v
+		}
+		msg.Headers = hdr
+		msgs[i] = msg
+	}
+	return a.SendBatch(ctx, msgs, time.Time{})
+}
@@ -0,0 +1,54 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"net/mail"
+	"net/textproto"
+	"testing"
+)
+
+func TestSendPersonalized(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	base := Message{
+		From:      "from@example.com",
+		To:        []string{"ignored@example.com"},
+		Subject:   "Newsletter",
+		PlainBody: "hello",
+		Headers:   textproto.MIMEHeader{"X-Campaign": {"spring"}, "List-Unsubscribe": {"<https://example.com/unsubscribe>"}},
+	}
+	results := client.SendPersonalized(context.Background(), base, map[string]textproto.MIMEHeader{
+		"b@example.com": {"list-unsubscribe": {"<https://example.com/unsubscribe/b>"}},
+		"a@example.com": {"List-Unsubscribe": {"<https://example.com/unsubscribe/a>"}},
+	})
+
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %d", len(results))
+	}
+	seen := make(map[string]string)
+	for i, res := range results {
+		if res.Err != nil {
+			t.Fatalf("error sending to %v: %v", res.Message.To, res.Err)
+		}
+		if want := []string{"a@example.com", "b@example.com"}[i]; len(res.Message.To) != 1 || res.Message.To[0] != want {
+			t.Fatalf("expected result %d to be for %s, got %v", i, want, res.Message.To)
+		}
+	}
+	for i := range rec.reqs {
+		m, err := mail.ReadMessage(bytes.NewReader(rec.raw(t, i)))
+		if err != nil {
+			t.Fatalf("error parsing message: %v", err)
+		}
+		if m.Header.Get("X-Campaign") != "spring" {
+			t.Fatalf("expected the base headers, got %v", m.Header)
+		}
+		seen[m.Header.Get("To")] = m.Header.Get("List-Unsubscribe")
+	}
+	if seen["<a@example.com>"] != "<https://example.com/unsubscribe/a>" || seen["<b@example.com>"] != "<https://example.com/unsubscribe/b>" {
+		t.Fatalf("unexpected per recipient headers: %v", seen)
+	}
+	if base.Headers.Get("List-Unsubscribe") != "<https://example.com/unsubscribe>" {
+		t.Fatal("expected the base message's headers not to be modified")
+	}
+}
@@ -0,0 +1,79 @@
+package postal
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// SendSplitPlainOnly sends the message to its recipients on the client's
+// plain-only domains without its HTML body, see WithPlainOnlyDomains, and
+// as it is to the others. A message has a single body for all its
+// recipients, so it's split in two messages, sent like SendBatch sends
+// messages: the message to the other recipients, then the plain-only copy.
+// Either is left out if it has no recipients, so the results are those of
+// one or two sends; use CountResults to count how many were sent.
+//
+// The messages are split by their envelope recipients: both keep the To and
+// Cc headers of the message, and its EnvelopeTo, or To, Cc and Bcc if it
+// has none, are split between their EnvelopeTo. Like messages with
+// EnvelopeTo, they can only be sent to the raw send endpoint. The plain-only
+// copy has no HTML body nor inline attachments. A message without a plain
+// body has no plain variant, so it's sent as it is to every recipient.
+func (a *ApiClient) SendSplitPlainOnly(ctx context.Context, msg Message) []SendResult {
+	rcpts, err := envelopeRecipients(msg)
+	if err != nil || len(a.plainOnlyDomains) == 0 || msg.PlainBody == "" || msg.HTMLBody == "" {
+		// An invalid message is sent as it is, to fail like it does with
+		// any send.
+		return a.SendBatch(ctx, []Message{msg}, time.Time{})
+	}
+
+	var full, plain []string
+	for _, r := range rcpts {
+		if a.plainOnlyDomain(r) {
+			plain = append(plain, r)
+		} else {
+			full = append(full, r)
+		}
+	}
+	if len(plain) == 0 {
+		return a.SendBatch(ctx, []Message{msg}, time.Time{})
+	}
+
+	var msgs []Message
+	if len(full) > 0 {
+		m := msg
+		m.EnvelopeTo = full
+		msgs = append(msgs, m)
+	}
+	m := plainOnly(msg)
+	m.EnvelopeTo = plain
+	msgs = append(msgs, m)
+	return a.SendBatch(ctx, msgs, time.Time{})
+}
+
+// plainOnlyDomain returns whether the address is on one of the client's
+// plain-only domains, or a subdomain of one.
+func (a *ApiClient) plainOnlyDomain(addr string) bool {
+	domain := addressDomain(addr)
+	for _, d := range a.plainOnlyDomains {
+		if domain == d || strings.HasSuffix(domain, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// plainOnly returns the message without its HTML body and the inline
+// attachments it references.
+func plainOnly(msg Message) Message {
+	msg.HTMLBody = ""
+	attachments := make([]Attachment, 0, len(msg.attachments))
+	for _, at := range msg.attachments {
+		if !at.HTMLRelated {
+			attachments = append(attachments, at)
+		}
+	}
+	msg.attachments = attachments
+	return msg
+}
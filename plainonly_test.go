@@ -0,0 +1,74 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSendSplitPlainOnly(t *testing.T) {
+	client, rec := newRecordingClient(t, WithPlainOnlyDomains("Corp.example"))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"a@example.com", "b@mail.corp.example"},
+		Cc:        []string{"c@corp.example"},
+		Subject:   "hello",
+		PlainBody: "hello",
+		HTMLBody:  `<p>hello <img src="cid:logo.png"></p>`,
+	}
+	if _, err := msg.AttachInline(strings.NewReader("png"), "logo.png", "image/png"); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	results := client.SendSplitPlainOnly(context.Background(), msg)
+	if counts := CountResults(results); len(results) != 2 || counts.Sent != 2 {
+		t.Fatalf("expected 2 sends, got %+v", results)
+	}
+	if !reflect.DeepEqual(results[0].Message.EnvelopeTo, []string{"a@example.com"}) ||
+		!reflect.DeepEqual(results[1].Message.EnvelopeTo, []string{"b@mail.corp.example", "c@corp.example"}) {
+		t.Fatalf("unexpected split: %v and %v", results[0].Message.EnvelopeTo, results[1].Message.EnvelopeTo)
+	}
+
+	if len(rec.reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(rec.reqs))
+	}
+	for i, req := range rec.reqs {
+		raw := rec.raw(t, i)
+		// Both keep the headers of the message.
+		if !bytes.Contains(raw, []byte("To: <a@example.com>, <b@mail.corp.example>")) {
+			t.Fatalf("expected the To header to be kept:\n%s", raw)
+		}
+		hasHTML := bytes.Contains(raw, []byte("text/html")) || bytes.Contains(raw, []byte("logo.png"))
+		if plain := len(req.To) == 2; plain == hasHTML {
+			t.Fatalf("expected only the copy to %v to be plain-only:\n%s", req.To, raw)
+		}
+	}
+}
+
+func TestSendSplitPlainOnlyUnsplit(t *testing.T) {
+	client, rec := newRecordingClient(t, WithPlainOnlyDomains("corp.example"))
+
+	// No recipient on a plain-only domain.
+	msg := Message{From: "from@example.com", To: []string{"a@example.com"}, PlainBody: "hello", HTMLBody: "<p>hello</p>"}
+	if results := client.SendSplitPlainOnly(context.Background(), msg); len(results) != 1 || results[0].Err != nil {
+		t.Fatalf("expected the message to be sent as it is, got %+v", results)
+	}
+
+	// Every recipient on a plain-only domain.
+	msg.To = []string{"b@corp.example"}
+	results := client.SendSplitPlainOnly(context.Background(), msg)
+	if len(results) != 1 || results[0].Err != nil || results[0].Message.HTMLBody != "" {
+		t.Fatalf("expected only the plain-only copy, got %+v", results)
+	}
+
+	// No plain body to send instead.
+	msg.PlainBody = ""
+	if results := client.SendSplitPlainOnly(context.Background(), msg); len(results) != 1 || results[0].Message.HTMLBody == "" {
+		t.Fatalf("expected the HTML only message to be sent as it is, got %+v", results)
+	}
+	if len(rec.reqs) != 3 {
+		t.Fatalf("expected 3 requests, got %d", len(rec.reqs))
+	}
+}
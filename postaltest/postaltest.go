@@ -0,0 +1,227 @@
+// Package postaltest provides a fake postal server, for testing code which
+// sends through postal without a live server.
+package postaltest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+)
+
+// Token is the API token the server accepts, unless set with
+// NewServerWithToken.
+const Token = "postaltest-token"
+
+// Message is a message sent to the server.
+type Message struct {
+	// From and To are the envelope sender and recipients.
+	From   string
+	To     []string
+	Bounce bool
+	// Raw is the decoded RFC 5322 message, and Header its parsed header.
+	Raw    []byte
+	Header mail.Header
+}
+
+// Server is a fake postal server serving the raw send endpoint,
+// /api/v1/send/raw. Requests are checked like postal checks them, so a
+// request postal would reject, such as one without recipients or with a bad
+// token, is answered with postal's error. Accepted messages are recorded,
+// and answered with a successful response.
+//
+// The server embeds the underlying httptest.Server, so its URL is the base
+// URL to create a client with, and it's closed with Close.
+type Server struct {
+	*httptest.Server
+	token string
+
+	mu       sync.Mutex
+	messages []Message
+	failures []failure
+	nextID   int64
+}
+
+// failure is a canned failure of the next send.
+type failure struct {
+	status int
+	code   string
+	msg    string
+}
+
+// NewServer starts and returns a Server accepting the API token Token.
+func NewServer() *Server {
+	return NewServerWithToken(Token)
+}
+
+// NewServerWithToken starts and returns a Server accepting the given API
+// token.
+func NewServerWithToken(token string) *Server {
+	s := &Server{token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/send/raw", s.sendRaw)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Messages returns the messages accepted by the server, in the order they
+// were sent.
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Message(nil), s.messages...)
+}
+
+// Reset forgets the accepted messages and the pending failures.
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.messages = nil
+	s.failures = nil
+}
+
+// FailNext makes the next send fail with postal's error response with the
+// given code and message, such as "UnauthenticatedFromAddress". Each call
+// queues one failure.
+func (s *Server) FailNext(code, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, failure{status: http.StatusOK, code: code, msg: message})
+}
+
+// FailNextStatus makes the next send fail with the HTTP status, such as 503
+// while postal is under maintenance. Each call queues one failure.
+func (s *Server) FailNextStatus(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures = append(s.failures, failure{status: status})
+}
+
+// rawRequest is the body of a request to the raw send endpoint.
+type rawRequest struct {
+	MailFrom string   `json:"mail_from"`
+	RcptTo   []string `json:"rcpt_to"`
+	Data     string   `json:"data"`
+	Bounce   bool     `json:"bounce"`
+}
+
+// responseMessage is the message postal created for a recipient.
+type responseMessage struct {
+	ID    int64  `json:"id"`
+	Token string `json:"token"`
+}
+
+func (s *Server) sendRaw(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if key := r.Header.Get("X-Server-API-Key"); key == "" {
+		writeResponse(w, "error", map[string]string{
+			"code":    "AccessDenied",
+			"message": "Must be authenticated as a server.",
+		})
+		return
+	} else if key != s.token {
+		writeResponse(w, "error", map[string]string{
+			"code":    "InvalidServerAPIKey",
+			"message": "The API token provided in X-Server-API-Key was not valid.",
+		})
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+		http.Error(w, "expected a JSON request, got "+ct, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var req rawRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "error decoding request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	msg, err := parseRequest(req)
+	if err != nil {
+		writeResponse(w, "parameter-error", map[string]string{"message": err.Error()})
+		return
+	}
+
+	s.mu.Lock()
+	if len(s.failures) > 0 {
+		f := s.failures[0]
+		s.failures = s.failures[1:]
+		s.mu.Unlock()
+
+		if f.status != http.StatusOK {
+			http.Error(w, http.StatusText(f.status), f.status)
+			return
+		}
+		writeResponse(w, "error", map[string]string{"code": f.code, "message": f.msg})
+		return
+	}
+	s.messages = append(s.messages, msg)
+	s.nextID++
+	id := s.nextID
+	rcpts := make(map[string]responseMessage, len(msg.To))
+	for _, rcpt := range msg.To {
+		s.nextID++
+		rcpts[rcpt] = responseMessage{ID: s.nextID, Token: fmt.Sprintf("token%d", s.nextID)}
+	}
+	s.mu.Unlock()
+
+	writeResponse(w, "success", map[string]interface{}{
+		"message_id": fmt.Sprintf("postaltest-%d@postaltest", id),
+		"messages":   rcpts,
+	})
+}
+
+// parseRequest checks a request to the raw send endpoint and returns the
+// message it sends.
+func parseRequest(req rawRequest) (Message, error) {
+	switch {
+	case req.MailFrom == "":
+		return Message{}, fmt.Errorf("`mail_from` parameter is required but missing")
+	case len(req.RcptTo) == 0:
+		return Message{}, fmt.Errorf("`rcpt_to` parameter is required but missing")
+	case req.Data == "":
+		return Message{}, fmt.Errorf("`data` parameter is required but missing")
+	}
+
+	// The data may be padded and wrapped at 76 characters.
+	data := strings.NewReplacer("\r", "", "\n", "").Replace(req.Data)
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "="))
+	if err != nil {
+		return Message{}, fmt.Errorf("`data` isn't base64 encoded: %v", err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return Message{}, fmt.Errorf("`data` isn't an RFC 5322 message: %v", err)
+	}
+
+	return Message{
+		From:   req.MailFrom,
+		To:     req.RcptTo,
+		Bounce: req.Bounce,
+		Raw:    raw,
+		Header: m.Header,
+	}, nil
+}
+
+// writeResponse writes postal's response with the given status and data.
+func writeResponse(w http.ResponseWriter, status string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"time":   0.01,
+		"flags":  map[string]interface{}{},
+		"data":   data,
+	})
+}
@@ -0,0 +1,85 @@
+package postaltest_test
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	postal "github.com/iamd3vil/postal_go"
+	"github.com/iamd3vil/postal_go/postaltest"
+)
+
+func newClient(t *testing.T, srv *postaltest.Server, token string) *postal.ApiClient {
+	t.Helper()
+
+	client, err := postal.NewAPIClient(srv.URL, token, srv.Client())
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+	return client
+}
+
+func TestServer(t *testing.T) {
+	srv := postaltest.NewServer()
+	defer srv.Close()
+	client := newClient(t, srv, postaltest.Token)
+
+	msg := postal.Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com", "other@example.com"},
+		Subject:   "hello",
+		PlainBody: "hello",
+	}
+	resp, err := client.SendMessage(msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if resp.MessageID == "" || len(resp.Messages) != 2 {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+
+	msgs := srv.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	if msgs[0].From != "from@example.com" || !reflect.DeepEqual(msgs[0].To, msg.To) {
+		t.Fatalf("unexpected envelope: %s to %v", msgs[0].From, msgs[0].To)
+	}
+	if got := msgs[0].Header.Get("Subject"); got != "hello" {
+		t.Fatalf("expected the subject hello, got %q", got)
+	}
+
+	srv.Reset()
+	if msgs := srv.Messages(); len(msgs) != 0 {
+		t.Fatalf("expected no messages after a reset, got %d", len(msgs))
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	srv := postaltest.NewServer()
+	defer srv.Close()
+	msg := postal.Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+
+	var apiErr *postal.APIError
+	if _, err := newClient(t, srv, "wrong").SendMessage(msg); !errors.As(err, &apiErr) || apiErr.Code != "InvalidServerAPIKey" {
+		t.Fatalf("expected an InvalidServerAPIKey error, got %v", err)
+	}
+
+	client := newClient(t, srv, postaltest.Token)
+	srv.FailNext("UnauthenticatedFromAddress", "The From address is not authorised to send mail from this server")
+	if _, err := client.SendMessage(msg); !errors.Is(err, postal.ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized, got %v", err)
+	}
+	srv.FailNextStatus(http.StatusServiceUnavailable)
+	if _, err := client.SendMessage(msg); !errors.Is(err, postal.ErrServerUnavailable) {
+		t.Fatalf("expected ErrServerUnavailable, got %v", err)
+	}
+
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("expected the failures to be used up, got %v", err)
+	}
+	if msgs := srv.Messages(); len(msgs) != 1 {
+		t.Fatalf("expected only the last message to be accepted, got %d", len(msgs))
+	}
+}
@@ -0,0 +1,55 @@
+package postal
+
+import "context"
+
+// PreparedMessage is a message which has been built once to be sent to
+// different recipients, without building it again for every send. Create
+// one with PrepareMessage.
+//
+// Every send of a prepared message has the same content, including its
+// headers, so the To and Cc headers and the Message-ID are the same for all
+// recipients. Only the envelope changes.
+type PreparedMessage struct {
+	client *ApiClient
+	from   string
+	// id is the Message-ID of the message.
+	id string
+	// data is the encoded message.
+	data string
+}
+
+// PrepareMessage validates and builds the message so it can be sent to many
+// sets of recipients using the returned PreparedMessage. Prepared messages
+// are always sent using the raw send endpoint, even with WithStructuredSend.
+func (a *ApiClient) PrepareMessage(msg Message) (*PreparedMessage, error) {
+	msg, err := a.normalizeChecked(context.Background(), msg)
+	if err != nil {
+		return nil, err
+	}
+	req, id, err := a.buildRequest(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PreparedMessage{
+		client: a,
+		from:   req.From,
+		id:     id,
+		data:   req.Data,
+	}, nil
+}
+
+// SendTo sends the prepared message to the given recipients, using the
+// message's From address as the envelope sender.
+func (p *PreparedMessage) SendTo(ctx context.Context, to ...string) (Response, error) {
+	return p.SendEnvelope(ctx, p.from, to)
+}
+
+// SendEnvelope sends the prepared message to the given recipients with from
+// as the envelope sender. The recipients are checked with the client's
+// recipient validator, like those of any other send.
+func (p *PreparedMessage) SendEnvelope(ctx context.Context, from string, to []string) (Response, error) {
+	res, err := p.client.sendEnvelope(ctx, from, to, p.data, p.id, false)
+	p.client.stats.recordSend(false, err)
+	return res.Response, err
+}
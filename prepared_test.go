@@ -0,0 +1,85 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPreparedMessage(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	prepared, err := client.PrepareMessage(Message{
+		From:      "from@example.com",
+		To:        []string{"list@example.com"},
+		Subject:   "newsletter",
+		PlainBody: "hello",
+	})
+	if err != nil {
+		t.Fatalf("error preparing message: %v", err)
+	}
+
+	first, err := prepared.SendTo(context.Background(), "a@example.com")
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	second, err := prepared.SendEnvelope(context.Background(), "bounces@example.com", []string{"b@example.com", "c@example.com"})
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	if len(rec.reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(rec.reqs))
+	}
+	if rec.reqs[0].Data != rec.reqs[1].Data {
+		t.Fatal("expected the same message data for every send")
+	}
+	if rec.reqs[0].From != "from@example.com" || !reflect.DeepEqual(rec.reqs[0].To, []string{"a@example.com"}) {
+		t.Fatalf("unexpected envelope: %+v", rec.reqs[0])
+	}
+	if rec.reqs[1].From != "bounces@example.com" || !reflect.DeepEqual(rec.reqs[1].To, []string{"b@example.com", "c@example.com"}) {
+		t.Fatalf("unexpected envelope: %+v", rec.reqs[1])
+	}
+	if first.RFCMessageID == "" || first.RFCMessageID != second.RFCMessageID {
+		t.Fatalf("expected the same Message-ID, got %q and %q", first.RFCMessageID, second.RFCMessageID)
+	}
+}
+
+func TestPreparedMessageNoRecipients(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	prepared, err := client.PrepareMessage(Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"})
+	if err != nil {
+		t.Fatalf("error preparing message: %v", err)
+	}
+	if _, err := prepared.SendTo(context.Background()); err == nil {
+		t.Fatal("expected an error without recipients")
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatal("expected no requests")
+	}
+}
+
+func TestPreparedMessageRecipientValidator(t *testing.T) {
+	errBlocked := errors.New("blocked domain")
+	client, rec := newRecordingClient(t, WithRecipientValidator(func(addr string) error {
+		if strings.HasSuffix(addr, "@blocked.example") {
+			return errBlocked
+		}
+		return nil
+	}))
+
+	prepared, err := client.PrepareMessage(Message{From: "from@example.com", To: []string{"list@example.com"}, PlainBody: "hello"})
+	if err != nil {
+		t.Fatalf("error preparing message: %v", err)
+	}
+	_, err = prepared.SendTo(context.Background(), "a@example.com", "Bob <bob@blocked.example>")
+	if !errors.Is(err, errBlocked) || !errors.Is(err, ErrInvalidMessage) || !strings.Contains(err.Error(), "bob@blocked.example") {
+		t.Fatalf("expected the validator's error for the blocked address, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatal("expected no requests")
+	}
+}
@@ -0,0 +1,49 @@
+package postal
+
+import (
+	"context"
+	"net/http"
+)
+
+// PreSendHook is called with every request to postal right before it's
+// sent, see WithPreSendHook.
+type PreSendHook func(ctx context.Context, req *http.Request, msg Message) error
+
+// preSendError is the error of a PreSendHook, which aborts the request.
+type preSendError struct {
+	err error
+}
+
+func (e *preSendError) Error() string {
+	return "error in pre-send hook: " + e.err.Error()
+}
+
+func (e *preSendError) Unwrap() error {
+	return e.err
+}
+
+// sentMessageKey is the context key of the message being sent, for the
+// pre-send hook.
+type sentMessageKey struct{}
+
+// withSentMessage returns ctx with the message being sent, if the client has
+// a pre-send hook to give it to.
+func (a *ApiClient) withSentMessage(ctx context.Context, msg Message) context.Context {
+	if a.preSend == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, sentMessageKey{}, msg)
+}
+
+// preSendHook calls the client's pre-send hook, if any, with the request and
+// the message being sent with ctx.
+func (a *ApiClient) preSendHook(ctx context.Context, req *http.Request) error {
+	if a.preSend == nil {
+		return nil
+	}
+	msg, _ := ctx.Value(sentMessageKey{}).(Message)
+	if err := a.preSend(ctx, req, msg); err != nil {
+		return &preSendError{err: err}
+	}
+	return nil
+}
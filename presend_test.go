@@ -0,0 +1,87 @@
+package postal
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPreSendHook(t *testing.T) {
+	sum := func(b []byte) string {
+		h := sha256.Sum256(b)
+		return hex.EncodeToString(h[:])
+	}
+
+	var (
+		gotMsg Message
+		calls  int32
+	)
+	hook := func(ctx context.Context, req *http.Request, msg Message) error {
+		gotMsg = msg
+		body, err := req.GetBody()
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("X-Body-Sha256", sum(b))
+		req.Header.Set("X-Tenant", "acme")
+		// Standard headers are already set, so they can be overridden.
+		req.Header.Set("X-Server-API-Key", "tenant-token")
+		return nil
+	}
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		b, _ := io.ReadAll(r.Body)
+		if got := r.Header.Get("X-Body-Sha256"); got != sum(b) {
+			t.Errorf("expected the body's hash %s, got %s", sum(b), got)
+		}
+		if r.Header.Get("X-Tenant") != "acme" || r.Header.Get("X-Server-API-Key") != "tenant-token" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithPreSendHook(hook), WithDefaultFrom("default@example.com"))
+
+	if _, err := client.SendMessage(Message{To: []string{"to@example.com"}, Subject: "hello", PlainBody: "hello"}); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if gotMsg.From != "default@example.com" || gotMsg.Subject != "hello" {
+		t.Fatalf("expected the hook to get the message as sent, got %+v", gotMsg)
+	}
+	// The test server answers every request as a send, so the details
+	// can't be decoded; only the hook's message matters.
+	_, _ = client.GetMessageDetails(1)
+	if gotMsg.From != "" {
+		t.Fatalf("expected the zero Message for a request which doesn't send one, got %+v", gotMsg)
+	}
+}
+
+func TestPreSendHookAborts(t *testing.T) {
+	var calls int32
+	hookErr := errors.New("redaction failed")
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}, WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}), WithCircuitBreaker(1, time.Minute),
+		WithPreSendHook(func(ctx context.Context, req *http.Request, msg Message) error {
+			return hookErr
+		}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendMessage(retryMsg); !errors.Is(err, hookErr) {
+			t.Fatalf("expected the hook's error, got %v", err)
+		} else if errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected the hook's error not to open the breaker, got %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 0 {
+		t.Fatalf("expected no requests, got %d", got)
+	}
+}
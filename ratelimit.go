@@ -0,0 +1,76 @@
+package postal
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// rateLimiter is a token bucket limiting the rate of requests to postal.
+type rateLimiter struct {
+	mu    sync.Mutex
+	clock Clock
+	// interval is the time it takes for a token to be added.
+	interval time.Duration
+	burst    float64
+	tokens   float64
+	last     time.Time
+}
+
+// newRateLimiter returns a limiter which allows perSecond requests a second
+// with bursts of up to burst requests. The bucket starts out full.
+func newRateLimiter(c Clock, perSecond float64, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		clock:    c,
+		interval: time.Duration(float64(time.Second) / perSecond),
+		burst:    float64(burst),
+		tokens:   float64(burst),
+		last:     c.Now(),
+	}
+}
+
+// wait blocks until a request is allowed or the context is done.
+func (l *rateLimiter) wait(ctx context.Context) error {
+	for {
+		l.mu.Lock()
+		now := l.clock.Now()
+		l.tokens += float64(now.Sub(l.last)) / float64(l.interval)
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+		d := time.Duration((1 - l.tokens) * float64(l.interval))
+		l.mu.Unlock()
+
+		if err := sleep(ctx, l.clock, d); err != nil {
+			return err
+		}
+	}
+}
+
+// semaphore limits the number of requests to postal in flight at once.
+type semaphore chan struct{}
+
+// acquire blocks until a request can be made or the context is done. Every
+// successful acquire must be followed by a release.
+func (s semaphore) acquire(ctx context.Context) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s semaphore) release() {
+	<-s
+}
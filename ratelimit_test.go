@@ -0,0 +1,148 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	clock := newFakeClock()
+	l := newRateLimiter(clock, 1, 2)
+
+	// The burst is allowed right away.
+	for i := 0; i < 2; i++ {
+		if err := l.wait(context.Background()); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.wait(context.Background())
+	}()
+
+	clock.waitForWaiters(t, 1)
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("wait returned before a token was added")
+	default:
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestRateLimiterContextDone(t *testing.T) {
+	l := newRateLimiter(newFakeClock(), 1, 1)
+	if err := l.wait(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestWithRateLimit(t *testing.T) {
+	clock := newFakeClock()
+	client, rec := newRecordingClient(t, WithClock(clock), WithRateLimit(1, 1))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.SendMessage(msg)
+		done <- err
+	}()
+
+	clock.waitForWaiters(t, 1)
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(rec.reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(rec.reqs))
+	}
+}
+
+func TestWithMaxConcurrency(t *testing.T) {
+	var inFlight, maxInFlight int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithMaxConcurrency(2))
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.SendMessageContext(context.Background(), msg)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("error sending message: %v", err)
+		}
+	}
+	if got := atomic.LoadInt32(&maxInFlight); got > 2 {
+		t.Fatalf("expected at most 2 requests at once, got %d", got)
+	}
+}
+
+func TestWithMaxConcurrencyContextDone(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithMaxConcurrency(1))
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	first := client.SendAsync(context.Background(), msg)
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.SendMessageContext(ctx, msg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the send waiting for a slot to time out, got %v", err)
+	}
+
+	close(release)
+	if res := <-first; res.Err != nil {
+		t.Fatalf("error sending message: %v", res.Err)
+	}
+}
@@ -0,0 +1,150 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+)
+
+// ErrBareLF is returned by SendRaw for messages with a line ending in a bare
+// LF, rather than CRLF, with RawLineEndingsStrict.
+var ErrBareLF = errors.New("postal: message has a bare LF line ending")
+
+// RawLineEndings controls what SendRaw does with messages whose lines end in
+// a bare LF. SMTP requires CRLF line endings: servers relaying such a
+// message may fix them, reject it or mangle it, and a DKIM signature
+// computed over the original lines may no longer verify.
+type RawLineEndings int
+
+const (
+	// RawLineEndingsAsIs sends messages as they are.
+	RawLineEndingsAsIs RawLineEndings = iota
+	// RawLineEndingsStrict fails the sends of messages with a bare LF with
+	// ErrBareLF, before anything is sent to postal.
+	RawLineEndingsStrict
+	// RawLineEndingsCRLF converts every bare LF to CRLF. Signatures already
+	// in the message are of the original lines, so DKIM sign it after.
+	RawLineEndingsCRLF
+)
+
+// bareLF returns the line number of the first line of raw which ends in a
+// bare LF, or 0 if there's none.
+func bareLF(raw []byte) int {
+	line := 1
+	for i, c := range raw {
+		if c != '\n' {
+			continue
+		}
+		if i == 0 || raw[i-1] != '\r' {
+			return line
+		}
+		line++
+	}
+	return 0
+}
+
+// toCRLF returns raw with every bare LF replaced by CRLF.
+func toCRLF(raw []byte) []byte {
+	if bareLF(raw) == 0 {
+		return raw
+	}
+
+	out := make([]byte, 0, len(raw)+bytes.Count(raw, []byte("\n")))
+	for i, c := range raw {
+		if c == '\n' && (i == 0 || raw[i-1] != '\r') {
+			out = append(out, '\r')
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// Reader validates and builds the message, and returns a reader of the
+// RFC 5322 message, for example to send it with SendRaw while copying it
+// elsewhere with an io.TeeReader. The message is built without a client, so
+// options such as WithDefaultFrom or WithDKIM don't apply to it.
+//
+// The message is built in memory before it's returned, so the reader doesn't
+// save memory over building it, only a second build.
+func (m Message) Reader() (io.ReadCloser, error) {
+	a := &ApiClient{clock: realClock{}}
+	raw, _, err := a.buildMIME(m)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(raw)), nil
+}
+
+// SendRaw sends the RFC 5322 message read from r to the given recipients
+// with from as the envelope sender, using the raw send endpoint. The
+// message is sent as is: the client's defaults, headers and DKIM signing
+// don't apply to it, but its recipients are checked and rewritten and its
+// size checked like those of any other send. Lines ending in a bare LF are
+// sent as they are unless set otherwise with WithRawLineEndings.
+//
+// Postal takes the message base64 encoded in a JSON request, so r is read to
+// the end before anything is sent.
+func (a *ApiClient) SendRaw(ctx context.Context, from string, to []string, r io.Reader) (resp Response, err error) {
+	defer func() { a.stats.recordSend(false, err) }()
+	raw, err := io.ReadAll(r)
+	if err != nil {
+		return Response{}, fmt.Errorf("error reading raw message: %w", err)
+	}
+	switch a.rawLineEndings {
+	case RawLineEndingsStrict:
+		if line := bareLF(raw); line > 0 {
+			return Response{}, withKind(ErrInvalidMessage, fmt.Errorf("%w on line %d", ErrBareLF, line))
+		}
+	case RawLineEndingsCRLF:
+		raw = toCRLF(raw)
+	}
+	if err := a.checkSize(len(raw)); err != nil {
+		return Response{}, err
+	}
+
+	res, err := a.sendEnvelope(ctx, from, to, a.encodeData(raw), "", false)
+	return res.Response, err
+}
+
+// sendEnvelope sends the encoded message data to the given recipients with
+// from as the envelope sender, as a bounce if bounce is set. id is the
+// Message-ID of the message, if known.
+func (a *ApiClient) sendEnvelope(ctx context.Context, from string, to []string, data, id string, bounce bool) (FullResult, error) {
+	if a.allowedFrom != nil || len(a.allowedFromDomains) > 0 {
+		addr, err := mail.ParseAddress(from)
+		if err != nil {
+			return FullResult{}, withKind(ErrInvalidMessage, fmt.Errorf("%w: can't parse envelope sender %q", ErrSenderNotAllowed, from))
+		}
+		if err := a.checkSender("envelope sender", addr.Address); err != nil {
+			return FullResult{}, withKind(ErrInvalidMessage, err)
+		}
+	}
+
+	to = a.rewriteEnvelope(to)
+	if len(to) == 0 {
+		return FullResult{}, withKind(ErrInvalidMessage, fmt.Errorf("%w: message has no envelope recipients", ErrNoRecipients))
+	}
+	if err := a.checkRecipients(to); err != nil {
+		return FullResult{}, err
+	}
+
+	res, err := a.sendRaw(ctx, SendOptions{}, request{
+		From:   from,
+		To:     to,
+		Data:   data,
+		Bounce: bounce,
+	})
+	if err != nil {
+		return FullResult{}, err
+	}
+	res.RFCMessageID = id
+	res.SubmittedRecipients = to
+
+	if rejected := rejectedRecipients(res.Response, to); len(rejected) > 0 {
+		return res, &PartialSuccessError{Rejected: rejected}
+	}
+	return res, nil
+}
@@ -0,0 +1,102 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestReaderSendRaw(t *testing.T) {
+	client, rec := newRecordingClient(t, WithMaxMessageSize(1<<20))
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, Subject: "hello", PlainBody: "hello"}
+	r, err := msg.Reader()
+	if err != nil {
+		t.Fatalf("error building message: %v", err)
+	}
+	defer r.Close()
+
+	var archive bytes.Buffer
+	if _, err := client.SendRaw(context.Background(), "bounces@example.com", []string{"to@example.com"}, io.TeeReader(r, &archive)); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	sent := rec.last(t)
+	if !bytes.Equal(sent, archive.Bytes()) {
+		t.Fatalf("expected the archived message to be the sent one:\n%s\n%s", archive.Bytes(), sent)
+	}
+	if !bytes.Contains(sent, []byte("Subject: hello\r\n")) {
+		t.Fatalf("expected the built message to be sent, got:\n%s", sent)
+	}
+	req := rec.reqs[0]
+	if req.From != "bounces@example.com" || !reflect.DeepEqual(req.To, []string{"to@example.com"}) {
+		t.Fatalf("unexpected envelope: %s to %v", req.From, req.To)
+	}
+}
+
+func TestReaderSendRawErrors(t *testing.T) {
+	if _, err := (Message{From: "from@example.com"}).Reader(); !errors.Is(err, ErrNoRecipients) {
+		t.Fatalf("expected ErrNoRecipients, got %v", err)
+	}
+
+	client, rec := newRecordingClient(t, WithMaxMessageSize(10))
+	ctx := context.Background()
+	raw := []byte("Subject: hello\r\n\r\nhello\r\n")
+
+	if _, err := client.SendRaw(ctx, "from@example.com", nil, bytes.NewReader(raw[:10])); !errors.Is(err, ErrNoRecipients) {
+		t.Fatalf("expected ErrNoRecipients, got %v", err)
+	}
+	if _, err := client.SendRaw(ctx, "from@example.com", []string{"to@example.com"}, bytes.NewReader(raw)); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("expected ErrMessageTooLarge, got %v", err)
+	}
+	readErr := errors.New("read failed")
+	if _, err := client.SendRaw(ctx, "from@example.com", []string{"to@example.com"}, iotest.ErrReader(readErr)); !errors.Is(err, readErr) {
+		t.Fatalf("expected the read error, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatalf("expected nothing to be sent, got %d requests", len(rec.reqs))
+	}
+}
+
+func TestSendRawLineEndings(t *testing.T) {
+	ctx := context.Background()
+	to := []string{"to@example.com"}
+	// Mixed line endings, with a bare LF on the second line.
+	raw := "Subject: hello\r\nFrom: from@example.com\n\r\nhello\nworld\r\n"
+
+	client, rec := newRecordingClient(t)
+	if _, err := client.SendRaw(ctx, "from@example.com", to, bytes.NewReader([]byte(raw))); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if got := string(rec.last(t)); got != raw {
+		t.Fatalf("expected the message to be sent as it is, got %q", got)
+	}
+
+	client, rec = newRecordingClient(t, WithRawLineEndings(RawLineEndingsStrict))
+	_, err := client.SendRaw(ctx, "from@example.com", to, bytes.NewReader([]byte(raw)))
+	if !errors.Is(err, ErrBareLF) || !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrBareLF, got %v", err)
+	}
+	if want := "line 2"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("expected the error to name %s, got %v", want, err)
+	}
+	if _, err := client.SendRaw(ctx, "from@example.com", to, bytes.NewReader([]byte("Subject: hello\r\n\r\nhello\r\n"))); err != nil {
+		t.Fatalf("expected a CRLF message to be sent, got %v", err)
+	}
+	if len(rec.reqs) != 1 {
+		t.Fatalf("expected only the CRLF message to be sent, got %d requests", len(rec.reqs))
+	}
+
+	client, rec = newRecordingClient(t, WithRawLineEndings(RawLineEndingsCRLF))
+	if _, err := client.SendRaw(ctx, "from@example.com", to, bytes.NewReader([]byte(raw))); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if got, want := string(rec.last(t)), "Subject: hello\r\nFrom: from@example.com\r\n\r\nhello\r\nworld\r\n"; got != want {
+		t.Fatalf("expected the line endings to be converted:\n%q\n%q", got, want)
+	}
+}
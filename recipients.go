@@ -0,0 +1,98 @@
+package postal
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// ParseAddressList parses a comma separated list of addresses, such as
+// "a@example.com, Bob <b@example.com>", into addresses which can be used for
+// the recipients of a message. Display names are kept and quoted where
+// needed. An empty list gives no addresses.
+func ParseAddressList(s string) ([]string, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	addrs, err := mail.ParseAddressList(s)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing address list: %w", err)
+	}
+
+	out := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		out = append(out, a.String())
+	}
+	return out, nil
+}
+
+// recipientKey returns the key recipients are compared by: the bare address,
+// lower cased.
+func recipientKey(r string) string {
+	if addr, err := mail.ParseAddress(r); err == nil {
+		r = addr.Address
+	}
+	return strings.ToLower(strings.TrimSpace(r))
+}
+
+// DuplicateRecipients returns the recipients of the message which appear
+// more than once across To, Cc and Bcc, compared by their bare address
+// regardless of case. Each duplicate is reported once, as first given.
+func (m Message) DuplicateRecipients() []string {
+	var (
+		seen = make(map[string]int)
+		dups []string
+	)
+	for _, list := range [][]string{m.To, m.Cc, m.Bcc} {
+		for _, r := range list {
+			k := recipientKey(r)
+			seen[k]++
+			if seen[k] == 2 {
+				dups = append(dups, r)
+			}
+		}
+	}
+	return dups
+}
+
+// dedupRecipients returns the message with duplicate recipients removed, if
+// the client is configured to. A recipient is kept in the first of To, Cc and
+// Bcc it appears in, so an address in both To and Bcc stays visible. The
+// given message isn't modified.
+func (a *ApiClient) dedupRecipients(ctx context.Context, msg Message) Message {
+	if !a.dedup {
+		return msg
+	}
+
+	var (
+		seen    = make(map[string]bool)
+		removed []string
+	)
+	dedup := func(list []string) []string {
+		if list == nil {
+			return nil
+		}
+
+		out := make([]string, 0, len(list))
+		for _, r := range list {
+			k := recipientKey(r)
+			if seen[k] {
+				removed = append(removed, r)
+				continue
+			}
+			seen[k] = true
+			out = append(out, r)
+		}
+		return out
+	}
+	msg.To = dedup(msg.To)
+	msg.Cc = dedup(msg.Cc)
+	msg.Bcc = dedup(msg.Bcc)
+
+	if len(removed) > 0 {
+		a.logf(ctx, "postal: removed duplicate recipients %s", strings.Join(removed, ", "))
+	}
+	return msg
+}
@@ -0,0 +1,165 @@
+package postal
+
+import (
+	"bytes"
+	"errors"
+	"net/mail"
+	"reflect"
+	"testing"
+)
+
+func TestDuplicateRecipients(t *testing.T) {
+	msg := Message{
+		To:  []string{"a@example.com", "B <b@example.com>"},
+		Cc:  []string{"A@example.com"},
+		Bcc: []string{"b@example.com", "c@example.com", "a@example.com"},
+	}
+
+	want := []string{"A@example.com", "b@example.com"}
+	if got := msg.DuplicateRecipients(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected duplicates %v, got %v", want, got)
+	}
+	if got := (Message{To: []string{"a@example.com"}}).DuplicateRecipients(); got != nil {
+		t.Fatalf("expected no duplicates, got %v", got)
+	}
+}
+
+func TestWithDedupRecipients(t *testing.T) {
+	logger := &testLogger{}
+	client, rec := newRecordingClient(t, WithDedupRecipients(), WithLogger(logger))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"a@example.com"},
+		Cc:        []string{"b@example.com"},
+		Bcc:       []string{"A@example.com", "b@example.com", "c@example.com"},
+		PlainBody: "hello",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	if want := []string{"a@example.com", "b@example.com", "c@example.com"}; !reflect.DeepEqual(rec.reqs[0].To, want) {
+		t.Fatalf("expected rcpt_to %v, got %v", want, rec.reqs[0].To)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get("To"); got != "<a@example.com>" && got != "a@example.com" {
+		t.Fatalf("unexpected To header %q", got)
+	}
+	if len(logger.lines) != 1 {
+		t.Fatalf("expected a warning, got %v", logger.lines)
+	}
+	if len(msg.Bcc) != 3 {
+		t.Fatal("the message was modified")
+	}
+}
+
+func TestDedupRecipientsDisabled(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"a@example.com"},
+		Bcc:       []string{"a@example.com"},
+		PlainBody: "hello",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(rec.reqs[0].To) != 2 {
+		t.Fatalf("expected recipients to be kept as is, got %v", rec.reqs[0].To)
+	}
+}
+
+func TestParseAddressList(t *testing.T) {
+	got, err := ParseAddressList(`a@example.com, Bob <b@example.com>, "Smith, Carol" <c@example.com>`)
+	if err != nil {
+		t.Fatalf("error parsing address list: %v", err)
+	}
+	want := []string{"<a@example.com>", `"Bob" <b@example.com>`, `"Smith, Carol" <c@example.com>`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+
+	if got, err := ParseAddressList("  "); err != nil || got != nil {
+		t.Fatalf("expected no addresses, got %q, %v", got, err)
+	}
+	if _, err := ParseAddressList("a@example.com, not an address"); err == nil {
+		t.Fatal("expected an error for an invalid address")
+	}
+}
+
+func TestEnvelopeTo(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	msg := Message{
+		From:       "from@example.com",
+		To:         []string{"Visible <to@example.com>"},
+		Bcc:        []string{"unused@example.com"},
+		EnvelopeTo: []string{"to@example.com", "Monitor <monitor@example.com>"},
+		PlainBody:  "hello",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if got, want := rec.reqs[0].To, []string{"to@example.com", "monitor@example.com"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected envelope %v, got %v", want, got)
+	}
+	raw := rec.last(t)
+	if !bytes.Contains(raw, []byte("To: \"Visible\" <to@example.com>\r\n")) || bytes.Contains(raw, []byte("monitor@example.com")) {
+		t.Fatalf("expected only To in the headers, got:\n%s", raw)
+	}
+
+	// Envelope recipients alone are enough to send a message.
+	msg.To, msg.Bcc = nil, nil
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message without header recipients: %v", err)
+	}
+
+	msg.EnvelopeTo = []string{" "}
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrNoRecipients) {
+		t.Fatalf("expected ErrNoRecipients, got %v", err)
+	}
+}
+
+func TestEnvelopeToRewriting(t *testing.T) {
+	msg := Message{
+		From:       "from@example.com",
+		To:         []string{"to@example.com"},
+		EnvelopeTo: []string{"monitor@example.com"},
+		PlainBody:  "hello",
+	}
+
+	client, rec := newRecordingClient(t, WithRedirectAllTo("staging@example.com"))
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if got := rec.reqs[0].To; !reflect.DeepEqual(got, []string{"staging@example.com"}) {
+		t.Fatalf("expected the envelope to be redirected, got %v", got)
+	}
+	if !bytes.Contains(rec.last(t), []byte("X-Original-Recipients: monitor@example.com\r\n")) {
+		t.Fatalf("expected the envelope recipients in %s", HdrOriginalRecipients)
+	}
+
+	rejected := errors.New("rejected")
+	client, rec = newRecordingClient(t, WithRecipientValidator(func(addr string) error {
+		if addr == "monitor@example.com" {
+			return rejected
+		}
+		return nil
+	}))
+	if _, err := client.SendMessage(msg); !errors.Is(err, rejected) {
+		t.Fatalf("expected the validator to check the envelope, got %v", err)
+	}
+
+	client, _ = newRecordingClient(t, WithStructuredSend())
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrEnvelopeStructured) || !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrEnvelopeStructured, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatalf("expected nothing to be sent, got %d requests", len(rec.reqs))
+	}
+}
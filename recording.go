@@ -0,0 +1,136 @@
+package postal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Record is a send made through a RecordingClient.
+type Record struct {
+	Message  Message
+	Response Response
+	Err      error
+}
+
+// recordJSON is how a Record is dumped. Errors can only be kept as their
+// message.
+type recordJSON struct {
+	Message  Message
+	Response Response
+	Err      string `json:",omitempty"`
+}
+
+// RecordingClient is a Client which sends through another Client and records
+// every send, for tests which check the exact sends made or replay them with
+// a ReplayClient. It's safe for concurrent use.
+type RecordingClient struct {
+	client Client
+
+	mu      sync.Mutex
+	records []Record
+}
+
+// NewRecordingClient returns a RecordingClient which sends through c.
+func NewRecordingClient(c Client) *RecordingClient {
+	return &RecordingClient{client: c}
+}
+
+// SendMessage sends the message through the wrapped client and records it.
+func (r *RecordingClient) SendMessage(msg Message) (Response, error) {
+	resp, err := r.client.SendMessage(msg)
+
+	r.mu.Lock()
+	r.records = append(r.records, Record{Message: msg, Response: resp, Err: err})
+	r.mu.Unlock()
+	return resp, err
+}
+
+// GetMessageDetails looks up the message through the wrapped client. Lookups
+// aren't recorded.
+func (r *RecordingClient) GetMessageDetails(id int64) (MessageDetails, error) {
+	return r.client.GetMessageDetails(id)
+}
+
+// Records returns the sends made so far, in order.
+func (r *RecordingClient) Records() []Record {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Record(nil), r.records...)
+}
+
+// Dump writes the sends made so far to w as JSON, one per line, so they can
+// be loaded with LoadRecords. Attachments aren't dumped, and errors are only
+// kept as their message.
+func (r *RecordingClient) Dump(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	for _, rec := range r.Records() {
+		j := recordJSON{Message: rec.Message, Response: rec.Response}
+		if rec.Err != nil {
+			j.Err = rec.Err.Error()
+		}
+		if err := enc.Encode(j); err != nil {
+			return fmt.Errorf("error dumping record: %v", err)
+		}
+	}
+	return nil
+}
+
+// LoadRecords reads records written by RecordingClient.Dump.
+func LoadRecords(r io.Reader) ([]Record, error) {
+	var records []Record
+	dec := json.NewDecoder(r)
+	for {
+		var j recordJSON
+		if err := dec.Decode(&j); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("error loading record %d: %v", len(records)+1, err)
+		}
+
+		rec := Record{Message: j.Message, Response: j.Response}
+		if j.Err != "" {
+			rec.Err = errors.New(j.Err)
+		}
+		records = append(records, rec)
+	}
+}
+
+// ErrNoMoreRecords is returned by a ReplayClient which has replayed all of
+// its records.
+var ErrNoMoreRecords = errors.New("postal: no more records to replay")
+
+// ReplayClient is a Client which replays recorded sends: each send returns
+// the response and error of the next record, whatever the message. It's safe
+// for concurrent use.
+type ReplayClient struct {
+	mu      sync.Mutex
+	records []Record
+}
+
+// NewReplayClient returns a ReplayClient which replays the records in order.
+func NewReplayClient(records []Record) *ReplayClient {
+	return &ReplayClient{records: append([]Record(nil), records...)}
+}
+
+// GetMessageDetails fails with ErrNotSupported, as only sends are recorded.
+func (r *ReplayClient) GetMessageDetails(id int64) (MessageDetails, error) {
+	return MessageDetails{}, fmt.Errorf("%w: replay client can't look up message %d", ErrNotSupported, id)
+}
+
+// SendMessage returns the response and error of the next record, or
+// ErrNoMoreRecords once all of them were replayed.
+func (r *ReplayClient) SendMessage(Message) (Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.records) == 0 {
+		return Response{}, ErrNoMoreRecords
+	}
+	rec := r.records[0]
+	r.records = r.records[1:]
+	return rec.Response, rec.Err
+}
@@ -0,0 +1,49 @@
+package postal
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var (
+	_ Client = (*RecordingClient)(nil)
+	_ Client = (*ReplayClient)(nil)
+)
+
+func TestRecordingClient(t *testing.T) {
+	replay := NewReplayClient([]Record{
+		{Response: Response{MessageID: "abc@postal", Messages: map[string]ResponseMessage{"to@example.com": {ID: 1, Token: "abc"}}}},
+		{Err: errors.New("rejected")},
+	})
+	client := NewRecordingClient(replay)
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, Subject: "hello", PlainBody: "hello"}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.SendMessage(msg); err == nil || err.Error() != "rejected" {
+		t.Fatalf("expected the recorded error, got %v", err)
+	}
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrNoMoreRecords) {
+		t.Fatalf("expected ErrNoMoreRecords, got %v", err)
+	}
+
+	records := client.Records()
+	if len(records) != 3 || records[0].Response.MessageID != "abc@postal" || records[0].Message.Subject != "hello" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+
+	var buf bytes.Buffer
+	if err := client.Dump(&buf); err != nil {
+		t.Fatalf("error dumping records: %v", err)
+	}
+	loaded, err := LoadRecords(&buf)
+	if err != nil {
+		t.Fatalf("error loading records: %v", err)
+	}
+	if len(loaded) != 3 || !reflect.DeepEqual(loaded[0], records[0]) || loaded[1].Err.Error() != "rejected" {
+		t.Fatalf("unexpected loaded records: %+v", loaded)
+	}
+}
@@ -0,0 +1,44 @@
+package postal
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+// replyRouteToken is the placeholder for the reply's identifier in a reply
+// route template.
+const replyRouteToken = "{id}"
+
+// ErrInvalidReplyRoute is returned by SetReplyRoute when the route template
+// or identifier can't form an address.
+var ErrInvalidReplyRoute = errors.New("postal: invalid reply route")
+
+// SetReplyRoute sets the Reply-To of the message to an address handled by
+// one of postal's inbound routes, so replies come back through postal to the
+// route's endpoint, such as an HTTP endpoint of the application.
+//
+// template is the route's address with a {id} placeholder, such as
+// "reply+{id}@inbound.example.com", which is replaced by id to tell replies
+// apart; the route itself must match the address with the placeholder
+// replaced, such as a route named "reply" on the inbound.example.com domain,
+// which postal matches for "reply+anything" too. id may only have letters,
+// digits and "-", "_" and "." so it survives in the local part. A template
+// without a placeholder is used as it is.
+func (m *Message) SetReplyRoute(template, id string) error {
+	addr := template
+	if strings.Contains(template, replyRouteToken) {
+		if id == "" || strings.Trim(id, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_.") != "" {
+			return fmt.Errorf("%w: invalid id %q", ErrInvalidReplyRoute, id)
+		}
+		addr = strings.ReplaceAll(template, replyRouteToken, id)
+	}
+
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Address != addr {
+		return fmt.Errorf("%w: %q isn't a bare address", ErrInvalidReplyRoute, addr)
+	}
+	m.ReplyTo = []string{addr}
+	return nil
+}
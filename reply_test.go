@@ -0,0 +1,35 @@
+package postal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetReplyRoute(t *testing.T) {
+	var msg Message
+	if err := msg.SetReplyRoute("reply+{id}@inbound.example.com", "ticket-42"); err != nil {
+		t.Fatalf("error setting reply route: %v", err)
+	}
+	if len(msg.ReplyTo) != 1 || msg.ReplyTo[0] != "reply+ticket-42@inbound.example.com" {
+		t.Fatalf("unexpected Reply-To: %v", msg.ReplyTo)
+	}
+
+	if err := msg.SetReplyRoute("replies@inbound.example.com", ""); err != nil || msg.ReplyTo[0] != "replies@inbound.example.com" {
+		t.Fatalf("expected a template without a placeholder to be used as is, got %v: %v", msg.ReplyTo, err)
+	}
+
+	for _, tt := range []struct{ template, id string }{
+		{"reply+{id}@inbound.example.com", "a b"},
+		{"reply+{id}@inbound.example.com", "x@evil.com"},
+		{"reply+{id}@inbound.example.com", ""},
+		{"Replies <reply@inbound.example.com>", ""},
+		{"not an address", ""},
+	} {
+		if err := msg.SetReplyRoute(tt.template, tt.id); !errors.Is(err, ErrInvalidReplyRoute) {
+			t.Fatalf("expected ErrInvalidReplyRoute for %q and %q, got %v", tt.template, tt.id, err)
+		}
+	}
+	if msg.ReplyTo[0] != "replies@inbound.example.com" {
+		t.Fatalf("expected a failed call not to change Reply-To, got %v", msg.ReplyTo)
+	}
+}
@@ -0,0 +1,214 @@
+package postal
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// FullResult is postal's response to a send along with metadata about the
+// request.
+type FullResult struct {
+	Response
+
+	// Time is the time postal took to process the request, in seconds.
+	Time float64
+
+	// ServerDate is the server's clock, from the Date header of the response.
+	// It is zero if the response had no Date header.
+	ServerDate time.Time
+
+	// Received is the local time at which the response was received.
+	Received time.Time
+
+	// LookupUntil is when postal is assumed to delete the messages, after
+	// which GetMessageDetails can't find them by their IDs. Postal doesn't
+	// report it, so it's Received plus the client's message retention, see
+	// WithMessageRetention; keep IDs and tokens for reconciliation until
+	// then.
+	LookupUntil time.Time
+
+	// RequestSize is the size of the JSON body sent to postal, in bytes,
+	// which includes the base64 encoded message.
+	RequestSize int
+
+	// Flags are the flags of postal's response, as JSON. It's nil if the
+	// response had none.
+	Flags json.RawMessage
+
+	// Raw is the full body of postal's response, for fields the client
+	// doesn't decode.
+	Raw json.RawMessage
+
+	// RateLimit is the rate limit reported by the response's headers, or nil
+	// if it had none.
+	RateLimit *RateLimitInfo
+
+	// SubmittedRecipients are the envelope recipients the message was
+	// submitted to postal with, as rcpt_to, after the client's rewriting,
+	// redirection, deduplication and sandboxing, so they may differ from
+	// the message's. They're the addresses to reconcile the keys of
+	// Messages against. For structured sends, they're the To, Cc and Bcc
+	// postal sends to.
+	SubmittedRecipients []string
+
+	// Timing is the timing of the request, or of its last attempt if it was
+	// retried. It's nil unless the client traces requests, see
+	// WithHTTPTrace.
+	Timing *RequestTiming
+
+	// TLS is the state of the TLS connection the request was sent over,
+	// such as its Version and CipherSuite, to check API traffic is
+	// encrypted as expected. It's nil if the request wasn't sent over TLS,
+	// as with an http:// base URL.
+	TLS *tls.ConnectionState
+
+	// PerRecipient are the results of the messages sent to each recipient
+	// with WithPerRecipientMessages, in the order of the recipients, when
+	// there was more than one. The Messages of the result are theirs
+	// merged, and its MessageID and RFCMessageID the first message's.
+	PerRecipient []FullResult
+
+	// Skipped is set if nothing was sent because the client's address
+	// rewriter removed every recipient, see WithSkipRemovedRecipients. The
+	// rest of the result is empty.
+	Skipped bool
+
+	// Endpoint is the send endpoint the message was sent with. It's set
+	// even if the send failed.
+	Endpoint Endpoint
+}
+
+// Endpoint is one of postal's send endpoints.
+type Endpoint string
+
+const (
+	// EndpointRaw is the raw send endpoint, to which the client sends the
+	// MIME message it built.
+	EndpointRaw Endpoint = "raw"
+	// EndpointStructured is the structured send endpoint, with which postal
+	// builds the message itself, see WithStructuredSend.
+	EndpointStructured Endpoint = "structured"
+)
+
+// RateLimitInfo is a rate limit reported in the X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset headers of a response. Postal
+// doesn't send them itself, but proxies in front of it may.
+type RateLimitInfo struct {
+	Limit     int
+	Remaining int
+	// Reset is when the limit resets. It's zero if the response didn't say.
+	Reset time.Time
+}
+
+// archiveResponse writes the body of postal's response to a send to the
+// client's archiver, if it has one. Failing to archive the response doesn't
+// fail the send, as postal has already taken the message; it's logged
+// instead.
+func (a *ApiClient) archiveResponse(ctx context.Context, res response, err error) {
+	if a.archiver == nil {
+		return
+	}
+
+	body := res.body
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		body = apiErr.Body
+	}
+	if len(body) == 0 {
+		return
+	}
+
+	a.archiveMu.Lock()
+	defer a.archiveMu.Unlock()
+	if _, err := a.archiver.Write(body); err != nil {
+		a.logf(ctx, "postal: error archiving response: %v", err)
+	}
+}
+
+// MessageArchiver is given every message sent by a client, after the send,
+// with the message as it was sent, its raw RFC 5322 form, and the send's
+// response and error. raw is nil if the message couldn't be built, or was
+// sent with WithStructuredSend. It's called from the goroutine which made
+// the send, so concurrent sends call it concurrently.
+type MessageArchiver func(ctx context.Context, msg Message, raw []byte, resp Response, err error)
+
+// archiveMessage passes a sent message to the client's message archiver, if
+// it has one.
+func (a *ApiClient) archiveMessage(ctx context.Context, msg Message, raw []byte, resp Response, err error) {
+	if a.msgArchiver != nil {
+		a.msgArchiver(ctx, msg, raw, resp, err)
+	}
+}
+
+// ServerTime returns the server's clock at the time it responded. It is zero
+// if postal didn't send a Date header.
+func (r FullResult) ServerTime() time.Time {
+	return r.ServerDate
+}
+
+// ClockSkew returns how far the server's clock is ahead of the local clock,
+// or 0 if the server's clock isn't known. The Date header only has second
+// precision, so skews below a second aren't meaningful.
+func (r FullResult) ClockSkew() time.Duration {
+	if r.ServerDate.IsZero() || r.Received.IsZero() {
+		return 0
+	}
+	return r.ServerDate.Sub(r.Received.Truncate(time.Second))
+}
+
+// serverDate parses the Date header of a response.
+func serverDate(h http.Header) time.Time {
+	d, err := http.ParseTime(h.Get("Date"))
+	if err != nil {
+		return time.Time{}
+	}
+	return d
+}
+
+// rateLimitInfo parses the rate limit headers of a response received at
+// received. X-RateLimit-Reset is either a Unix time or a number of seconds
+// from now, told apart by their size. It returns nil unless the response
+// has valid Limit and Remaining headers.
+func rateLimitInfo(h http.Header, received time.Time) *RateLimitInfo {
+	limit, err := strconv.Atoi(h.Get("X-RateLimit-Limit"))
+	if err != nil {
+		return nil
+	}
+	remaining, err := strconv.Atoi(h.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return nil
+	}
+
+	info := &RateLimitInfo{Limit: limit, Remaining: remaining}
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil && reset >= 0 {
+		// Anything over a year of seconds is a Unix time.
+		if reset > 365*24*60*60 {
+			info.Reset = time.Unix(reset, 0)
+		} else {
+			info.Reset = received.Add(time.Duration(reset) * time.Second)
+		}
+	}
+	return info
+}
+
+// checkClockSkew logs a warning if the skew between the local clock and the
+// server's clock exceeds the configured threshold.
+func (a *ApiClient) checkClockSkew(ctx context.Context, r FullResult) {
+	if a.logger == nil || a.skewThreshold <= 0 {
+		return
+	}
+
+	skew := r.ClockSkew()
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > a.skewThreshold {
+		a.logf(ctx, "postal: clock skew of %s between local clock and postal server (%s), which can break DKIM and scheduling",
+			r.ClockSkew(), r.ServerDate.Format(time.RFC1123))
+	}
+}
@@ -0,0 +1,360 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLogger collects the log lines in a slice.
+type testLogger struct {
+	lines []string
+}
+
+func (l *testLogger) Printf(format string, v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, v...))
+}
+
+func TestServerTime(t *testing.T) {
+	clock := newFakeClock()
+	serverNow := clock.Now().Add(2 * time.Minute)
+	logger := &testLogger{}
+
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", serverNow.Format(http.TimeFormat))
+		w.Write([]byte(`{"status":"success","time":0.25,"data":{"message_id":"abc@postal","messages":{"to@example.com":{"id":1,"token":"abc"}}}}`))
+	}, WithClock(clock), WithLogger(logger), WithClockSkewWarning(time.Minute))
+
+	res, err := client.SendMessageFull(context.Background(), Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	})
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	if !res.ServerTime().Equal(serverNow) {
+		t.Fatalf("expected server time %s, got %s", serverNow, res.ServerTime())
+	}
+	if res.ClockSkew() != 2*time.Minute {
+		t.Fatalf("expected skew of 2m, got %s", res.ClockSkew())
+	}
+	if res.Time != 0.25 {
+		t.Fatalf("expected processing time 0.25, got %v", res.Time)
+	}
+	if res.MessageID != "abc@postal" {
+		t.Fatalf("unexpected message id: %s", res.MessageID)
+	}
+	if len(logger.lines) != 1 || !strings.Contains(logger.lines[0], "clock skew") {
+		t.Fatalf("expected a clock skew warning, got %v", logger.lines)
+	}
+}
+
+func TestServerTimeMissing(t *testing.T) {
+	if skew := (FullResult{Received: time.Now()}).ClockSkew(); skew != 0 {
+		t.Fatalf("expected no skew without a server date, got %s", skew)
+	}
+}
+
+func TestRequestSize(t *testing.T) {
+	var size int
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		size = len(body)
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	})
+
+	res, err := client.SendMessageFull(context.Background(), Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	})
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if res.RequestSize == 0 || res.RequestSize != size {
+		t.Fatalf("expected request size %d, got %d", size, res.RequestSize)
+	}
+}
+
+func TestFullResultRaw(t *testing.T) {
+	body := `{"status":"success","time":0.1,"flags":{"uuid":"b1c2"},"data":{"message_id":"abc@postal","messages":{"to@example.com":{"id":1,"token":"abc"}},"server":"main"}}`
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+
+	res, err := client.SendMessageFull(context.Background(), Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	})
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if string(res.Raw) != body {
+		t.Fatalf("unexpected raw response %s", res.Raw)
+	}
+
+	var flags struct {
+		UUID string `json:"uuid"`
+	}
+	if err := json.Unmarshal(res.Flags, &flags); err != nil || flags.UUID != "b1c2" {
+		t.Fatalf("unexpected flags %s: %v", res.Flags, err)
+	}
+
+	var data struct {
+		Server string `json:"server"`
+	}
+	if err := json.Unmarshal(res.Raw, &struct {
+		Data interface{} `json:"data"`
+	}{&data}); err != nil || data.Server != "main" {
+		t.Fatalf("expected to decode unknown fields from the raw response, got %+v: %v", data, err)
+	}
+}
+
+func TestWithResponseArchiver(t *testing.T) {
+	bodies := []string{
+		`{"status":"success","time":0.1,"flags":{},"data":{"message_id":"abc@postal","messages":{"to@example.com":{"id":1,"token":"abc"}}}}`,
+		`{"status":"error","time":0.1,"flags":{},"data":{"code":"NoRecipients","message":"There are no recipients defined to receive this message"}}`,
+	}
+	var archive bytes.Buffer
+	i := 0
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(bodies[i]))
+		i++
+	}, WithResponseArchiver(&archive))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if _, err := client.SendMessage(msg); err == nil {
+		t.Fatal("expected the second send to fail")
+	}
+
+	if got, want := archive.String(), strings.Join(bodies, ""); got != want {
+		t.Fatalf("unexpected archive:\n got: %s\nwant: %s", got, want)
+	}
+}
+
+func TestRateLimitInfo(t *testing.T) {
+	clock := newFakeClock()
+	now := clock.Now()
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    *RateLimitInfo
+	}{
+		{"none", nil, nil},
+		{"seconds", map[string]string{"X-RateLimit-Limit": "100", "X-RateLimit-Remaining": "7", "X-RateLimit-Reset": "30"},
+			&RateLimitInfo{Limit: 100, Remaining: 7, Reset: now.Add(30 * time.Second)}},
+		{"unix time", map[string]string{"X-RateLimit-Limit": "100", "X-RateLimit-Remaining": "0", "X-RateLimit-Reset": "1700000000"},
+			&RateLimitInfo{Limit: 100, Remaining: 0, Reset: time.Unix(1700000000, 0)}},
+		{"no reset", map[string]string{"X-RateLimit-Limit": "100", "X-RateLimit-Remaining": "50"},
+			&RateLimitInfo{Limit: 100, Remaining: 50}},
+		{"invalid", map[string]string{"X-RateLimit-Limit": "many", "X-RateLimit-Remaining": "50"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				for k, v := range tt.headers {
+					w.Header().Set(k, v)
+				}
+				w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+			}, WithClock(clock))
+
+			res, err := client.SendMessageFull(context.Background(), retryMsg)
+			if err != nil {
+				t.Fatalf("error sending message: %v", err)
+			}
+			switch {
+			case tt.want == nil && res.RateLimit != nil:
+				t.Fatalf("expected no rate limit, got %+v", res.RateLimit)
+			case tt.want != nil && (res.RateLimit == nil || res.RateLimit.Limit != tt.want.Limit || res.RateLimit.Remaining != tt.want.Remaining || !res.RateLimit.Reset.Equal(tt.want.Reset)):
+				t.Fatalf("expected rate limit %+v, got %+v", tt.want, res.RateLimit)
+			}
+		})
+	}
+}
+
+func TestWithMessageArchiver(t *testing.T) {
+	type archived struct {
+		msg  Message
+		raw  []byte
+		resp Response
+		err  error
+	}
+	var got []archived
+	archive := func(_ context.Context, msg Message, raw []byte, resp Response, err error) {
+		got = append(got, archived{msg, raw, resp, err})
+	}
+
+	fail := false
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			return
+		}
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithMessageArchiver(archive))
+
+	if _, err := client.SendMessage(retryMsg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	fail = true
+	_, sendErr := client.SendMessage(retryMsg)
+	if sendErr == nil {
+		t.Fatal("expected the send to fail")
+	}
+	if _, err := client.SendMessage(Message{From: "from@example.com"}); err == nil {
+		t.Fatal("expected an invalid message to fail")
+	}
+
+	if len(got) != 3 {
+		t.Fatalf("expected 3 archived sends, got %d", len(got))
+	}
+	if got[0].err != nil || got[0].resp.MessageID != "abc@postal" || !bytes.Contains(got[0].raw, []byte("Message-ID: ")) {
+		t.Fatalf("unexpected archive of the successful send: %+v", got[0])
+	}
+	if got[1].err != sendErr || len(got[1].raw) == 0 {
+		t.Fatalf("expected the failed send to be archived with its message, got %+v", got[1])
+	}
+	if got[2].err == nil || got[2].raw != nil {
+		t.Fatalf("expected the invalid message to be archived without a raw message, got %+v", got[2])
+	}
+}
+
+func TestFullResultEndpoint(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		want Endpoint
+	}{
+		{"raw", nil, EndpointRaw},
+		{"structured", []Option{WithStructuredSend()}, EndpointStructured},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+			}, tt.opts...)
+
+			res, err := client.SendMessageFull(context.Background(), Message{
+				From:      "from@example.com",
+				To:        []string{"to@example.com"},
+				PlainBody: "hello",
+			})
+			if err != nil {
+				t.Fatalf("error sending message: %v", err)
+			}
+			if res.Endpoint != tt.want {
+				t.Fatalf("expected endpoint %q, got %q", tt.want, res.Endpoint)
+			}
+		})
+	}
+}
+
+func TestFullResultSubmittedRecipients(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"raw", nil},
+		{"structured", []Option{WithStructuredSend()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Write(successResponse("abc@postal", []string{"qa@example.com"}))
+			}, append(tt.opts, WithRedirectAllTo("qa@example.com"), WithDedupRecipients())...)
+
+			res, err := client.SendMessageFull(context.Background(), Message{
+				From:      "from@example.com",
+				To:        []string{"to@example.com"},
+				Cc:        []string{"cc@example.com"},
+				PlainBody: "hello",
+			})
+			if err != nil {
+				t.Fatalf("error sending message: %v", err)
+			}
+			if want := []string{"qa@example.com"}; !reflect.DeepEqual(res.SubmittedRecipients, want) {
+				t.Fatalf("expected the submitted recipients %v, got %v", want, res.SubmittedRecipients)
+			}
+		})
+	}
+}
+
+func TestFullResultLookupUntil(t *testing.T) {
+	clock := newFakeClock()
+	for _, tt := range []struct {
+		name string
+		opts []Option
+		want time.Duration
+	}{
+		{"default", nil, DefaultMessageRetention},
+		{"configured", []Option{WithMessageRetention(7 * 24 * time.Hour)}, 7 * 24 * time.Hour},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := newRecordingClient(t, append(tt.opts, WithClock(clock))...)
+			res, err := client.SendMessageFull(context.Background(), Message{
+				From:      "from@example.com",
+				To:        []string{"to@example.com"},
+				PlainBody: "hello",
+			})
+			if err != nil {
+				t.Fatalf("error sending message: %v", err)
+			}
+			if want := clock.Now().Add(tt.want); !res.LookupUntil.Equal(want) {
+				t.Fatalf("expected lookups until %v, got %v", want, res.LookupUntil)
+			}
+		})
+	}
+}
+
+func TestFullResultTLS(t *testing.T) {
+	h := func(w http.ResponseWriter, r *http.Request) {
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(h))
+	defer srv.Close()
+	client, err := NewAPIClient(srv.URL, "test-token", srv.Client())
+	if err != nil {
+		t.Fatalf("error creating api client: %v", err)
+	}
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	res, err := client.SendMessageFull(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if res.TLS == nil || !res.TLS.HandshakeComplete || res.TLS.Version < tls.VersionTLS12 || res.TLS.CipherSuite == 0 {
+		t.Fatalf("expected the TLS state of the connection, got %+v", res.TLS)
+	}
+
+	// Without TLS, there's no state.
+	res, err = newTestClient(t, h).SendMessageFull(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if res.TLS != nil {
+		t.Fatalf("expected no TLS state over plain HTTP, got %+v", res.TLS)
+	}
+}
@@ -0,0 +1,161 @@
+package postal
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy configures how the client retries requests which fail with an
+// error for which IsRetryable reports true.
+//
+// The wait between attempts starts at InitialBackoff and doubles after each
+// attempt, up to MaxBackoff. If the request's context has a deadline, the
+// client doesn't wait for an attempt which couldn't be made before it;
+// instead the last error is returned right away.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first
+	// one. Values less than 2 disable retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between attempts. If it's 0, the wait isn't
+	// capped.
+	MaxBackoff time.Duration
+	// UnavailableBackoff replaces InitialBackoff after a 503 response, an
+	// ErrServerUnavailable, which postal or a proxy in front of it sends
+	// when it's down for maintenance and won't be back in a few
+	// milliseconds. If it's 0, it's four times InitialBackoff.
+	UnavailableBackoff time.Duration
+}
+
+// unavailableBackoffFactor is the factor of InitialBackoff the wait after a
+// 503 response starts at, unless set with UnavailableBackoff.
+const unavailableBackoffFactor = 4
+
+// backoff returns the wait after the given attempt, starting from 1, which
+// failed with err.
+func (p RetryPolicy) backoff(attempt int, err error) time.Duration {
+	d := p.InitialBackoff
+	if errors.Is(err, ErrServerUnavailable) {
+		d = p.UnavailableBackoff
+		if d == 0 {
+			d = unavailableBackoffFactor * p.InitialBackoff
+		}
+	}
+	for i := 1; i < attempt; i++ {
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			break
+		}
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// defaultRetryableStatuses are the response statuses which are retryable
+// unless changed with WithRetryableStatuses.
+var defaultRetryableStatuses = statusSet(
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+)
+
+// statusSet returns a set of the HTTP statuses.
+func statusSet(codes ...int) map[int]bool {
+	set := make(map[int]bool, len(codes))
+	for _, c := range codes {
+		set[c] = true
+	}
+	return set
+}
+
+// IsRetryable reports whether a request which failed with err can safely be
+// retried.
+//
+// Transient network failures such as DNS errors, refused or reset
+// connections and connections closed before a response are retryable, as are
+// 429, 500, 502, 503 and 504 responses from postal. TLS certificate errors,
+// other responses and context cancellation or deadlines are not: a deadline
+// is the caller's budget and retrying past it defeats its purpose.
+//
+// Clients configured with WithRetryableStatuses retry the statuses they
+// were given instead.
+func IsRetryable(err error) bool {
+	return isRetryable(err, defaultRetryableStatuses)
+}
+
+// isRetryable is IsRetryable with the given retryable response statuses.
+func isRetryable(err error, statuses map[int]bool) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return statuses[apiErr.StatusCode]
+	}
+
+	if isTLSError(err) {
+		return false
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	// Failing to dial postal is retryable, whatever the underlying cause.
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return false
+}
+
+// retryable reports whether a request which failed with err can be retried,
+// according to the client's retryable statuses.
+func (a *ApiClient) retryable(err error) bool {
+	if a.retryStatuses != nil {
+		return isRetryable(err, a.retryStatuses)
+	}
+	return IsRetryable(err)
+}
+
+// isTLSError reports whether err is caused by a failed TLS handshake or an
+// invalid certificate.
+func isTLSError(err error) bool {
+	var (
+		unknownAuthErr x509.UnknownAuthorityError
+		invalidErr     x509.CertificateInvalidError
+		hostnameErr    x509.HostnameError
+		recordErr      tls.RecordHeaderError
+	)
+	return errors.As(err, &unknownAuthErr) || errors.As(err, &invalidErr) ||
+		errors.As(err, &hostnameErr) || errors.As(err, &recordErr)
+}
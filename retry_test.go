@@ -0,0 +1,254 @@
+package postal
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	// wrap wraps err the way http.Client and SendMessage do.
+	wrap := func(err error) error {
+		return fmt.Errorf("error sending request to postal: %w", &url.Error{Op: "Post", URL: "https://postal", Err: err})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"dns", wrap(&net.DNSError{Err: "no such host", Name: "postal"}), true},
+		{"connection refused", wrap(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), true},
+		{"connection reset", wrap(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), true},
+		{"unexpected eof", wrap(io.ErrUnexpectedEOF), true},
+		{"unknown authority", wrap(x509.UnknownAuthorityError{}), false},
+		{"hostname mismatch", wrap(x509.HostnameError{Host: "postal"}), false},
+		{"context deadline", wrap(context.DeadlineExceeded), false},
+		{"context canceled", wrap(context.Canceled), false},
+		{"429", &APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{"500", &APIError{StatusCode: http.StatusInternalServerError}, true},
+		{"503", fmt.Errorf("wrapped: %w", &APIError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"501", &APIError{StatusCode: http.StatusNotImplemented}, false},
+		{"400", &APIError{StatusCode: http.StatusBadRequest}, false},
+		{"404", &APIError{StatusCode: http.StatusNotFound}, false},
+		{"other", errors.New("something else"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Fatalf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := p.backoff(attempt+1, nil); got != want {
+			t.Fatalf("backoff(%d) = %v, want %v", attempt+1, got, want)
+		}
+	}
+}
+
+func TestRetryUnavailable(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Minute}
+	unavailable := &APIError{StatusCode: http.StatusServiceUnavailable}
+	if got := p.backoff(1, unavailable); got != 4*time.Second {
+		t.Fatalf("expected a 4s wait after a 503, got %v", got)
+	}
+	if got := p.backoff(3, unavailable); got != 16*time.Second {
+		t.Fatalf("expected a 16s wait after the third 503, got %v", got)
+	}
+	p.UnavailableBackoff = 30 * time.Second
+	if got := p.backoff(2, fmt.Errorf("wrapped: %w", unavailable)); got != time.Minute {
+		t.Fatalf("expected the wait to be capped at 1m, got %v", got)
+	}
+	if got := p.backoff(1, &APIError{StatusCode: http.StatusBadGateway}); got != time.Second {
+		t.Fatalf("expected a 1s wait after a 502, got %v", got)
+	}
+
+	var calls int32
+	clock := newFakeClock()
+	client := newTestClient(t, failingHandler(1, http.StatusServiceUnavailable, &calls),
+		WithClock(clock), WithRetry(RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Second}))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.SendMessage(retryMsg)
+		done <- err
+	}()
+
+	clock.waitForWaiters(t, 1)
+	clock.Advance(3 * time.Second)
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected no retry before 4s, got %d attempts", got)
+	}
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected 2 attempts, got %d", got)
+	}
+}
+
+// failingHandler fails the first n requests with status and succeeds after.
+func failingHandler(n int32, status int, calls *int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(calls, 1) <= n {
+			w.WriteHeader(status)
+			return
+		}
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}
+}
+
+var retryMsg = Message{
+	From:      "from@example.com",
+	To:        []string{"to@example.com"},
+	PlainBody: "hello",
+}
+
+func TestWithRetry(t *testing.T) {
+	var calls int32
+	clock := newFakeClock()
+	client := newTestClient(t, failingHandler(2, http.StatusBadGateway, &calls),
+		WithClock(clock), WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second}))
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.SendMessage(retryMsg)
+		done <- err
+	}()
+
+	clock.waitForWaiters(t, 1)
+	clock.Advance(time.Second)
+	clock.waitForWaiters(t, 1)
+	clock.Advance(2 * time.Second)
+
+	if err := <-done; err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestWithRetryGivesUp(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, failingHandler(10, http.StatusBadGateway, &calls),
+		WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+
+	_, err := client.SendMessage(retryMsg)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected a 502 APIError, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestWithRetryNotRetryable(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, failingHandler(10, http.StatusBadRequest, &calls),
+		WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}))
+
+	if _, err := client.SendMessage(retryMsg); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected 1 attempt, got %d", got)
+	}
+}
+
+func TestWithRetryableStatuses(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, failingHandler(2, 420, &calls),
+		WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}), WithRetryableStatuses(420, http.StatusServiceUnavailable))
+
+	if _, err := client.SendMessage(retryMsg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+
+	// The default statuses are replaced.
+	calls = 0
+	client = newTestClient(t, failingHandler(2, http.StatusBadGateway, &calls),
+		WithRetry(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}), WithRetryableStatuses(420))
+	if _, err := client.SendMessage(retryMsg); err == nil {
+		t.Fatal("expected an error")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected 1 attempt, got %d", got)
+	}
+}
+
+func TestWithRetryContextDeadlineFakeClock(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, failingHandler(100, http.StatusBadGateway, &calls),
+		WithClock(newFakeClock()), WithRetry(RetryPolicy{MaxAttempts: 10, InitialBackoff: time.Second}))
+
+	// The fake clock never advances, so waiting for the backoff would only
+	// end with the context.
+	const timeout = 500 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.SendMessageContext(ctx, retryMsg)
+	elapsed := time.Since(start)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected the 502 APIError, got %v", err)
+	}
+	if elapsed >= timeout/2 {
+		t.Fatalf("expected to give up without waiting for the backoff, took %v", elapsed)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected 1 attempt, got %d", got)
+	}
+}
+
+func TestWithRetryContextDeadline(t *testing.T) {
+	var calls int32
+	client := newTestClient(t, failingHandler(100, http.StatusBadGateway, &calls),
+		WithRetry(RetryPolicy{MaxAttempts: 10, InitialBackoff: 50 * time.Millisecond}))
+
+	const timeout = 200 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Attempts are made at 0, 50ms and 150ms. The next one would be at
+	// 350ms, past the deadline, so the client gives up after the third.
+	start := time.Now()
+	_, err := client.SendMessageContext(ctx, retryMsg)
+	elapsed := time.Since(start)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+		t.Fatalf("expected the last 502 APIError, got %v", err)
+	}
+	if elapsed >= timeout {
+		t.Fatalf("expected to return before the deadline, took %v", elapsed)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 attempts, got %d", got)
+	}
+}
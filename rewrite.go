@@ -0,0 +1,96 @@
+package postal
+
+import (
+	"context"
+	"fmt"
+	"net/textproto"
+	"strings"
+)
+
+// HdrOriginalRecipients lists the recipients a message redirected with
+// WithRedirectAllTo was meant for.
+const HdrOriginalRecipients = "X-Original-Recipients"
+
+// AddressRewriter rewrites a list of recipients of a message, its To, Cc or
+// Bcc, before it's sent. It can return nil to drop the whole list. See
+// WithAddressRewriter.
+type AddressRewriter func(addrs []string) []string
+
+// rewriteRecipients returns the message with its recipients rewritten by the
+// client's rewriter and redirected to its redirect address, if it has them.
+// The given message isn't modified.
+func (a *ApiClient) rewriteRecipients(msg Message) Message {
+	if a.rewriter != nil {
+		msg.To = a.rewriter(msg.To)
+		msg.Cc = a.rewriter(msg.Cc)
+		msg.Bcc = a.rewriter(msg.Bcc)
+		if len(msg.EnvelopeTo) > 0 {
+			msg.EnvelopeTo = a.rewriter(msg.EnvelopeTo)
+		}
+	}
+	if a.redirectTo == "" {
+		return msg
+	}
+
+	var orig []string
+	lists := [][]string{msg.To, msg.Cc, msg.Bcc}
+	if len(msg.EnvelopeTo) > 0 {
+		lists = [][]string{msg.EnvelopeTo}
+	}
+	for _, list := range lists {
+		orig = append(orig, list...)
+	}
+	hdr := make(textproto.MIMEHeader, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		hdr[k] = v
+	}
+	if len(orig) > 0 {
+		hdr.Set(HdrOriginalRecipients, strings.Join(orig, ", "))
+	}
+
+	msg.Headers = hdr
+	msg.To = []string{a.redirectTo}
+	msg.Cc, msg.Bcc, msg.EnvelopeTo = nil, nil, nil
+	return msg
+}
+
+// recipientsRemoved reports whether the client's rewriting removed every
+// recipient of orig, leaving msg, the normalized message, with none. Without
+// the check, a message whose EnvelopeTo were all removed would be sent to
+// its To, Cc and Bcc.
+func (a *ApiClient) recipientsRemoved(orig, msg Message) bool {
+	if a.redirectTo != "" {
+		return false
+	}
+	if len(orig.EnvelopeTo) > 0 {
+		return hasAddress(orig.EnvelopeTo) && !hasAddress(msg.EnvelopeTo)
+	}
+	return (hasAddress(orig.To) || hasAddress(orig.Cc) || hasAddress(orig.Bcc)) &&
+		!hasAddress(msg.To) && !hasAddress(msg.Cc) && !hasAddress(msg.Bcc)
+}
+
+// errRecipientsRemoved is the error of sends of messages whose recipients
+// were all removed by the client's rewriting.
+var errRecipientsRemoved = withKind(ErrInvalidMessage, fmt.Errorf("%w: every recipient was removed by the client's address rewriter", ErrNoRecipients))
+
+// normalizeChecked is normalize, but fails if the client's rewriting removed
+// every recipient of the message.
+func (a *ApiClient) normalizeChecked(ctx context.Context, msg Message) (Message, error) {
+	normalized := a.normalize(ctx, msg)
+	if a.recipientsRemoved(msg, normalized) {
+		return normalized, errRecipientsRemoved
+	}
+	return normalized, nil
+}
+
+// rewriteEnvelope rewrites the envelope recipients of a prepared or raw
+// message like rewriteRecipients does the recipients of a message.
+func (a *ApiClient) rewriteEnvelope(rcpts []string) []string {
+	if a.rewriter != nil {
+		rcpts = a.rewriter(rcpts)
+	}
+	if a.redirectTo != "" {
+		return []string{a.redirectTo}
+	}
+	return rcpts
+}
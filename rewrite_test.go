@@ -0,0 +1,116 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/mail"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWithAddressRewriter(t *testing.T) {
+	toStaging := func(addrs []string) []string {
+		var out []string
+		for _, a := range addrs {
+			out = append(out, strings.Replace(a, "@example.com", "@staging.example.com", 1))
+		}
+		return out
+	}
+	client, rec := newRecordingClient(t, WithAddressRewriter(toStaging))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		Bcc:       []string{"bcc@example.com"},
+		PlainBody: "hello",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if want := []string{"to@staging.example.com", "bcc@staging.example.com"}; !reflect.DeepEqual(rec.reqs[0].To, want) {
+		t.Fatalf("expected rcpt_to %v, got %v", want, rec.reqs[0].To)
+	}
+	if msg.To[0] != "to@example.com" {
+		t.Fatal("the message was modified")
+	}
+}
+
+func TestWithRedirectAllTo(t *testing.T) {
+	client, rec := newRecordingClient(t, WithRedirectAllTo("inbox@test.example.com"))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		Cc:        []string{"cc@example.com"},
+		Bcc:       []string{"bcc@example.com"},
+		PlainBody: "hello",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if want := []string{"inbox@test.example.com"}; !reflect.DeepEqual(rec.reqs[0].To, want) {
+		t.Fatalf("expected rcpt_to %v, got %v", want, rec.reqs[0].To)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get("To"); got != "<inbox@test.example.com>" {
+		t.Fatalf("unexpected To header %q", got)
+	}
+	if got, want := m.Header.Get(HdrOriginalRecipients), "to@example.com, cc@example.com, bcc@example.com"; got != want {
+		t.Fatalf("expected %s %q, got %q", HdrOriginalRecipients, want, got)
+	}
+
+	prepared, err := client.PrepareMessage(msg)
+	if err != nil {
+		t.Fatalf("error preparing message: %v", err)
+	}
+	if _, err := prepared.SendTo(context.Background(), "other@example.com"); err != nil {
+		t.Fatalf("error sending prepared message: %v", err)
+	}
+	if want := []string{"inbox@test.example.com"}; !reflect.DeepEqual(rec.reqs[1].To, want) {
+		t.Fatalf("expected prepared rcpt_to %v, got %v", want, rec.reqs[1].To)
+	}
+}
+
+func TestRewriterRemovesEveryRecipient(t *testing.T) {
+	suppress := func(addrs []string) []string {
+		var out []string
+		for _, a := range addrs {
+			if !strings.HasPrefix(a, "bounced") {
+				out = append(out, a)
+			}
+		}
+		return out
+	}
+	msgs := map[string]Message{
+		"recipients": {From: "from@example.com", To: []string{"bounced@example.com"}, Cc: []string{"bounced2@example.com"}, PlainBody: "hello"},
+		// Without the check, the message would be sent to its To.
+		"envelope": {From: "from@example.com", To: []string{"list@example.com"}, EnvelopeTo: []string{"bounced@example.com"}, PlainBody: "hello"},
+	}
+
+	for name, msg := range msgs {
+		t.Run(name, func(t *testing.T) {
+			client, rec := newRecordingClient(t, WithAddressRewriter(suppress))
+			if _, err := client.SendMessage(msg); !errors.Is(err, ErrNoRecipients) || !errors.Is(err, ErrInvalidMessage) {
+				t.Fatalf("expected ErrNoRecipients, got %v", err)
+			}
+			if _, err := client.PrepareMessage(msg); !errors.Is(err, ErrNoRecipients) {
+				t.Fatalf("expected ErrNoRecipients preparing the message, got %v", err)
+			}
+
+			skipping, skipRec := newRecordingClient(t, WithAddressRewriter(suppress), WithSkipRemovedRecipients())
+			res, err := skipping.SendMessageFull(context.Background(), msg)
+			if err != nil || !res.Skipped {
+				t.Fatalf("expected the send to be skipped, got %+v, %v", res, err)
+			}
+			if len(rec.reqs)+len(skipRec.reqs) != 0 {
+				t.Fatalf("expected nothing to be sent, got %d requests", len(rec.reqs)+len(skipRec.reqs))
+			}
+		})
+	}
+}
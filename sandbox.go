@@ -0,0 +1,19 @@
+package postal
+
+import "errors"
+
+// ErrNoSandboxRecipient is returned when a sandbox message is sent by a
+// client without a sandbox recipient.
+var ErrNoSandboxRecipient = errors.New("postal: sandbox message sent without a sandbox recipient, see WithSandboxRecipient")
+
+// sandboxRecipients returns the envelope recipients of the message: rcpts,
+// or the client's sandbox recipient if it's a sandbox message.
+func (a *ApiClient) sandboxRecipients(msg Message, rcpts []string) ([]string, error) {
+	if !msg.Sandbox {
+		return rcpts, nil
+	}
+	if a.sandboxRcpt == "" {
+		return nil, withKind(ErrInvalidMessage, ErrNoSandboxRecipient)
+	}
+	return []string{a.sandboxRcpt}, nil
+}
@@ -0,0 +1,67 @@
+package postal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"testing"
+)
+
+var sandboxMsg = Message{
+	From:      "from@example.com",
+	To:        []string{"customer@example.com"},
+	Cc:        []string{"cc@example.com"},
+	PlainBody: "hello",
+	Sandbox:   true,
+}
+
+func TestSandboxRecipient(t *testing.T) {
+	client, rec := newRecordingClient(t, WithSandboxRecipient("sink@example.com"))
+
+	if _, err := client.SendMessage(sandboxMsg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if want := []string{"sink@example.com"}; !reflect.DeepEqual(rec.reqs[0].To, want) {
+		t.Fatalf("expected rcpt_to %v, got %v", want, rec.reqs[0].To)
+	}
+
+	// The headers are those of the real message.
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get("To"); got != "<customer@example.com>" {
+		t.Fatalf("unexpected To header %q", got)
+	}
+}
+
+func TestSandboxRecipientStructured(t *testing.T) {
+	var req structuredRequest
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		w.Write(successResponse("abc@postal", []string{"sink@example.com"}))
+	}, WithStructuredSend(), WithSandboxRecipient("sink@example.com"))
+
+	if _, err := client.SendMessage(sandboxMsg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if !reflect.DeepEqual(req.To, []string{"sink@example.com"}) || req.Cc != nil || req.Bcc != nil {
+		t.Fatalf("expected only the sandbox recipient, got to %v, cc %v, bcc %v", req.To, req.Cc, req.Bcc)
+	}
+}
+
+func TestSandboxWithoutRecipient(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	if _, err := client.SendMessage(sandboxMsg); !errors.Is(err, ErrNoSandboxRecipient) {
+		t.Fatalf("expected ErrNoSandboxRecipient, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatal("expected the message not to be sent")
+	}
+}
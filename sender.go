@@ -0,0 +1,151 @@
+package postal
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+)
+
+const HdrSender = "Sender"
+
+// ErrInvalidSender is returned when a message has more than one From address
+// and its Sender isn't a single address.
+var ErrInvalidSender = errors.New("postal: sender must be a single address")
+
+// SenderHeaderMode controls when a message's Sender header is written.
+type SenderHeaderMode int
+
+const (
+	// SenderHeaderAuto writes the Sender header only when RFC 5322 requires
+	// it, for messages with more than one From address, whose envelope
+	// sender is then the Sender. Otherwise the envelope sender is the From
+	// address, and the Sender field isn't used.
+	SenderHeaderAuto SenderHeaderMode = iota
+	// SenderHeaderAlways writes the message's Sender, if it has one, in the
+	// Sender header, and makes it the envelope sender.
+	SenderHeaderAlways
+	// SenderHeaderOmit never writes the Sender header, which some receivers
+	// penalize when it differs from From, and makes the message's Sender, if
+	// it has one, only the envelope sender. Messages with more than one From
+	// address can't omit it.
+	SenderHeaderOmit
+)
+
+// requiredSender returns the Sender header for a message with the given From
+// and Sender. RFC 5322 requires a Sender header when From has more than one
+// address, so unless sender is set, it's the first From address. It's empty
+// when From has a single address, and no Sender header is needed.
+func requiredSender(from, sender string) (string, error) {
+	addrs, err := mail.ParseAddressList(from)
+	if err != nil || len(addrs) < 2 {
+		return "", nil
+	}
+
+	if sender == "" {
+		return addrs[0].String(), nil
+	}
+	s, err := mail.ParseAddress(sender)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidSender, err)
+	}
+	return s.String(), nil
+}
+
+// SetFriendlyFrom sets the From of the message to envelopeAddr with the
+// given display name, such as "Jane via MyApp". The display name is only
+// shown in the From header, encoded as needed; the envelope sender is the
+// bare address.
+func (m *Message) SetFriendlyFrom(displayName, envelopeAddr string) error {
+	addr, err := mail.ParseAddress(envelopeAddr)
+	if err != nil {
+		return fmt.Errorf("error parsing from address: %v", err)
+	}
+	if addr.Name != "" {
+		return fmt.Errorf("from address %q must be a bare address", envelopeAddr)
+	}
+
+	addr.Name = displayName
+	m.From = addr.String()
+	return nil
+}
+
+// envelopeSender returns the envelope sender of the message: the address of
+// its From, or of its Sender if From has more than one address or the
+// message's SenderHeader isn't SenderHeaderAuto.
+func envelopeSender(msg Message) (string, error) {
+	if msg.SenderHeader != SenderHeaderAuto && msg.Sender != "" {
+		addr, err := mail.ParseAddress(msg.Sender)
+		if err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidSender, err)
+		}
+		return addr.Address, nil
+	}
+
+	sender, err := requiredSender(msg.From, msg.Sender)
+	if err != nil {
+		return "", err
+	}
+	if sender == "" {
+		if addr, err := mail.ParseAddress(msg.From); err == nil {
+			return addr.Address, nil
+		}
+		return msg.From, nil
+	}
+
+	addr, err := mail.ParseAddress(sender)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
+
+// withDefaults returns the message with the client's default From and Sender
+// for the ones it doesn't have, see WithDefaultFrom and WithDefaultSender,
+// and its default body if it only has attachments, see
+// WithAttachmentOnlyBody.
+func (a *ApiClient) withDefaults(msg Message) Message {
+	if strings.TrimSpace(msg.From) == "" {
+		msg.From = a.defaultFrom
+	}
+	if msg.Sender == "" {
+		msg.Sender = a.defaultSender
+	}
+	if msg.PlainBody == "" && msg.HTMLBody == "" && len(msg.attachments) > 0 {
+		msg.PlainBody = a.attachOnlyBody
+	}
+	return msg
+}
+
+// headerSender returns the Sender the MIME builder gets for the message, which
+// it writes in the Sender header if the From has more than one address.
+func headerSender(msg Message) string {
+	if msg.SenderHeader == SenderHeaderOmit {
+		return ""
+	}
+	return msg.Sender
+}
+
+// checkSenderHeader checks that the message's Sender header can be written
+// as its SenderHeader asks.
+func checkSenderHeader(m Message) error {
+	switch m.SenderHeader {
+	case SenderHeaderAuto:
+		return nil
+	case SenderHeaderAlways, SenderHeaderOmit:
+	default:
+		return fmt.Errorf("invalid sender header mode %d", m.SenderHeader)
+	}
+
+	if m.Sender != "" {
+		if _, err := mail.ParseAddress(m.Sender); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidSender, err)
+		}
+	}
+	if m.SenderHeader == SenderHeaderOmit {
+		if addrs, err := mail.ParseAddressList(m.From); err == nil && len(addrs) > 1 {
+			return fmt.Errorf("%w: a message with more than one From address needs a Sender header", ErrInvalidSender)
+		}
+	}
+	return nil
+}
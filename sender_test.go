@@ -0,0 +1,210 @@
+package postal
+
+import (
+	"bytes"
+	"errors"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestMultipleFromSender(t *testing.T) {
+	tests := []struct {
+		name         string
+		from, sender string
+		wantSender   string
+		wantEnvelope string
+	}{
+		{"single from", "from@example.com", "", "", "from@example.com"},
+		{"from with display name", "Jane via MyApp <notifications@myapp.com>", "", "", "notifications@myapp.com"},
+		{"multiple from", "Alice <a@example.com>, b@example.com", "", "\"Alice\" <a@example.com>", "a@example.com"},
+		{"multiple from with sender", "a@example.com, b@example.com", "Ops <ops@example.com>", "\"Ops\" <ops@example.com>", "ops@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, rec := newRecordingClient(t)
+			msg := Message{
+				From:      tt.from,
+				Sender:    tt.sender,
+				To:        []string{"to@example.com"},
+				PlainBody: "hello",
+			}
+			if _, err := client.SendMessage(msg); err != nil {
+				t.Fatalf("error sending message: %v", err)
+			}
+
+			m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+			if err != nil {
+				t.Fatalf("error parsing message: %v", err)
+			}
+			if got := m.Header.Get(HdrSender); got != tt.wantSender {
+				t.Fatalf("expected Sender %q, got %q", tt.wantSender, got)
+			}
+			if got := rec.reqs[0].From; got != tt.wantEnvelope {
+				t.Fatalf("expected mail_from %q, got %q", tt.wantEnvelope, got)
+			}
+			if from, err := m.Header.AddressList("From"); err != nil || len(from) == 0 {
+				t.Fatalf("unexpected From header %q: %v", m.Header.Get("From"), err)
+			}
+		})
+	}
+}
+
+func TestMultipleFromInvalidSender(t *testing.T) {
+	client, rec := newRecordingClient(t)
+	msg := Message{
+		From:      "a@example.com, b@example.com",
+		Sender:    "a@example.com, b@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrInvalidSender) {
+		t.Fatalf("expected ErrInvalidSender, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatal("expected the message not to be sent")
+	}
+}
+
+func TestSetFriendlyFrom(t *testing.T) {
+	msg := Message{
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	if err := msg.SetFriendlyFrom("José via MyApp", "notifications@myapp.com"); err != nil {
+		t.Fatalf("error setting from: %v", err)
+	}
+
+	client, rec := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if got := rec.reqs[0].From; got != "notifications@myapp.com" {
+		t.Fatalf("expected a bare envelope sender, got %q", got)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	raw := m.Header.Get("From")
+	if !strings.HasPrefix(raw, "=?utf-8?") {
+		t.Fatalf("expected an RFC 2047 encoded display name, got %q", raw)
+	}
+	from, err := m.Header.AddressList("From")
+	if err != nil || len(from) != 1 || from[0].Name != "José via MyApp" || from[0].Address != "notifications@myapp.com" {
+		t.Fatalf("unexpected From header %q: %v", raw, err)
+	}
+
+	for _, addr := range []string{"not an address", "Jane <jane@example.com>"} {
+		if err := msg.SetFriendlyFrom("Jane", addr); err == nil {
+			t.Fatalf("expected an error for %q", addr)
+		}
+	}
+}
+
+func TestWithDefaultFrom(t *testing.T) {
+	client, rec := newRecordingClient(t, WithDefaultFrom("App <app@example.com>"), WithDefaultSender("bounces@example.com"))
+
+	if _, err := client.SendMessage(Message{To: []string{"to@example.com"}, PlainBody: "hello"}); err != nil {
+		t.Fatalf("error sending message without a From: %v", err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if from := m.Header.Get("From"); from != `"App" <app@example.com>` {
+		t.Fatalf("expected the default From, got %q", from)
+	}
+
+	// The Sender is only needed for messages with more than one From.
+	if _, err := client.SendMessage(Message{From: "a@example.com, b@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	m, err = mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if sender := m.Header.Get(HdrSender); sender != "<bounces@example.com>" {
+		t.Fatalf("expected the default Sender, got %q", sender)
+	}
+
+	if _, err := client.SendMessage(Message{From: "other@example.com", Sender: "other-bounces@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	m, err = mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if from := m.Header.Get("From"); from != "<other@example.com>" {
+		t.Fatalf("expected the message's own From, got %q", from)
+	}
+
+	if _, err := NewAPIClient("http://localhost", "token", nil, WithDefaultFrom("not an address")); err == nil {
+		t.Fatal("expected an error for an invalid default From")
+	}
+}
+
+func TestSenderHeaderMode(t *testing.T) {
+	tests := []struct {
+		name         string
+		mode         SenderHeaderMode
+		from, sender string
+		wantSender   string
+		wantEnvelope string
+	}{
+		{"auto single from", SenderHeaderAuto, "from@example.com", "bounce@example.com", "", "from@example.com"},
+		{"always", SenderHeaderAlways, "from@example.com", "Ops <ops@example.com>", "\"Ops\" <ops@example.com>", "ops@example.com"},
+		{"always without sender", SenderHeaderAlways, "from@example.com", "", "", "from@example.com"},
+		{"always multiple from", SenderHeaderAlways, "a@example.com, b@example.com", "ops@example.com", "<ops@example.com>", "ops@example.com"},
+		{"omit", SenderHeaderOmit, "from@example.com", "bounce@example.com", "", "bounce@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, rec := newRecordingClient(t)
+			msg := Message{
+				From:         tt.from,
+				Sender:       tt.sender,
+				SenderHeader: tt.mode,
+				To:           []string{"to@example.com"},
+				PlainBody:    "hello",
+			}
+			if _, err := client.SendMessage(msg); err != nil {
+				t.Fatalf("error sending message: %v", err)
+			}
+
+			m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+			if err != nil {
+				t.Fatalf("error parsing message: %v", err)
+			}
+			if got := m.Header[HdrSender]; len(got) > 1 {
+				t.Fatalf("expected a single Sender header, got %q", got)
+			}
+			if got := m.Header.Get(HdrSender); got != tt.wantSender {
+				t.Fatalf("expected Sender %q, got %q", tt.wantSender, got)
+			}
+			if got := rec.reqs[0].From; got != tt.wantEnvelope {
+				t.Fatalf("expected mail_from %q, got %q", tt.wantEnvelope, got)
+			}
+		})
+	}
+}
+
+func TestSenderHeaderOmitMultipleFrom(t *testing.T) {
+	client, rec := newRecordingClient(t)
+	msg := Message{
+		From:         "a@example.com, b@example.com",
+		Sender:       "ops@example.com",
+		SenderHeader: SenderHeaderOmit,
+		To:           []string{"to@example.com"},
+		PlainBody:    "hello",
+	}
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrInvalidSender) {
+		t.Fatalf("expected ErrInvalidSender, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatal("expected the message not to be sent")
+	}
+}
@@ -0,0 +1,71 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"time"
+)
+
+// HdrDedupKey is the header holding the key of messages sent with
+// SendOnceWithin, so the key is kept with the message in postal.
+const HdrDedupKey = "X-Postal-Dedup-Key"
+
+// ErrNoSendLog is returned by SendOnceWithin when the client has no send log.
+var ErrNoSendLog = errors.New("postal: no send log, see WithSendLog")
+
+// SendLog records the sends made with SendOnceWithin by key. See WithSendLog.
+//
+// Postal's legacy API can't search messages by tag or header, so it can't be
+// asked whether a message with a key was already sent; the log has to be
+// kept elsewhere, such as in a database shared by every instance of the
+// application.
+type SendLog interface {
+	// Lookup returns the response of the last send with the key and when it
+	// was made. ok is false if there was none.
+	Lookup(ctx context.Context, key string) (resp Response, sentAt time.Time, ok bool, err error)
+	// Store records a send with the key.
+	Store(ctx context.Context, key string, resp Response, sentAt time.Time) error
+}
+
+// SendOnceWithin sends the message unless a message with the same key was
+// sent within window, according to the client's send log. If one was, it
+// returns that send's response and false without sending anything. The key
+// is sent in the X-Postal-Dedup-Key header.
+//
+// The log is checked and then updated, so two concurrent sends with the same
+// key can both go out unless the log serializes them.
+func (a *ApiClient) SendOnceWithin(ctx context.Context, msg Message, key string, window time.Duration) (Response, bool, error) {
+	if a.sendLog == nil {
+		return Response{}, false, ErrNoSendLog
+	}
+	if err := checkHeaderValue(HdrDedupKey, key); err != nil {
+		return Response{}, false, withKind(ErrInvalidMessage, err)
+	}
+
+	prev, sentAt, ok, err := a.sendLog.Lookup(ctx, key)
+	if err != nil {
+		return Response{}, false, fmt.Errorf("error looking up send %s: %w", key, err)
+	}
+	now := a.clock.Now()
+	if ok && now.Sub(sentAt) < window {
+		return prev, false, nil
+	}
+
+	hdr := make(textproto.MIMEHeader, len(msg.Headers)+1)
+	for k, v := range msg.Headers {
+		hdr[k] = v
+	}
+	hdr.Set(HdrDedupKey, key)
+	msg.Headers = hdr
+
+	resp, err := a.SendMessageContext(ctx, msg)
+	if err != nil {
+		return resp, false, err
+	}
+	if err := a.sendLog.Store(ctx, key, resp, now); err != nil {
+		return resp, true, fmt.Errorf("error recording send %s: %w", key, err)
+	}
+	return resp, true, nil
+}
@@ -0,0 +1,78 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/mail"
+	"testing"
+	"time"
+)
+
+// memorySendLog is a SendLog in memory.
+type memorySendLog map[string]struct {
+	resp   Response
+	sentAt time.Time
+}
+
+func (l memorySendLog) Lookup(_ context.Context, key string) (Response, time.Time, bool, error) {
+	e, ok := l[key]
+	return e.resp, e.sentAt, ok, nil
+}
+
+func (l memorySendLog) Store(_ context.Context, key string, resp Response, sentAt time.Time) error {
+	l[key] = struct {
+		resp   Response
+		sentAt time.Time
+	}{resp, sentAt}
+	return nil
+}
+
+func TestSendOnceWithin(t *testing.T) {
+	clock := newFakeClock()
+	client, rec := newRecordingClient(t, WithSendLog(memorySendLog{}), WithClock(clock))
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	ctx := context.Background()
+
+	first, sent, err := client.SendOnceWithin(ctx, msg, "welcome-42", time.Hour)
+	if err != nil || !sent {
+		t.Fatalf("expected the first send to be made, got %v, %v", sent, err)
+	}
+	m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if got := m.Header.Get(HdrDedupKey); got != "welcome-42" {
+		t.Fatalf("expected the dedup key header, got %q", got)
+	}
+	if msg.Headers != nil {
+		t.Fatal("expected the message's headers not to be modified")
+	}
+
+	clock.Advance(30 * time.Minute)
+	resp, sent, err := client.SendOnceWithin(ctx, msg, "welcome-42", time.Hour)
+	if err != nil || sent {
+		t.Fatalf("expected the second send to be skipped, got %v, %v", sent, err)
+	}
+	if resp.MessageID != first.MessageID {
+		t.Fatalf("expected the first send's response, got %+v", resp)
+	}
+	if len(rec.reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(rec.reqs))
+	}
+
+	clock.Advance(time.Hour)
+	if _, sent, err := client.SendOnceWithin(ctx, msg, "welcome-42", time.Hour); err != nil || !sent {
+		t.Fatalf("expected a send after the window, got %v, %v", sent, err)
+	}
+	if len(rec.reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(rec.reqs))
+	}
+}
+
+func TestSendOnceWithinNoLog(t *testing.T) {
+	client, _ := newRecordingClient(t)
+	if _, _, err := client.SendOnceWithin(context.Background(), Message{}, "key", time.Hour); !errors.Is(err, ErrNoSendLog) {
+		t.Fatalf("expected ErrNoSendLog, got %v", err)
+	}
+}
@@ -0,0 +1,423 @@
+package postal
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Defaults of an SMTPClient, see NewSMTPClient.
+const (
+	defaultSMTPMaxConns = 4
+	defaultSMTPTimeout  = 30 * time.Second
+)
+
+// ErrSMTPClientClosed is returned by the sends of an SMTPClient after it's
+// closed.
+var ErrSMTPClientClosed = errors.New("postal: smtp client closed")
+
+// SMTPClient is a Client which sends messages to postal's SMTP server instead
+// of its HTTP API, for when only the SMTP port can be reached. Messages are
+// built the same way as by an ApiClient, and sent over a pool of
+// connections, which Close releases.
+type SMTPClient struct {
+	addr string
+	host string
+	auth smtp.Auth
+	// tlsConfig is the configuration of STARTTLS, or of the connection with
+	// implicitTLS. Connections are in plain text if it's nil.
+	tlsConfig   *tls.Config
+	implicitTLS bool
+	hello       string
+	timeout     time.Duration
+	maxConns    int
+	buildOpts   []Option
+	// builder builds the messages the way an ApiClient with the same
+	// options would.
+	builder *ApiClient
+
+	// conns limits the number of connections in use.
+	conns  chan struct{}
+	mu     sync.Mutex
+	idle   []*smtpConn
+	closed bool
+	// sending are the sends in progress, which Close waits for.
+	sending sync.WaitGroup
+}
+
+// SMTPOption configures an SMTPClient.
+type SMTPOption func(*SMTPClient)
+
+// WithSMTPTLSConfig sets the TLS configuration of the client's connections,
+// which by default is one verifying the server's certificate for its host.
+func WithSMTPTLSConfig(cfg *tls.Config) SMTPOption {
+	return func(c *SMTPClient) {
+		c.tlsConfig = cfg
+	}
+}
+
+// WithSMTPImplicitTLS makes the client connect with TLS from the start, as
+// on port 465, rather than upgrade the connection with STARTTLS. It's the
+// default on port 465.
+func WithSMTPImplicitTLS() SMTPOption {
+	return func(c *SMTPClient) {
+		c.implicitTLS = true
+	}
+}
+
+// WithSMTPPlainText makes the client send messages, and its credentials,
+// unencrypted, for a server without TLS on a trusted network. Go's PLAIN
+// authentication still refuses to send credentials unencrypted to a host
+// other than localhost.
+func WithSMTPPlainText() SMTPOption {
+	return func(c *SMTPClient) {
+		c.tlsConfig = nil
+		c.implicitTLS = false
+	}
+}
+
+// WithSMTPMaxConns sets the maximum number of connections the client opens
+// at the same time, 4 by default. Sends wait for a connection beyond it.
+func WithSMTPMaxConns(n int) SMTPOption {
+	return func(c *SMTPClient) {
+		c.maxConns = n
+	}
+}
+
+// WithSMTPTimeout sets the timeout of opening a connection and of each send
+// over it, 30 seconds by default.
+func WithSMTPTimeout(d time.Duration) SMTPOption {
+	return func(c *SMTPClient) {
+		c.timeout = d
+	}
+}
+
+// WithSMTPHello sets the host name the client introduces itself with in its
+// EHLO command, which is "localhost" by default.
+func WithSMTPHello(name string) SMTPOption {
+	return func(c *SMTPClient) {
+		c.hello = name
+	}
+}
+
+// WithSMTPMessageOptions sets the options messages are built with, as for
+// NewAPIClient; options about sending have no effect.
+func WithSMTPMessageOptions(opts ...Option) SMTPOption {
+	return func(c *SMTPClient) {
+		c.buildOpts = append(c.buildOpts, opts...)
+	}
+}
+
+// NewSMTPClient returns an SMTPClient sending to the SMTP server at host and
+// port, and authenticating with PLAIN authentication if username isn't
+// empty. For postal, the username is any string and the password an SMTP
+// credential of the mail server. Connections are upgraded with STARTTLS,
+// except on port 465, where they use TLS from the start, and are opened when
+// messages are sent.
+func NewSMTPClient(host string, port int, username, password string, opts ...SMTPOption) (*SMTPClient, error) {
+	if host == "" || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("invalid smtp server %s:%d", host, port)
+	}
+
+	c := &SMTPClient{
+		addr:        net.JoinHostPort(host, strconv.Itoa(port)),
+		host:        host,
+		tlsConfig:   &tls.Config{ServerName: host},
+		implicitTLS: port == 465,
+		timeout:     defaultSMTPTimeout,
+		maxConns:    defaultSMTPMaxConns,
+	}
+	if username != "" {
+		c.auth = smtp.PlainAuth("", username, password, host)
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.maxConns <= 0 {
+		return nil, fmt.Errorf("invalid maximum number of smtp connections: %d", c.maxConns)
+	}
+	if c.implicitTLS && c.tlsConfig == nil {
+		c.tlsConfig = &tls.Config{ServerName: host}
+	}
+
+	builder, err := NewAPIClient("", "", nil, c.buildOpts...)
+	if err != nil {
+		return nil, err
+	}
+	c.builder = builder
+	c.conns = make(chan struct{}, c.maxConns)
+	return c, nil
+}
+
+// SendMessage builds the message and sends it over SMTP to its envelope
+// recipients, with its envelope sender, as SendMessage of an ApiClient does.
+//
+// An SMTP server doesn't return postal's IDs for the message, so the
+// response only has its RFCMessageID: MessageID is empty and Messages is
+// nil. Use the Message-ID to find the message in postal.
+//
+// Errors of the SMTP server wrap its *textproto.Error, with the reply's
+// code, and are of the same kinds as the errors of postal's API: 421 is
+// ErrServerUnavailable, 530 and 535 are ErrUnauthorized, other 4xx replies
+// are ErrServer and other 5xx replies are ErrInvalidMessage. Other failures
+// of the connection are ErrNetwork.
+//
+// As with an ApiClient, a message whose recipients were all removed by the
+// client's address rewriter fails with ErrNoRecipients, or is skipped with
+// WithSkipRemovedRecipients.
+func (c *SMTPClient) SendMessage(msg Message) (Response, error) {
+	msg, err := c.builder.normalizeChecked(context.Background(), msg)
+	if err != nil {
+		if c.builder.skipRemoved {
+			c.builder.logf(context.Background(), "postal: skipped message %q: %v", msg.Subject, err)
+			return Response{}, nil
+		}
+		return Response{}, err
+	}
+	raw, id, err := c.builder.buildMIME(msg)
+	if err != nil {
+		return Response{}, err
+	}
+	rcpts, err := envelopeRecipients(msg)
+	if err != nil {
+		return Response{}, withKind(ErrInvalidMessage, err)
+	}
+	if rcpts, err = c.builder.sandboxRecipients(msg, rcpts); err != nil {
+		return Response{}, err
+	}
+	from, err := envelopeSender(msg)
+	if err != nil {
+		return Response{}, withKind(ErrInvalidMessage, err)
+	}
+
+	if err := c.send(from, rcpts, raw); err != nil {
+		return Response{}, err
+	}
+	return Response{RFCMessageID: id}, nil
+}
+
+// GetMessageDetails fails with ErrNotSupported, as postal's SMTP server
+// doesn't return its message IDs, nor has a way to look up messages. Look
+// them up with an ApiClient with the server's API key instead.
+func (c *SMTPClient) GetMessageDetails(id int64) (MessageDetails, error) {
+	return MessageDetails{}, fmt.Errorf("%w: smtp client can't look up message %d", ErrNotSupported, id)
+}
+
+// Close waits for the sends in progress to finish, and closes the client's
+// connections. Sends after Close fail with ErrSMTPClientClosed.
+func (c *SMTPClient) Close() error {
+	c.mu.Lock()
+	idle := c.idle
+	c.idle = nil
+	c.closed = true
+	c.mu.Unlock()
+
+	for _, conn := range idle {
+		conn.quit(c.timeout)
+	}
+	// The connections of the sends in progress are closed once they're
+	// released.
+	c.sending.Wait()
+	return nil
+}
+
+// smtpConn is a connection of an SMTPClient.
+type smtpConn struct {
+	nc     net.Conn
+	client *smtp.Client
+}
+
+// quit ends the session, and closes the connection.
+func (s *smtpConn) quit(timeout time.Duration) {
+	_ = s.nc.SetDeadline(time.Now().Add(timeout))
+	if err := s.client.Quit(); err != nil {
+		s.client.Close()
+	}
+}
+
+// send sends the message to the recipients over one of the client's
+// connections. A send which fails on an idle connection, which the server
+// may have closed, is tried again on a new one.
+func (c *SMTPClient) send(from string, rcpts []string, raw []byte) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrSMTPClientClosed
+	}
+	c.sending.Add(1)
+	c.mu.Unlock()
+	defer c.sending.Done()
+
+	c.conns <- struct{}{}
+	defer func() { <-c.conns }()
+
+	conn, reused, err := c.conn()
+	for {
+		if err != nil {
+			return smtpError(err)
+		}
+		err = conn.send(from, rcpts, raw, c.timeout)
+		c.release(conn, err)
+
+		var reply *textproto.Error
+		if err == nil || !reused || errors.As(err, &reply) {
+			return smtpError(err)
+		}
+		conn, err = c.dial()
+		reused = false
+	}
+}
+
+// conn returns an idle connection of the client, or else a new one, and
+// whether it's an idle one.
+func (c *SMTPClient) conn() (*smtpConn, bool, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, false, ErrSMTPClientClosed
+	}
+	if n := len(c.idle); n > 0 {
+		conn := c.idle[n-1]
+		c.idle = c.idle[:n-1]
+		c.mu.Unlock()
+		return conn, true, nil
+	}
+	c.mu.Unlock()
+
+	conn, err := c.dial()
+	return conn, false, err
+}
+
+// release puts the connection back in the pool after a send which failed
+// with err, unless the connection failed with it.
+func (c *SMTPClient) release(conn *smtpConn, err error) {
+	var reply *textproto.Error
+	switch {
+	case err == nil:
+	case errors.As(err, &reply):
+		// The server rejected the message: the connection can be used
+		// again once the transaction is aborted.
+		if conn.client.Reset() != nil {
+			conn.client.Close()
+			return
+		}
+	default:
+		conn.client.Close()
+		return
+	}
+
+	c.mu.Lock()
+	if !c.closed {
+		c.idle = append(c.idle, conn)
+		conn = nil
+	}
+	c.mu.Unlock()
+	if conn != nil {
+		conn.quit(c.timeout)
+	}
+}
+
+// dial opens a new connection to the server, ready to send.
+func (c *SMTPClient) dial() (*smtpConn, error) {
+	d := net.Dialer{Timeout: c.timeout}
+	var (
+		nc  net.Conn
+		err error
+	)
+	if c.implicitTLS {
+		nc, err = tls.DialWithDialer(&d, "tcp", c.addr, c.tlsConfig)
+	} else {
+		nc, err = d.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = nc.SetDeadline(time.Now().Add(c.timeout))
+
+	client, err := smtp.NewClient(nc, c.host)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	if err := c.setup(client); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return &smtpConn{nc: nc, client: client}, nil
+}
+
+// setup greets the server, upgrades the connection with STARTTLS and
+// authenticates, as configured.
+func (c *SMTPClient) setup(client *smtp.Client) error {
+	if c.hello != "" {
+		if err := client.Hello(c.hello); err != nil {
+			return err
+		}
+	}
+	if c.tlsConfig != nil && !c.implicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("smtp server %s doesn't support STARTTLS", c.addr)
+		}
+		if err := client.StartTLS(c.tlsConfig); err != nil {
+			return err
+		}
+	}
+	if c.auth != nil {
+		if err := client.Auth(c.auth); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send sends the message in a single transaction.
+func (s *smtpConn) send(from string, rcpts []string, raw []byte, timeout time.Duration) error {
+	_ = s.nc.SetDeadline(time.Now().Add(timeout))
+	if err := s.client.Mail(from); err != nil {
+		return err
+	}
+	for _, r := range rcpts {
+		if err := s.client.Rcpt(r); err != nil {
+			return err
+		}
+	}
+	w, err := s.client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(raw); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+// smtpError returns err, from a send over SMTP, marked with its kind.
+func smtpError(err error) error {
+	if err == nil || errors.Is(err, ErrSMTPClientClosed) {
+		return err
+	}
+	err = fmt.Errorf("error sending message over smtp: %w", err)
+
+	var reply *textproto.Error
+	if !errors.As(err, &reply) {
+		return withKind(ErrNetwork, err)
+	}
+	switch {
+	case reply.Code == 421:
+		return withKind(ErrServerUnavailable, err)
+	case reply.Code == 530 || reply.Code == 535:
+		return withKind(ErrUnauthorized, err)
+	case reply.Code >= 500:
+		return withKind(ErrInvalidMessage, err)
+	default:
+		return withKind(ErrServer, err)
+	}
+}
@@ -0,0 +1,327 @@
+package postal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// SMTPClient must satisfy Client.
+var _ Client = (*SMTPClient)(nil)
+
+// smtpEnvelope is a message received by an smtpServer.
+type smtpEnvelope struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// smtpServer is a minimal SMTP server for testing SMTPClient, with PLAIN
+// authentication and without STARTTLS.
+type smtpServer struct {
+	ln       net.Listener
+	password string
+	// reject is a recipient the server rejects.
+	reject string
+	// hangUp makes the server close connections after each message.
+	hangUp bool
+	// hold, if set, holds the reply to each message until it's closed.
+	hold chan struct{}
+
+	mu    sync.Mutex
+	conns int
+	msgs  []smtpEnvelope
+}
+
+func newSMTPServer(t *testing.T, password string) *smtpServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	s := &smtpServer{ln: ln, password: password}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.conns++
+			s.mu.Unlock()
+			go s.serve(nc)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) messages() []smtpEnvelope {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]smtpEnvelope(nil), s.msgs...)
+}
+
+func (s *smtpServer) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func (s *smtpServer) serve(nc net.Conn) {
+	conn := textproto.NewConn(nc)
+	defer conn.Close()
+
+	var env smtpEnvelope
+	conn.PrintfLine("220 localhost ready")
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(cmd) {
+		case "EHLO", "HELO":
+			conn.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+		case "AUTH":
+			creds, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+			if parts := strings.Split(string(creds), "\x00"); len(parts) == 3 && parts[2] == s.password {
+				conn.PrintfLine("235 authenticated")
+			} else {
+				conn.PrintfLine("535 invalid credentials")
+			}
+		case "MAIL":
+			if env.From != "" {
+				conn.PrintfLine("503 nested MAIL command")
+				continue
+			}
+			env.From = strings.Trim(strings.TrimPrefix(arg, "FROM:"), "<>")
+			conn.PrintfLine("250 ok")
+		case "RCPT":
+			to := strings.Trim(strings.TrimPrefix(arg, "TO:"), "<>")
+			if to == s.reject {
+				conn.PrintfLine("550 no such recipient")
+				continue
+			}
+			env.To = append(env.To, to)
+			conn.PrintfLine("250 ok")
+		case "DATA":
+			conn.PrintfLine("354 go ahead")
+			if env.Data, err = conn.ReadDotBytes(); err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.msgs = append(s.msgs, env)
+			s.mu.Unlock()
+			env = smtpEnvelope{}
+			if s.hold != nil {
+				<-s.hold
+			}
+			conn.PrintfLine("250 queued")
+			if s.hangUp {
+				return
+			}
+		case "RSET":
+			env = smtpEnvelope{}
+			conn.PrintfLine("250 ok")
+		case "QUIT":
+			conn.PrintfLine("221 bye")
+			return
+		default:
+			conn.PrintfLine("502 unknown command")
+		}
+	}
+}
+
+func newSMTPTestClient(t *testing.T, s *smtpServer, password string, opts ...SMTPOption) *SMTPClient {
+	t.Helper()
+
+	client, err := NewSMTPClient("127.0.0.1", s.port(), "postal", password, append([]SMTPOption{WithSMTPPlainText()}, opts...)...)
+	if err != nil {
+		t.Fatalf("error creating smtp client: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestSMTPClient(t *testing.T) {
+	srv := newSMTPServer(t, "secret")
+	client := newSMTPTestClient(t, srv, "secret", WithSMTPMessageOptions(WithSource("billing")))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		Bcc:       []string{"bcc@example.com"},
+		Subject:   "hello",
+		PlainBody: "hello\r\n.\r\n",
+	}
+	resp, err := client.SendMessage(msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if resp.RFCMessageID == "" || resp.MessageID != "" || resp.Messages != nil {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+
+	msgs := srv.messages()
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %d", len(msgs))
+	}
+	if srv.connections() != 1 {
+		t.Fatalf("expected the connection to be reused, got %d connections", srv.connections())
+	}
+	if msgs[0].From != "from@example.com" || !reflect.DeepEqual(msgs[0].To, []string{"to@example.com", "bcc@example.com"}) {
+		t.Fatalf("unexpected envelope: %s to %v", msgs[0].From, msgs[0].To)
+	}
+
+	m, err := mail.ReadMessage(bytes.NewReader(msgs[0].Data))
+	if err != nil {
+		t.Fatalf("error parsing message: %v", err)
+	}
+	if m.Header.Get("Message-ID") != resp.RFCMessageID || m.Header.Get(HdrPostalSource) != "billing" || m.Header.Get("Bcc") != "" {
+		t.Fatalf("unexpected headers: %v", m.Header)
+	}
+	// ReadDotBytes undoes the dot stuffing, and turns CRLF into LF.
+	if !bytes.HasSuffix(msgs[0].Data, []byte("\n\nhello\n.\n")) {
+		t.Fatalf("expected the body's dot line to survive:\n%s", msgs[0].Data)
+	}
+
+	if _, err := client.SendMessage(Message{}); err == nil {
+		t.Fatal("expected an error for an invalid message")
+	}
+	if len(srv.messages()) != 2 {
+		t.Fatal("expected the invalid message not to be sent")
+	}
+}
+
+func TestSMTPClientErrors(t *testing.T) {
+	srv := newSMTPServer(t, "secret")
+	srv.reject = "nobody@example.com"
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+
+	_, err := newSMTPTestClient(t, srv, "wrong").SendMessage(msg)
+	var reply *textproto.Error
+	if !errors.Is(err, ErrUnauthorized) || !errors.As(err, &reply) || reply.Code != 535 {
+		t.Fatalf("expected ErrUnauthorized with the 535 reply, got %v", err)
+	}
+
+	client := newSMTPTestClient(t, srv, "secret")
+	rejected := msg
+	rejected.To = []string{"nobody@example.com"}
+	if _, err := client.SendMessage(rejected); !errors.Is(err, ErrInvalidMessage) || !errors.As(err, &reply) || reply.Code != 550 {
+		t.Fatalf("expected ErrInvalidMessage with the 550 reply, got %v", err)
+	}
+	// The rejected transaction was aborted, so the connection can be used
+	// again.
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message after a rejection: %v", err)
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("error closing client: %v", err)
+	}
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrSMTPClientClosed) {
+		t.Fatalf("expected ErrSMTPClientClosed, got %v", err)
+	}
+
+	srv.ln.Close()
+	closed, err := NewSMTPClient("127.0.0.1", srv.port(), "", "", WithSMTPPlainText())
+	if err != nil {
+		t.Fatalf("error creating smtp client: %v", err)
+	}
+	if _, err := closed.SendMessage(msg); !errors.Is(err, ErrNetwork) {
+		t.Fatalf("expected ErrNetwork, got %v", err)
+	}
+}
+
+func TestSMTPClientRemovedRecipients(t *testing.T) {
+	srv := newSMTPServer(t, "secret")
+	suppress := func([]string) []string { return nil }
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+
+	client := newSMTPTestClient(t, srv, "secret", WithSMTPMessageOptions(WithAddressRewriter(suppress)))
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrNoRecipients) || !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrNoRecipients, got %v", err)
+	}
+
+	skipping := newSMTPTestClient(t, srv, "secret", WithSMTPMessageOptions(WithAddressRewriter(suppress), WithSkipRemovedRecipients()))
+	if _, err := skipping.SendMessage(msg); err != nil {
+		t.Fatalf("expected the message to be skipped, got %v", err)
+	}
+	if n := srv.connections(); n != 0 {
+		t.Fatalf("expected nothing to be sent, got %d connections", n)
+	}
+}
+
+func TestSMTPClientCloseWaits(t *testing.T) {
+	srv := newSMTPServer(t, "secret")
+	srv.hold = make(chan struct{})
+	client := newSMTPTestClient(t, srv, "secret")
+
+	sent := make(chan error, 1)
+	go func() {
+		_, err := client.SendMessage(Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"})
+		sent <- err
+	}()
+	for len(srv.messages()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		client.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("expected Close to wait for the send in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(srv.hold)
+	if err := <-sent; err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	<-closed
+}
+
+func TestSMTPClientReconnects(t *testing.T) {
+	srv := newSMTPServer(t, "secret")
+	srv.hangUp = true
+	client := newSMTPTestClient(t, srv, "secret")
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	for i := 0; i < 2; i++ {
+		if _, err := client.SendMessage(msg); err != nil {
+			t.Fatalf("error sending message %d: %v", i, err)
+		}
+	}
+	if len(srv.messages()) != 2 || srv.connections() != 2 {
+		t.Fatalf("expected 2 messages over 2 connections, got %d over %d", len(srv.messages()), srv.connections())
+	}
+}
+
+func TestNewSMTPClientInvalid(t *testing.T) {
+	if _, err := NewSMTPClient("", 25, "", ""); err == nil {
+		t.Fatal("expected an error without a host")
+	}
+	if _, err := NewSMTPClient("smtp.example.com", 25, "", "", WithSMTPMaxConns(0)); err == nil {
+		t.Fatal("expected an error without connections")
+	}
+}
@@ -0,0 +1,96 @@
+package postal
+
+import "sync"
+
+// Stats are counters of a client's sends and requests since it was created,
+// see ApiClient.Stats.
+type Stats struct {
+	// Sent is the number of messages postal accepted, Failed the number of
+	// sends which failed, including those of invalid messages which weren't
+	// sent to postal, and Skipped the number of sends skipped because every
+	// recipient was removed, see WithSkipRemovedRecipients. A send which
+	// partially succeeded is failed.
+	Sent    int64
+	Failed  int64
+	Skipped int64
+
+	// Requests is the number of requests made to postal, including every
+	// attempt of retried requests and requests which don't send messages,
+	// and RequestBytes the size of their JSON bodies.
+	Requests     int64
+	RequestBytes int64
+	// Statuses counts the requests by the HTTP status of their responses.
+	// Requests which got no response, such as those which failed to
+	// connect, aren't counted.
+	Statuses map[int]int64
+}
+
+// clientStats holds the counters of a client. Its methods do nothing on a
+// nil clientStats, as for clients which only build messages.
+type clientStats struct {
+	mu    sync.Mutex
+	stats Stats
+}
+
+func newClientStats() *clientStats {
+	return &clientStats{stats: Stats{Statuses: make(map[int]int64)}}
+}
+
+// recordSend counts a send which ended with err.
+func (s *clientStats) recordSend(skipped bool, err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case err != nil:
+		s.stats.Failed++
+	case skipped:
+		s.stats.Skipped++
+	default:
+		s.stats.Sent++
+	}
+}
+
+// recordRequest counts a request with a body of the given size.
+func (s *clientStats) recordRequest(size int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Requests++
+	s.stats.RequestBytes += int64(size)
+}
+
+// recordStatus counts a response with the status.
+func (s *clientStats) recordStatus(status int) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.stats.Statuses[status]++
+}
+
+// Stats returns a snapshot of the client's counters of sends and requests,
+// for quick numbers without a metrics backend. It's safe to call while
+// messages are sent.
+func (a *ApiClient) Stats() Stats {
+	if a.stats == nil {
+		return Stats{Statuses: map[int]int64{}}
+	}
+	a.stats.mu.Lock()
+	defer a.stats.mu.Unlock()
+
+	s := a.stats.stats
+	s.Statuses = make(map[int]int64, len(a.stats.stats.Statuses))
+	for k, v := range a.stats.stats.Statuses {
+		s.Statuses[k] = v
+	}
+	return s
+}
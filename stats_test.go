@@ -0,0 +1,78 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		size int64
+	)
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		var req request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		if req.To[0] == "fail@example.com" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(successResponse("abc@postal", req.To))
+	})
+	if s := client.Stats(); s.Sent != 0 || s.Requests != 0 || s.Statuses == nil {
+		t.Fatalf("expected no stats, got %+v", s)
+	}
+
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := client.SendMessageFull(context.Background(), msg)
+			if err != nil {
+				t.Errorf("error sending message: %v", err)
+			}
+			mu.Lock()
+			size += int64(res.RequestSize)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	fail := msg
+	fail.To = []string{"fail@example.com"}
+	if _, err := client.SendMessageFull(context.Background(), fail); err == nil {
+		t.Fatal("expected the send to fail")
+	}
+	if _, err := client.SendMessage(Message{From: "from@example.com", PlainBody: "hello"}); err == nil {
+		t.Fatal("expected the message without recipients to fail")
+	}
+	if _, err := client.SendRaw(context.Background(), "from@example.com", msg.To, bytes.NewReader([]byte("Subject: hi\r\n\r\nhi\r\n"))); err != nil {
+		t.Fatalf("error sending raw message: %v", err)
+	}
+
+	s := client.Stats()
+	if s.Sent != 11 || s.Failed != 2 || s.Skipped != 0 {
+		t.Fatalf("expected 11 sent and 2 failed, got %+v", s)
+	}
+	if s.Requests != 12 || s.Statuses[http.StatusOK] != 11 || s.Statuses[http.StatusServiceUnavailable] != 1 {
+		t.Fatalf("unexpected requests: %+v", s)
+	}
+	// The failed request and the raw message count too.
+	if s.RequestBytes <= size {
+		t.Fatalf("expected the bytes of every request, got %d", s.RequestBytes)
+	}
+
+	// The snapshot is a copy.
+	s.Statuses[http.StatusOK] = 0
+	if client.Stats().Statuses[http.StatusOK] != 11 {
+		t.Fatal("expected changes to a snapshot not to change the client's stats")
+	}
+}
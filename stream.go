@@ -0,0 +1,175 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// defaultSendConcurrency is the number of messages SendStream sends at once
+// unless set with WithSendConcurrency.
+const defaultSendConcurrency = 4
+
+// ErrNotAttempted is the error of messages in a stream or batch which weren't
+// sent because it stopped before they were.
+var ErrNotAttempted = errors.New("postal: message not sent, the batch stopped before it")
+
+// SendResult is the result of sending one of many messages.
+type SendResult struct {
+	// Index is the position of the message in the order it was given.
+	Index    int
+	Message  Message
+	Response Response
+	Err      error
+}
+
+// BatchCounts counts the results of a batch by outcome, see CountResults.
+type BatchCounts struct {
+	// Sent is the number of messages postal accepted.
+	Sent int
+	// Failed is the number of messages whose send failed.
+	Failed int
+	// Canceled is the number of messages whose send was in flight when the
+	// batch's context was done. Postal may have accepted some of them.
+	Canceled int
+	// NotAttempted is the number of messages which weren't sent because the
+	// batch stopped before them.
+	NotAttempted int
+}
+
+// CountResults counts the results of a batch or stream by outcome, such as
+// to report how much of a batch was sent before it was canceled.
+func CountResults(results []SendResult) BatchCounts {
+	var c BatchCounts
+	for _, res := range results {
+		switch {
+		case res.Err == nil:
+			c.Sent++
+		case errors.Is(res.Err, ErrNotAttempted):
+			c.NotAttempted++
+		case errors.Is(res.Err, context.Canceled) || errors.Is(res.Err, context.DeadlineExceeded):
+			c.Canceled++
+		default:
+			c.Failed++
+		}
+	}
+	return c
+}
+
+// SendStream sends the messages written to the returned input channel and
+// delivers their results on the returned output channel. Up to the client's
+// send concurrency messages are sent at once, see WithSendConcurrency, so
+// results may arrive out of order; use SendResult.Index to match them up.
+//
+// The output channel must be read from while messages are written, or the
+// stream blocks. Closing the input channel makes the stream finish sending
+// the remaining messages and then close the output channel. Sends are bound
+// to ctx, so once it's done the remaining messages aren't sent and fail with
+// ErrNotAttempted, which wraps the context's error.
+func (a *ApiClient) SendStream(ctx context.Context) (chan<- Message, <-chan SendResult) {
+	return a.sendStream(ctx, time.Time{})
+}
+
+// SendBatch sends the messages like SendStream and returns their results in
+// the order of msgs.
+//
+// No send is started after stopAt, unless it's zero, which bounds the time
+// the batch takes: sends already in flight are allowed to finish, within
+// ctx, and the remaining messages fail with ErrNotAttempted. Canceling ctx
+// stops the batch promptly: the sends in flight are canceled and the
+// remaining messages fail with ErrNotAttempted. Use CountResults to count
+// how many were sent.
+func (a *ApiClient) SendBatch(ctx context.Context, msgs []Message, stopAt time.Time) []SendResult {
+	in, out := a.sendStream(ctx, stopAt)
+	go func() {
+		defer close(in)
+		for _, msg := range msgs {
+			in <- msg
+		}
+	}()
+
+	results := make([]SendResult, len(msgs))
+	for res := range out {
+		results[res.Index] = res
+	}
+	return results
+}
+
+// SendAsync sends the message in the background and returns a channel which
+// delivers its result once it's sent. The channel is buffered, so the
+// result doesn't need to be read. The send is bound to ctx and counts
+// against the client's rate limit like any other. Use Flush to wait for
+// the sends in flight.
+func (a *ApiClient) SendAsync(ctx context.Context, msg Message) <-chan SendResult {
+	out := make(chan SendResult, 1)
+	e := a.async.add("")
+	go func() {
+		res := SendResult{Message: msg}
+		res.Response, res.Err = a.SendMessageContext(ctx, msg)
+		a.async.finish(e, res.Err)
+		out <- res
+		close(out)
+	}()
+	return out
+}
+
+// Flush waits for the sends started with SendAsync which are in flight when
+// it's called, such as to make sure a notification was sent before
+// responding to a request, or for ctx to be done, in which case it returns
+// an error wrapping the context's. It returns a *FlushError of the sends
+// which failed.
+func (a *ApiClient) Flush(ctx context.Context) error {
+	return a.async.wait(ctx)
+}
+
+// sendStream is SendStream, starting no sends after stopAt if it isn't
+// zero.
+func (a *ApiClient) sendStream(ctx context.Context, stopAt time.Time) (chan<- Message, <-chan SendResult) {
+	var (
+		in   = make(chan Message)
+		out  = make(chan SendResult)
+		jobs = make(chan SendResult)
+	)
+
+	go func() {
+		defer close(jobs)
+
+		i := 0
+		for msg := range in {
+			jobs <- SendResult{Index: i, Message: msg}
+			i++
+		}
+	}()
+
+	n := a.sendConcurrency
+	if n < 1 {
+		n = defaultSendConcurrency
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				switch {
+				case ctx.Err() != nil:
+					job.Err = withKind(ErrNotAttempted, ctx.Err())
+				case !stopAt.IsZero() && !a.clock.Now().Before(stopAt):
+					job.Err = ErrNotAttempted
+				default:
+					job.Response, job.Err = a.SendMessageContext(ctx, job.Message)
+				}
+				out <- job
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return in, out
+}
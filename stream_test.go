@@ -0,0 +1,211 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendStream(t *testing.T) {
+	var inFlight, maxInFlight int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			m := atomic.LoadInt32(&maxInFlight)
+			if n <= m || atomic.CompareAndSwapInt32(&maxInFlight, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithSendConcurrency(2))
+
+	const count = 10
+	in, out := client.SendStream(context.Background())
+	go func() {
+		defer close(in)
+		for i := 0; i < count; i++ {
+			in <- Message{
+				From:      "from@example.com",
+				To:        []string{"to@example.com"},
+				Subject:   fmt.Sprintf("message %d", i),
+				PlainBody: "hello",
+			}
+		}
+	}()
+
+	seen := make(map[int]bool)
+	for res := range out {
+		if res.Err != nil {
+			t.Fatalf("error sending message %d: %v", res.Index, res.Err)
+		}
+		if want := fmt.Sprintf("message %d", res.Index); res.Message.Subject != want {
+			t.Fatalf("result %d is for %q", res.Index, res.Message.Subject)
+		}
+		seen[res.Index] = true
+	}
+
+	if len(seen) != count {
+		t.Fatalf("expected %d results, got %d", count, len(seen))
+	}
+	if got := atomic.LoadInt32(&maxInFlight); got > 2 {
+		t.Fatalf("expected at most 2 sends at once, got %d", got)
+	}
+}
+
+func TestSendStreamEmpty(t *testing.T) {
+	client, _ := newRecordingClient(t)
+
+	in, out := client.SendStream(context.Background())
+	close(in)
+	if _, ok := <-out; ok {
+		t.Fatal("expected no results")
+	}
+}
+
+func TestSendBatchStopAt(t *testing.T) {
+	clock := newFakeClock()
+	var calls int32
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		// The batch runs out of time while the first message is sent.
+		clock.Advance(time.Minute)
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithClock(clock), WithSendConcurrency(1))
+
+	msgs := []Message{retryMsg, retryMsg, retryMsg}
+	results := client.SendBatch(context.Background(), msgs, clock.Now().Add(time.Second))
+
+	if len(results) != len(msgs) {
+		t.Fatalf("expected %d results, got %d", len(msgs), len(results))
+	}
+	if results[0].Err != nil {
+		t.Fatalf("unexpected error for the first message: %v", results[0].Err)
+	}
+	for _, res := range results[1:] {
+		if !errors.Is(res.Err, ErrNotAttempted) {
+			t.Fatalf("expected ErrNotAttempted for message %d, got %v", res.Index, res.Err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected 1 request, got %d", got)
+	}
+}
+
+func TestSendStreamContextDone(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, res := range client.SendBatch(ctx, []Message{retryMsg, retryMsg}, time.Time{}) {
+		if !errors.Is(res.Err, ErrNotAttempted) || !errors.Is(res.Err, context.Canceled) {
+			t.Fatalf("expected ErrNotAttempted wrapping context.Canceled, got %v", res.Err)
+		}
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatal("expected nothing to be sent")
+	}
+}
+
+func TestSendAsync(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	// Start the sends, do other work, and check the results later.
+	pending := []<-chan SendResult{
+		client.SendAsync(context.Background(), retryMsg),
+		client.SendAsync(context.Background(), retryMsg),
+	}
+	for _, ch := range pending {
+		res := <-ch
+		if res.Err != nil {
+			t.Fatalf("error sending message: %v", res.Err)
+		}
+		if res.Response.MessageID == "" {
+			t.Fatalf("unexpected response: %+v", res.Response)
+		}
+	}
+	if len(rec.reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(rec.reqs))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res := <-client.SendAsync(ctx, retryMsg); !errors.Is(res.Err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", res.Err)
+	}
+}
+
+func TestSendBatchCancel(t *testing.T) {
+	var calls int32
+	blocked := make(chan struct{})
+	release := make(chan struct{})
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 3 {
+			// Hold the third send until the batch is canceled, or the test
+			// is done so the server can shut down.
+			close(blocked)
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}, WithSendConcurrency(1))
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-blocked
+		cancel()
+	}()
+
+	msgs := make([]Message, 5)
+	for i := range msgs {
+		msgs[i] = Message{
+			From:      "from@example.com",
+			To:        []string{"to@example.com"},
+			PlainBody: "hello",
+		}
+	}
+
+	done := make(chan []SendResult)
+	go func() {
+		done <- client.SendBatch(ctx, msgs, time.Time{})
+	}()
+	var results []SendResult
+	select {
+	case results = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the batch to stop once canceled")
+	}
+
+	want := BatchCounts{Sent: 2, Canceled: 1, NotAttempted: 2}
+	if got := CountResults(results); got != want {
+		t.Fatalf("expected counts %+v, got %+v", want, got)
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Fatalf("expected 3 requests, got %d", got)
+	}
+}
+
+func TestCountResults(t *testing.T) {
+	results := []SendResult{
+		{},
+		{Err: ErrServer},
+		{Err: fmt.Errorf("sending: %w", context.DeadlineExceeded)},
+		{Err: withKind(ErrNotAttempted, context.Canceled)},
+		{Err: ErrNotAttempted},
+	}
+	want := BatchCounts{Sent: 1, Failed: 1, Canceled: 1, NotAttempted: 2}
+	if got := CountResults(results); got != want {
+		t.Fatalf("expected counts %+v, got %+v", want, got)
+	}
+}
@@ -0,0 +1,199 @@
+package postal
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+
+	"github.com/knadh/smtppool"
+)
+
+// ErrInlineAttachments is returned when a message with inline attachments is
+// sent using the structured send endpoint, which doesn't support them.
+var ErrInlineAttachments = errors.New("postal: inline attachments aren't supported by the structured send endpoint")
+
+// ErrEnvelopeStructured is returned when a message with EnvelopeTo is sent
+// using the structured send endpoint, which only takes header recipients.
+var ErrEnvelopeStructured = errors.New("postal: envelope recipients aren't supported by the structured send endpoint")
+
+// ErrConflictingEndpoints is returned when a message sets both ForceRaw and
+// ForceStructured.
+var ErrConflictingEndpoints = errors.New("postal: message forces both the raw and structured send endpoints")
+
+// useStructured reports whether the message is sent using the structured
+// send endpoint rather than the raw one.
+func (a *ApiClient) useStructured(msg Message) (bool, error) {
+	switch {
+	case msg.ForceRaw && msg.ForceStructured:
+		return false, withKind(ErrInvalidMessage, ErrConflictingEndpoints)
+	case msg.ForceRaw:
+		return false, nil
+	case msg.ForceStructured:
+		return true, nil
+	}
+	return a.structured, nil
+}
+
+// structuredRequest is the request for postal's structured send endpoint.
+// Postal builds the message itself, using To and Cc for the visible headers
+// and all of To, Cc and Bcc as recipients.
+type structuredRequest struct {
+	To          []string               `json:"to,omitempty"`
+	Cc          []string               `json:"cc,omitempty"`
+	Bcc         []string               `json:"bcc,omitempty"`
+	From        string                 `json:"from"`
+	Sender      string                 `json:"sender,omitempty"`
+	Subject     string                 `json:"subject,omitempty"`
+	Tag         string                 `json:"tag,omitempty"`
+	ReplyTo     string                 `json:"reply_to,omitempty"`
+	PlainBody   string                 `json:"plain_body,omitempty"`
+	HTMLBody    string                 `json:"html_body,omitempty"`
+	Attachments []structuredAttachment `json:"attachments,omitempty"`
+	Headers     map[string]string      `json:"headers,omitempty"`
+	Bounce      bool                   `json:"bounce,omitempty"`
+}
+
+// structuredAttachment is an attachment of a structuredRequest. Data is the
+// base64 encoded content.
+type structuredAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Data        string `json:"data"`
+}
+
+// sendStructured sends the message using postal's structured send endpoint.
+func (a *ApiClient) sendStructured(ctx context.Context, msg Message, opts SendOptions) (FullResult, error) {
+	req, err := a.buildStructuredRequest(msg)
+	if err != nil {
+		return FullResult{}, err
+	}
+
+	rcpts, err := envelopeRecipients(msg)
+	if err != nil {
+		return FullResult{}, withKind(ErrInvalidMessage, err)
+	}
+	rcpts, err = a.sandboxRecipients(msg, rcpts)
+	if err != nil {
+		return FullResult{}, err
+	}
+
+	res, err := a.sendRequest(ctx, opts, a.apiPath("/send/message"), req)
+	if err != nil {
+		return FullResult{}, err
+	}
+	// Postal generates the Message-ID of the message.
+	res.RFCMessageID = res.MessageID
+	res.SubmittedRecipients = rcpts
+
+	if rejected := rejectedRecipients(res.Response, rcpts); len(rejected) > 0 {
+		return res, &PartialSuccessError{Rejected: rejected}
+	}
+	return res, nil
+}
+
+// buildStructuredRequest validates the message and maps it to a request for
+// the structured send endpoint.
+func (a *ApiClient) buildStructuredRequest(msg Message) (structuredRequest, error) {
+	if err := a.validate(msg); err != nil {
+		return structuredRequest{}, err
+	}
+	if len(msg.EnvelopeTo) > 0 {
+		return structuredRequest{}, withKind(ErrInvalidMessage, ErrEnvelopeStructured)
+	}
+
+	email := a.email(msg)
+	sender, err := requiredSender(email.From, email.Sender)
+	if err != nil {
+		return structuredRequest{}, withKind(ErrInvalidMessage, err)
+	}
+	if sender == "" {
+		sender = email.Sender
+	}
+
+	req := structuredRequest{
+		To:        email.To,
+		Cc:        email.Cc,
+		Bcc:       email.Bcc,
+		From:      email.From,
+		Sender:    sender,
+		Subject:   email.Subject,
+		Tag:       email.Headers.Get(HdrPostalTag),
+		ReplyTo:   strings.Join(email.ReplyTo, ", "),
+		PlainBody: string(email.Text),
+		HTMLBody:  string(email.HTML),
+		Headers:   structuredHeaders(email),
+		Bounce:    msg.Bounce,
+	}
+
+	size := len(email.Text) + len(email.HTML)
+	for _, at := range email.Attachments {
+		src, _, err := emailSource(msg.attachments, at)
+		if err != nil {
+			return structuredRequest{}, withKind(ErrInvalidMessage, err)
+		}
+		if src != nil {
+			size += int(src.Size())
+		} else {
+			size += len(at.Content)
+		}
+	}
+	if err := a.checkSize(size); err != nil {
+		return structuredRequest{}, err
+	}
+	if err := a.checkHeaderSize(msg.headerSize()); err != nil {
+		return structuredRequest{}, err
+	}
+
+	for _, at := range email.Attachments {
+		if at.HTMLRelated {
+			return structuredRequest{}, withKind(ErrInvalidMessage, ErrInlineAttachments)
+		}
+
+		contentType := at.Header.Get(HdrContentType)
+		if contentType == "" {
+			contentType = ContentTypeOctetStream
+		}
+		// Postal takes the content in the request, so content read from a
+		// source is read here in full.
+		content := at.Content
+		if src, _, _ := emailSource(msg.attachments, at); src != nil {
+			if content, err = (Attachment{Source: src}).content(); err != nil {
+				return structuredRequest{}, fmt.Errorf("error reading attachment %s: %w", at.Filename, err)
+			}
+		}
+		req.Attachments = append(req.Attachments, structuredAttachment{
+			Name:        at.Filename,
+			ContentType: contentType,
+			Data:        base64.StdEncoding.EncodeToString(content),
+		})
+	}
+
+	// Postal sends structured messages to their To, Cc and Bcc, so sandbox
+	// messages can only be redirected by replacing them.
+	if msg.Sandbox {
+		req.To = []string{a.sandboxRcpt}
+		req.Cc, req.Bcc = nil, nil
+	}
+
+	return req, nil
+}
+
+// structuredHeaders returns the custom headers of the email. Postal only
+// takes a single value per header, so only the first one is kept. The tag
+// header is left out as it's sent as the request's tag.
+func structuredHeaders(e smtppool.Email) map[string]string {
+	if len(e.Headers) == 0 {
+		return nil
+	}
+
+	hdr := make(map[string]string, len(e.Headers))
+	for k, v := range e.Headers {
+		if len(v) > 0 && textproto.CanonicalMIMEHeaderKey(k) != HdrPostalTag {
+			hdr[k] = v[0]
+		}
+	}
+	return hdr
+}
@@ -0,0 +1,163 @@
+package postal
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/textproto"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStructuredSend(t *testing.T) {
+	var (
+		path    string
+		payload map[string]json.RawMessage
+	)
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			t.Errorf("error decoding request: %v", err)
+		}
+		w.Write(successResponse("abc@postal", []string{"to@example.com", "cc@example.com", "bcc@example.com"}))
+	}, WithStructuredSend(), WithSource("billing"))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		Cc:        []string{"cc@example.com"},
+		Bcc:       []string{"bcc@example.com"},
+		ReplyTo:   []string{"reply@example.com"},
+		Subject:   "hello",
+		PlainBody: "hello",
+		HTMLBody:  "<p>hello</p>",
+		Headers:   textproto.MIMEHeader{"X-Campaign": {"spring"}},
+	}
+	if err := msg.Attach(strings.NewReader("pdf"), "report.pdf", "application/pdf", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	resp, err := client.SendMessage(msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if path != "/api/v1/send/message" {
+		t.Fatalf("expected structured send endpoint, got %s", path)
+	}
+	if resp.RFCMessageID != "abc@postal" {
+		t.Fatalf("expected postal's message id, got %q", resp.RFCMessageID)
+	}
+
+	fields := map[string]interface{}{
+		"to":         []string{"to@example.com"},
+		"cc":         []string{"cc@example.com"},
+		"bcc":        []string{"bcc@example.com"},
+		"from":       "from@example.com",
+		"reply_to":   "reply@example.com",
+		"subject":    "hello",
+		"plain_body": "hello",
+		"html_body":  "<p>hello</p>",
+		"headers":    map[string]string{"X-Campaign": "spring", HdrPostalSource: "billing", HdrXMailer: defaultMailer},
+		"attachments": []structuredAttachment{{
+			Name:        "report.pdf",
+			ContentType: "application/pdf",
+			Data:        base64.StdEncoding.EncodeToString([]byte("pdf")),
+		}},
+	}
+	for key, want := range fields {
+		raw, ok := payload[key]
+		if !ok {
+			t.Fatalf("missing %q in request", key)
+		}
+
+		got := reflect.New(reflect.TypeOf(want))
+		if err := json.Unmarshal(raw, got.Interface()); err != nil {
+			t.Fatalf("error decoding %q: %v", key, err)
+		}
+		if !reflect.DeepEqual(got.Elem().Interface(), want) {
+			t.Fatalf("unexpected %q: got %v, want %v", key, got.Elem().Interface(), want)
+		}
+	}
+	if _, ok := payload["rcpt_to"]; ok {
+		t.Fatal("structured request shouldn't have rcpt_to")
+	}
+}
+
+func TestStructuredSendInlineAttachments(t *testing.T) {
+	client := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request")
+	}, WithStructuredSend())
+
+	msg := Message{
+		From:     "from@example.com",
+		To:       []string{"to@example.com"},
+		HTMLBody: `<img src="cid:logo.png">`,
+	}
+	if _, err := msg.AttachInline(strings.NewReader("png"), "logo.png", "image/png"); err != nil {
+		t.Fatalf("error attaching inline: %v", err)
+	}
+
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrInlineAttachments) {
+		t.Fatalf("expected ErrInlineAttachments, got %v", err)
+	}
+}
+
+func TestForceEndpoint(t *testing.T) {
+	var paths []string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write(successResponse("id", []string{"to@example.com"}))
+	}
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+
+	tests := []struct {
+		name       string
+		structured bool
+		forceRaw   bool
+		forceStr   bool
+		want       string
+		endpoint   Endpoint
+	}{
+		{"raw client", false, false, false, "/api/v1/send/raw", EndpointRaw},
+		{"forced structured", false, false, true, "/api/v1/send/message", EndpointStructured},
+		{"structured client", true, false, false, "/api/v1/send/message", EndpointStructured},
+		{"forced raw", true, true, false, "/api/v1/send/raw", EndpointRaw},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts []Option
+			if tt.structured {
+				opts = append(opts, WithStructuredSend())
+			}
+			client := newTestClient(t, h, opts...)
+
+			paths = nil
+			m := msg
+			m.ForceRaw, m.ForceStructured = tt.forceRaw, tt.forceStr
+			res, err := client.SendMessageFull(context.Background(), m)
+			if err != nil {
+				t.Fatalf("error sending message: %v", err)
+			}
+			if len(paths) != 1 || paths[0] != tt.want {
+				t.Fatalf("expected a request to %s, got %v", tt.want, paths)
+			}
+			if res.Endpoint != tt.endpoint {
+				t.Fatalf("expected endpoint %q, got %q", tt.endpoint, res.Endpoint)
+			}
+		})
+	}
+
+	client := newTestClient(t, h)
+	paths = nil
+	msg.ForceRaw, msg.ForceStructured = true, true
+	_, err := client.SendMessage(msg)
+	if !errors.Is(err, ErrConflictingEndpoints) || !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrConflictingEndpoints, got %v", err)
+	}
+	if len(paths) != 0 {
+		t.Fatalf("expected nothing to be sent, got %v", paths)
+	}
+}
@@ -0,0 +1,82 @@
+package postal
+
+import (
+	"context"
+	"encoding/base64"
+)
+
+const (
+	// summaryHeaderSize is the estimated size of the top level headers of a
+	// message, excluding its address headers and subject.
+	summaryHeaderSize = 512
+	// summaryPartSize is the estimated size of the headers and boundary of
+	// each part of a multipart message.
+	summaryPartSize = 128
+)
+
+// MessageSummary describes the size and content of a message.
+type MessageSummary struct {
+	// Recipients is the number of addresses in To, Cc and Bcc.
+	Recipients int
+	// Attachments is the number of attachments.
+	Attachments int
+	// AttachmentBytes is the size of the attachments before encoding.
+	AttachmentBytes int64
+	// EstimatedSize is the estimated size of the message once built, in
+	// bytes. Use ApiClient.MessageSize for its exact size.
+	EstimatedSize int64
+	HasPlain      bool
+	HasHTML       bool
+}
+
+// Summary returns a summary of the message, estimating its size from its
+// fields without building it. It doesn't apply a client's defaults and
+// recipient rewriting, see ApiClient.Summarize for that.
+func (m Message) Summary() MessageSummary {
+	s := MessageSummary{
+		Recipients:  len(m.To) + len(m.Cc) + len(m.Bcc),
+		Attachments: len(m.attachments),
+		HasPlain:    m.PlainBody != "",
+		HasHTML:     m.HTMLBody != "",
+	}
+
+	size := int64(summaryHeaderSize + m.headerSize())
+
+	// Bodies are quoted-printable encoded, which leaves ASCII text mostly
+	// as it is.
+	for _, b := range []string{m.PlainBody, m.HTMLBody} {
+		if b != "" {
+			size += int64(len(b)) + summaryPartSize
+		}
+	}
+
+	// Attachments are base64 encoded, with a CRLF every 76 characters.
+	for _, a := range m.attachments {
+		s.AttachmentBytes += a.size()
+		enc := int64(base64.StdEncoding.EncodedLen(int(a.size())))
+		size += enc + (enc/76+1)*2 + summaryPartSize
+	}
+
+	s.EstimatedSize = size
+	return s
+}
+
+// Summarize returns a summary of the message as the client would send it,
+// after applying its defaults and recipient rewriting and deduplication.
+func (a *ApiClient) Summarize(msg Message) MessageSummary {
+	return a.normalize(context.Background(), msg).Summary()
+}
+
+// MessageSize returns the exact size of the message once built by the
+// client, in bytes, before it's base64 encoded for postal.
+func (a *ApiClient) MessageSize(msg Message) (int, error) {
+	msg, err := a.normalizeChecked(context.Background(), msg)
+	if err != nil {
+		return 0, err
+	}
+	raw, _, err := a.buildMIME(msg)
+	if err != nil {
+		return 0, err
+	}
+	return len(raw), nil
+}
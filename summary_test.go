@@ -0,0 +1,54 @@
+package postal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMessageSummary(t *testing.T) {
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com", "other@example.com"},
+		Bcc:       []string{"bcc@example.com"},
+		Subject:   "report",
+		PlainBody: strings.Repeat("hello ", 100),
+	}
+	if err := msg.Attach(bytes.NewReader(make([]byte, 100000)), "report.pdf", "application/pdf", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	s := msg.Summary()
+	if s.Recipients != 3 || s.Attachments != 1 || s.AttachmentBytes != 100000 || !s.HasPlain || s.HasHTML {
+		t.Fatalf("unexpected summary: %+v", s)
+	}
+
+	client, _ := newRecordingClient(t)
+	size, err := client.MessageSize(msg)
+	if err != nil {
+		t.Fatalf("error getting message size: %v", err)
+	}
+	// The estimate should be within 5% of the real size.
+	if diff := s.EstimatedSize - int64(size); diff < -int64(size)/20 || diff > int64(size)/20 {
+		t.Fatalf("estimated size %d is too far from the real size %d", s.EstimatedSize, size)
+	}
+}
+
+func TestSummarizeNormalizes(t *testing.T) {
+	client, _ := newRecordingClient(t, WithDedupRecipients(), WithDefaultFrom("from@example.com"))
+	msg := Message{
+		To:        []string{"to@example.com"},
+		Cc:        []string{"to@example.com", "cc@example.com"},
+		PlainBody: "hello",
+	}
+
+	if s := client.Summarize(msg); s.Recipients != 2 {
+		t.Fatalf("expected 2 recipients after dedup, got %+v", s)
+	}
+	if s := msg.Summary(); s.Recipients != 3 {
+		t.Fatalf("expected the message's own summary to count 3 recipients, got %+v", s)
+	}
+	if _, err := client.MessageSize(msg); err != nil {
+		t.Fatalf("expected the default From to be applied, got %v", err)
+	}
+}
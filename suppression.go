@@ -0,0 +1,86 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrNoSuppressionList is returned by SendIfNotSuppressed when the client
+// has no suppression list.
+var ErrNoSuppressionList = errors.New("postal: no suppression list, see WithSuppressionList")
+
+// SuppressionList tells which addresses mail shouldn't be sent to, such as
+// addresses which hard bounced or complained. See WithSuppressionList.
+//
+// Postal keeps a suppression list per server but its legacy API has no way
+// to query it, so it has to be provided; for example from a store fed by
+// postal's bounce webhooks.
+type SuppressionList interface {
+	// Suppressed returns the addresses among addrs which are suppressed.
+	// addrs are bare addresses.
+	Suppressed(ctx context.Context, addrs []string) ([]string, error)
+}
+
+// SendIfNotSuppressed sends the message to its recipients which aren't on
+// the client's suppression list, and returns the suppressed ones which were
+// left out. If every recipient is suppressed, nothing is sent and the
+// response is empty.
+func (a *ApiClient) SendIfNotSuppressed(ctx context.Context, msg Message) (Response, []string, error) {
+	if a.suppressions == nil {
+		return Response{}, nil, ErrNoSuppressionList
+	}
+
+	rcpts, err := envelopeRecipients(msg)
+	if err != nil {
+		return Response{}, nil, withKind(ErrInvalidMessage, err)
+	}
+	suppressed, err := a.suppressions.Suppressed(ctx, rcpts)
+	if err != nil {
+		return Response{}, nil, fmt.Errorf("error checking suppressed recipients: %w", err)
+	}
+	if len(suppressed) == 0 {
+		resp, err := a.SendMessageContext(ctx, msg)
+		return resp, nil, err
+	}
+
+	drop := make(map[string]bool, len(suppressed))
+	for _, s := range suppressed {
+		drop[recipientKey(s)] = true
+	}
+
+	var skipped []string
+	filter := func(list []string) []string {
+		if list == nil {
+			return nil
+		}
+
+		out := make([]string, 0, len(list))
+		for _, r := range list {
+			if drop[recipientKey(r)] {
+				skipped = append(skipped, r)
+				continue
+			}
+			out = append(out, r)
+		}
+		return out
+	}
+	// The suppressed recipients are the envelope recipients, so they're
+	// filtered out of EnvelopeTo if it's set, and the headers are left as
+	// they are.
+	if len(msg.EnvelopeTo) > 0 {
+		msg.EnvelopeTo = filter(msg.EnvelopeTo)
+		if !hasAddress(msg.EnvelopeTo) {
+			return Response{}, skipped, nil
+		}
+	} else {
+		msg.To = filter(msg.To)
+		msg.Cc = filter(msg.Cc)
+		msg.Bcc = filter(msg.Bcc)
+		if !hasAddress(msg.To) && !hasAddress(msg.Cc) && !hasAddress(msg.Bcc) {
+			return Response{}, skipped, nil
+		}
+	}
+	resp, err := a.SendMessageContext(ctx, msg)
+	return resp, skipped, err
+}
@@ -0,0 +1,80 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// staticSuppressions is a SuppressionList of fixed addresses.
+type staticSuppressions []string
+
+func (s staticSuppressions) Suppressed(_ context.Context, addrs []string) ([]string, error) {
+	var out []string
+	for _, a := range addrs {
+		for _, sup := range s {
+			if strings.EqualFold(a, sup) {
+				out = append(out, a)
+			}
+		}
+	}
+	return out, nil
+}
+
+func TestSendIfNotSuppressed(t *testing.T) {
+	client, rec := newRecordingClient(t, WithSuppressionList(staticSuppressions{"bounced@example.com"}))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com", "Bounced <Bounced@example.com>"},
+		Bcc:       []string{"bcc@example.com"},
+		PlainBody: "hello",
+	}
+	_, skipped, err := client.SendIfNotSuppressed(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if want := []string{"Bounced <Bounced@example.com>"}; !reflect.DeepEqual(skipped, want) {
+		t.Fatalf("expected skipped %v, got %v", want, skipped)
+	}
+	if got, want := rec.reqs[0].To, []string{"to@example.com", "bcc@example.com"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected recipients %v, got %v", want, got)
+	}
+
+	msg.To = []string{"bounced@example.com"}
+	msg.Bcc = nil
+	resp, skipped, err := client.SendIfNotSuppressed(context.Background(), msg)
+	if err != nil || len(skipped) != 1 || len(resp.Messages) != 0 {
+		t.Fatalf("expected the send to be skipped, got %+v, %v, %v", resp, skipped, err)
+	}
+	if len(rec.reqs) != 1 {
+		t.Fatal("expected nothing to be sent when every recipient is suppressed")
+	}
+}
+
+func TestSendIfNotSuppressedWithoutList(t *testing.T) {
+	client, _ := newRecordingClient(t)
+	if _, _, err := client.SendIfNotSuppressed(context.Background(), retryMsg); !errors.Is(err, ErrNoSuppressionList) {
+		t.Fatalf("expected ErrNoSuppressionList, got %v", err)
+	}
+}
+
+func TestSendIfNotSuppressedEnvelope(t *testing.T) {
+	client, rec := newRecordingClient(t, WithSuppressionList(staticSuppressions{"bounced@example.com"}))
+
+	msg := Message{
+		From:       "from@example.com",
+		To:         []string{"list@example.com"},
+		EnvelopeTo: []string{"bounced@example.com"},
+		PlainBody:  "hello",
+	}
+	resp, skipped, err := client.SendIfNotSuppressed(context.Background(), msg)
+	if err != nil || len(skipped) != 1 || len(resp.Messages) != 0 {
+		t.Fatalf("expected the send to be skipped, got %+v, %v, %v", resp, skipped, err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatal("expected nothing to be sent when every envelope recipient is suppressed")
+	}
+}
@@ -0,0 +1,165 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strings"
+	"sync"
+)
+
+const (
+	HdrInReplyTo  = "In-Reply-To"
+	HdrReferences = "References"
+)
+
+// SetThread sets the In-Reply-To and References headers which make the
+// message a reply to the message with the Message-ID inReplyTo.
+//
+// references is the References chain of the parent message, oldest first.
+// The parent's Message-ID is appended to it if it isn't already the last
+// entry. IDs may be given with or without angle brackets.
+func (m *Message) SetThread(inReplyTo string, references ...string) error {
+	parent, err := normalizeMessageID(inReplyTo)
+	if err != nil {
+		return err
+	}
+
+	refs := make([]string, 0, len(references)+1)
+	for _, r := range references {
+		id, err := normalizeMessageID(r)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, id)
+	}
+	if len(refs) == 0 || refs[len(refs)-1] != parent {
+		refs = append(refs, parent)
+	}
+
+	if m.Headers == nil {
+		m.Headers = textproto.MIMEHeader{}
+	}
+	m.Headers.Set(HdrInReplyTo, parent)
+	m.Headers.Set(HdrReferences, strings.Join(refs, " "))
+	return nil
+}
+
+// normalizeMessageID validates the Message-ID and returns it wrapped in
+// angle brackets.
+func normalizeMessageID(id string) (string, error) {
+	id = strings.TrimSpace(id)
+	bare := strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+
+	at := strings.LastIndex(bare, "@")
+	if at <= 0 || at == len(bare)-1 || strings.ContainsAny(bare, "<> \t\r\n") {
+		return "", fmt.Errorf("invalid message id: %q", id)
+	}
+	for _, c := range bare {
+		if c < '!' || c > '~' {
+			return "", fmt.Errorf("invalid message id: %q", id)
+		}
+	}
+	return "<" + bare + ">", nil
+}
+
+// Thread is the last message sent in a thread, as recorded by a
+// ThreadTracker.
+type Thread struct {
+	// MessageID is the Message-ID of the message, in angle brackets.
+	MessageID string
+	// References is the References chain of the message, oldest first.
+	References []string
+}
+
+// ThreadTracker stores the last message sent in each thread, so that the
+// client can make messages replies to it. Threads are identified by the
+// caller, for example by the ID of a conversation in their application. See
+// WithThreadTracker.
+type ThreadTracker interface {
+	// LastMessage returns the last message sent in the thread. ok is false
+	// if no message has been sent in it yet.
+	LastMessage(ctx context.Context, threadID string) (t Thread, ok bool, err error)
+	// RecordMessage records t as the last message sent in the thread.
+	RecordMessage(ctx context.Context, threadID string, t Thread) error
+}
+
+// MemoryThreadTracker is a ThreadTracker which keeps threads in memory. It's
+// safe for concurrent use.
+type MemoryThreadTracker struct {
+	mu      sync.Mutex
+	threads map[string]Thread
+}
+
+// NewMemoryThreadTracker returns an empty MemoryThreadTracker.
+func NewMemoryThreadTracker() *MemoryThreadTracker {
+	return &MemoryThreadTracker{threads: make(map[string]Thread)}
+}
+
+func (m *MemoryThreadTracker) LastMessage(_ context.Context, threadID string) (Thread, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ok := m.threads[threadID]
+	return t, ok, nil
+}
+
+func (m *MemoryThreadTracker) RecordMessage(_ context.Context, threadID string, t Thread) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.threads[threadID] = t
+	return nil
+}
+
+// threadMessage makes the message a reply to the last message of its thread,
+// if the client has a thread tracker and the message isn't already a reply.
+// The given message isn't modified.
+func (a *ApiClient) threadMessage(ctx context.Context, msg Message) (Message, error) {
+	if a.threads == nil || msg.ThreadID == "" || msg.Headers.Get(HdrInReplyTo) != "" {
+		return msg, nil
+	}
+
+	last, ok, err := a.threads.LastMessage(ctx, msg.ThreadID)
+	if err != nil {
+		return msg, fmt.Errorf("error getting last message of thread %q: %w", msg.ThreadID, err)
+	}
+	if !ok {
+		return msg, nil
+	}
+
+	hdr := make(textproto.MIMEHeader, len(msg.Headers)+2)
+	for k, v := range msg.Headers {
+		hdr[k] = v
+	}
+	msg.Headers = hdr
+	if err := msg.SetThread(last.MessageID, last.References...); err != nil {
+		return msg, fmt.Errorf("error threading message: %w", err)
+	}
+	return msg, nil
+}
+
+// recordThread records a sent message as the last message of its thread. A
+// failure to record it is logged rather than returned, as the message has
+// been sent regardless.
+func (a *ApiClient) recordThread(ctx context.Context, msg Message, res FullResult, sendErr error) {
+	var partial *PartialSuccessError
+	if a.threads == nil || msg.ThreadID == "" || (sendErr != nil && !errors.As(sendErr, &partial)) {
+		return
+	}
+
+	id, err := normalizeMessageID(res.RFCMessageID)
+	if err != nil {
+		a.logf(ctx, "postal: not recording message in thread %q: %v", msg.ThreadID, err)
+		return
+	}
+	t := Thread{MessageID: id}
+	if refs := msg.Headers.Get(HdrReferences); refs != "" {
+		t.References = strings.Fields(refs)
+	}
+
+	if err := a.threads.RecordMessage(ctx, msg.ThreadID, t); err != nil {
+		a.logf(ctx, "postal: error recording message in thread %q: %v", msg.ThreadID, err)
+	}
+}
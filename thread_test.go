@@ -0,0 +1,94 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"net/mail"
+	"testing"
+)
+
+func TestSetThread(t *testing.T) {
+	msg := Message{}
+	if err := msg.SetThread("parent@example.com", "<root@example.com>", "reply@example.com"); err != nil {
+		t.Fatalf("error setting thread: %v", err)
+	}
+
+	if got := msg.Headers.Get(HdrInReplyTo); got != "<parent@example.com>" {
+		t.Fatalf("unexpected In-Reply-To: %q", got)
+	}
+	if got, want := msg.Headers.Get(HdrReferences), "<root@example.com> <reply@example.com> <parent@example.com>"; got != want {
+		t.Fatalf("unexpected References:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestSetThreadParentAlreadyReferenced(t *testing.T) {
+	msg := Message{}
+	if err := msg.SetThread("<parent@example.com>", "<root@example.com>", "<parent@example.com>"); err != nil {
+		t.Fatalf("error setting thread: %v", err)
+	}
+	if got, want := msg.Headers.Get(HdrReferences), "<root@example.com> <parent@example.com>"; got != want {
+		t.Fatalf("unexpected References:\n got: %q\nwant: %q", got, want)
+	}
+}
+
+func TestSetThreadInvalidID(t *testing.T) {
+	for _, id := range []string{"", "no-at-sign", "<a@b> <c@d>", "@example.com", "a@", "bad id@example.com"} {
+		msg := Message{}
+		if err := msg.SetThread(id); err == nil {
+			t.Errorf("expected error for message id %q", id)
+		}
+		if err := msg.SetThread("parent@example.com", id); err == nil {
+			t.Errorf("expected error for reference %q", id)
+		}
+	}
+}
+
+func TestWithThreadTracker(t *testing.T) {
+	tracker := NewMemoryThreadTracker()
+	client, rec := newRecordingClient(t, WithThreadTracker(tracker))
+
+	send := func() *mail.Message {
+		t.Helper()
+
+		msg := Message{
+			From:      "support@example.com",
+			To:        []string{"customer@example.com"},
+			Subject:   "Your ticket",
+			PlainBody: "hello",
+			ThreadID:  "ticket-42",
+		}
+		if _, err := client.SendMessage(msg); err != nil {
+			t.Fatalf("error sending message: %v", err)
+		}
+		m, err := mail.ReadMessage(bytes.NewReader(rec.last(t)))
+		if err != nil {
+			t.Fatalf("error parsing message: %v", err)
+		}
+		return m
+	}
+
+	first := send()
+	if got := first.Header.Get(HdrInReplyTo); got != "" {
+		t.Fatalf("expected the first message not to be a reply, got %q", got)
+	}
+
+	second := send()
+	firstID := first.Header.Get("Message-Id")
+	if got := second.Header.Get(HdrInReplyTo); got != firstID {
+		t.Fatalf("expected In-Reply-To %q, got %q", firstID, got)
+	}
+
+	third := send()
+	secondID := second.Header.Get("Message-Id")
+	if got := third.Header.Get(HdrInReplyTo); got != secondID {
+		t.Fatalf("expected In-Reply-To %q, got %q", secondID, got)
+	}
+	if got, want := third.Header.Get(HdrReferences), firstID+" "+secondID; got != want {
+		t.Fatalf("expected References %q, got %q", want, got)
+	}
+
+	last, ok, err := tracker.LastMessage(context.Background(), "ticket-42")
+	if err != nil || !ok || last.MessageID != third.Header.Get("Message-Id") {
+		t.Fatalf("unexpected last message %+v, %v, %v", last, ok, err)
+	}
+}
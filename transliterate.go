@@ -0,0 +1,84 @@
+package postal
+
+import (
+	"mime"
+	"net/textproto"
+	"strings"
+	"unicode"
+)
+
+// asciiLetters are the ASCII transliterations of the letters of the Latin
+// alphabets, which are most of the non-ASCII characters in filenames.
+var asciiLetters = map[rune]string{
+	'À': "A", 'Á': "A", 'Â': "A", 'Ã': "A", 'Ä': "A", 'Å': "A", 'Ā': "A", 'Ă': "A", 'Ą': "A",
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'Æ': "AE", 'æ': "ae",
+	'Ç': "C", 'Ć': "C", 'Ĉ': "C", 'Ċ': "C", 'Č': "C",
+	'ç': "c", 'ć': "c", 'ĉ': "c", 'ċ': "c", 'č': "c",
+	'Ď': "D", 'Đ': "D", 'Ð': "D", 'ď': "d", 'đ': "d", 'ð': "d",
+	'È': "E", 'É': "E", 'Ê': "E", 'Ë': "E", 'Ē': "E", 'Ĕ': "E", 'Ė': "E", 'Ę': "E", 'Ě': "E",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ĕ': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'Ĝ': "G", 'Ğ': "G", 'Ġ': "G", 'Ģ': "G", 'ĝ': "g", 'ğ': "g", 'ġ': "g", 'ģ': "g",
+	'Ĥ': "H", 'Ħ': "H", 'ĥ': "h", 'ħ': "h",
+	'Ì': "I", 'Í': "I", 'Î': "I", 'Ï': "I", 'Ĩ': "I", 'Ī': "I", 'Ĭ': "I", 'Į': "I", 'İ': "I",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ĩ': "i", 'ī': "i", 'ĭ': "i", 'į': "i", 'ı': "i",
+	'Ĵ': "J", 'ĵ': "j", 'Ķ': "K", 'ķ': "k",
+	'Ĺ': "L", 'Ļ': "L", 'Ľ': "L", 'Ŀ': "L", 'Ł': "L", 'ĺ': "l", 'ļ': "l", 'ľ': "l", 'ŀ': "l", 'ł': "l",
+	'Ñ': "N", 'Ń': "N", 'Ņ': "N", 'Ň': "N", 'ñ': "n", 'ń': "n", 'ņ': "n", 'ň': "n",
+	'Ò': "O", 'Ó': "O", 'Ô': "O", 'Õ': "O", 'Ö': "O", 'Ø': "O", 'Ō': "O", 'Ŏ': "O", 'Ő': "O",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ŏ': "o", 'ő': "o",
+	'Œ': "OE", 'œ': "oe",
+	'Ŕ': "R", 'Ŗ': "R", 'Ř': "R", 'ŕ': "r", 'ŗ': "r", 'ř': "r",
+	'Ś': "S", 'Ŝ': "S", 'Ş': "S", 'Š': "S", 'ś': "s", 'ŝ': "s", 'ş': "s", 'š': "s", 'ß': "ss",
+	'Ţ': "T", 'Ť': "T", 'Ŧ': "T", 'ţ': "t", 'ť': "t", 'ŧ': "t", 'Þ': "TH", 'þ': "th",
+	'Ù': "U", 'Ú': "U", 'Û': "U", 'Ü': "U", 'Ũ': "U", 'Ū': "U", 'Ŭ': "U", 'Ů': "U", 'Ű': "U", 'Ų': "U",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ũ': "u", 'ū': "u", 'ŭ': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'Ŵ': "W", 'ŵ': "w",
+	'Ý': "Y", 'Ÿ': "Y", 'Ŷ': "Y", 'ý': "y", 'ÿ': "y", 'ŷ': "y",
+	'Ź': "Z", 'Ż': "Z", 'Ž': "Z", 'ź': "z", 'ż': "z", 'ž': "z",
+	// Punctuation which is often typed in place of its ASCII form.
+	'‘': "'", '’': "'", '“': "\"", '”': "\"", '–': "-", '—': "-", '…': "...",
+}
+
+// transliterate returns filename with the characters outside ASCII replaced
+// by their ASCII transliterations, or by "_" for those without one.
+func transliterate(filename string) string {
+	var b strings.Builder
+	b.Grow(len(filename))
+	for _, r := range filename {
+		switch {
+		case r <= unicode.MaxASCII:
+			b.WriteRune(r)
+		case asciiLetters[r] != "":
+			b.WriteString(asciiLetters[r])
+		case unicode.Is(unicode.Mn, r):
+			// Combining marks, such as the accent of a decomposed é, are
+			// dropped with the letter they follow kept.
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// transliterateFilename returns the ASCII transliteration of the filename of
+// the attachment and its header with the Content-Disposition set for it. The
+// attachment's header isn't modified, and its Content-ID is kept so the HTML
+// body's references to it still resolve.
+func transliterateFilename(at Attachment, hdr textproto.MIMEHeader) (string, textproto.MIMEHeader) {
+	name := transliterate(at.Filename)
+	if name == at.Filename {
+		return at.Filename, hdr
+	}
+
+	disposition := "attachment"
+	if d, _, err := mime.ParseMediaType(hdr.Get(HdrContentDisposition)); err == nil {
+		disposition = d
+	}
+	out := make(textproto.MIMEHeader, len(hdr))
+	for k, v := range hdr {
+		out[k] = v
+	}
+	out.Set(HdrContentDisposition, formatDisposition(disposition, name))
+	return name, out
+}
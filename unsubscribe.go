@@ -0,0 +1,70 @@
+package postal
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+	texttemplate "text/template"
+)
+
+// UnsubscribeMarker marks the unsubscribe footer of an HTML body. A body
+// which already has it, or already has the message's UnsubscribeURL, gets no
+// footer, see WithUnsubscribeFooter.
+const UnsubscribeMarker = "<!-- postal-unsubscribe -->"
+
+// unsubscribeLink stands in for the URL when the footer is rendered for an
+// HTML body, so it's replaced by a link once the footer is escaped.
+const unsubscribeLink = "\x00unsubscribe-url\x00"
+
+// unsubscribeData is what the footer template is executed with.
+type unsubscribeData struct {
+	URL string
+}
+
+// parseUnsubscribeFooter parses the footer template, and checks that it can
+// be executed, so footers don't fail when messages are sent.
+func parseUnsubscribeFooter(footer string) (*texttemplate.Template, error) {
+	t, err := texttemplate.New("unsubscribe").Parse(footer)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing unsubscribe footer: %w", err)
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, unsubscribeData{URL: "https://example.com/unsubscribe"}); err != nil {
+		return nil, fmt.Errorf("error rendering unsubscribe footer: %w", err)
+	}
+	return t, nil
+}
+
+// withUnsubscribeFooter returns the message with the client's unsubscribe
+// footer for its UnsubscribeURL appended to each body which doesn't have it,
+// see WithUnsubscribeFooter.
+func (a *ApiClient) withUnsubscribeFooter(msg Message) Message {
+	if a.unsubscribeFooter == nil || msg.UnsubscribeURL == "" {
+		return msg
+	}
+
+	if msg.PlainBody != "" && !strings.Contains(msg.PlainBody, msg.UnsubscribeURL) {
+		var b bytes.Buffer
+		// The template was checked by parseUnsubscribeFooter.
+		_ = a.unsubscribeFooter.Execute(&b, unsubscribeData{URL: msg.UnsubscribeURL})
+		msg.PlainBody = strings.TrimRight(msg.PlainBody, "\r\n") + "\r\n\r\n" + b.String()
+	}
+
+	if msg.HTMLBody != "" && !strings.Contains(msg.HTMLBody, UnsubscribeMarker) &&
+		!strings.Contains(msg.HTMLBody, html.EscapeString(msg.UnsubscribeURL)) {
+		var b bytes.Buffer
+		_ = a.unsubscribeFooter.Execute(&b, unsubscribeData{URL: unsubscribeLink})
+		url := html.EscapeString(msg.UnsubscribeURL)
+		text := strings.ReplaceAll(html.EscapeString(b.String()), unsubscribeLink, `<a href="`+url+`">`+url+`</a>`)
+		footer := UnsubscribeMarker + "\r\n<p>" + strings.ReplaceAll(text, "\n", "<br>\n") + "</p>\r\n"
+
+		// The footer goes at the end of the body element, if there's one.
+		if i := strings.LastIndex(strings.ToLower(msg.HTMLBody), "</body>"); i >= 0 {
+			msg.HTMLBody = msg.HTMLBody[:i] + footer + msg.HTMLBody[i:]
+		} else {
+			msg.HTMLBody += "\r\n" + footer
+		}
+	}
+	return msg
+}
@@ -0,0 +1,85 @@
+package postal
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUnsubscribeFooter(t *testing.T) {
+	const url = "https://example.com/unsubscribe?u=1&l=2"
+	tests := []struct {
+		name      string
+		msg       Message
+		wantPlain string
+		wantHTML  string
+	}{
+		{
+			"both bodies",
+			Message{PlainBody: "hello\n", HTMLBody: "<html><body><p>hello</p></body></html>", UnsubscribeURL: url},
+			"hello\r\n\r\nUnsubscribe: " + url,
+			"<html><body><p>hello</p>" + UnsubscribeMarker + "\r\n<p>Unsubscribe: <a href=\"https://example.com/unsubscribe?u=1&amp;l=2\">https://example.com/unsubscribe?u=1&amp;l=2</a></p>\r\n</body></html>",
+		},
+		{
+			"html without body element",
+			Message{HTMLBody: "<p>hello</p>", UnsubscribeURL: url},
+			"",
+			"<p>hello</p>\r\n" + UnsubscribeMarker + "\r\n<p>Unsubscribe: <a href=\"https://example.com/unsubscribe?u=1&amp;l=2\">https://example.com/unsubscribe?u=1&amp;l=2</a></p>\r\n",
+		},
+		{
+			"already present",
+			Message{PlainBody: "hello " + url, HTMLBody: "<p>hello</p>" + UnsubscribeMarker, UnsubscribeURL: url},
+			"hello " + url,
+			"<p>hello</p>" + UnsubscribeMarker,
+		},
+		{
+			"no url",
+			Message{PlainBody: "hello", HTMLBody: "<p>hello</p>"},
+			"hello",
+			"<p>hello</p>",
+		},
+	}
+
+	client, _ := newRecordingClient(t, WithUnsubscribeFooter("Unsubscribe: {{.URL}}"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := client.normalize(context.Background(), tt.msg)
+			if got.PlainBody != tt.wantPlain {
+				t.Errorf("expected plain body %q, got %q", tt.wantPlain, got.PlainBody)
+			}
+			if got.HTMLBody != tt.wantHTML {
+				t.Errorf("expected html body %q, got %q", tt.wantHTML, got.HTMLBody)
+			}
+			// Normalizing again doesn't add a second footer.
+			if again := client.normalize(context.Background(), got); again.PlainBody != got.PlainBody || again.HTMLBody != got.HTMLBody {
+				t.Errorf("expected the footer to be added once, got %q and %q", again.PlainBody, again.HTMLBody)
+			}
+		})
+	}
+
+	for _, footer := range []string{"{{.URL", "{{.Missing}}"} {
+		if _, err := NewAPIClient("http://localhost", "token", http.DefaultClient, WithUnsubscribeFooter(footer)); err == nil {
+			t.Errorf("expected an error for the footer %q", footer)
+		}
+	}
+}
+
+func TestUnsubscribeFooterSent(t *testing.T) {
+	client, rec := newRecordingClient(t, WithUnsubscribeFooter("Unsubscribe: {{.URL}}"))
+	msg := Message{
+		From:           "from@example.com",
+		To:             []string{"to@example.com"},
+		PlainBody:      "hello",
+		UnsubscribeURL: "https://example.com/u/1",
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if raw := string(rec.last(t)); !strings.Contains(raw, "Unsubscribe: https://example.com/u/1") {
+		t.Fatalf("expected the footer in the message:\n%s", raw)
+	}
+	if msg.PlainBody != "hello" {
+		t.Fatalf("expected the message not to be modified, got %q", msg.PlainBody)
+	}
+}
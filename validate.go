@@ -0,0 +1,240 @@
+package postal
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/mail"
+	"path"
+	"strings"
+)
+
+// ErrTooManyAttachments is returned when a message has more attachments than
+// the client allows.
+var ErrTooManyAttachments = errors.New("postal: too many attachments")
+
+// ErrEmptyAttachment is returned when a message has an attachment without
+// content and the client rejects those, see WithRejectEmptyAttachments.
+var ErrEmptyAttachment = errors.New("postal: empty attachment")
+
+// ErrNoSubject is returned when a message without a subject is sent by a
+// client which requires one, see WithRequireSubject.
+var ErrNoSubject = errors.New("postal: message has no subject")
+
+// ErrMessageTooLarge is returned when a message is larger than the client
+// allows, see WithMaxMessageSize and WithMaxSizeFromServer.
+var ErrMessageTooLarge = errors.New("postal: message too large")
+
+// ErrAttachmentNotAllowed is returned when a message has an attachment whose
+// type isn't allowed by the client.
+var ErrAttachmentNotAllowed = errors.New("postal: attachment type not allowed")
+
+// ErrDuplicateContentID is returned when an inline attachment of a message
+// has the same Content-ID as another attachment, see WithStrictContentIDs.
+var ErrDuplicateContentID = errors.New("postal: duplicate content id")
+
+// Validate checks that the message has a sender, at least one recipient and
+// some content. Postal would reject it otherwise. The errors are
+// ErrInvalidMessage.
+func (m Message) Validate() error {
+	return withKind(ErrInvalidMessage, m.validate())
+}
+
+func (m Message) validate() error {
+	rcpts := hasAddress(m.To) || hasAddress(m.Cc) || hasAddress(m.Bcc)
+	if len(m.EnvelopeTo) > 0 {
+		rcpts = hasAddress(m.EnvelopeTo)
+	}
+	if strings.TrimSpace(m.From) == "" {
+		if !rcpts {
+			return fmt.Errorf("%w: message has no sender or recipients", ErrInvalidFrom)
+		}
+		return fmt.Errorf("%w: message has no sender", ErrInvalidFrom)
+	}
+	if !rcpts {
+		return fmt.Errorf("%w: message has no recipients", ErrNoRecipients)
+	}
+	if m.PlainBody == "" && m.HTMLBody == "" && len(m.attachments) == 0 {
+		return ErrNoContent
+	}
+	if m.ContentLanguage != "" {
+		if err := checkLanguageTag(m.ContentLanguage); err != nil {
+			return err
+		}
+	}
+	return checkSenderHeader(m)
+}
+
+// CheckSubject warns if the message has no subject. Messages without a
+// subject look broken and are more likely to be marked as spam, but postal
+// sends them; use WithRequireSubject to reject them instead.
+func (m Message) CheckSubject() []Warning {
+	if strings.TrimSpace(m.Subject) == "" {
+		return []Warning{{Field: "Subject", Message: "message has no subject, it's more likely to be marked as spam"}}
+	}
+	return nil
+}
+
+// hasAddress reports whether any of the addresses isn't blank.
+func hasAddress(addrs []string) bool {
+	for _, a := range addrs {
+		if strings.TrimSpace(a) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the message, and the message against the client's limits,
+// before it is sent.
+func (a *ApiClient) validate(msg Message) error {
+	if err := msg.Validate(); err != nil {
+		return err
+	}
+	if a.requireSubject && strings.TrimSpace(msg.Subject) == "" {
+		return withKind(ErrInvalidMessage, ErrNoSubject)
+	}
+	if a.maxAttachments > 0 && len(msg.attachments) > a.maxAttachments {
+		return withKind(ErrInvalidMessage, fmt.Errorf("%w: message has %d attachments, the limit is %d", ErrTooManyAttachments, len(msg.attachments), a.maxAttachments))
+	}
+	for _, at := range msg.attachments {
+		if a.rejectEmpty && at.size() == 0 {
+			return withKind(ErrInvalidMessage, fmt.Errorf("%w: %s", ErrEmptyAttachment, at.Filename))
+		}
+		if err := a.checkAttachmentType(at); err != nil {
+			return withKind(ErrInvalidMessage, err)
+		}
+	}
+	if err := a.checkSenders(msg); err != nil {
+		return withKind(ErrInvalidMessage, err)
+	}
+	if a.strictCIDs {
+		if err := checkContentIDs(msg.attachments); err != nil {
+			return withKind(ErrInvalidMessage, err)
+		}
+	}
+	return a.checkRecipients(msg.To, msg.Cc, msg.Bcc, msg.EnvelopeTo)
+}
+
+// checkContentIDs checks that no inline attachment shares its Content-ID
+// with another attachment. Regular attachments may share one, as two files
+// with the same name do, since nothing refers to them by it.
+func checkContentIDs(attachments []Attachment) error {
+	seen := make(map[string]Attachment, len(attachments))
+	for _, at := range attachments {
+		cid := strings.TrimSpace(at.Header.Get(HdrContentID))
+		if cid == "" {
+			continue
+		}
+		if prev, ok := seen[cid]; ok && (at.HTMLRelated || prev.HTMLRelated) {
+			return fmt.Errorf("%w: %s and %s are both %s", ErrDuplicateContentID, prev.Filename, at.Filename, cid)
+		}
+		if _, ok := seen[cid]; !ok || at.HTMLRelated {
+			seen[cid] = at
+		}
+	}
+	return nil
+}
+
+// checkSize checks the size, in bytes, of a message against the client's
+// maximum message size.
+func (a *ApiClient) checkSize(size int) error {
+	if a.maxMessageSize > 0 && int64(size) > a.maxMessageSize {
+		return withKind(ErrInvalidMessage, fmt.Errorf("%w: message is %d bytes, the limit is %d", ErrMessageTooLarge, size, a.maxMessageSize))
+	}
+	return nil
+}
+
+// checkRecipients checks every address in the lists with the client's
+// recipient validator, see WithRecipientValidator.
+func (a *ApiClient) checkRecipients(lists ...[]string) error {
+	if a.rcptValidator == nil {
+		return nil
+	}
+	for _, list := range lists {
+		for _, r := range list {
+			addr := r
+			if parsed, err := mail.ParseAddress(r); err == nil {
+				addr = parsed.Address
+			}
+			if err := a.rcptValidator(addr); err != nil {
+				return withKind(ErrInvalidMessage, fmt.Errorf("recipient %s not allowed: %w", addr, err))
+			}
+		}
+	}
+	return nil
+}
+
+// checkAttachmentType checks the attachment's content type and file extension
+// against the client's allowlist and denylist.
+func (a *ApiClient) checkAttachmentType(at Attachment) error {
+	if len(a.attachAllow) == 0 && len(a.attachDeny) == 0 {
+		return nil
+	}
+
+	// The type the attachment is sent with is checked.
+	ct := at.Header.Get(HdrContentType)
+	if a.sniffTypes {
+		head, err := at.peek()
+		if err != nil {
+			return fmt.Errorf("error reading attachment %s: %w", at.Filename, err)
+		}
+		if sniffed, ok := sniffContentType(at.Filename, ct, head); ok {
+			ct = sniffed
+		}
+	}
+	ct = strings.ToLower(ct)
+	if mt, _, err := mime.ParseMediaType(ct); err == nil {
+		ct = mt
+	}
+	ext := strings.ToLower(path.Ext(at.Filename))
+
+	for _, d := range a.attachDeny {
+		if typeMatches(d, ct, ext) {
+			return fmt.Errorf("%w: %s is %s", ErrAttachmentNotAllowed, at.Filename, d)
+		}
+	}
+
+	if len(a.attachAllow) == 0 {
+		return nil
+	}
+	var typeListed, typeOK, extListed, extOK bool
+	for _, e := range a.attachAllow {
+		if strings.HasPrefix(e, ".") {
+			extListed = true
+			extOK = extOK || e == ext
+		} else {
+			typeListed = true
+			typeOK = typeOK || typeMatches(e, ct, ext)
+		}
+	}
+	if typeListed && !typeOK {
+		return fmt.Errorf("%w: %s has content type %q", ErrAttachmentNotAllowed, at.Filename, ct)
+	}
+	if extListed && !extOK {
+		return fmt.Errorf("%w: %s has extension %q", ErrAttachmentNotAllowed, at.Filename, ext)
+	}
+	return nil
+}
+
+// typeMatches reports whether the allowlist or denylist entry matches the
+// content type or file extension. Entries starting with a dot are
+// extensions, and content types may end in "/*" to match any subtype.
+func typeMatches(entry, contentType, ext string) bool {
+	if strings.HasPrefix(entry, ".") {
+		return entry == ext
+	}
+	if strings.HasSuffix(entry, "/*") {
+		return strings.HasPrefix(contentType, strings.TrimSuffix(entry, "*"))
+	}
+	return entry == contentType
+}
+
+// lowerAll returns the strings lower cased and trimmed.
+func lowerAll(ss []string) []string {
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		out[i] = strings.ToLower(strings.TrimSpace(s))
+	}
+	return out
+}
@@ -0,0 +1,206 @@
+package postal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWithMaxAttachments(t *testing.T) {
+	client, rec := newRecordingClient(t, WithMaxAttachments(2))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"to@example.com"},
+		PlainBody: "hello",
+	}
+	for i := 0; i < 2; i++ {
+		if err := msg.Attach(strings.NewReader("data"), "file.txt", "text/plain", nil); err != nil {
+			t.Fatalf("error attaching: %v", err)
+		}
+	}
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message at the limit: %v", err)
+	}
+
+	if err := msg.Attach(strings.NewReader("data"), "file.txt", "text/plain", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrTooManyAttachments) {
+		t.Fatalf("expected ErrTooManyAttachments, got %v", err)
+	}
+	if len(rec.reqs) != 1 {
+		t.Fatalf("expected the message over the limit not to be sent, got %d requests", len(rec.reqs))
+	}
+}
+
+func TestMessageValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  Message
+		want error
+	}{
+		{"zero", Message{}, ErrInvalidFrom},
+		{"no sender", Message{To: []string{"to@example.com"}, PlainBody: "hello"}, ErrInvalidFrom},
+		{"no recipients", Message{From: "from@example.com", PlainBody: "hello"}, ErrNoRecipients},
+		{"blank recipients", Message{From: "from@example.com", To: []string{" "}, PlainBody: "hello"}, ErrNoRecipients},
+		{"no content", Message{From: "from@example.com", To: []string{"to@example.com"}}, ErrNoContent},
+		{"bcc only", Message{From: "from@example.com", Bcc: []string{"bcc@example.com"}, HTMLBody: "<p>hello</p>"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.msg.Validate(); !errors.Is(err, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestSendZeroMessage(t *testing.T) {
+	client, rec := newRecordingClient(t)
+
+	_, err := client.SendMessage(Message{})
+	if !errors.Is(err, ErrInvalidFrom) || !strings.Contains(err.Error(), "no sender or recipients") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatal("expected the message not to be sent")
+	}
+}
+
+func TestWithRecipientValidator(t *testing.T) {
+	errPersonal := errors.New("personal email domain")
+	var checked []string
+	client, rec := newRecordingClient(t, WithRecipientValidator(func(addr string) error {
+		checked = append(checked, addr)
+		if strings.HasSuffix(addr, "@gmail.com") {
+			return errPersonal
+		}
+		return nil
+	}))
+
+	msg := Message{
+		From:      "from@example.com",
+		To:        []string{"Jane <jane@example.com>"},
+		Bcc:       []string{"jane.personal@gmail.com"},
+		PlainBody: "hello",
+	}
+	_, err := client.SendMessage(msg)
+	if !errors.Is(err, errPersonal) || !errors.Is(err, ErrInvalidMessage) || !strings.Contains(err.Error(), "jane.personal@gmail.com") {
+		t.Fatalf("expected the validator's error for the personal address, got %v", err)
+	}
+	if want := []string{"jane@example.com", "jane.personal@gmail.com"}; strings.Join(checked, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v to be checked, got %v", want, checked)
+	}
+
+	msg.Bcc = nil
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(rec.reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(rec.reqs))
+	}
+}
+
+func TestAttachmentTypeLists(t *testing.T) {
+	tests := []struct {
+		name        string
+		opt         Option
+		filename    string
+		contentType string
+		allowed     bool
+	}{
+		{"allowed type", WithAttachmentTypeAllowlist([]string{"application/pdf", "image/*"}), "report.pdf", "application/pdf", true},
+		{"allowed wildcard", WithAttachmentTypeAllowlist([]string{"application/pdf", "image/*"}), "logo.png", "image/png", true},
+		{"type not allowed", WithAttachmentTypeAllowlist([]string{"application/pdf", "image/*"}), "page.html", "text/html; charset=utf-8", false},
+		{"extension not allowed", WithAttachmentTypeAllowlist([]string{"application/pdf", ".pdf"}), "report.exe", "application/pdf", false},
+		{"denied type", WithAttachmentTypeDenylist([]string{"text/javascript", ".exe"}), "app.js", "text/javascript", false},
+		{"denied extension", WithAttachmentTypeDenylist([]string{"text/javascript", ".EXE"}), "setup.Exe", "application/octet-stream", false},
+		{"not denied", WithAttachmentTypeDenylist([]string{"text/javascript", ".exe"}), "notes.txt", "text/plain", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, rec := newRecordingClient(t, tt.opt)
+
+			msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+			if err := msg.Attach(strings.NewReader("data"), tt.filename, tt.contentType, nil); err != nil {
+				t.Fatalf("error attaching: %v", err)
+			}
+			_, err := client.SendMessage(msg)
+			if tt.allowed {
+				if err != nil {
+					t.Fatalf("error sending message: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrAttachmentNotAllowed) || !errors.Is(err, ErrInvalidMessage) || !strings.Contains(err.Error(), tt.filename) {
+				t.Fatalf("expected ErrAttachmentNotAllowed naming %s, got %v", tt.filename, err)
+			}
+			if len(rec.reqs) != 0 {
+				t.Fatalf("expected the message not to be sent, got %d requests", len(rec.reqs))
+			}
+		})
+	}
+}
+
+func TestWithRejectEmptyAttachments(t *testing.T) {
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if err := msg.Attach(strings.NewReader(""), "empty.csv", "text/csv", nil); err != nil {
+		t.Fatalf("error attaching: %v", err)
+	}
+
+	client, rec := newRecordingClient(t, WithRejectEmptyAttachments())
+	_, err := client.SendMessage(msg)
+	if !errors.Is(err, ErrEmptyAttachment) || !errors.Is(err, ErrInvalidMessage) || !strings.Contains(err.Error(), "empty.csv") {
+		t.Fatalf("expected ErrEmptyAttachment naming the file, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatalf("expected the message not to be sent, got %d requests", len(rec.reqs))
+	}
+
+	// Empty attachments are allowed by default.
+	client, _ = newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+}
+
+func TestCheckSubject(t *testing.T) {
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello", Subject: " "}
+	warnings := msg.CheckSubject()
+	if len(warnings) != 1 || warnings[0].Field != "Subject" {
+		t.Fatalf("expected a Subject warning, got %v", warnings)
+	}
+
+	// Without WithRequireSubject, the message is still sent.
+	client, rec := newRecordingClient(t)
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+	if len(rec.reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(rec.reqs))
+	}
+
+	msg.Subject = "Your receipt"
+	if warnings := msg.CheckSubject(); len(warnings) != 0 {
+		t.Fatalf("expected no warnings, got %v", warnings)
+	}
+}
+
+func TestWithRequireSubject(t *testing.T) {
+	client, rec := newRecordingClient(t, WithRequireSubject())
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+	if _, err := client.SendMessage(msg); !errors.Is(err, ErrNoSubject) || !errors.Is(err, ErrInvalidMessage) {
+		t.Fatalf("expected ErrNoSubject, got %v", err)
+	}
+	if len(rec.reqs) != 0 {
+		t.Fatalf("expected the message not to be sent, got %d requests", len(rec.reqs))
+	}
+
+	msg.Subject = "Your receipt"
+	if _, err := client.SendMessage(msg); err != nil {
+		t.Fatalf("error sending message: %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package postal
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HdrPostalVersion is the response header the server's version is read from,
+// unless set with WithServerVersionHeader. See ServerVersion.
+const HdrPostalVersion = "X-Postal-Version"
+
+// ServerVersion returns the version of the client's postal server, as it was
+// in the version header of the last response which had one, or "" if none
+// did, such as before the first request.
+//
+// Postal's legacy API doesn't report its version: it has no capabilities
+// endpoint, and its responses have no version header. The version is thus
+// read from a header which a proxy in front of postal can add, such as with
+// nginx's `add_header X-Postal-Version 3.3.4 always;`. Without one, it's
+// always "", and features are better detected by trying them, as with the
+// ErrNotSupported of ListDomains.
+func (a *ApiClient) ServerVersion() string {
+	a.versionMu.Lock()
+	defer a.versionMu.Unlock()
+
+	return a.serverVersion
+}
+
+// recordServerVersion keeps the server's version from the headers of a
+// response, if they have it.
+func (a *ApiClient) recordServerVersion(h http.Header) {
+	v := strings.TrimSpace(h.Get(a.versionHeader))
+	if v == "" {
+		return
+	}
+
+	a.versionMu.Lock()
+	defer a.versionMu.Unlock()
+	a.serverVersion = v
+}
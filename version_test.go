@@ -0,0 +1,45 @@
+package postal
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestServerVersion(t *testing.T) {
+	version := ""
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if version != "" {
+			w.Header().Set("X-Proxy-Postal", version)
+			w.Header().Set(HdrPostalVersion, "ignored")
+		}
+		w.Write(successResponse("abc@postal", []string{"to@example.com"}))
+	}
+	client := newTestClient(t, h, WithServerVersionHeader("X-Proxy-Postal"))
+	msg := Message{From: "from@example.com", To: []string{"to@example.com"}, PlainBody: "hello"}
+
+	if got := client.ServerVersion(); got != "" {
+		t.Fatalf("expected no version before the first request, got %q", got)
+	}
+	send := func() {
+		t.Helper()
+		if _, err := client.SendMessage(msg); err != nil {
+			t.Fatalf("error sending message: %v", err)
+		}
+	}
+	send()
+	if got := client.ServerVersion(); got != "" {
+		t.Fatalf("expected no version without the header, got %q", got)
+	}
+
+	version = " 3.3.4 "
+	send()
+	if got := client.ServerVersion(); got != "3.3.4" {
+		t.Fatalf("expected the version 3.3.4, got %q", got)
+	}
+	// A response without the header keeps the last version.
+	version = ""
+	send()
+	if got := client.ServerVersion(); got != "3.3.4" {
+		t.Fatalf("expected the version to be kept, got %q", got)
+	}
+}
@@ -0,0 +1,59 @@
+package postal
+
+import (
+	"context"
+	"time"
+)
+
+// WaveOptions configures SendWaves.
+type WaveOptions struct {
+	// WindowDuration is the time the waves are spread over: the first wave
+	// is sent right away, and the others at equal intervals after it, the
+	// last one starting WindowDuration/Waves before the window ends.
+	WindowDuration time.Duration
+	// Waves is the number of waves the messages are split into. It's 1 if
+	// it's less than 1.
+	Waves int
+}
+
+// SendWaves splits the messages into waves of equal size and sends the waves
+// spread over a time window, such as to warm up new IPs or avoid traffic
+// spikes. The messages of a wave are sent like SendStream does, within the
+// client's send concurrency and rate limit, and their results are delivered
+// on the returned channel as they complete; it's closed once every message
+// has a result. A wave which starts while the previous one is still being
+// sent queues behind it.
+//
+// Once ctx is done, the messages which weren't sent fail with
+// ErrNotAttempted.
+func (a *ApiClient) SendWaves(ctx context.Context, msgs []Message, opts WaveOptions) <-chan SendResult {
+	waves := opts.Waves
+	if waves < 1 {
+		waves = 1
+	}
+	size := (len(msgs) + waves - 1) / waves
+	interval := opts.WindowDuration / time.Duration(waves)
+
+	in, out := a.sendStream(ctx, time.Time{})
+	go func() {
+		defer close(in)
+
+		start := a.clock.Now()
+		for i := 0; i*size < len(msgs); i++ {
+			if i > 0 {
+				// A done context fails the rest of the messages in the
+				// stream, so they're still sent through it.
+				_ = sleep(ctx, a.clock, start.Add(time.Duration(i)*interval).Sub(a.clock.Now()))
+			}
+
+			end := (i + 1) * size
+			if end > len(msgs) {
+				end = len(msgs)
+			}
+			for _, msg := range msgs[i*size : end] {
+				in <- msg
+			}
+		}
+	}()
+	return out
+}
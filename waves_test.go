@@ -0,0 +1,72 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSendWaves(t *testing.T) {
+	clock := newFakeClock()
+	client, rec := newRecordingClient(t, WithClock(clock))
+
+	msgs := make([]Message, 5)
+	for i := range msgs {
+		msgs[i] = retryMsg
+	}
+	out := client.SendWaves(context.Background(), msgs, WaveOptions{WindowDuration: 3 * time.Hour, Waves: 3})
+
+	seen := make(map[int]bool)
+	receive := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			res := <-out
+			if res.Err != nil {
+				t.Fatalf("error sending message %d: %v", res.Index, res.Err)
+			}
+			seen[res.Index] = true
+		}
+	}
+
+	// The waves have 2, 2 and 1 messages, an hour apart.
+	receive(2)
+	clock.waitForWaiters(t, 1)
+	if n := len(rec.reqs); n != 2 {
+		t.Fatalf("expected only the first wave to be sent, got %d requests", n)
+	}
+	clock.Advance(time.Hour)
+	receive(2)
+	clock.waitForWaiters(t, 1)
+	clock.Advance(time.Hour)
+	receive(1)
+
+	if _, ok := <-out; ok {
+		t.Fatal("expected the results channel to be closed")
+	}
+	if len(seen) != 5 {
+		t.Fatalf("expected a result for each message, got %v", seen)
+	}
+}
+
+func TestSendWavesContextDone(t *testing.T) {
+	clock := newFakeClock()
+	client, rec := newRecordingClient(t, WithClock(clock))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := client.SendWaves(ctx, []Message{retryMsg, retryMsg}, WaveOptions{WindowDuration: time.Hour, Waves: 2})
+
+	if res := <-out; res.Err != nil {
+		t.Fatalf("error sending the first wave: %v", res.Err)
+	}
+	clock.waitForWaiters(t, 1)
+	cancel()
+
+	res := <-out
+	if !errors.Is(res.Err, ErrNotAttempted) || !errors.Is(res.Err, context.Canceled) {
+		t.Fatalf("expected the second wave not to be attempted, got %v", res.Err)
+	}
+	if len(rec.reqs) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(rec.reqs))
+	}
+}
@@ -0,0 +1,99 @@
+package postal
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Webhook events sent by postal for engagement tracking.
+const (
+	EventMessageLinkClicked = "MessageLinkClicked"
+	EventMessageLoaded      = "MessageLoaded"
+)
+
+// WebhookEvent is a webhook request sent by postal. Payload depends on the
+// event and can be decoded with the method for the event, such as
+// LinkClicked.
+type WebhookEvent struct {
+	Event     string          `json:"event"`
+	Timestamp Timestamp       `json:"timestamp"`
+	UUID      string          `json:"uuid"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// WebhookMessage is the message a webhook event is about.
+type WebhookMessage struct {
+	ID         int64     `json:"id"`
+	Token      string    `json:"token"`
+	Direction  string    `json:"direction"`
+	MessageID  string    `json:"message_id"`
+	To         string    `json:"to"`
+	From       string    `json:"from"`
+	Subject    string    `json:"subject"`
+	Timestamp  Timestamp `json:"timestamp"`
+	SpamStatus string    `json:"spam_status"`
+	Tag        string    `json:"tag"`
+}
+
+// LinkClicked is the payload of a MessageLinkClicked event, sent when a
+// recipient clicks a tracked link.
+type LinkClicked struct {
+	URL       string         `json:"url"`
+	Token     string         `json:"token"`
+	IPAddress string         `json:"ip_address"`
+	UserAgent string         `json:"user_agent"`
+	Message   WebhookMessage `json:"message"`
+	// Time is when the link was clicked, the time of the event.
+	Time time.Time `json:"-"`
+}
+
+// MessageLoaded is the payload of a MessageLoaded event, sent when a
+// recipient opens a message and its tracking pixel is loaded.
+type MessageLoaded struct {
+	IPAddress string         `json:"ip_address"`
+	UserAgent string         `json:"user_agent"`
+	Message   WebhookMessage `json:"message"`
+	// Time is when the message was opened, the time of the event.
+	Time time.Time `json:"-"`
+}
+
+// ParseWebhook decodes the body of a webhook request from postal.
+func ParseWebhook(body []byte) (WebhookEvent, error) {
+	var e WebhookEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return WebhookEvent{}, fmt.Errorf("error decoding webhook: %v", err)
+	}
+	return e, nil
+}
+
+// LinkClicked decodes the payload of a MessageLinkClicked event.
+func (e WebhookEvent) LinkClicked() (LinkClicked, error) {
+	var p LinkClicked
+	if err := e.decodePayload(EventMessageLinkClicked, &p); err != nil {
+		return LinkClicked{}, err
+	}
+	p.Time = e.Timestamp.Time
+	return p, nil
+}
+
+// MessageLoaded decodes the payload of a MessageLoaded event.
+func (e WebhookEvent) MessageLoaded() (MessageLoaded, error) {
+	var p MessageLoaded
+	if err := e.decodePayload(EventMessageLoaded, &p); err != nil {
+		return MessageLoaded{}, err
+	}
+	p.Time = e.Timestamp.Time
+	return p, nil
+}
+
+// decodePayload decodes the payload into v if the event is the given one.
+func (e WebhookEvent) decodePayload(event string, v interface{}) error {
+	if e.Event != event {
+		return fmt.Errorf("webhook event is %q, not %q", e.Event, event)
+	}
+	if err := json.Unmarshal(e.Payload, v); err != nil {
+		return fmt.Errorf("error decoding %s payload: %v", event, err)
+	}
+	return nil
+}
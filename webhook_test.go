@@ -0,0 +1,64 @@
+package postal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWebhookLinkClicked(t *testing.T) {
+	body := []byte(`{
+		"event": "MessageLinkClicked",
+		"timestamp": 1477945177.5,
+		"uuid": "0d5fc6d5-4f68-4e41-bd4c-f5a4f4b9de2f",
+		"payload": {
+			"url": "https://example.com/offer",
+			"token": "VJzsFA0S",
+			"ip_address": "192.0.2.1",
+			"user_agent": "Mozilla/5.0",
+			"message": {"id": 1, "token": "abc", "message_id": "abc@postal", "to": "to@example.com", "tag": "spring"}
+		}
+	}`)
+
+	e, err := ParseWebhook(body)
+	if err != nil {
+		t.Fatalf("error parsing webhook: %v", err)
+	}
+	click, err := e.LinkClicked()
+	if err != nil {
+		t.Fatalf("error decoding click: %v", err)
+	}
+
+	if click.URL != "https://example.com/offer" || click.IPAddress != "192.0.2.1" || click.UserAgent != "Mozilla/5.0" {
+		t.Fatalf("unexpected click: %+v", click)
+	}
+	if click.Message.MessageID != "abc@postal" || click.Message.Tag != "spring" {
+		t.Fatalf("unexpected message: %+v", click.Message)
+	}
+	if want := time.Unix(1477945177, 5e8); !click.Time.Equal(want) {
+		t.Fatalf("expected time %v, got %v", want, click.Time)
+	}
+
+	if _, err := e.MessageLoaded(); err == nil {
+		t.Fatal("expected an error decoding a click as a load")
+	}
+}
+
+func TestWebhookMessageLoaded(t *testing.T) {
+	body := []byte(`{
+		"event": "MessageLoaded",
+		"timestamp": 1477945177,
+		"payload": {"ip_address": "192.0.2.1", "user_agent": "Mozilla/5.0", "message": {"id": 1}}
+	}`)
+
+	e, err := ParseWebhook(body)
+	if err != nil {
+		t.Fatalf("error parsing webhook: %v", err)
+	}
+	open, err := e.MessageLoaded()
+	if err != nil {
+		t.Fatalf("error decoding load: %v", err)
+	}
+	if open.IPAddress != "192.0.2.1" || open.Message.ID != 1 || !open.Time.Equal(time.Unix(1477945177, 0)) {
+		t.Fatalf("unexpected load: %+v", open)
+	}
+}